@@ -0,0 +1,189 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync/atomic"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// anomalyDetection, when set to true, enables the checks for non-finite
+// values (NaN or ±Inf) in the forward and backward passes.
+var anomalyDetection atomic.Bool
+
+// SetAnomalyDetection enables or disables the anomaly detection mode.
+//
+// When enabled, every operator records the call stack of its creation, the
+// value of each operator is checked right after the forward pass, and every
+// gradient is checked during the backward pass. The first non-finite value
+// (NaN or ±Inf) is reported as an *AnomalyError: a non-finite value found in
+// the forward pass is recorded on the result and passed on to the results
+// depending on it, so that Err and Backward return it, while Backward stops
+// at the first non-finite gradient and returns it.
+//
+// In anomaly detection mode the operators run synchronously, regardless of the
+// "async" flag in the Run() function, so that the first anomaly is always
+// reported from the goroutine that built the graph.
+// Since it considerably slows down the execution, this mode is only meant
+// for debugging.
+func SetAnomalyDetection(enable bool) {
+	anomalyDetection.Store(enable)
+}
+
+// Err returns the first anomaly found in the forward pass of the given
+// tensors, or of the tensors they depend on, while the anomaly detection mode
+// is enabled (see SetAnomalyDetection). It returns nil if there is none.
+func Err(xs ...mat.Tensor) error {
+	for _, x := range xs {
+		if err := forwardAnomaly(x); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// forwardAnomaly returns the anomaly recorded for the tensor in the forward
+// pass, if any.
+func forwardAnomaly(x mat.Tensor) error {
+	switch v := x.(type) {
+	case *Operator:
+		v.Value() // wait for the forward pass, if still running
+		return v.anomaly
+	case *boundMatrix:
+		return v.anomaly
+	default:
+		return nil
+	}
+}
+
+// checkForward returns the anomaly of the first operand which has one, or
+// a new AnomalyError if the value computed by the operator is not finite.
+func checkForward(o *Operator, value mat.Tensor) error {
+	for _, operand := range o.Operands() {
+		if err := forwardAnomaly(operand); err != nil {
+			return err
+		}
+	}
+	if !isFinite(value) {
+		return newAnomalyError(o, "forward", value.Shape())
+	}
+	return nil
+}
+
+// AnomalyError is the error reported when a non-finite value is found while
+// the anomaly detection mode is enabled.
+type AnomalyError struct {
+	// Phase is either "forward" or "backward".
+	Phase string
+	// Function is the type name of the AutoGradFunction involved.
+	Function string
+	// OperandShapes are the shapes of the function's operands.
+	OperandShapes [][]int
+	// Shape is the shape of the non-finite value or gradient.
+	Shape []int
+	// Stack is the call stack captured when the operator was created.
+	// It is empty if the operator was created while anomaly detection
+	// was disabled.
+	Stack []runtime.Frame
+}
+
+// Error returns a description of the anomaly including the operator's
+// creation stack.
+func (e *AnomalyError) Error() string {
+	var sb strings.Builder
+	switch e.Phase {
+	case "forward":
+		fmt.Fprintf(&sb, "ag: non-finite value %v produced by %s", e.Shape, e.Function)
+	default:
+		fmt.Fprintf(&sb, "ag: non-finite gradient %v w.r.t. the output of %s", e.Shape, e.Function)
+	}
+	fmt.Fprintf(&sb, " with operands %v", e.OperandShapes)
+	if len(e.Stack) == 0 {
+		sb.WriteString(" (creation stack not available)")
+		return sb.String()
+	}
+	sb.WriteString("; operator created at:")
+	for _, frame := range e.Stack {
+		fmt.Fprintf(&sb, "\n\t%s\n\t\t%s:%d", frame.Function, frame.File, frame.Line)
+	}
+	return sb.String()
+}
+
+// newAnomalyError returns a new AnomalyError for the given operator.
+func newAnomalyError(o *Operator, phase string, shape []int) *AnomalyError {
+	operands := o.Operands()
+	shapes := make([][]int, len(operands))
+	for i, operand := range operands {
+		shapes[i] = operand.Shape()
+	}
+	return &AnomalyError{
+		Phase:         phase,
+		Function:      reflect.TypeOf(o.fn).String(),
+		OperandShapes: shapes,
+		Shape:         shape,
+		Stack:         callersFrames(o.stack),
+	}
+}
+
+// newLeafAnomalyError returns a new AnomalyError for a non-finite gradient
+// accumulated into a leaf tensor, reporting the operator that consumed it.
+func newLeafAnomalyError(consumer *Operator, leaf mat.Tensor) *AnomalyError {
+	err := newAnomalyError(consumer, "backward", leaf.Shape())
+	err.Function = fmt.Sprintf("the leaf %T, operand of %s", leaf, err.Function)
+	return err
+}
+
+// captureStack returns the program counters of the caller of NewOperator.
+func captureStack() []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// callersFrames resolves the program counters into stack frames, skipping
+// the outermost frames of the ag package itself (e.g. ag.Add).
+func callersFrames(pcs []uintptr) []runtime.Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	out := make([]runtime.Frame, 0, len(pcs))
+	for {
+		frame, more := frames.Next()
+		if len(out) > 0 || !isAgFrame(frame) {
+			out = append(out, frame)
+		}
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// isAgFrame reports whether the frame belongs to the (non-test) sources of
+// the ag package.
+func isAgFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, "github.com/nlpodyssey/spago/ag.") &&
+		!strings.HasSuffix(frame.File, "_test.go")
+}
+
+// isFinite reports whether all the values of the tensor are finite.
+func isFinite(t mat.Tensor) bool {
+	if isNil(t) {
+		return true
+	}
+	for _, v := range t.Data().F64() {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnomalyDetection(t *testing.T) {
+	t.Run("float32", testAnomalyDetection[float32])
+	t.Run("float64", testAnomalyDetection[float64])
+}
+
+func testAnomalyDetection[T float.DType](t *testing.T) {
+	SetAnomalyDetection(true)
+	defer SetAnomalyDetection(false)
+
+	t.Run("non-finite forward value", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, -1}), mat.WithGrad(true))
+		y := ReduceSum(Exp(Log(Add(x, x)))).(*Operator)
+
+		err := Err(y)
+		var anomaly *AnomalyError
+		require.ErrorAs(t, err, &anomaly)
+		assert.Equal(t, "forward", anomaly.Phase)
+		assert.Contains(t, anomaly.Function, "gradfn.Log", "the first anomaly must be reported")
+		assert.Equal(t, [][]int{{2, 1}}, anomaly.OperandShapes)
+		assert.NotEmpty(t, anomaly.Stack)
+		assert.Contains(t, anomaly.Error(), "anomaly_test.go")
+
+		assert.Same(t, err, Backward(y))
+		assert.Nil(t, x.Grad())
+		assert.True(t, y.isBackwardIdle())
+		assert.NoError(t, Err(x, Add(x, x)))
+	})
+
+	t.Run("non-finite forward value without gradients", func(t *testing.T) {
+		e := NewEngine(WithNoGrad(true))
+		x := e.Bind(mat.NewDense[T](mat.WithBacking([]T{1, -1})))
+		y := ReduceSum(Log(x))
+
+		var anomaly *AnomalyError
+		require.ErrorAs(t, Err(y), &anomaly)
+		assert.Equal(t, "forward", anomaly.Phase)
+		assert.Contains(t, anomaly.Function, "gradfn.Log")
+	})
+
+	t.Run("non-finite gradient of an operator", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{0, 1}), mat.WithGrad(true))
+		y := ReduceSum(Sqrt(Prod(x, x)))
+
+		err := Backward(y)
+		require.Error(t, err)
+		var anomaly *AnomalyError
+		require.ErrorAs(t, err, &anomaly)
+		assert.Equal(t, "backward", anomaly.Phase)
+		assert.Contains(t, anomaly.Function, "gradfn.Prod")
+		assert.Equal(t, [][]int{{2, 1}, {2, 1}}, anomaly.OperandShapes)
+		assert.NotEmpty(t, anomaly.Stack)
+	})
+
+	t.Run("non-finite gradient of a leaf", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{0, 1}), mat.WithGrad(true))
+		y := ReduceSum(Sqrt(x))
+
+		err := Backward(y)
+		var anomaly *AnomalyError
+		require.ErrorAs(t, err, &anomaly)
+		assert.Equal(t, "backward", anomaly.Phase)
+		assert.Contains(t, anomaly.Function, "gradfn.Sqrt")
+	})
+
+	t.Run("finite values", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		y := ReduceSum(Sqrt(Prod(x, x)))
+
+		require.NoError(t, Backward(y))
+		assert.InDeltaSlice(t, []float64{1, 1}, x.Grad().Data().F64(), 1e-6)
+	})
+}
+
+func TestAnomalyDetection_Disabled(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithBacking([]float64{0, 1}), mat.WithGrad(true))
+	assert.False(t, isFinite(Log(x).Value()))
+
+	y := ReduceSum(Sqrt(x))
+	assert.NoError(t, Backward(y))
+	assert.False(t, isFinite(x.Grad()))
+}
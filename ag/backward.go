@@ -5,7 +5,9 @@
 package ag
 
 import (
+	"fmt"
 	"sync"
+	"sync/atomic"
 
 	"github.com/nlpodyssey/spago/mat"
 )
@@ -20,13 +22,161 @@ import (
 //
 // During the back-propagation process, the gradients of all tensors, except for the given tensors, are summed to the existing gradients.
 // Unless you intend to do so, ensure that all tensors have zero gradients.
+//
+// The graph is left as it is, including the gradients of the operators, which
+// can be inspected with Operator.Grad. For this reason, Backward must not be
+// called more than once over the same (or an overlapping) graph: use
+// BackwardWith and the RetainGraph option instead.
+//
+// If the backward function of an operator fails, or a non-finite gradient is
+// found in anomaly detection mode (see SetAnomalyDetection), the pass is
+// stopped and the first error is returned. In anomaly detection mode, the
+// first non-finite value found in the forward pass of the tensors (see Err)
+// is returned without starting the pass.
 func Backward(xs ...mat.Tensor) error {
-	ops := filterOperators(xs)
-	if len(ops) == 0 {
+	_, err := backward(filterOperators(xs))
+	return err
+}
+
+// BackwardOption allows to configure BackwardWith.
+type BackwardOption func(*backwardOptions)
+
+type backwardOptions struct {
+	retainGraph bool
+	weights     []float64
+}
+
+func newBackwardOptions(opts []BackwardOption) backwardOptions {
+	var options backwardOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// RetainGraph keeps the graph after the backward pass, so that
+// back-propagation can be performed again over the same graph, or over
+// another graph sharing part of it (e.g. when training with multiple losses).
+//
+// The gradients of the operators are cleared at the end of the pass, while
+// the gradients of the leaves (e.g. the parameters) keep being accumulated.
+func RetainGraph() BackwardOption {
+	return func(o *backwardOptions) {
+		o.retainGraph = true
+	}
+}
+
+// Weights scales the gradients of the outputs of BackwardWithGrads by the
+// given weights, one for each output, e.g. to weight several losses
+// sharing part of the graph without summing them into a single node.
+// BackwardWith returns an error if it is given this option.
+func Weights(weights ...float64) BackwardOption {
+	return func(o *backwardOptions) {
+		o.weights = weights
+	}
+}
+
+// BackwardWith initiates back-propagation from the input tensors, like
+// Backward.
+//
+// Unless the RetainGraph option is given, the graph is released at the end of
+// the pass (see ReleaseGraph). The Weights option is not supported: use
+// BackwardWithGrads to weight the outputs.
+func BackwardWith(xs []mat.Tensor, opts ...BackwardOption) error {
+	options := newBackwardOptions(opts)
+	if options.weights != nil {
+		return fmt.Errorf("ag: the Weights option is only supported by BackwardWithGrads")
+	}
+	return backwardWith(filterOperators(xs), options)
+}
+
+// BackwardWithGrads initiates back-propagation from the given outputs,
+// seeding each of them with the corresponding gradients, which must have the
+// same shape as the output. A nil gradient is only allowed for a scalar
+// output, which is seeded with 1. If the Weights option is given, each
+// gradient is scaled by the corresponding weight.
+//
+// The gradients are accumulated to the ones the outputs may already have.
+// Outputs which are not operators are ignored.
+//
+// Unless the RetainGraph option is given, the graph is released at the end of
+// the pass (see ReleaseGraph).
+func BackwardWithGrads(outputs, grads []mat.Tensor, opts ...BackwardOption) error {
+	options := newBackwardOptions(opts)
+	if len(grads) != len(outputs) {
+		return fmt.Errorf("ag: %d gradients given for %d outputs", len(grads), len(outputs))
+	}
+	if options.weights != nil && len(options.weights) != len(outputs) {
+		return fmt.Errorf("ag: %d weights given for %d outputs", len(options.weights), len(outputs))
+	}
+
+	seeds := make([]mat.Tensor, len(outputs))
+	for i, y := range outputs {
+		seed, err := outputGradient(y, grads[i])
+		if err != nil {
+			return fmt.Errorf("ag: output %d: %w", i, err)
+		}
+		if options.weights != nil {
+			seed = seed.(mat.Matrix).ProdScalar(options.weights[i])
+		}
+		seeds[i] = seed
+	}
+
+	ops := make([]*Operator, 0, len(outputs))
+	for i, y := range outputs {
+		if op, ok := y.(*Operator); ok {
+			op.AccGrad(seeds[i])
+			ops = append(ops, op)
+		}
+	}
+	return backwardWith(ops, options)
+}
+
+// outputGradient validates the gradient of the output y, returning 1 for a
+// nil gradient of a scalar output.
+func outputGradient(y, grad mat.Tensor) (mat.Tensor, error) {
+	value := y.Value()
+	if isNil(grad) {
+		if value.Size() != 1 {
+			return nil, fmt.Errorf("missing gradient for the non-scalar output of shape %v", value.Shape())
+		}
+		return value.(mat.Matrix).NewScalar(1), nil
+	}
+	if !mat.SameDims(value, grad) {
+		return nil, fmt.Errorf("gradient of shape %v does not match the output shape %v", grad.Shape(), value.Shape())
+	}
+	return grad, nil
+}
+
+func backwardWith(ops []*Operator, options backwardOptions) error {
+	nodes, err := backward(ops)
+	if err != nil {
+		return err
+	}
+
+	if !options.retainGraph {
+		releaseGraph(ops)
 		return nil
 	}
+	for _, op := range nodes {
+		op.Value().ZeroGrad()
+	}
+	return nil
+}
+
+// backward performs the backward pass from the given operators, and returns
+// the operators that took part in it.
+func backward(ops []*Operator) ([]*Operator, error) {
+	if len(ops) == 0 {
+		return nil, nil
+	}
+	for _, op := range ops {
+		if err := forwardAnomaly(op); err != nil {
+			return nil, err
+		}
+	}
 
-	// The three for loops below are intentionally executed in sequence.
+	// The four steps below are intentionally executed in sequence.
 	// These steps must occur in this order, so the loops cannot be combined due to their sequential dependencies.
 
 	// 1. Prepare the backward pass for each operator.
@@ -34,20 +184,191 @@ func Backward(xs ...mat.Tensor) error {
 		op.prepareBackwardPass()
 	}
 
-	// 2. Assign the output gradients for each operator.
+	// 2. Collect the operators taking part in the backward pass.
+	bp := newBackwardPass(ops[0].engine)
 	for _, op := range ops {
+		op.processBackwardPass(bp)
+	}
+
+	if bp.released {
+		bp.reset()
+		return nil, errReleasedGraph
+	}
+
+	// 3. Assign the output gradients for each operator.
+	for _, op := range ops {
+		if op.isBackwardIdle() {
+			continue // no gradients required
+		}
 		if err := op.assignOutputGradient(); err != nil {
-			return err
+			bp.reset()
+			return nil, err
 		}
 	}
 
-	// 3. Process the backward pass for each operator in parallel using wait groups.
-	wg := &sync.WaitGroup{}
-	for _, op := range ops {
-		op.processBackwardPass(wg)
+	// 4. Process the backward pass for each operator in parallel, scheduling each of them
+	// on the worker pool as soon as its gradients have been completely accumulated.
+	bp.run()
+
+	if bp.err != nil {
+		return nil, bp.err
+	}
+	if anomalyDetection.Load() {
+		if err := checkLeafGradients(ops); err != nil {
+			return nil, err
+		}
+	}
+	return bp.nodes, nil
+}
+
+// backwardPass holds the shared state of a single backward pass.
+type backwardPass struct {
+	// inline reports whether the operators are executed sequentially on the
+	// goroutine calling Backward, instead of on the worker pool (e.g. in
+	// deterministic mode).
+	inline bool
+	// stack holds the operators scheduled for inline execution.
+	stack []*Operator
+	// nodes are the operators taking part in the pass.
+	nodes []*Operator
+	// released reports whether the pass reaches an operator released by
+	// an earlier pass (see ReleaseGraph).
+	released bool
+	// remaining is the number of nodes not yet executed.
+	remaining atomic.Int64
+	// wg tracks the scheduled operators still executing.
+	wg sync.WaitGroup
+	// done is closed when all the nodes have been executed.
+	done chan struct{}
+	// abort is closed as soon as the first error occurs.
+	abort    chan struct{}
+	failOnce sync.Once
+	// err is the first error occurred during the pass.
+	err error
+}
+
+func newBackwardPass(e *Engine) *backwardPass {
+	return &backwardPass{
+		inline: e.SyncExecution() || e.Deterministic() || anomalyDetection.Load(),
+		done:   make(chan struct{}),
+		abort:  make(chan struct{}),
+	}
+}
+
+// run executes the backward function of all the nodes, and waits for them
+// to complete. The nodes must have been already collected.
+func (bp *backwardPass) run() {
+	if len(bp.nodes) == 0 {
+		return
+	}
+	bp.remaining.Store(int64(len(bp.nodes)))
+	for _, op := range bp.nodes {
+		if atomic.LoadInt64(&op.pendingGrads) == 0 {
+			bp.schedule(op, nil)
+		}
+	}
+
+	if bp.inline {
+		for len(bp.stack) > 0 && !bp.aborted() {
+			last := len(bp.stack) - 1
+			op := bp.stack[last]
+			bp.stack = bp.stack[:last]
+			op.executeBackward(bp, nil)
+		}
+	} else {
+		select {
+		case <-bp.done:
+		case <-bp.abort:
+		}
+		bp.wg.Wait()
+	}
+
+	if bp.aborted() {
+		bp.reset()
+	}
+}
+
+// reset sets the nodes back to the idle state.
+func (bp *backwardPass) reset() {
+	for _, op := range bp.nodes {
+		atomic.StoreInt64(&op.pendingGrads, 0)
+		op.setBackwardIdle()
+	}
+}
+
+// schedule submits the execution of the backward function of the operator,
+// if its gradients have been completely accumulated and it has not been
+// scheduled yet.
+func (bp *backwardPass) schedule(op *Operator, w *worker) {
+	if bp.aborted() || !op.trySetBackwardScheduled() {
+		return
+	}
+	if bp.inline {
+		bp.stack = append(bp.stack, op)
+		return
+	}
+	bp.wg.Add(1) // decrement when the backward function is done
+	op.engine.workers().submit(task{op: op, bp: bp}, w)
+}
+
+// taskDone is called when the backward function of a node has been
+// executed.
+func (bp *backwardPass) taskDone() {
+	if !bp.inline {
+		defer bp.wg.Done()
+	}
+	if bp.remaining.Add(-1) == 0 {
+		close(bp.done)
+	}
+}
+
+// aborted reports whether the pass has been aborted.
+func (bp *backwardPass) aborted() bool {
+	select {
+	case <-bp.abort:
+		return true
+	default:
+		return false
 	}
-	wg.Wait()
+}
 
+// fail records the error and aborts the pass, unless another error has
+// already been recorded.
+func (bp *backwardPass) fail(err error) {
+	bp.failOnce.Do(func() {
+		bp.err = err
+		close(bp.abort)
+	})
+}
+
+// checkLeafGradients visits the graph of the given operators and returns an
+// AnomalyError for the first leaf tensor holding non-finite gradients.
+func checkLeafGradients(ops []*Operator) error {
+	visited := make(map[*Operator]struct{})
+	var visit func(op *Operator) error
+	visit = func(op *Operator) error {
+		if _, ok := visited[op]; ok {
+			return nil
+		}
+		visited[op] = struct{}{}
+		for _, operand := range op.Operands() {
+			if oo, ok := operand.(*Operator); ok {
+				if err := visit(oo); err != nil {
+					return err
+				}
+				continue
+			}
+			if operand.RequiresGrad() && !isFinite(operand.Grad()) {
+				return newLeafAnomalyError(op, operand)
+			}
+		}
+		return nil
+	}
+	for _, op := range ops {
+		if err := visit(op); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
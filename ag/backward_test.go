@@ -0,0 +1,74 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackwardWithGrads(t *testing.T) {
+	t.Run("float32", testBackwardWithGrads[float32])
+	t.Run("float64", testBackwardWithGrads[float64])
+}
+
+func testBackwardWithGrads[T float.DType](t *testing.T) {
+	t.Run("non-scalar outputs", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		y1 := Prod(x, x)
+		y2 := ProdScalar(x, mat.Scalar[T](3))
+
+		err := BackwardWithGrads(
+			[]mat.Tensor{y1, y2},
+			[]mat.Tensor{
+				mat.NewDense[T](mat.WithBacking([]T{1, 0.5})),
+				mat.NewDense[T](mat.WithBacking([]T{1, 1})),
+			},
+		)
+		require.NoError(t, err)
+		// 2x * [1, 0.5] + 3
+		assert.Equal(t, []T{5, 5}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("weighted losses sharing a subgraph", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		h := Prod(x, x)
+		loss1 := ReduceSum(h)
+		loss2 := ReduceSum(ProdScalar(h, mat.Scalar[T](3)))
+
+		err := BackwardWithGrads([]mat.Tensor{loss1, loss2}, []mat.Tensor{nil, nil}, Weights(0.5, 2))
+		require.NoError(t, err)
+		// (0.5 + 2*3) * 2x
+		assert.Equal(t, []T{13, 26}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("retain graph", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		y := Prod(x, x)
+		g := mat.NewDense[T](mat.WithBacking([]T{1, 1}))
+
+		require.NoError(t, BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{g}, RetainGraph()))
+		require.NoError(t, BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{g}, RetainGraph()))
+		assert.Equal(t, []T{4, 8}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		y := Prod(x, x)
+
+		assert.Error(t, BackwardWithGrads([]mat.Tensor{y}, nil))
+		assert.Error(t, BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{nil}))
+		assert.Error(t, BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{mat.NewDense[T](mat.WithBacking([]T{1, 2, 3}))}))
+		assert.Error(t, BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{mat.NewDense[T](mat.WithBacking([]T{1, 1}))}, Weights(1, 2)))
+		assert.Error(t, BackwardWith([]mat.Tensor{ReduceSum(y)}, Weights(2)))
+
+		assert.Nil(t, x.Grad())
+		assert.True(t, y.(*Operator).isBackwardIdle())
+	})
+}
@@ -0,0 +1,291 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/gradfn"
+	"github.com/nlpodyssey/spago/mat/rand"
+)
+
+// Engine is the execution environment of the operators: it holds its own
+// pool of workers, synchronous/asynchronous execution policy and random
+// number generator.
+//
+// Async operators (see Operator.Run) and backward passes are executed by a
+// fixed-size pool of work-stealing workers: an operator is scheduled as soon
+// as all its operands are ready, instead of blocking a goroutine while
+// waiting for them.
+//
+// Each operator runs on the engine it is bound to. New operators inherit the
+// engine of their operands (the first one bound to an engine), or use the
+// default engine (see DefaultEngine) when none of them is bound. Use
+// Engine.Bind to start a new graph on a specific engine, so that several
+// independent graphs (e.g. of different tenants) can run isolated in the
+// same process.
+type Engine struct {
+	// concurrency is the number of workers of the pool.
+	concurrency int
+	// poolOnce is used to initialize the pool only once.
+	poolOnce sync.Once
+	// pool executes async forward operations and backward passes.
+	pool *workerPool
+	// syncExecution, when set to true, forces operators to run synchronously,
+	// overriding any "async" flag in the Run() function.
+	syncExecution atomic.Bool
+	// rand is the random number generator used by the operators.
+	rand *rand.LockedRand
+	// seed is the seed of the random streams of the operators, in
+	// deterministic mode.
+	seed atomic.Uint64
+	// graph assigns the random streams of the operators not bound to any
+	// other graph (see BindStream).
+	graph streamGraph
+	// deterministic reports whether the engine runs in deterministic mode.
+	deterministic atomic.Bool
+	// noGrad reports whether the functions are executed eagerly, without
+	// building the graph.
+	noGrad bool
+}
+
+// EngineOption allows to configure a new Engine.
+type EngineOption func(e *Engine)
+
+// WithConcurrency sets the number of workers executing the async forward
+// operations and the backward passes. It panics if n is not positive.
+//
+// The default is runtime.NumCPU().
+func WithConcurrency(n int) EngineOption {
+	if n <= 0 {
+		panic(fmt.Sprintf("ag: invalid concurrency %d", n))
+	}
+	return func(e *Engine) {
+		e.concurrency = n
+	}
+}
+
+// WithSyncExecution sets whether the operators must run synchronously,
+// regardless of the "async" flag in the Run() function (default false).
+func WithSyncExecution(enable bool) EngineOption {
+	return func(e *Engine) {
+		e.syncExecution.Store(enable)
+	}
+}
+
+// WithRand sets the random number generator of the engine.
+func WithRand(r *rand.LockedRand) EngineOption {
+	return func(e *Engine) {
+		e.rand = r
+	}
+}
+
+// WithSeed sets a new random number generator initialized with the given
+// seed, which is also the seed of the random streams of the operators in
+// deterministic mode.
+func WithSeed(seed uint64) EngineOption {
+	return func(e *Engine) {
+		e.rand = rand.NewLockedRand(seed)
+		e.seed.Store(seed)
+	}
+}
+
+// WithDeterministic sets whether the engine runs in deterministic mode
+// (default false). See Engine.SetDeterministic.
+func WithDeterministic(enable bool) EngineOption {
+	return func(e *Engine) {
+		e.deterministic.Store(enable)
+	}
+}
+
+// WithNoGrad sets whether the engine runs in no-grad inference mode
+// (default false).
+//
+// On a no-grad engine the ag functions compute their values eagerly and
+// return plain mat.Matrix results, without creating operators: the results
+// hold no references to their operands, so that they can be garbage
+// collected as soon as they are no longer used, and gradients are never
+// accumulated. Since the parameters of a model are only read, and never
+// marked as requiring gradients, the Forward method of a model can be
+// called concurrently on a no-grad engine.
+//
+// Use Engine.Bind on the input of a model to execute it on a no-grad engine,
+// or carry the engine with a context.Context (see ContextWithEngine).
+func WithNoGrad(enable bool) EngineOption {
+	return func(e *Engine) {
+		e.noGrad = enable
+	}
+}
+
+// NewEngine returns a new Engine.
+func NewEngine(opts ...EngineOption) *Engine {
+	e := &Engine{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.concurrency == 0 {
+		e.concurrency = runtime.NumCPU()
+	}
+	if e.rand == nil {
+		e.rand = rand.NewLockedRand(defaultSeed)
+		e.seed.Store(defaultSeed)
+	}
+	return e
+}
+
+// defaultSeed is the seed of the random number generator of a new Engine.
+const defaultSeed = 12345
+
+// defaultEngine is used by the operators not bound to any engine.
+var defaultEngine = NewEngine()
+
+// DefaultEngine returns the engine used by the operators whose operands are
+// not bound to any engine.
+func DefaultEngine() *Engine {
+	return defaultEngine
+}
+
+// Concurrency returns the number of workers executing the async forward
+// operations and the backward passes.
+func (e *Engine) Concurrency() int {
+	return e.concurrency
+}
+
+// Close releases the idle workers of the engine.
+// The engine can still be used afterwards: new workers are started on
+// demand, and exit as soon as they run out of work.
+func (e *Engine) Close() {
+	e.workers().close()
+}
+
+// workers returns the pool of the engine, initializing it on first use.
+func (e *Engine) workers() *workerPool {
+	e.poolOnce.Do(func() {
+		e.pool = newWorkerPool(e.concurrency)
+	})
+	return e.pool
+}
+
+// SetSyncExecution enables or disables the forcing of synchronous execution
+// for all operators of the engine.
+// When enabled, the operators will run synchronously, regardless of the
+// "async" flag in the Run() function.
+// This setting can be particularly useful for debugging.
+func (e *Engine) SetSyncExecution(enable bool) {
+	e.syncExecution.Store(enable)
+}
+
+// SyncExecution reports whether the operators are forced to run
+// synchronously.
+func (e *Engine) SyncExecution() bool {
+	return e.syncExecution.Load()
+}
+
+// NoGrad reports whether the engine runs in no-grad inference mode.
+func (e *Engine) NoGrad() bool {
+	return e.noGrad
+}
+
+// Rand returns the random number generator of the engine.
+func (e *Engine) Rand() *rand.LockedRand {
+	return e.rand
+}
+
+// Seed sets the seed of the random number generator of the engine, and of
+// the random streams of the operators in deterministic mode, restarting the
+// assignment of the streams to the operators not bound to any graph (see
+// BindStream).
+func (e *Engine) Seed(seed uint64) {
+	e.rand.Seed(seed)
+	e.seed.Store(seed)
+	e.graph.n.Store(0)
+}
+
+// SetDeterministic enables or disables the deterministic mode, making the
+// results bit-for-bit reproducible regardless of goroutine scheduling:
+//
+//   - each random operator (e.g. Dropout) draws from its own stream of a
+//     counter-based Philox generator, keyed by its position in the graph
+//     (see Stream), instead of sharing the generator of the engine in the
+//     nondeterministic order of execution;
+//   - the backward passes are executed sequentially, so that gradients are
+//     accumulated in a fixed order.
+//
+// Async forward operations are still executed concurrently.
+func (e *Engine) SetDeterministic(enable bool) {
+	e.deterministic.Store(enable)
+}
+
+// Deterministic reports whether the engine runs in deterministic mode.
+func (e *Engine) Deterministic() bool {
+	return e.deterministic.Load()
+}
+
+// NewOperator creates a new operator with the given AutoGradFunction,
+// explicitly bound to the engine.
+func (e *Engine) NewOperator(f AutoGradFunction) *Operator {
+	o := newOperator(f)
+	o.engine = e
+	o.graph = graphOf(o.Operands())
+	return o
+}
+
+// Bind returns a new operator bound to the engine, whose value is a copy of
+// the value of x. Gradients accumulated into the operator are propagated to
+// x as they are.
+// On a no-grad engine, it returns the value of x bound to the engine,
+// without copying it.
+//
+// It is typically used on the input of a model, so that all the operators
+// of the resulting graph run on the engine.
+func (e *Engine) Bind(x mat.Tensor) mat.Tensor {
+	if b, ok := x.(engineBound); ok && b.Engine() == e {
+		return x
+	}
+	if e.noGrad {
+		return &boundMatrix{Matrix: x.Value().(mat.Matrix), engine: e}
+	}
+	return e.NewOperator(gradfn.NewCopy(x)).Run()
+}
+
+// engineBound is implemented by the tensors bound to an engine.
+type engineBound interface {
+	Engine() *Engine
+}
+
+// engineOf returns the engine of the first operand bound to an engine, or
+// the default engine.
+func engineOf(operands []mat.Tensor) *Engine {
+	for _, operand := range operands {
+		if b, ok := operand.(engineBound); ok {
+			if e := b.Engine(); e != nil {
+				return e
+			}
+		}
+	}
+	return defaultEngine
+}
+
+// engineContextKey is the key for the Engine stored in a context.Context.
+type engineContextKey struct{}
+
+// ContextWithEngine returns a copy of the context carrying the given engine.
+func ContextWithEngine(ctx context.Context, e *Engine) context.Context {
+	return context.WithValue(ctx, engineContextKey{}, e)
+}
+
+// EngineFromContext returns the engine carried by the context, or the
+// default engine if none is set.
+func EngineFromContext(ctx context.Context) *Engine {
+	if e, ok := ctx.Value(engineContextKey{}).(*Engine); ok && e != nil {
+		return e
+	}
+	return defaultEngine
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"context"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewEngine(t *testing.T) {
+	e := NewEngine(WithConcurrency(3), WithSyncExecution(true), WithSeed(42))
+	assert.Equal(t, 3, e.Concurrency())
+	assert.True(t, e.SyncExecution())
+	require.NotNil(t, e.Rand())
+	assert.NotSame(t, DefaultEngine(), e)
+
+	e.SetSyncExecution(false)
+	assert.False(t, e.SyncExecution())
+
+	assert.Panics(t, func() { WithConcurrency(0) })
+}
+
+func TestEngine_Bind(t *testing.T) {
+	t.Run("float32", testEngineBind[float32])
+	t.Run("float64", testEngineBind[float64])
+}
+
+func testEngineBind[T float.DType](t *testing.T) {
+	e := NewEngine()
+	x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+	w := mat.NewDense[T](mat.WithBacking([]T{3, 4}), mat.WithGrad(true))
+
+	bx := e.Bind(x)
+	assert.Same(t, bx, e.Bind(bx))
+	assert.Same(t, e, bx.(*Operator).Engine())
+
+	y := ReduceSum(Prod(Add(bx, w), w))
+	assert.Same(t, e, y.(*Operator).Engine())
+
+	z := ReduceSum(Prod(x, w))
+	assert.Same(t, DefaultEngine(), z.(*Operator).Engine())
+
+	require.NoError(t, Backward(y))
+	assert.Equal(t, []T{3, 4}, mat.Data[T](x.Grad()))
+	assert.Equal(t, []T{7, 10}, mat.Data[T](w.Grad()))
+}
+
+func TestEngine_SyncExecution(t *testing.T) {
+	e := NewEngine(WithSyncExecution(true))
+	x := e.Bind(mat.NewDense[float64](mat.WithBacking([]float64{1, 2})))
+	op := Add(x, x).(*Operator)
+	assert.Nil(t, op.broadcast, "the operator must have run synchronously")
+
+	op = Add(mat.NewDense[float64](mat.WithBacking([]float64{1, 2})), x).(*Operator)
+	assert.Nil(t, op.broadcast, "the engine must be inherited from any operand")
+}
+
+func TestEngine_Rand(t *testing.T) {
+	dropout := func(e *Engine) []float64 {
+		x := e.Bind(mat.NewDense[float64](mat.WithShape(50, 1)).OnesLike())
+		return Dropout(x, 0.5).Value().Data().F64()
+	}
+	a := dropout(NewEngine(WithSeed(7)))
+	b := dropout(NewEngine(WithSeed(7)))
+	c := dropout(NewEngine(WithSeed(8)))
+	assert.Equal(t, a, b)
+	assert.NotEqual(t, a, c)
+}
+
+func TestEngineFromContext(t *testing.T) {
+	assert.Same(t, DefaultEngine(), EngineFromContext(context.Background()))
+
+	e := NewEngine()
+	ctx := ContextWithEngine(context.Background(), e)
+	assert.Same(t, e, EngineFromContext(ctx))
+}
@@ -0,0 +1,168 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// ForwardFunc computes the value of a Function from the values of its
+// operands. It can either use the methods of mat.Matrix or the ag functions,
+// which are executed eagerly on the given values, without building a graph.
+type ForwardFunc func(ctx *FuncContext, xs []mat.Matrix) (mat.Tensor, error)
+
+// BackwardFunc computes the gradients of the operands of a Function, given
+// the gradients of its output. It must return one gradient for each operand,
+// in the same order; a nil gradient is not propagated.
+type BackwardFunc func(ctx *FuncContext, gy mat.Matrix) ([]mat.Matrix, error)
+
+// FuncContext is shared by the forward and the backward closures of a
+// Function, to save the tensors computed in the forward pass which are
+// needed by the backward pass.
+type FuncContext struct {
+	saved []mat.Matrix
+}
+
+// SaveForBackward saves the given tensors, for the backward pass.
+func (c *FuncContext) SaveForBackward(ms ...mat.Matrix) {
+	c.saved = append(c.saved, ms...)
+}
+
+// Saved returns the tensors saved by SaveForBackward, in the same order.
+func (c *FuncContext) Saved() []mat.Matrix {
+	return c.saved
+}
+
+var _ AutoGradFunction = &Function{}
+
+// Function is an AutoGradFunction defined by Go closures, so that custom
+// differentiable operations can be defined inline, with no need to write a
+// gradfn type.
+//
+// If the backward closure is nil, the backward pass is derived automatically:
+// the forward closure, which must be written with the ag functions, is run
+// again on copies of the operands, and the gradients are back-propagated
+// through the resulting graph.
+type Function struct {
+	forward  ForwardFunc
+	backward BackwardFunc
+	operands []mat.Tensor
+	ctx      FuncContext
+}
+
+// NewFunction returns a new Function with the given closures and operands.
+// The backward closure can be nil, to derive the backward pass automatically.
+//
+// Use NewOperator(NewFunction(...)).Run() to run it, or just Func.
+func NewFunction(forward ForwardFunc, backward BackwardFunc, operands ...mat.Tensor) *Function {
+	if forward == nil {
+		panic("ag: the forward function of a Function cannot be nil")
+	}
+	return &Function{
+		forward:  forward,
+		backward: backward,
+		operands: operands,
+	}
+}
+
+// Func returns a new operator node as a result of the Function defined by the
+// given closures and operands (see NewFunction).
+func Func(forward ForwardFunc, backward BackwardFunc, operands ...mat.Tensor) mat.Tensor {
+	return apply(NewFunction(forward, backward, operands...), false)
+}
+
+// funcEngine executes the ag functions called by the forward closures.
+var funcEngine = NewEngine(WithNoGrad(true), WithRand(defaultEngine.rand))
+
+// derivationEngine executes the graphs built to derive the backward pass
+// automatically. It runs synchronously, since the backward pass of a
+// Function may already be executed by a worker of a pool.
+var derivationEngine = NewEngine(WithSyncExecution(true), WithRand(defaultEngine.rand))
+
+// Operands returns the list of operands.
+func (f *Function) Operands() []mat.Tensor {
+	return f.operands
+}
+
+// Forward computes the output of the function.
+func (f *Function) Forward() (mat.Tensor, error) {
+	xs := make([]mat.Matrix, len(f.operands))
+	for i, operand := range f.operands {
+		xs[i] = funcEngine.Bind(operand).(mat.Matrix)
+	}
+	y, err := f.forward(&f.ctx, xs)
+	if err != nil {
+		return nil, err
+	}
+	if isNil(y) {
+		return nil, fmt.Errorf("ag: the forward function returned a nil value")
+	}
+	return y.Value(), nil
+}
+
+// Backward computes the backward pass given the gradient of the output.
+func (f *Function) Backward(gy mat.Tensor) error {
+	var gxs []mat.Matrix
+	var err error
+	if f.backward != nil {
+		gxs, err = f.backward(&f.ctx, gy.(mat.Matrix))
+	} else {
+		gxs, err = f.derivedBackward(gy)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(gxs) != len(f.operands) {
+		return fmt.Errorf("ag: the backward function returned %d gradients for %d operands", len(gxs), len(f.operands))
+	}
+	for i, gx := range gxs {
+		x := f.operands[i]
+		if isNil(gx) || !x.RequiresGrad() {
+			continue
+		}
+		if !mat.SameDims(x.Value(), gx) {
+			return fmt.Errorf("ag: the gradient of shape %v does not match the operand %d of shape %v", gx.Shape(), i, x.Value().Shape())
+		}
+		x.AccGrad(gx)
+	}
+	return nil
+}
+
+// derivedBackward computes the gradients of the operands by back-propagating
+// through the graph of the forward closure, executed on copies of the
+// operands.
+func (f *Function) derivedBackward(gy mat.Tensor) ([]mat.Matrix, error) {
+	leaves := make([]mat.Matrix, len(f.operands))
+	xs := make([]mat.Matrix, len(f.operands))
+	for i, operand := range f.operands {
+		leaf := operand.Value().(mat.Matrix).Clone()
+		leaf.SetRequiresGrad(operand.RequiresGrad())
+		leaves[i] = leaf
+		xs[i] = &boundMatrix{Matrix: leaf, engine: derivationEngine}
+	}
+
+	var ctx FuncContext
+	y, err := f.forward(&ctx, xs)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := y.(*Operator); !ok {
+		return nil, fmt.Errorf("ag: cannot derive the backward pass: the forward function must be written with the ag functions")
+	}
+	if err := BackwardWithGrads([]mat.Tensor{y}, []mat.Tensor{gy}); err != nil {
+		return nil, err
+	}
+
+	gxs := make([]mat.Matrix, len(leaves))
+	for i, leaf := range leaves {
+		if g := leaf.Grad(); !isNil(g) {
+			gxs[i] = g.(mat.Matrix)
+		}
+	}
+	return gxs, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFunc(t *testing.T) {
+	t.Run("float32", testFunc[float32])
+	t.Run("float64", testFunc[float64])
+}
+
+func testFunc[T float.DType](t *testing.T) {
+	t.Run("explicit backward with saved tensors", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2, 3}), mat.WithGrad(true))
+
+		square := func(x mat.Tensor) mat.Tensor {
+			return Func(
+				func(ctx *FuncContext, xs []mat.Matrix) (mat.Tensor, error) {
+					ctx.SaveForBackward(xs[0])
+					return xs[0].Prod(xs[0]), nil
+				},
+				func(ctx *FuncContext, gy mat.Matrix) ([]mat.Matrix, error) {
+					x := ctx.Saved()[0]
+					return []mat.Matrix{x.ProdScalar(2).Prod(gy)}, nil
+				},
+				x,
+			)
+		}
+
+		y := ReduceSum(square(x))
+		assert.Equal(t, []T{14}, mat.Data[T](y.Value()))
+		require.NoError(t, Backward(y))
+		assert.Equal(t, []T{2, 4, 6}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("derived backward", func(t *testing.T) {
+		x1 := mat.NewDense[T](mat.WithBacking([]T{0.1, -0.2, 0.3}), mat.WithGrad(true))
+		x2 := mat.NewDense[T](mat.WithBacking([]T{0.5, 0.4, -0.3}), mat.WithGrad(true))
+		c := mat.NewDense[T](mat.WithBacking([]T{1, 2, 3}))
+
+		forward := func(ctx *FuncContext, xs []mat.Matrix) (mat.Tensor, error) {
+			return Sigmoid(Add(Prod(xs[0], xs[1]), xs[2])), nil
+		}
+		y := ReduceSum(Func(forward, nil, x1, x2, c))
+		require.NoError(t, Backward(y))
+
+		// The same function, directly.
+		x1b := mat.NewDense[T](mat.WithBacking([]T{0.1, -0.2, 0.3}), mat.WithGrad(true))
+		x2b := mat.NewDense[T](mat.WithBacking([]T{0.5, 0.4, -0.3}), mat.WithGrad(true))
+		expected := ReduceSum(Sigmoid(Add(Prod(x1b, x2b), c)))
+		require.NoError(t, Backward(expected))
+
+		assert.InDelta(t, expected.Value().Item().F64(), y.Value().Item().F64(), 1e-6)
+		assert.InDeltaSlice(t, x1b.Grad().Data().F64(), x1.Grad().Data().F64(), 1e-6)
+		assert.InDeltaSlice(t, x2b.Grad().Data().F64(), x2.Grad().Data().F64(), 1e-6)
+		assert.Nil(t, c.Grad())
+	})
+
+	t.Run("no-grad engine", func(t *testing.T) {
+		e := NewEngine(WithNoGrad(true))
+		x := e.Bind(mat.NewDense[T](mat.WithBacking([]T{1, 2})))
+		y := Func(func(_ *FuncContext, xs []mat.Matrix) (mat.Tensor, error) {
+			return Exp(xs[0]), nil
+		}, nil, x)
+		_, isOperator := y.(*Operator)
+		assert.False(t, isOperator)
+		assert.InDeltaSlice(t, []float64{2.718281, 7.389056}, y.Value().Data().F64(), 1e-5)
+	})
+}
+
+func TestFunc_Errors(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithBacking([]float64{1, 2}), mat.WithGrad(true))
+	identity := func(_ *FuncContext, xs []mat.Matrix) (mat.Tensor, error) {
+		return xs[0].Clone(), nil
+	}
+
+	t.Run("wrong number of gradients", func(t *testing.T) {
+		y := Func(identity, func(_ *FuncContext, gy mat.Matrix) ([]mat.Matrix, error) {
+			return []mat.Matrix{gy, gy}, nil
+		}, x)
+		assert.Error(t, Backward(ReduceSum(y)))
+	})
+
+	t.Run("wrong gradient shape", func(t *testing.T) {
+		y := Func(identity, func(_ *FuncContext, gy mat.Matrix) ([]mat.Matrix, error) {
+			return []mat.Matrix{mat.NewDense[float64](mat.WithShape(3))}, nil
+		}, x)
+		assert.Error(t, Backward(ReduceSum(y)))
+	})
+
+	t.Run("backward cannot be derived", func(t *testing.T) {
+		y := Func(identity, nil, x)
+		assert.Error(t, Backward(ReduceSum(y)))
+	})
+
+	assert.Panics(t, func() { NewFunction(nil, nil, x) })
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"sync"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// ForwardHook is a function called with the value of an operator, right after
+// its forward pass.
+type ForwardHook func(op *Operator, value mat.Tensor)
+
+// GradHook is a function called with a gradient before it is used.
+// It can return a new gradient to use in place of the given one (e.g. for
+// scaling or reversal); if it returns nil, the gradient is left unchanged.
+// The given gradient must not be modified in place.
+type GradHook func(grad mat.Tensor) mat.Tensor
+
+// HookHandle is returned by the registration of a hook, and allows its
+// removal.
+type HookHandle struct {
+	once   sync.Once
+	remove func()
+}
+
+// NewHookHandle returns a new HookHandle which calls the given function,
+// only once, on Remove.
+func NewHookHandle(remove func()) *HookHandle {
+	return &HookHandle{remove: remove}
+}
+
+// Remove removes the hook. Calling Remove more than once has no effect.
+func (h *HookHandle) Remove() {
+	h.once.Do(h.remove)
+}
+
+// ApplyGradHooks calls each hook in sequence, passing the gradient returned
+// by a hook on to the next one, and returns the final gradient.
+func ApplyGradHooks(grad mat.Tensor, hooks []GradHook) mat.Tensor {
+	for _, hook := range hooks {
+		if g := hook(grad); g != nil {
+			grad = g
+		}
+	}
+	return grad
+}
+
+// HookList is a list of hooks of any kind, guarded by an external mutex.
+// The zero value is an empty list ready to use.
+type HookList[F any] struct {
+	entries []*hookEntry[F]
+}
+
+// hookEntry wraps a hook, so that it can be identified for removal.
+type hookEntry[F any] struct {
+	fn F
+}
+
+// operatorHooks holds the hooks registered on an Operator.
+type operatorHooks struct {
+	forward HookList[ForwardHook]
+	grad    HookList[GradHook]
+}
+
+// Add appends the hook to the list, and returns a handle which removes it.
+// The caller must hold mu, which is locked again by the removal.
+func (l *HookList[F]) Add(mu sync.Locker, fn F) *HookHandle {
+	e := &hookEntry[F]{fn: fn}
+	l.entries = append(l.entries, e)
+	return NewHookHandle(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for i, entry := range l.entries {
+			if entry == e {
+				l.entries = append(l.entries[:i:i], l.entries[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// List returns a copy of the hooks, in order of registration.
+// The caller must hold the mutex given to Add, at least for reading.
+func (l *HookList[F]) List() []F {
+	fns := make([]F, len(l.entries))
+	for i, e := range l.entries {
+		fns[i] = e.fn
+	}
+	return fns
+}
+
+// Len returns the number of hooks in the list.
+func (l *HookList[F]) Len() int {
+	return len(l.entries)
+}
+
+// RegisterForwardHook registers a hook to be called with the value of the
+// operator, right after its forward pass.
+// If the forward pass has already been executed, the hook is called
+// immediately.
+func (o *Operator) RegisterForwardHook(hook ForwardHook) *HookHandle {
+	o.hooksMu.Lock()
+	if o.hooks == nil {
+		o.hooks = new(operatorHooks)
+	}
+	handle := o.hooks.forward.Add(&o.hooksMu, hook)
+	forwarded := o.forwarded
+	o.hooksMu.Unlock()
+
+	if forwarded {
+		hook(o, o.Value())
+	}
+	return handle
+}
+
+// RegisterGradHook registers a hook to be called during the backward pass
+// with the gradient of the operator, once it has been completely
+// accumulated and before it is propagated to the operands.
+func (o *Operator) RegisterGradHook(hook GradHook) *HookHandle {
+	o.hooksMu.Lock()
+	defer o.hooksMu.Unlock()
+	if o.hooks == nil {
+		o.hooks = new(operatorHooks)
+	}
+	return o.hooks.grad.Add(&o.hooksMu, hook)
+}
+
+// forwardHooks marks the forward pass as executed and returns the forward
+// hooks to be called.
+func (o *Operator) forwardHooks() []ForwardHook {
+	o.hooksMu.Lock()
+	defer o.hooksMu.Unlock()
+	o.forwarded = true
+	if o.hooks == nil {
+		return nil
+	}
+	return o.hooks.forward.List()
+}
+
+// gradHooks returns the grad hooks to be called.
+func (o *Operator) gradHooks() []GradHook {
+	o.hooksMu.Lock()
+	defer o.hooksMu.Unlock()
+	if o.hooks == nil {
+		return nil
+	}
+	return o.hooks.grad.List()
+}
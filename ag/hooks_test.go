@@ -0,0 +1,92 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperator_RegisterForwardHook(t *testing.T) {
+	t.Run("float32", testOperatorRegisterForwardHook[float32])
+	t.Run("float64", testOperatorRegisterForwardHook[float64])
+}
+
+func testOperatorRegisterForwardHook[T float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithBacking([]T{1, 2}))
+
+	t.Run("registered before the forward pass", func(t *testing.T) {
+		op := NewOperator(&dummyFunction[T, mat.Tensor]{
+			forward: func() (mat.Tensor, error) { return x, nil },
+		})
+		var calls []mat.Tensor
+		op.RegisterForwardHook(func(o *Operator, value mat.Tensor) {
+			assert.Same(t, op, o)
+			calls = append(calls, value)
+		})
+		op.Run()
+		require.Len(t, calls, 1)
+		assert.Same(t, x, calls[0])
+	})
+
+	t.Run("registered after the forward pass", func(t *testing.T) {
+		op := NewOperator(&dummyFunction[T, mat.Tensor]{
+			forward: func() (mat.Tensor, error) { return x, nil },
+		}).Run(true)
+		op.Value()
+		calls := 0
+		op.RegisterForwardHook(func(o *Operator, value mat.Tensor) {
+			calls++
+		})
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("removed", func(t *testing.T) {
+		op := NewOperator(&dummyFunction[T, mat.Tensor]{})
+		calls := 0
+		h := op.RegisterForwardHook(func(o *Operator, value mat.Tensor) {
+			calls++
+		})
+		h.Remove()
+		h.Remove()
+		op.Run()
+		assert.Equal(t, 0, calls)
+	})
+}
+
+func TestOperator_RegisterGradHook(t *testing.T) {
+	t.Run("float32", testOperatorRegisterGradHook[float32])
+	t.Run("float64", testOperatorRegisterGradHook[float64])
+}
+
+func testOperatorRegisterGradHook[T float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+	y := Prod(x, x).(*Operator)
+	z := ReduceSum(y)
+
+	var seen mat.Tensor
+	y.RegisterGradHook(func(grad mat.Tensor) mat.Tensor {
+		seen = grad
+		return nil
+	})
+	h := y.RegisterGradHook(func(grad mat.Tensor) mat.Tensor {
+		return grad.(mat.Matrix).ProdScalar(-1) // gradient reversal
+	})
+
+	require.NoError(t, Backward(z))
+	assert.Equal(t, []T{1, 1}, mat.Data[T](seen))
+	assert.Equal(t, []T{-2, -4}, mat.Data[T](x.Grad()))
+
+	h.Remove()
+	x.ZeroGrad()
+	y.ZeroGrad()
+	z.ZeroGrad()
+	require.NoError(t, Backward(z))
+	assert.Equal(t, []T{2, 4}, mat.Data[T](x.Grad()))
+}
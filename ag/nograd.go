@@ -0,0 +1,68 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"log"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// boundMatrix is a plain mat.Matrix, whose Value() is the matrix itself,
+// which only remembers the engine it is bound to, so that the functions it
+// is passed to are executed on that engine.
+//
+// It is the result of a function executed on a no-grad engine (see
+// WithNoGrad): it holds no reference to its operands, hence it can be
+// garbage collected as soon as it is no longer used.
+type boundMatrix struct {
+	mat.Matrix
+	engine *Engine
+	graph  *streamGraph
+	// anomaly is the first non-finite value found while computing the
+	// matrix, only in anomaly detection mode.
+	anomaly error
+}
+
+// Engine returns the engine the matrix is bound to.
+func (v *boundMatrix) Engine() *Engine {
+	return v.engine
+}
+
+// apply executes the function on the engine of its operands. On a no-grad
+// engine the value is computed eagerly and returned as is; otherwise a new
+// operator is run, asynchronously if async is true.
+func apply(f AutoGradFunction, async bool) mat.Tensor {
+	operands := f.Operands()
+	e := engineOf(operands)
+	if e.NoGrad() {
+		return e.eager(f, graphOf(operands))
+	}
+	o := newOperator(f)
+	o.engine = e
+	o.graph = graphOf(operands)
+	o.onceOperands.Do(func() {
+		o.operands = operands
+	})
+	return o.Run(async)
+}
+
+// eager computes the value of the function, without keeping track of it
+// in the graph.
+func (e *Engine) eager(f AutoGradFunction, graph *streamGraph) mat.Tensor {
+	value, err := f.Forward()
+	if err != nil {
+		log.Fatalf("ag: error during forward pass: %v", err) // TODO: handle error
+	}
+	result := &boundMatrix{
+		Matrix: value.(mat.Matrix),
+		engine: e,
+		graph:  graph,
+	}
+	if anomalyDetection.Load() {
+		result.anomaly = checkForward(&Operator{fn: f, stack: captureStack()}, value)
+	}
+	return result
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoGrad(t *testing.T) {
+	t.Run("float32", testNoGrad[float32])
+	t.Run("float64", testNoGrad[float64])
+}
+
+func testNoGrad[T float.DType](t *testing.T) {
+	e := NewEngine(WithNoGrad(true))
+	assert.True(t, e.NoGrad())
+	assert.False(t, NewEngine().NoGrad())
+
+	w := mat.NewDense[T](mat.WithShape(2, 2), mat.WithBacking([]T{1, 2, 3, 4}), mat.WithGrad(true))
+	b := mat.NewDense[T](mat.WithBacking([]T{0.5, -0.5}), mat.WithGrad(true))
+	x := mat.NewDense[T](mat.WithBacking([]T{1, 1}))
+
+	bx := e.Bind(x)
+	assert.Same(t, bx, e.Bind(bx))
+
+	y := ReduceSum(Square(Affine(b, w, bx)))
+	_, isOperator := y.(*Operator)
+	assert.False(t, isOperator, "no operator must be created")
+	_, isMatrix := y.(mat.Matrix)
+	assert.True(t, isMatrix)
+	assert.Same(t, e, engineOf([]mat.Tensor{y}))
+
+	// (1+2+0.5)^2 + (3+4-0.5)^2
+	assert.InDelta(t, 54.5, y.Value().Item().F64(), 1e-6)
+
+	// The same graph, with autograd.
+	expected := ReduceSum(Square(Affine(b, w, x)))
+	assert.InDelta(t, expected.Value().Item().F64(), y.Value().Item().F64(), 1e-6)
+	require.NoError(t, Backward(expected))
+	w.ZeroGrad()
+	b.ZeroGrad()
+
+	require.NoError(t, Backward(y), "nothing to propagate")
+	assert.Nil(t, w.Grad())
+	assert.Nil(t, b.Grad())
+}
+
+func TestNoGrad_ConcurrentForward(t *testing.T) {
+	e := NewEngine(WithNoGrad(true))
+	w := mat.NewDense[float64](mat.WithShape(3, 3), mat.WithBacking([]float64{1, 0, 0, 0, 2, 0, 0, 0, 3}), mat.WithGrad(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			x := e.Bind(mat.NewDense[float64](mat.WithBacking([]float64{1, 1, float64(i)})))
+			y := ReduceSum(Tanh(Mul(w, x)))
+			assert.Same(t, e, engineOf([]mat.Tensor{y}))
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Nil(t, w.Grad())
+}
+
+func TestNoGrad_Context(t *testing.T) {
+	e := NewEngine(WithNoGrad(true))
+	ctx := ContextWithEngine(context.Background(), e)
+
+	x := EngineFromContext(ctx).Bind(mat.NewDense[float64](mat.WithBacking([]float64{1, 2})))
+	y := Add(x, x)
+	assert.Equal(t, []float64{2, 4}, mat.Data[float64](y.Value()))
+	assert.Same(t, e, engineOf([]mat.Tensor{y}))
+}
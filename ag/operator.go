@@ -8,7 +8,6 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"runtime"
 	"sync"
 	"sync/atomic"
 
@@ -16,17 +15,12 @@ import (
 	"github.com/nlpodyssey/spago/mat/float"
 )
 
-var (
-	// forceSyncExecution, when set to true, forces operators to run synchronously, overriding any "async" flag in the Run() function.
-	// This can be particularly useful for debugging.
-	forceSyncExecution = false
-)
-
-// SetForceSyncExecution enables or disables the forcing of synchronous execution for all operators.
+// SetForceSyncExecution enables or disables the forcing of synchronous execution for all operators
+// of the default engine (see Engine.SetSyncExecution).
 // When enabled, the operators will run synchronously, regardless of the "async" flag in the Run() function.
 // This setting can be particularly useful for debugging.
 func SetForceSyncExecution(enable bool) {
-	forceSyncExecution = enable
+	defaultEngine.SetSyncExecution(enable)
 }
 
 // backwardState is an enumeration type associated to an Operator, to keep
@@ -56,11 +50,23 @@ const (
 	// performing its Operator.backward method.
 	//
 	// This status remains set until the gradients of all dependents have been
-	// resolved, and the node's own gradients have been propagated too.
-	// After that, the status is set back to idle.
+	// resolved.
+	//
+	// The next logical state is scheduled.
 	ongoing
+	// scheduled is set on an operator node once all its gradients have been
+	// accumulated, and its Operator.backward method has been submitted for
+	// execution. After the node's own gradients have been propagated, the
+	// status is set back to idle.
+	scheduled
 )
 
+// inlineThreshold is the maximum total size of the operands of an async
+// operator for its forward pass to be executed inline, when its operands
+// are already available: scheduling it on the pool would cost more than
+// the operation itself.
+const inlineThreshold = 256
+
 // AutoGradFunction represents a function with automatic differentiation features.
 // It's used to define a new operator.
 type AutoGradFunction interface {
@@ -72,19 +78,6 @@ type AutoGradFunction interface {
 	Operands() []mat.Tensor
 }
 
-// forwardGuard is a buffered channel that acts as a semaphore to limit the concurrency
-// of async forward operations in the Run function. Its buffer size determines the maximum
-// number of forward operations that can run concurrently. Acquiring and releasing slots
-// in the semaphore ensures that the concurrency level stays within the desired limit.
-var forwardGuard chan struct{}
-
-// Using runtime.NumCPU() * 2 is a common heuristic for setting the number of concurrent goroutines or the concurrency level in a Go program.
-var concurrencyLimit = runtime.NumCPU() * 2
-
-func init() {
-	forwardGuard = make(chan struct{}, concurrencyLimit)
-}
-
 // Operator is a type of node.
 // It's used to represent a function with automatic differentiation features.
 type Operator struct {
@@ -113,12 +106,51 @@ type Operator struct {
 	requiresGrad bool
 	// backwardState is the state of the backward pass.
 	backwardState backwardState
+	// stack is the call stack captured on creation, only in anomaly detection mode.
+	stack []uintptr
+	// anomaly is the first non-finite value found in the forward pass of the
+	// operator or of the operators it depends on, only in anomaly detection mode.
+	anomaly error
+	// hooksMu guards hooks and forwarded.
+	hooksMu sync.Mutex
+	// hooks are the registered hooks, allocated on first registration.
+	hooks *operatorHooks
+	// forwarded reports whether the forward hooks have already been called.
+	forwarded bool
+	// depMu guards done and dependents.
+	depMu sync.Mutex
+	// done reports whether the forward pass has been executed.
+	done bool
+	// dependents are the async operators waiting for the value of the operator.
+	dependents []*Operator
+	// pendingOperands is the number of operands an async operator is waiting for.
+	pendingOperands int32
+	// forwardPanic is the value of the panic raised by the forward pass, when
+	// executed by a worker of the pool.
+	forwardPanic any
+	// engine is the engine the operator runs on.
+	engine *Engine
+	// graph assigns the random streams of the operators of the graph, if it
+	// is bound to one (see Engine.BindStream).
+	graph *streamGraph
 }
 
 // NewOperator creates a new operator with the given AutoGradFunction.
+// The operator is bound to the engine of its operands (see Engine).
 // Note that the operator's Value() can only be accessed after calling the Run() function.
 func NewOperator(f AutoGradFunction) *Operator {
-	return &Operator{fn: f}
+	o := newOperator(f)
+	o.engine = engineOf(o.Operands())
+	o.graph = graphOf(o.Operands())
+	return o
+}
+
+func newOperator(f AutoGradFunction) *Operator {
+	o := &Operator{fn: f}
+	if anomalyDetection.Load() {
+		o.stack = captureStack()
+	}
+	return o
 }
 
 // SetAt sets the value at the given indices.
@@ -134,37 +166,127 @@ func (o *Operator) At(indices ...int) mat.Tensor {
 }
 
 // Run starts the execution of the operator, performing the forward pass.
-// If the optional async argument is set to true, the forward pass will be executed in a separate goroutine.
+// If the optional async argument is set to true, the forward pass will be executed by the worker pool
+// of the operator's engine as soon as all its operands are ready, unless the engine forces synchronous execution.
+// Tiny async operators whose operands are already ready are executed inline.
 // The function returns a pointer to the Operator, allowing for method chaining.
 func (o *Operator) Run(async ...bool) *Operator {
-	isAsync := !forceSyncExecution && len(async) > 0 && async[0]
-
-	if isAsync {
-		//lint:ignore S1019 explicitly set the buffer size to 0 as the channel is used as a signal
-		o.broadcast = make(chan struct{}, 0)
-		forwardGuard <- struct{}{}
-		go func() {
-			o.executeForward()
-			<-forwardGuard
-		}()
+	isAsync := !o.engine.SyncExecution() && !anomalyDetection.Load() && len(async) > 0 && async[0]
+
+	if !isAsync {
+		o.executeForward(nil)
 		return o
 	}
 
-	o.executeForward()
+	//lint:ignore S1019 explicitly set the buffer size to 0 as the channel is used as a signal
+	o.broadcast = make(chan struct{}, 0)
+
+	// The extra count prevents the operator from being scheduled before
+	// all the operands have been inspected.
+	o.pendingOperands = 1
+	for _, operand := range o.Operands() {
+		if oo, ok := operand.(*Operator); ok {
+			atomic.AddInt32(&o.pendingOperands, 1)
+			if !oo.addDependent(o) {
+				atomic.AddInt32(&o.pendingOperands, -1)
+			}
+		}
+	}
+	if atomic.AddInt32(&o.pendingOperands, -1) != 0 {
+		return o // scheduled by the last operand to complete
+	}
+
+	if o.isTiny() {
+		o.executeForward(nil)
+		return o
+	}
+	o.engine.workers().submit(task{op: o}, nil)
 	return o
 }
 
-// forward executes the forward function and inform all goroutines that have been waiting for the result.
-func (o *Operator) executeForward() {
+// addDependent registers the async operator d to be scheduled once the
+// forward pass of o has been executed. It returns false if the forward pass
+// has already been executed.
+func (o *Operator) addDependent(d *Operator) bool {
+	o.depMu.Lock()
+	defer o.depMu.Unlock()
+	if o.done {
+		return false
+	}
+	o.dependents = append(o.dependents, d)
+	return true
+}
+
+// isTiny reports whether the total size of the operands is below the
+// inlineThreshold. The operands must be ready.
+func (o *Operator) isTiny() bool {
+	size := 0
+	for _, operand := range o.Operands() {
+		if size += operand.Size(); size > inlineThreshold {
+			return false
+		}
+	}
+	return true
+}
+
+// executeForward executes the forward function, informs all goroutines that have been waiting
+// for the result and schedules the dependents that were waiting only for this operator.
+// The worker w is nil if the function is not executed by a worker of the pool.
+func (o *Operator) executeForward(w *worker) {
 	value, err := o.fn.Forward()
 	if err != nil {
 		log.Fatalf("ag: error during forward pass: %v", err) // TODO: handle error
 	}
 	o.value = value
 
+	if anomalyDetection.Load() {
+		o.anomaly = checkForward(o, value)
+	}
+
+	o.complete(w)
+
+	for _, hook := range o.forwardHooks() {
+		hook(o, value)
+	}
+}
+
+// complete informs all goroutines that have been waiting for the result of the forward pass,
+// and schedules the dependents that were waiting only for this operator.
+func (o *Operator) complete(w *worker) {
 	if o.broadcast != nil { // if nil, it means that the operator is not async
 		close(o.broadcast) // inform all goroutines that have been waiting for the result
 	}
+
+	o.depMu.Lock()
+	o.done = true
+	dependents := o.dependents
+	o.dependents = nil
+	o.depMu.Unlock()
+
+	for _, d := range dependents {
+		if atomic.AddInt32(&d.pendingOperands, -1) == 0 {
+			d.engine.workers().submit(task{op: d}, w)
+		}
+	}
+}
+
+// failForward records the value r of a panic raised by the forward pass executed by the worker w,
+// to be raised again by Value, and completes the operator, so that no goroutine waits for it forever.
+// The panics raised by the forward hooks, once the value has been published, are not recovered.
+func (o *Operator) failForward(r any, w *worker) {
+	o.depMu.Lock()
+	done := o.done
+	o.depMu.Unlock()
+	if done {
+		panic(r)
+	}
+	o.forwardPanic = r
+	o.complete(w)
+}
+
+// Engine returns the engine the operator runs on.
+func (o *Operator) Engine() *Engine {
+	return o.engine
 }
 
 // Value returns the result of the function.
@@ -172,6 +294,9 @@ func (o *Operator) Value() mat.Tensor {
 	if o.broadcast != nil { // if nil, it means that the operator is not async
 		<-o.broadcast // wait for the forward goroutine to finish
 	}
+	if o.forwardPanic != nil {
+		panic(o.forwardPanic)
+	}
 	return o.value
 }
 
@@ -269,32 +394,73 @@ func (o *Operator) prepareBackwardPass() {
 	}
 }
 
-func (o *Operator) processBackwardPass(wg *sync.WaitGroup) {
+func (o *Operator) processBackwardPass(bp *backwardPass) {
+	if o.isReleased() {
+		bp.released = true // its value and operands are gone
+	}
 	if !o.RequiresGrad() || !o.trySetBackwardOngoing() {
 		return
 	}
 
-	wg.Add(1) // decrement when the backward pass is done
-	go o.executeBackward(wg)
+	bp.nodes = append(bp.nodes, o)
 
 	for _, operand := range o.Operands() {
 		if oo, ok := operand.(*Operator); ok {
-			oo.processBackwardPass(wg)
+			oo.processBackwardPass(bp)
 		}
 	}
 }
 
-func (o *Operator) executeBackward(wg *sync.WaitGroup) {
-	defer wg.Done()
-	defer o.setBackwardIdle()
-
-	grad := o.Grad() // wait until the accumulated gradients are ready
+// executeBackward propagates the accumulated gradients to the operands, and
+// schedules the operands whose gradients have been completely accumulated.
+// The worker w is nil if the function is not executed by a worker of the pool.
+// The pass is notified that the node has been executed only at the end, so that a panic
+// recovered by the worker is reported before the pass is over (see task.run).
+func (o *Operator) executeBackward(bp *backwardPass, w *worker) {
+	grad := o.Value().Grad()
 	if grad == nil {
-		return // no gradients to propagate
+		o.releaseOperands() // no gradients to propagate
+	} else if err := o.propagateGrad(grad); err != nil {
+		bp.fail(err)
+		bp.taskDone()
+		return
+	}
+
+	o.setBackwardIdle()
+	for _, operand := range o.Operands() {
+		if oo, ok := operand.(*Operator); ok && atomic.LoadInt64(&oo.pendingGrads) == 0 {
+			bp.schedule(oo, w)
+		}
+	}
+	bp.taskDone()
+}
+
+// propagateGrad calls the backward function with the given gradients.
+func (o *Operator) propagateGrad(grad mat.Tensor) error {
+	if anomalyDetection.Load() && !isFinite(grad) {
+		return newAnomalyError(o, "backward", grad.Shape())
+	}
+
+	if hooks := o.gradHooks(); len(hooks) > 0 {
+		grad = ApplyGradHooks(grad, hooks)
 	}
 
 	if err := o.fn.Backward(grad); err != nil {
-		log.Fatalf("ag: error during backward pass: %v", err) // TODO: handle error
+		return fmt.Errorf("ag: error during backward pass: %w", err)
+	}
+	return nil
+}
+
+// releaseOperands decrements the pending gradients of the operands, as if
+// the gradients had been accumulated, when there are no gradients to
+// propagate.
+func (o *Operator) releaseOperands() {
+	for _, operand := range o.Operands() {
+		if oo, ok := operand.(*Operator); ok && oo.RequiresGrad() && !oo.isBackwardIdle() {
+			if atomic.AddInt64(&oo.pendingGrads, -1) == 0 {
+				close(oo.broadcastGrad)
+			}
+		}
 	}
 }
 
@@ -314,6 +480,10 @@ func (o *Operator) trySetBackwardOngoing() bool {
 	return atomic.CompareAndSwapUint32(&o.backwardState, pending, ongoing)
 }
 
+func (o *Operator) trySetBackwardScheduled() bool {
+	return atomic.CompareAndSwapUint32(&o.backwardState, ongoing, scheduled)
+}
+
 // isNil returns true if the gradients are nil.
 func isNil(grad any) bool {
 	if grad == nil || reflect.ValueOf(grad).IsNil() {
@@ -14,7 +14,19 @@ import (
 
 // Abs returns a new operator node as a result of the `Abs` function.
 func Abs(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewAbs(x)).Run()
+	return apply(gradfn.NewAbs(x), false)
+}
+
+// AdaptiveAvgPooling returns a new operator node as a result of the
+// gradfn.AdaptiveAvgPooling function, pooling x to a matrix of the given size.
+func AdaptiveAvgPooling(x mat.Tensor, rows, columns int) mat.Tensor {
+	return apply(gradfn.NewAdaptiveAvgPooling(x, rows, columns), false)
+}
+
+// AdaptiveMaxPooling returns a new operator node as a result of the
+// gradfn.AdaptiveMaxPooling function, pooling x to a matrix of the given size.
+func AdaptiveMaxPooling(x mat.Tensor, rows, columns int) mat.Tensor {
+	return apply(gradfn.NewAdaptiveMaxPooling(x, rows, columns), false)
 }
 
 // Add returns a new operator node as a result of the gradfn.Add function.
@@ -24,342 +36,416 @@ func Add(x1 mat.Tensor, x2 mat.Tensor) mat.Tensor {
 	if x1 == nil {
 		return Copy(x2) // return a copy of `x2` as is
 	}
-	return NewOperator(gradfn.NewAdd(x1, x2)).Run(true)
+	return apply(gradfn.NewAdd(x1, x2), true)
 }
 
 // AddScalar returns a new operator node as a result of the gradfn.AddScalar function.
 func AddScalar(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewAddScalar(x1, x2)).Run()
+	return apply(gradfn.NewAddScalar(x1, x2), false)
 }
 
 // Affine returns a new operator node as a result of the gradfn.Affine function.
 func Affine(b, w1, x1 mat.Tensor, wxPairs ...mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewAffine(b, w1, x1, wxPairs...)).Run(true)
+	return apply(gradfn.NewAffine(b, w1, x1, wxPairs...), true)
 }
 
 // AppendRows returns a new operator node as a result of the gradfn.AppendRows function.
 func AppendRows(x mat.Tensor, vs ...mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewAppendRows(x, vs...)).Run()
+	return apply(gradfn.NewAppendRows(x, vs...), false)
 }
 
 // At returns a new operator node as a result of the gradfn.At function.
 func At(x mat.Tensor, indices ...int) mat.Tensor {
-	return NewOperator(gradfn.NewAt(x, indices...)).Run()
+	return apply(gradfn.NewAt(x, indices...), false)
+}
+
+// AvgPooling returns a new operator node as a result of the gradfn.AvgPooling function.
+func AvgPooling(x mat.Tensor, config gradfn.PoolingConfig) mat.Tensor {
+	return apply(gradfn.NewAvgPooling(x, config), false)
 }
 
 // CELU returns a new operator node as a result of the gradfn.CELU function.
 func CELU(x, alpha mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewCELU(x, alpha)).Run()
+	return apply(gradfn.NewCELU(x, alpha), false)
+}
+
+// Cast returns a new operator node as a result of the gradfn.Cast function.
+// Its gradient is converted back to the type of x.
+func Cast(x mat.Tensor, dtype mat.DType) mat.Tensor {
+	return apply(gradfn.NewCast(x, dtype), false)
+}
+
+// CausalLinearAttention returns a new operator node as a result of the
+// gradfn.CausalLinearAttention function: the linear attention of the
+// features of the queries qs, the last positions of the keys k, over the
+// keys up to their positions and the values v. The result has one column
+// for each query.
+func CausalLinearAttention(qs []mat.Tensor, k, v mat.Tensor) mat.Tensor {
+	return apply(gradfn.NewCausalLinearAttention(qs, k, v), true)
 }
 
 // ColView returns a new operator node as a result of the gradfn.ColView function.
 func ColView(x mat.Tensor, column int) mat.Tensor {
-	return NewOperator(gradfn.NewColView(x, column)).Run()
+	return apply(gradfn.NewColView(x, column), false)
 }
 
 // Concat returns a new operator node as a result of the gradfn.Concat function.
 func Concat(xs ...mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewConcat(xs)).Run()
+	return apply(gradfn.NewConcat(xs), false)
+}
+
+// Conv1D returns a new operator node as a result of the gradfn.Conv1D function.
+// With a single group, the kernel ws[o*len(xs)+i] is applied to the input
+// channel xs[i] for the output channel o; the result has one column for each
+// output channel.
+func Conv1D(xs, ws []mat.Tensor, config gradfn.ConvConfig) mat.Tensor {
+	return apply(gradfn.NewConv1D(xs, ws, config), true)
+}
+
+// Conv2D returns a new operator node as a result of the gradfn.Conv2D function.
+// With a single group, the kernel ws[o*len(xs)+i] is applied to the input
+// channel xs[i] for the output channel o; the result has one row for each
+// output channel, holding its values in row-major order.
+func Conv2D(xs, ws []mat.Tensor, config gradfn.ConvConfig) mat.Tensor {
+	return apply(gradfn.NewConv2D(xs, ws, config), true)
+}
+
+// Conv1DTranspose returns a new operator node as a result of the
+// gradfn.Conv1DTranspose function, the adjoint of Conv1D with the same
+// kernels. The result has one row for each output channel.
+func Conv1DTranspose(xs, ws []mat.Tensor, config gradfn.ConvTransposeConfig) mat.Tensor {
+	return apply(gradfn.NewConv1DTranspose(xs, ws, config), true)
+}
+
+// Conv2DTranspose returns a new operator node as a result of the
+// gradfn.Conv2DTranspose function, the adjoint of Conv2D with the same
+// kernels. The result has one row for each output channel, holding its
+// values in row-major order.
+func Conv2DTranspose(xs, ws []mat.Tensor, config gradfn.ConvTransposeConfig) mat.Tensor {
+	return apply(gradfn.NewConv2DTranspose(xs, ws, config), true)
 }
 
 // Cos returns a new operator node as a result of the `Cos` function.
 func Cos(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewCos(x)).Run()
+	return apply(gradfn.NewCos(x), false)
 }
 
 // Div returns a new operator node as a result of the gradfn.Div function.
 func Div(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewDiv(x1, x2)).Run()
+	return apply(gradfn.NewDiv(x1, x2), false)
 }
 
 // DivScalar returns a new operator node as a result of the gradfn.DivScalar function.
 func DivScalar(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewDivScalar(x1, x2)).Run()
+	return apply(gradfn.NewDivScalar(x1, x2), false)
 }
 
 // Dot returns a new operator node as a result of the gradfn.Dot function.
 func Dot(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewDot(x1, x2)).Run()
+	return apply(gradfn.NewDot(x1, x2), false)
 }
 
 // DropoutFunc returns a function to create a Dropout operator working with the given dropout probability.
 func DropoutFunc(p float64) func(x mat.Tensor) mat.Tensor {
 	return func(x mat.Tensor) mat.Tensor {
-		if p == 0.0 {
-			return x
-		}
-		return NewOperator(gradfn.NewDropout(x, p, globalGenerator)).Run()
+		return Dropout(x, p)
 	}
 }
 
 // Dropout returns a new operator node as a result of the gradfn.Dropout function.
+// The dropout mask is drawn from a random stream of the engine of x (see Stream).
 // If the dropout probability is zero, the operator will not be created,
 // so the input itself is returned directly.
 func Dropout(x mat.Tensor, p float64) mat.Tensor {
 	if p == 0.0 {
 		return x
 	}
-	return NewOperator(gradfn.NewDropout(x, p, globalGenerator)).Run()
+	return apply(gradfn.NewDropout(x, p, Stream(x)), false)
 }
 
 // ELU returns a new operator node as a result of the gradfn.ELU function.
 func ELU(x, alpha mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewELU(x, alpha)).Run()
+	return apply(gradfn.NewELU(x, alpha), false)
 }
 
 // Exp returns a new operator node as a result of the `Exp` function.
 func Exp(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewExp(x)).Run()
+	return apply(gradfn.NewExp(x), false)
 }
 
 // Flatten returns a new operator node as a result of the gradfn.Flatten function.
 func Flatten(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewFlatten(x)).Run()
+	return apply(gradfn.NewFlatten(x), false)
 }
 
 // GELU returns a new operator node as a result of the gradfn.GELU function.
 func GELU(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewGELU(x)).Run()
+	return apply(gradfn.NewGELU(x), false)
+}
+
+// GlobalAvgPooling returns a new operator node as a result of the
+// gradfn.AdaptiveAvgPooling function, averaging all the values of x into
+// a 1×1 matrix.
+func GlobalAvgPooling(x mat.Tensor) mat.Tensor {
+	return AdaptiveAvgPooling(x, 1, 1)
+}
+
+// GlobalMaxPooling returns a new operator node as a result of the
+// gradfn.AdaptiveMaxPooling function, reducing all the values of x to their
+// maximum, as a 1×1 matrix.
+func GlobalMaxPooling(x mat.Tensor) mat.Tensor {
+	return AdaptiveMaxPooling(x, 1, 1)
 }
 
 // HardSigmoid returns a new operator node as a result of the `HardSigmoid` function.
 func HardSigmoid(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewHardSigmoid(x)).Run()
+	return apply(gradfn.NewHardSigmoid(x), false)
 }
 
 // HardTanh returns a new operator node as a result of the `HardTanh` function.
 func HardTanh(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewHardTanh(x)).Run()
+	return apply(gradfn.NewHardTanh(x), false)
 }
 
 // Copy returns a new operator node as a result of the gradfn.Copy function.
 func Copy(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewCopy(x)).Run()
+	return apply(gradfn.NewCopy(x), false)
 }
 
 // LeakyReLU returns a new operator node as a result of the gradfn.LeakyReLU function.
 func LeakyReLU(x, alpha mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewLeakyReLU(x, alpha)).Run()
+	return apply(gradfn.NewLeakyReLU(x, alpha), false)
 }
 
 // Log returns a new operator node as a result of the `Log` function.
 func Log(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewLog(x)).Run()
+	return apply(gradfn.NewLog(x), false)
+}
+
+// LpPooling returns a new operator node as a result of the gradfn.LpPooling function.
+func LpPooling(x mat.Tensor, p float64, config gradfn.PoolingConfig) mat.Tensor {
+	return apply(gradfn.NewLpPooling(x, p, config), false)
 }
 
 // Max returns a new operator node as a result of the gradfn.Max function.
 func Max(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewMax(x1, x2)).Run()
+	return apply(gradfn.NewMax(x1, x2), false)
 }
 
 // MaxPooling returns a new operator node as a result of the gradfn.MaxPooling function.
 func MaxPooling(x mat.Tensor, rows, columns int) mat.Tensor {
-	return NewOperator(gradfn.NewMaxPooling(x, rows, columns)).Run()
+	return apply(gradfn.NewMaxPooling(x, rows, columns), false)
 }
 
 // Min returns a new operator node as a result of the gradfn.Min function.
 func Min(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewMin(x1, x2)).Run()
+	return apply(gradfn.NewMin(x1, x2), false)
 }
 
 // Mish returns a new operator node as a result of the `Mish` function.
 func Mish(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewMish(x)).Run()
+	return apply(gradfn.NewMish(x), false)
 }
 
 // Mul returns a new operator node as a result of the gradfn.Mul function.
 func Mul(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewMul(x1, x2)).Run()
+	return apply(gradfn.NewMul(x1, x2), false)
 }
 
 func MulT(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewMulT(x1, x2)).Run(true)
+	return apply(gradfn.NewMulT(x1, x2), true)
 }
 
 // Neg returns a new operator node as a result of the `Neg` function.
 func Neg(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewNeg(x)).Run()
+	return apply(gradfn.NewNeg(x), false)
 }
 
 // Pow returns a new operator node as a result of the gradfn.Pow function.
 func Pow(x mat.Tensor, power float64) mat.Tensor {
-	return NewOperator(gradfn.NewPow(x, power)).Run()
+	return apply(gradfn.NewPow(x, power), false)
 }
 
 // Prod returns a new operator node as a result of the gradfn.Prod function.
 func Prod(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewProd(x1, x2)).Run()
+	return apply(gradfn.NewProd(x1, x2), false)
 }
 
 // ProdScalar returns a new operator node as a result of the gradfn.ProdScalar function.
 func ProdScalar(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewProdScalar(x1, x2)).Run(true)
+	return apply(gradfn.NewProdScalar(x1, x2), true)
 }
 
 // Reciprocal returns a new operator node as a result of the `Reciprocal` function.
 func Reciprocal(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReciprocal(x)).Run()
+	return apply(gradfn.NewReciprocal(x), false)
 }
 
 // ReduceMax returns a new operator node as a result of the gradfn.ReduceMax function.
 func ReduceMax(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReduceMax(x)).Run()
+	return apply(gradfn.NewReduceMax(x), false)
 }
 
 // ReduceMean returns a new operator node as a result of the gradfn.ReduceMean function.
 func ReduceMean(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReduceMean(x)).Run()
+	return apply(gradfn.NewReduceMean(x), false)
 }
 
 // ReduceSum returns a new operator node as a result of the gradfn.ReduceSum function.
 func ReduceSum(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReduceSum(x)).Run()
+	return apply(gradfn.NewReduceSum(x), false)
 }
 
 // ReLU returns a new operator node as a result of the `ReLU` function.
 func ReLU(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReLU(x)).Run(true)
+	return apply(gradfn.NewReLU(x), true)
 }
 
 // Reshape returns a new operator node as a result of the gradfn.Reshape function.
 func Reshape(x mat.Tensor, rows, columns int) mat.Tensor {
-	return NewOperator(gradfn.NewReshape(x, rows, columns)).Run()
+	return apply(gradfn.NewReshape(x, rows, columns), false)
 }
 
 // ReverseSub returns a new operator node as a result of the fn.ReverseSub function.
 func ReverseSub(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReverseSubScalar(x1, x2)).Run()
+	return apply(gradfn.NewReverseSubScalar(x1, x2), false)
 }
 
 // ReverseSubOne returns a new operator node as a result of applying reverse subtraction with 1.0 to the input using the fn.ReverseSub function.
 func ReverseSubOne(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewReverseSubScalar(x, mat.Tensor(mat.Scalar(1.0)))).Run()
+	return apply(gradfn.NewReverseSubScalar(x, mat.Tensor(mat.Scalar(1.0))), false)
+}
+
+// Rotary returns a new operator node as a result of the gradfn.Rotary function,
+// applying the rotary position embedding of the given position to x.
+func Rotary(x mat.Tensor, position int, base float64) mat.Tensor {
+	return apply(gradfn.NewRotary(x, position, base), false)
 }
 
 // RotateR performs the right circular shift.
 // `i` is the number of places by which the elements are shifted.
 func RotateR(x mat.Tensor, i int) mat.Tensor {
-	return NewOperator(gradfn.NewRotateR(x, i)).Run()
+	return apply(gradfn.NewRotateR(x, i), false)
 }
 
 // RowView returns a new operator node as a result of the gradfn.RowView function.
 func RowView(x mat.Tensor, row int) mat.Tensor {
-	return NewOperator(gradfn.NewRowView(x, row)).Run()
+	return apply(gradfn.NewRowView(x, row), false)
 }
 
 // ScalarMax returns a new operator node as a result of the gradfn.ScalarMax function.
 func ScalarMax(xs []mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewScalarMax(xs)).Run()
+	return apply(gradfn.NewScalarMax(xs), false)
 }
 
 // SELU returns a new operator node as a result of the gradfn.SELU function.
 func SELU(x, alpha mat.Tensor, scale mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSELU(x, alpha, scale)).Run()
+	return apply(gradfn.NewSELU(x, alpha, scale), false)
 }
 
 // Sigmoid returns a new operator node as a result of the `Sigmoid` function.
 func Sigmoid(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSigmoid(x)).Run()
+	return apply(gradfn.NewSigmoid(x), false)
 }
 
 // SiLU returns a new operator node as a result of the fn.SiLU function.
 func SiLU(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSiLU(x)).Run()
+	return apply(gradfn.NewSiLU(x), false)
 }
 
 // Sin returns a new operator node as a result of the `Sin` function.
 func Sin(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSin(x)).Run()
+	return apply(gradfn.NewSin(x), false)
 }
 
 // Slice returns a new operator node as a result of the gradfn.Slice function.
 func Slice(x mat.Tensor, fromRow, fromCol, toRow, toCol int) mat.Tensor {
-	return NewOperator(gradfn.NewSlice(x, fromRow, fromCol, toRow, toCol)).Run()
+	return apply(gradfn.NewSlice(x, fromRow, fromCol, toRow, toCol), false)
 }
 
 // Softmax returns a new operator node as a result of the gradfn.Softmax function.
 func Softmax(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSoftmax(x)).Run()
+	return apply(gradfn.NewSoftmax(x), false)
 }
 
 // SoftPlus returns a new operator node as a result of the gradfn.SoftPlus function.
 func SoftPlus(x, beta, threshold mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSoftPlus(x, beta, threshold)).Run()
+	return apply(gradfn.NewSoftPlus(x, beta, threshold), false)
 }
 
 // SoftShrink returns a new operator node as a result of the gradfn.SoftShrink function.
 func SoftShrink(x, lambda mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSoftShrink(x, lambda)).Run()
+	return apply(gradfn.NewSoftShrink(x, lambda), false)
 }
 
 // Softsign returns a new operator node as a result of the `SoftSign` function.
 func Softsign(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSoftsign(x)).Run()
+	return apply(gradfn.NewSoftsign(x), false)
 }
 
 // SparseMax returns a new operator node as a result of the gradfn.SparseMax function.
 func SparseMax(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSparseMax(x)).Run()
+	return apply(gradfn.NewSparseMax(x), false)
 }
 
 // SparseMaxLoss returns a new operator node as a result of the gradfn.SparseMaxLoss function.
 func SparseMaxLoss(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSparseMaxLoss(x)).Run()
+	return apply(gradfn.NewSparseMaxLoss(x), false)
 }
 
 // Sqrt returns a new operator node as a result of the `Sqrt` function.
 func Sqrt(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSqrt(x)).Run()
+	return apply(gradfn.NewSqrt(x), false)
 }
 
 // Square returns a new operator node as a result of the gradfn.Prod(x, x) function.
 func Square(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSquare(x)).Run()
+	return apply(gradfn.NewSquare(x), false)
 }
 
 // Stack returns a new operator node as a result of the gradfn.Stack function.
 func Stack(xs ...mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewStack(xs)).Run()
+	return apply(gradfn.NewStack(xs), false)
 }
 
 // Sub returns a new operator node as a result of the gradfn.Sub function.
 func Sub(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSub(x1, x2)).Run()
+	return apply(gradfn.NewSub(x1, x2), false)
 }
 
 // SubScalar returns a new operator node as a result of the gradfn.SubScalar function.
 func SubScalar(x1, x2 mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSubScalar(x1, x2)).Run()
+	return apply(gradfn.NewSubScalar(x1, x2), false)
 }
 
 // Swish returns a new operator node as a result of the gradfn.Swish function.
 func Swish(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSwish(x)).Run()
+	return apply(gradfn.NewSwish(x), false)
 }
 
 // SwishB returns a new operator node as a result of the gradfn.SwishB function.
 func SwishB(x, beta mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewSwishB(x, beta)).Run()
+	return apply(gradfn.NewSwishB(x, beta), false)
 }
 
 // T returns a new operator node as a result of the fn.T function.
 func T(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewTranspose(x)).Run()
+	return apply(gradfn.NewTranspose(x), false)
 }
 
 // Tan returns a new operator node as a result of the `Tan` function.
 func Tan(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewTan(x)).Run()
+	return apply(gradfn.NewTan(x), false)
 }
 
 // Tanh returns a new operator node as a result of the `Tanh` function.
 func Tanh(x mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewTanh(x)).Run()
+	return apply(gradfn.NewTanh(x), false)
 }
 
 // Threshold returns a new operator node as a result of the gradfn.Threshold function.
 func Threshold(x, threshold, k mat.Tensor) mat.Tensor {
-	return NewOperator(gradfn.NewThreshold(x, threshold, k)).Run()
+	return apply(gradfn.NewThreshold(x, threshold, k), false)
 }
 
 // Map returns a transformed version of xs with all its components modified according to the mapping function.
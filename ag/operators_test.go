@@ -175,3 +175,17 @@ func testColViews[T float.DType](t *testing.T) {
 func newScalar[T float.DType](v T) mat.Tensor {
 	return mat.Scalar(v)
 }
+
+func TestCast(t *testing.T) {
+	x := mat.NewDense[float32](mat.WithBacking([]float32{1, 2}), mat.WithGrad(true))
+	w := mat.NewDense[float64](mat.WithBacking([]float64{3, 4}), mat.WithGrad(true))
+
+	y := Prod(Cast(x, mat.Float64), w)
+	assert.Equal(t, mat.Float64, mat.DTypeOf(y.Value().(mat.Matrix)))
+	assert.Equal(t, []float64{3, 8}, mat.Data[float64](y.Value()))
+
+	y.AccGrad(mat.NewDense[float64](mat.WithBacking([]float64{1, 1})))
+	assert.NoError(t, Backward(y))
+	assert.Equal(t, []float32{3, 4}, mat.Data[float32](x.Grad()))
+	assert.Equal(t, []float64{1, 2}, mat.Data[float64](w.Grad()))
+}
@@ -0,0 +1,241 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// task is a unit of work executed by a workerPool: the forward pass of an
+// operator, or its backward pass if bp is not nil.
+type task struct {
+	op *Operator
+	bp *backwardPass
+}
+
+// run executes the task on the given worker.
+//
+// A panic raised by the task does not stop the worker: a panic of the
+// backward pass aborts it with an error, while a panic of the forward pass
+// is raised again by Operator.Value, on the goroutines reading the value.
+func (t task) run(w *worker) {
+	defer func() {
+		if r := recover(); r != nil {
+			t.recover(r, w)
+		}
+	}()
+	if t.bp != nil {
+		t.op.executeBackward(t.bp, w)
+		return
+	}
+	t.op.executeForward(w)
+}
+
+// recover handles the value r of a panic raised by the task.
+func (t task) recover(r any, w *worker) {
+	if t.bp != nil {
+		t.bp.fail(fmt.Errorf("ag: panic during backward pass: %v", r))
+		t.bp.taskDone()
+		return
+	}
+	t.op.failForward(r, w)
+}
+
+// workerPool is a fixed-size pool of goroutines executing the tasks of an
+// Engine.
+//
+// Each worker owns a deque: the tasks spawned while executing another task
+// (e.g. the operators whose operands have just become ready) are pushed to
+// the back of the local deque and popped LIFO by the owner, for cache
+// locality, while idle workers steal from the front of the other deques.
+// Tasks submitted from outside the pool go to a shared global queue.
+//
+// Workers are started lazily, up to the size of the pool, and park when no
+// work is available. Once the pool is closed, the workers exit as soon as
+// they run out of work, instead of parking; new workers are still started
+// on demand.
+type workerPool struct {
+	workers []*worker
+	global  deque
+	// queued is the number of tasks in the global queue and in all deques.
+	queued atomic.Int64
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	running int
+	idle    int
+	closed  atomic.Bool
+}
+
+// worker is a goroutine of a workerPool.
+type worker struct {
+	pool  *workerPool
+	id    int
+	local deque
+	// active reports whether the goroutine is running. It is guarded by
+	// the pool's mutex.
+	active bool
+}
+
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{
+		workers: make([]*worker, size),
+	}
+	for i := range p.workers {
+		p.workers[i] = &worker{pool: p, id: i}
+	}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// submit schedules the task. If w is a worker of the pool, the task is
+// pushed to its local deque, otherwise to the global queue.
+func (p *workerPool) submit(t task, w *worker) {
+	p.queued.Add(1)
+	if w != nil && w.pool == p {
+		w.local.pushBack(t)
+	} else {
+		p.global.pushBack(t)
+	}
+	p.wake()
+}
+
+// wake resumes an idle worker, or starts a new one if the pool is not full.
+func (p *workerPool) wake() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case p.idle > 0:
+		p.cond.Signal()
+	case p.running < len(p.workers):
+		for _, w := range p.workers {
+			if !w.active {
+				w.active = true
+				p.running++
+				go w.loop()
+				return
+			}
+		}
+	}
+}
+
+// close stops the idle workers, and lets the running ones exit as soon as
+// they run out of work.
+func (p *workerPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed.Store(true)
+	p.cond.Broadcast()
+}
+
+// loop is the main loop of a worker.
+func (w *worker) loop() {
+	for {
+		t, ok := w.next()
+		if !ok {
+			if !w.park() {
+				return
+			}
+			continue
+		}
+		t.run(w)
+	}
+}
+
+// next returns the next task: from the back of the local deque, then from
+// the global queue, and finally stolen from the front of another deque.
+func (w *worker) next() (task, bool) {
+	p := w.pool
+	if p.queued.Load() == 0 {
+		return task{}, false
+	}
+	if t, ok := w.local.popBack(); ok {
+		p.queued.Add(-1)
+		return t, true
+	}
+	if t, ok := p.global.popFront(); ok {
+		p.queued.Add(-1)
+		return t, true
+	}
+	n := len(p.workers)
+	for i := 1; i < n; i++ {
+		victim := p.workers[(w.id+i)%n]
+		if t, ok := victim.local.popFront(); ok {
+			p.queued.Add(-1)
+			return t, true
+		}
+	}
+	return task{}, false
+}
+
+// park waits until new work is available. It returns false if the pool has
+// been closed.
+func (w *worker) park() bool {
+	p := w.pool
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.queued.Load() > 0 {
+		return true
+	}
+	if p.closed.Load() {
+		w.active = false
+		p.running--
+		return false
+	}
+	p.idle++
+	p.cond.Wait()
+	p.idle--
+	return true
+}
+
+// deque is a double-ended queue of tasks, safe for concurrent use.
+type deque struct {
+	mu    sync.Mutex
+	tasks []task
+	head  int
+}
+
+func (d *deque) pushBack(t task) {
+	d.mu.Lock()
+	d.tasks = append(d.tasks, t)
+	d.mu.Unlock()
+}
+
+func (d *deque) popBack() (task, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.head == len(d.tasks) {
+		return task{}, false
+	}
+	last := len(d.tasks) - 1
+	t := d.tasks[last]
+	d.tasks[last] = task{}
+	d.tasks = d.tasks[:last]
+	d.reset()
+	return t, true
+}
+
+func (d *deque) popFront() (task, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.head == len(d.tasks) {
+		return task{}, false
+	}
+	t := d.tasks[d.head]
+	d.tasks[d.head] = task{}
+	d.head++
+	d.reset()
+	return t, true
+}
+
+// reset reuses the backing array once the deque is empty.
+func (d *deque) reset() {
+	if d.head == len(d.tasks) {
+		d.head = 0
+		d.tasks = d.tasks[:0]
+	}
+}
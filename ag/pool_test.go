@@ -0,0 +1,146 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeque(t *testing.T) {
+	var d deque
+	ops := []*Operator{{}, {}, {}}
+	for _, op := range ops {
+		d.pushBack(task{op: op})
+	}
+
+	tk, ok := d.popBack()
+	require.True(t, ok)
+	assert.Same(t, ops[2], tk.op)
+
+	tk, ok = d.popFront()
+	require.True(t, ok)
+	assert.Same(t, ops[0], tk.op)
+
+	tk, ok = d.popFront()
+	require.True(t, ok)
+	assert.Same(t, ops[1], tk.op)
+
+	_, ok = d.popBack()
+	assert.False(t, ok)
+	_, ok = d.popFront()
+	assert.False(t, ok)
+	assert.Equal(t, 0, d.head)
+}
+
+func TestEngine_WorkerPool(t *testing.T) {
+	t.Run("float32", testEngineWorkerPool[float32])
+	t.Run("float64", testEngineWorkerPool[float64])
+}
+
+func testEngineWorkerPool[T float.DType](t *testing.T) {
+	const size = inlineThreshold // large enough not to be executed inline
+
+	run := func(e *Engine) (value, grad []float64) {
+		w := mat.NewDense[T](mat.WithShape(size), mat.WithBacking(mat.CreateInitializedSlice[T](size, 0.5)), mat.WithGrad(true))
+		x := e.Bind(mat.NewDense[T](mat.WithShape(size), mat.WithBacking(mat.CreateInitializedSlice[T](size, 1))))
+
+		// Many independent branches sharing the same leaf.
+		branches := make([]mat.Tensor, 32)
+		for i := range branches {
+			y := x
+			for j := 0; j < 8; j++ {
+				y = Add(ProdScalar(y, mat.Scalar[T](0.5)), Add(w, y))
+			}
+			branches[i] = y
+		}
+		out := ReduceSum(Sum(branches...))
+		require.NoError(t, Backward(out))
+		return out.Value().Data().F64(), w.Grad().Data().F64()
+	}
+
+	expectedValue, expectedGrad := run(NewEngine(WithSyncExecution(true)))
+
+	e := NewEngine(WithConcurrency(4))
+	defer e.Close()
+	for i := 0; i < 5; i++ {
+		value, grad := run(e)
+		// the gradients may be accumulated in a different order
+		assert.InDeltaSlice(t, expectedValue, value, 1e-3)
+		assert.InDeltaSlice(t, expectedGrad, grad, 1e-3)
+	}
+}
+
+func TestEngine_ConcurrentGraphs(t *testing.T) {
+	e := NewEngine(WithConcurrency(2))
+	defer e.Close()
+
+	const size = 2 * inlineThreshold
+	w := mat.NewDense[float64](mat.WithShape(size), mat.WithBacking(mat.CreateInitializedSlice[float64](size, 2)), mat.WithGrad(true))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			x := e.Bind(mat.NewDense[float64](mat.WithShape(size), mat.WithBacking(mat.CreateInitializedSlice[float64](size, 1))))
+			y := ReduceSum(Prod(Add(x, w), w))
+			assert.NoError(t, Backward(y))
+		}()
+	}
+	wg.Wait()
+
+	// dy/dw = x + 2w = 5, accumulated by each graph.
+	assert.Equal(t, mat.CreateInitializedSlice[float64](size, 40), mat.Data[float64](w.Grad()))
+}
+
+func TestEngine_Close(t *testing.T) {
+	e := NewEngine(WithConcurrency(2))
+	x := e.Bind(mat.NewDense[float64](mat.WithShape(2 * inlineThreshold)))
+
+	assert.Equal(t, 2*inlineThreshold, Add(x, x).Value().Size())
+	e.Close()
+	assert.Equal(t, 2*inlineThreshold, Add(x, x).Value().Size(), "the engine must be usable after Close")
+}
+
+func TestEngine_WorkerPanic(t *testing.T) {
+	e := NewEngine(WithConcurrency(2))
+	defer e.Close()
+
+	const size = 2 * inlineThreshold // large enough not to be executed inline
+	x := e.Bind(mat.NewDense[float64](mat.WithShape(size), mat.WithGrad(true)))
+
+	t.Run("forward", func(t *testing.T) {
+		f := &dummyFunction[float64, mat.Tensor]{
+			forward:  func() (mat.Tensor, error) { panic("forward failure") },
+			operands: func() []mat.Tensor { return []mat.Tensor{x} },
+		}
+		y := apply(f, true)
+		z := Add(y, x)
+		assert.PanicsWithValue(t, "forward failure", func() { y.Value() })
+		assert.PanicsWithValue(t, "forward failure", func() { z.Value() }, "the dependents must fail too")
+	})
+
+	t.Run("backward", func(t *testing.T) {
+		f := &dummyFunction[float64, mat.Tensor]{
+			forward:  func() (mat.Tensor, error) { return x.Value().(mat.Matrix).Clone(), nil },
+			backward: func(mat.Tensor) error { panic("backward failure") },
+			operands: func() []mat.Tensor { return []mat.Tensor{x} },
+		}
+		y := ReduceSum(Add(apply(f, true), x)).(*Operator)
+		err := Backward(y)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "backward failure")
+		assert.True(t, y.isBackwardIdle(), "a failed pass must not leave the graph pending")
+
+		// The workers keep running.
+		require.NoError(t, Backward(ReduceSum(Add(x, x))))
+	})
+}
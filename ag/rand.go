@@ -10,21 +10,20 @@ import (
 	"github.com/nlpodyssey/spago/mat/rand"
 )
 
-var globalGenerator = rand.NewLockedRand(12345)
-
-// Seed sets the seed for generating random numbers to the current time (converted to uint64).
+// Seed sets the seed of the default engine's random number generator to the current time (converted to uint64).
 func Seed() *rand.LockedRand {
-	globalGenerator.Seed(uint64(time.Now().UnixNano()))
-	return globalGenerator
+	defaultEngine.Seed(uint64(time.Now().UnixNano()))
+	return defaultEngine.rand
 }
 
-// ManualSeed sets the seed for generating random numbers.
+// ManualSeed sets the seed of the default engine's random number generator
+// (see Engine.Seed).
 func ManualSeed(seed uint64) *rand.LockedRand {
-	globalGenerator.Seed(seed)
-	return globalGenerator
+	defaultEngine.Seed(seed)
+	return defaultEngine.rand
 }
 
-// Rand returns the global random number generator.
+// Rand returns the random number generator of the default engine.
 func Rand() *rand.LockedRand {
-	return globalGenerator
+	return defaultEngine.rand
 }
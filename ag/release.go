@@ -0,0 +1,74 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"errors"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// errReleasedGraph is returned when back-propagating through a released graph.
+var errReleasedGraph = errors.New("ag: backward through a released graph")
+
+// ReleaseGraph releases the graph of operators the given outputs depend on,
+// so that it can be garbage collected even if the outputs are still in use.
+//
+// Each operator drops its gradients, the reference to its operands and the
+// function which computed it. The intermediate operators also drop their
+// values, while the outputs keep them. The leaves of the graph, such as the
+// parameters and the inputs, are left untouched.
+//
+// The released operators cannot take part in a backward pass anymore: all
+// the outputs sharing part of the graph must be released together, once they
+// are no longer needed. A backward pass reaching a released operator returns
+// an error, without propagating any gradient.
+func ReleaseGraph(outputs ...mat.Tensor) {
+	releaseGraph(filterOperators(outputs))
+}
+
+func releaseGraph(outputs []*Operator) {
+	isOutput := make(map[*Operator]struct{}, len(outputs))
+	for _, op := range outputs {
+		isOutput[op] = struct{}{}
+	}
+
+	visited := make(map[*Operator]struct{})
+	stack := append([]*Operator(nil), outputs...)
+	for len(stack) > 0 {
+		last := len(stack) - 1
+		op := stack[last]
+		stack = stack[:last]
+		if _, ok := visited[op]; ok || op.isReleased() {
+			continue
+		}
+		visited[op] = struct{}{}
+
+		for _, operand := range op.Operands() {
+			if oo, ok := operand.(*Operator); ok {
+				stack = append(stack, oo)
+			}
+		}
+		_, keepValue := isOutput[op]
+		op.release(keepValue)
+	}
+}
+
+// release drops the references held by the operator.
+func (o *Operator) release(keepValue bool) {
+	value := o.Value() // wait for the forward pass, if still running
+	value.ZeroGrad()
+	if !keepValue {
+		o.value = nil
+	}
+	o.Operands() // make sure the operands will not be memoized again
+	o.operands = nil
+	o.fn = nil
+}
+
+// isReleased reports whether the operator has been released.
+func (o *Operator) isReleased() bool {
+	return o.fn == nil
+}
@@ -0,0 +1,101 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackwardWith(t *testing.T) {
+	t.Run("float32", testBackwardWith[float32])
+	t.Run("float64", testBackwardWith[float64])
+}
+
+func testBackwardWith[T float.DType](t *testing.T) {
+	t.Run("retain graph with multiple losses", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		h := Prod(x, x)
+		loss1 := ReduceSum(h)
+		loss2 := ReduceSum(ProdScalar(h, mat.Scalar[T](3)))
+
+		require.NoError(t, BackwardWith([]mat.Tensor{loss1}, RetainGraph()))
+		assert.Equal(t, []T{2, 4}, mat.Data[T](x.Grad()))
+		assert.Nil(t, h.Grad(), "the gradients of the operators must be cleared")
+
+		require.NoError(t, BackwardWith([]mat.Tensor{loss2}, RetainGraph()))
+		assert.Equal(t, []T{8, 16}, mat.Data[T](x.Grad()))
+
+		require.NoError(t, BackwardWith([]mat.Tensor{loss1}, RetainGraph()))
+		assert.Equal(t, []T{10, 20}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("release graph", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		h := Prod(x, x).(*Operator)
+		loss := ReduceSum(h).(*Operator)
+
+		require.NoError(t, BackwardWith([]mat.Tensor{loss}))
+		assert.Equal(t, []T{2, 4}, mat.Data[T](x.Grad()))
+
+		assert.Nil(t, h.value)
+		assert.Nil(t, h.Operands())
+		assert.InDelta(t, 5, loss.Value().Item().F64(), 1e-6)
+		assert.Nil(t, loss.Operands())
+
+		assert.ErrorIs(t, Backward(loss), errReleasedGraph)
+		assert.Equal(t, []T{2, 4}, mat.Data[T](x.Grad()))
+	})
+
+	t.Run("backward through a released shared subgraph", func(t *testing.T) {
+		x := mat.NewDense[T](mat.WithBacking([]T{1, 2}), mat.WithGrad(true))
+		h := Exp(x)
+		loss1 := ReduceSum(h)
+		loss2 := ReduceSum(Prod(h, h)).(*Operator)
+
+		require.NoError(t, BackwardWith([]mat.Tensor{loss1}))
+		grad := append([]T(nil), mat.Data[T](x.Grad())...)
+
+		assert.ErrorIs(t, Backward(loss2), errReleasedGraph)
+		assert.Equal(t, grad, mat.Data[T](x.Grad()))
+		assert.True(t, loss2.isBackwardIdle(), "a failed pass must not leave the graph pending")
+		assert.Zero(t, loss2.pendingGrads)
+	})
+}
+
+func TestReleaseGraph(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithBacking([]float64{1, 2}), mat.WithGrad(true))
+	h := Exp(x).(*Operator)
+	y := ReduceSum(Add(h, h)).(*Operator)
+	require.NoError(t, Backward(y))
+	require.NotNil(t, h.Grad())
+
+	ReleaseGraph(y)
+	assert.True(t, h.isReleased())
+	assert.True(t, y.isReleased())
+	assert.Nil(t, h.value)
+	assert.NotNil(t, y.Value())
+	assert.Nil(t, y.Grad())
+	assert.NotNil(t, x.Grad(), "the leaves must be left untouched")
+
+	ReleaseGraph(y) // no effect
+}
+
+func TestBackward_MissingGradient(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithBacking([]float64{1, 2}), mat.WithGrad(true))
+	y := Prod(x, x).(*Operator)
+
+	assert.Error(t, Backward(y))
+	assert.True(t, y.isBackwardIdle(), "a failed pass must not leave the graph pending")
+	assert.Zero(t, y.pendingGrads)
+
+	y.AccGrad(mat.NewDense[float64](mat.WithBacking([]float64{1, 1})))
+	require.NoError(t, Backward(y))
+	assert.Equal(t, []float64{2, 4}, mat.Data[float64](x.Grad()))
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"sync/atomic"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/gradfn"
+	"github.com/nlpodyssey/spago/mat/rand"
+)
+
+// streamGraph assigns the random streams of the random operators of a
+// graph, in deterministic mode, in order of creation.
+type streamGraph struct {
+	// key identifies the graph (see Engine.BindStream).
+	key uint64
+	// bound reports whether the graph has been bound by Engine.BindStream,
+	// as opposed to the default graph of an engine.
+	bound bool
+	// n is the number of streams already assigned.
+	n atomic.Uint64
+}
+
+// streamBound is implemented by the tensors bound to a graph.
+type streamBound interface {
+	boundGraph() *streamGraph
+}
+
+// boundGraph returns the graph the operator is bound to, if any.
+func (o *Operator) boundGraph() *streamGraph {
+	return o.graph
+}
+
+// boundGraph returns the graph the matrix is bound to, if any.
+func (v *boundMatrix) boundGraph() *streamGraph {
+	return v.graph
+}
+
+// graphOf returns the graph of the first operand bound to a graph, or nil.
+func graphOf(operands []mat.Tensor) *streamGraph {
+	for _, operand := range operands {
+		if b, ok := operand.(streamBound); ok {
+			if g := b.boundGraph(); g != nil {
+				return g
+			}
+		}
+	}
+	return nil
+}
+
+// Stream returns the random number generator to be used by a new random
+// operator with the given operands.
+//
+// In deterministic mode (see Engine.SetDeterministic), it is a new stream of
+// a Philox generator, seeded by the engine, keyed by the position of the
+// operator in its graph: the key of the graph the operands are bound to (see
+// Engine.BindStream), and the number of streams already assigned in the same
+// graph. Otherwise, it is the random number generator of the engine of the
+// operands (see Engine.Rand).
+//
+// It must be called when the operator is created, not when it is executed.
+func Stream(operands ...mat.Tensor) *rand.LockedRand {
+	e := engineOf(operands)
+	if !e.Deterministic() {
+		return e.rand
+	}
+	g := graphOf(operands)
+	if g == nil {
+		g = &e.graph
+	}
+	p := rand.NewPhilox(e.seed.Load(), 0)
+	if g.bound {
+		p = rand.NewPhilox(e.seed.Load(), 1).Split(g.key)
+	}
+	return rand.NewLockedRandFromSource(p.Split(g.n.Add(1) - 1))
+}
+
+// BindStream is like Bind, and also binds x to a new graph identified by
+// the given key: in deterministic mode, the random operators of the graph
+// of the result draw from streams keyed by the key and by their position in
+// the graph (see Stream), regardless of the other graphs built concurrently
+// on the same engine.
+//
+// The key must be unique for each graph, e.g. derived from the training
+// step and from the index of the example in the batch.
+func (e *Engine) BindStream(x mat.Tensor, key uint64) mat.Tensor {
+	g := &streamGraph{key: key, bound: true}
+	if e.noGrad {
+		return &boundMatrix{Matrix: x.Value().(mat.Matrix), engine: e, graph: g}
+	}
+	o := e.NewOperator(gradfn.NewCopy(x))
+	o.graph = g
+	return o.Run()
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ag
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStream(t *testing.T) {
+	e := NewEngine(WithSeed(7))
+	x := e.Bind(mat.NewDense[float64](mat.WithShape(3, 1)))
+	assert.Same(t, e.Rand(), Stream(x), "the engine generator must be shared in nondeterministic mode")
+
+	e.SetDeterministic(true)
+	assert.True(t, e.Deterministic())
+	assert.NotSame(t, e.Rand(), Stream(x))
+	assert.True(t, newBackwardPass(e).inline, "the backward passes must be sequential in deterministic mode")
+}
+
+func TestEngine_Deterministic(t *testing.T) {
+	ones := mat.NewDense[float64](mat.WithShape(40, 1)).OnesLike()
+
+	t.Run("default graph", func(t *testing.T) {
+		e := NewEngine(WithDeterministic(true))
+		dropout := func() []float64 {
+			x := e.Bind(ones)
+			return Dropout(x, 0.5).Value().Data().F64()
+		}
+		e.Seed(3)
+		a1, a2 := dropout(), dropout()
+		assert.NotEqual(t, a1, a2)
+
+		e.Seed(3)
+		assert.Equal(t, a1, dropout(), "Seed must restart the assignment of the streams")
+		assert.Equal(t, a2, dropout())
+	})
+
+	t.Run("concurrent graphs", func(t *testing.T) {
+		run := func() ([][]float64, []float64) {
+			e := NewEngine(WithSeed(7), WithDeterministic(true), WithConcurrency(4))
+			defer e.Close()
+			w := mat.NewDense[float64](mat.WithShape(40, 1), mat.WithBacking(mat.CreateInitializedSlice(40, 0.1)), mat.WithGrad(true))
+
+			outputs := make([][]float64, 8)
+			losses := make([]mat.Tensor, len(outputs))
+			var wg sync.WaitGroup
+			for i := range outputs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					x := e.BindStream(ones, uint64(i))
+					h := Dropout(Add(x, w), 0.5)
+					y := Dropout(Prod(h, w), 0.3)
+					outputs[i] = y.Value().Data().F64()
+					losses[i] = ReduceSum(y)
+				}(i)
+			}
+			wg.Wait()
+
+			require.NoError(t, Backward(ReduceSum(Stack(losses...))))
+			return outputs, w.Grad().Data().F64()
+		}
+
+		outputs1, grad1 := run()
+		outputs2, grad2 := run()
+		assert.Equal(t, outputs1, outputs2)
+		assert.Equal(t, grad1, grad2)
+		assert.NotEqual(t, outputs1[0], outputs1[1], "each graph must draw from its own streams")
+	})
+}
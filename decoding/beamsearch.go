@@ -0,0 +1,232 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoding
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// Hypothesis is a sequence generated by the beam search.
+type Hypothesis struct {
+	// Tokens are the tokens of the sequence, without the EndToken.
+	Tokens []int
+	// LogProb is the sum of the log-probabilities of the tokens, including
+	// the EndToken, if the sequence is finished.
+	LogProb float64
+	// Score is the LogProb divided by the number of tokens, including the
+	// EndToken, raised to the LengthPenalty.
+	Score float64
+}
+
+// beam is a sequence being generated by the beam search.
+type beam[S any] struct {
+	tokens  []int
+	logProb float64
+	state   S
+}
+
+// candidate is a token following a beam.
+type candidate struct {
+	beam    int
+	token   int
+	logProb float64
+}
+
+// BeamSearch generates the sequences of highest scores, starting from the
+// given state, keeping at each step the BeamSize sequences of highest
+// log-probabilities, and returns the best BeamSize ones, in decreasing order
+// of score.
+//
+// A sequence is finished when the EndToken is among the BeamSize candidates
+// of highest log-probabilities, and the search stops when there are
+// BeamSize finished sequences and, without EarlyStopping, none of the other
+// ones can reach a higher score.
+func BeamSearch[S any](step StepFunc[S], state S, config Config) ([]Hypothesis, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	size := config.beamSize()
+	beams := []beam[S]{{state: state}}
+	var finished []Hypothesis
+
+	for length := 1; length <= config.MaxLength && len(beams) > 0; length++ {
+		var candidates []candidate
+		states := make([]S, len(beams))
+		for i, b := range beams {
+			token := config.StartToken
+			if len(b.tokens) > 0 {
+				token = b.tokens[len(b.tokens)-1]
+			}
+			var logits mat.Tensor
+			logits, states[i] = step(b.state, token)
+			logProbs := logSoftmax(config.scores(logits, b.tokens))
+			for _, t := range sortedIndices(logProbs)[:min(2*size, len(logProbs))] {
+				candidates = append(candidates, candidate{beam: i, token: t, logProb: b.logProb + logProbs[t]})
+			}
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].logProb > candidates[j].logProb
+		})
+
+		next := make([]beam[S], 0, size)
+		parents := make([]int, 0, size)
+		for rank, c := range candidates {
+			if len(next) == size {
+				break
+			}
+			if math.IsInf(c.logProb, -1) {
+				break
+			}
+			parent := beams[c.beam]
+			if c.token == config.EndToken {
+				if rank < size {
+					finished = append(finished, config.hypothesis(parent.tokens, c.logProb, len(parent.tokens)+1))
+				}
+				continue
+			}
+			tokens := make([]int, len(parent.tokens)+1)
+			copy(tokens, parent.tokens)
+			tokens[len(parent.tokens)] = c.token
+			next = append(next, beam[S]{tokens: tokens, logProb: c.logProb})
+			parents = append(parents, c.beam)
+		}
+		for i, s := range SelectBeams(states, parents) {
+			next[i].state = s
+		}
+		beams = next
+
+		if isDone(config, finished, beams) {
+			beams = nil
+		}
+	}
+
+	for _, b := range beams {
+		finished = append(finished, config.hypothesis(b.tokens, b.logProb, len(b.tokens)))
+	}
+	sort.SliceStable(finished, func(i, j int) bool {
+		return finished[i].Score > finished[j].Score
+	})
+	if len(finished) > size {
+		finished = finished[:size]
+	}
+	return finished, nil
+}
+
+// hypothesis returns a new Hypothesis of the given tokens and length, with
+// the length penalty applied to the log-probability.
+func (c Config) hypothesis(tokens []int, logProb float64, length int) Hypothesis {
+	return Hypothesis{
+		Tokens:  tokens,
+		LogProb: logProb,
+		Score:   c.normalize(logProb, length),
+	}
+}
+
+func (c Config) normalize(logProb float64, length int) float64 {
+	if c.LengthPenalty == 0 {
+		return logProb
+	}
+	return logProb / math.Pow(float64(length), c.LengthPenalty)
+}
+
+// isDone reports whether the beam search can stop, given the finished
+// sequences and the beams, in decreasing order of log-probability.
+func isDone[S any](c Config, finished []Hypothesis, beams []beam[S]) bool {
+	size := c.beamSize()
+	if len(finished) < size {
+		return false
+	}
+	if c.EarlyStopping || len(beams) == 0 {
+		return true
+	}
+	scores := make([]float64, len(finished))
+	for i, h := range finished {
+		scores[i] = h.Score
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(scores)))
+	worst := scores[size-1]
+
+	// The log-probabilities can only decrease, so the best score of the
+	// beams is the one of the best beam, at the length maximizing it.
+	best := beams[0]
+	length := len(best.tokens)
+	if c.LengthPenalty > 0 {
+		length = c.MaxLength
+	}
+	return c.normalize(best.logProb, length) <= worst
+}
+
+// SelectBeams returns the states of the given indices, e.g. the beams
+// selected at a step of a beam search. The state of the first occurrence of
+// each index is reused, while the ones of the following occurrences are
+// cloned, if they implement Clone() S, so that the given states must not be
+// used afterwards.
+func SelectBeams[S any](states []S, indices []int) []S {
+	selected := make([]S, len(indices))
+	used := make(map[int]bool, len(indices))
+	for i, index := range indices {
+		selected[i] = states[index]
+		if !used[index] {
+			used[index] = true
+			continue
+		}
+		if cloner, ok := any(states[index]).(interface{ Clone() S }); ok {
+			selected[i] = cloner.Clone()
+		}
+	}
+	return selected
+}
+
+// argMax returns the index of the highest score.
+func argMax(scores []float64) int {
+	best := 0
+	for i, s := range scores {
+		if s > scores[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// sortedIndices returns the indices of the values, in decreasing order of
+// value.
+func sortedIndices(values []float64) []int {
+	indices := make([]int, len(values))
+	for i := range indices {
+		indices[i] = i
+	}
+	sort.SliceStable(indices, func(i, j int) bool {
+		return values[indices[i]] > values[indices[j]]
+	})
+	return indices
+}
+
+// softmax returns the softmax of the scores.
+func softmax(scores []float64) []float64 {
+	logProbs := logSoftmax(scores)
+	probs := make([]float64, len(scores))
+	for i, lp := range logProbs {
+		probs[i] = math.Exp(lp)
+	}
+	return probs
+}
+
+// logSoftmax returns the log-softmax of the scores.
+func logSoftmax(scores []float64) []float64 {
+	maxScore := scores[argMax(scores)]
+	var sum float64
+	for _, s := range scores {
+		sum += math.Exp(s - maxScore)
+	}
+	logSum := maxScore + math.Log(sum)
+	logProbs := make([]float64, len(scores))
+	for i, s := range scores {
+		logProbs[i] = s - logSum
+	}
+	return logProbs
+}
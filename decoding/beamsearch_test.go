@@ -0,0 +1,146 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoding
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBeamSearch(t *testing.T) {
+	c := newTestConfig()
+	c.BeamSize = 2
+	hypotheses, err := BeamSearch(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	require.Len(t, hypotheses, 2)
+	// Unlike the greedy decoding, b is found.
+	assert.Equal(t, []int{tokenB}, hypotheses[0].Tokens)
+	assert.InDelta(t, math.Log(0.4*0.9), hypotheses[0].LogProb, 1.0e-9)
+	assert.InDelta(t, hypotheses[0].LogProb, hypotheses[0].Score, 1.0e-9)
+	assert.Equal(t, []int{tokenA}, hypotheses[1].Tokens)
+	assert.InDelta(t, math.Log(0.6*0.4), hypotheses[1].LogProb, 1.0e-9)
+
+	// A single beam is the greedy decoding.
+	c.BeamSize = 1
+	hypotheses, err = BeamSearch(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	require.Len(t, hypotheses, 1)
+	assert.Equal(t, []int{tokenA}, hypotheses[0].Tokens)
+}
+
+func TestBeamSearch_LengthPenalty(t *testing.T) {
+	c := newTestConfig()
+	c.BeamSize = 3
+	c.LengthPenalty = 1
+	hypotheses, err := BeamSearch(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	require.Len(t, hypotheses, 3)
+	for _, h := range hypotheses {
+		assert.InDelta(t, h.LogProb/float64(len(h.Tokens)+1), h.Score, 1.0e-9)
+	}
+	for i := 1; i < len(hypotheses); i++ {
+		assert.GreaterOrEqual(t, hypotheses[i-1].Score, hypotheses[i].Score)
+	}
+
+	// Without the end token, the sequences reach the maximum length.
+	c.EndToken = -1
+	hypotheses, err = BeamSearch(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	require.Len(t, hypotheses, 3)
+	for _, h := range hypotheses {
+		assert.Len(t, h.Tokens, 5)
+		assert.InDelta(t, h.LogProb/5, h.Score, 1.0e-9)
+	}
+}
+
+func TestBeamSearch_EarlyStopping(t *testing.T) {
+	steps := 0
+	step := func(state struct{}, token int) (mat.Tensor, struct{}) {
+		steps++
+		return toyStep(state, token)
+	}
+	c := newTestConfig()
+	c.BeamSize = 2
+	c.MaxLength = 20
+	c.EarlyStopping = true
+	hypotheses, err := BeamSearch(step, struct{}{}, c)
+	require.NoError(t, err)
+	assert.Len(t, hypotheses, 2)
+	early := steps
+
+	steps = 0
+	c.EarlyStopping = false
+	c.LengthPenalty = 2
+	_, err = BeamSearch(step, struct{}{}, c)
+	require.NoError(t, err)
+	assert.Less(t, early, steps, "favouring longer sequences, the search goes on")
+}
+
+// historyState is a mutable state recording the tokens of its beam.
+type historyState struct {
+	tokens []int
+}
+
+func (s *historyState) Clone() *historyState {
+	return &historyState{tokens: append([]int(nil), s.tokens...)}
+}
+
+// historyProbabilities returns the probabilities of the next token of a
+// language model depending on the whole history: each token is less
+// probable after it occurs.
+func historyProbabilities(tokens []int) []float64 {
+	weights := []float64{0.2, 1, 1, 0}
+	for i, t := range tokens {
+		weights[t] /= float64(2 + i)
+	}
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+	for i := range weights {
+		weights[i] /= sum
+	}
+	return weights
+}
+
+func TestBeamSearch_StateClone(t *testing.T) {
+	// The mutable states, cloned for each beam, give the same results of
+	// the immutable ones.
+	mutable := func(s *historyState, token int) (mat.Tensor, *historyState) {
+		s.tokens = append(s.tokens, token)
+		return logits(historyProbabilities(s.tokens[1:])), s
+	}
+	immutable := func(tokens []int, token int) (mat.Tensor, []int) {
+		next := append(append([]int(nil), tokens...), token)
+		return logits(historyProbabilities(next[1:])), next
+	}
+
+	c := newTestConfig()
+	c.BeamSize = 3
+	expected, err := BeamSearch(immutable, nil, c)
+	require.NoError(t, err)
+	actual, err := BeamSearch(mutable, &historyState{}, c)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Len(t, actual, 3)
+}
+
+func TestSelectBeams(t *testing.T) {
+	states := []*historyState{{tokens: []int{1}}, {tokens: []int{2}}}
+	beams := SelectBeams(states, []int{1, 1, 0})
+	require.Len(t, beams, 3)
+	assert.Same(t, states[1], beams[0])
+	assert.NotSame(t, states[1], beams[1])
+	assert.Equal(t, states[1], beams[1])
+	assert.Same(t, states[0], beams[2])
+
+	// The states not implementing Clone are shared.
+	shared := SelectBeams([][]int{{1}, {2}}, []int{0, 0})
+	assert.Equal(t, [][]int{{1}, {1}}, shared)
+}
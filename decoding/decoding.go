@@ -0,0 +1,225 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package decoding provides the generation of sequences of tokens with
+// models predicting one token at a time, such as recurrent networks and
+// Transformer decoders: greedy decoding, beam search and sampling.
+package decoding
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/rand"
+)
+
+// StepFunc performs a step of the decoding: given the state of the model and
+// the last token, it returns the scores (logits) of the next token, one for
+// each token of the vocabulary, and the state of the next step.
+//
+// The beam search passes the state of a beam to the steps of the beams
+// following it. If the state is mutated in place, e.g. a
+// transformer.KVCache, it must implement Clone() S, so that it is cloned
+// for each beam but the first one.
+type StepFunc[S any] func(state S, token int) (mat.Tensor, S)
+
+// Config provides the settings of the decoding.
+type Config struct {
+	// StartToken is the token of the first step, e.g. the beginning of
+	// sequence.
+	StartToken int
+	// EndToken is the token ending the sequences, e.g. the end of sequence,
+	// not included in the results. Negative means none.
+	EndToken int
+	// MinLength is the minimum number of tokens generated, before which the
+	// EndToken is never chosen.
+	MinLength int
+	// MaxLength is the maximum number of tokens generated. It must be
+	// positive.
+	MaxLength int
+	// RepetitionPenalty penalizes the tokens already generated, dividing
+	// their positive scores and multiplying the negative ones by it, as in
+	// CTRL. Zero means 1, no penalty.
+	RepetitionPenalty float64
+
+	// Temperature divides the scores of the sampling. Zero means 1.
+	Temperature float64
+	// TopK is the number of tokens of highest scores the sampling chooses
+	// from. Zero means all.
+	TopK int
+	// TopP is the minimum probability of the smallest set of tokens of
+	// highest scores the sampling chooses from (nucleus sampling). Zero
+	// means 1, all the tokens.
+	TopP float64
+
+	// BeamSize is the number of beams of the beam search. Zero means 1.
+	BeamSize int
+	// LengthPenalty is the exponent of the length dividing the scores of the
+	// sequences of the beam search, where larger values favour longer
+	// sequences. Zero means no normalization.
+	LengthPenalty float64
+	// EarlyStopping stops the beam search as soon as there are BeamSize
+	// finished sequences; otherwise, it stops when no beam can improve them.
+	EarlyStopping bool
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c Config) Validate() error {
+	switch {
+	case c.MaxLength <= 0:
+		return fmt.Errorf("decoding: the maximum length must be positive; found %d", c.MaxLength)
+	case c.MinLength < 0 || c.MinLength > c.MaxLength:
+		return fmt.Errorf("decoding: the minimum length must be in [0, %d]; found %d", c.MaxLength, c.MinLength)
+	case c.RepetitionPenalty < 0:
+		return fmt.Errorf("decoding: the repetition penalty must not be negative; found %g", c.RepetitionPenalty)
+	case c.Temperature < 0:
+		return fmt.Errorf("decoding: the temperature must not be negative; found %g", c.Temperature)
+	case c.TopK < 0:
+		return fmt.Errorf("decoding: top-k must not be negative; found %d", c.TopK)
+	case c.TopP < 0 || c.TopP > 1:
+		return fmt.Errorf("decoding: top-p must be in [0, 1]; found %g", c.TopP)
+	case c.BeamSize < 0:
+		return fmt.Errorf("decoding: the beam size must not be negative; found %d", c.BeamSize)
+	}
+	return nil
+}
+
+func (c Config) beamSize() int {
+	return max(c.BeamSize, 1)
+}
+
+// Greedy generates a sequence choosing the token of highest score at each
+// step, starting from the given state, and returns its tokens.
+func Greedy[S any](step StepFunc[S], state S, config Config) ([]int, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	var tokens []int
+	token := config.StartToken
+	for len(tokens) < config.MaxLength {
+		var logits mat.Tensor
+		logits, state = step(state, token)
+		scores := config.scores(logits, tokens)
+		token = argMax(scores)
+		if token == config.EndToken {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// Sample generates a sequence drawing each token from the distribution of
+// the scores, processed according to the temperature, top-k and top-p
+// settings, starting from the given state, and returns its tokens. The
+// tokens are drawn with the given random generator, so that a seeded one
+// gives reproducible results.
+func Sample[S any](step StepFunc[S], state S, config Config, rng *rand.LockedRand) ([]int, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if rng == nil {
+		return nil, fmt.Errorf("decoding: the sampling requires a random generator")
+	}
+	var tokens []int
+	token := config.StartToken
+	for len(tokens) < config.MaxLength {
+		var logits mat.Tensor
+		logits, state = step(state, token)
+		token = config.SampleToken(config.scores(logits, tokens), rng)
+		if token == config.EndToken {
+			break
+		}
+		tokens = append(tokens, token)
+	}
+	return tokens, nil
+}
+
+// scores returns the scores of the logits, with the repetition penalty of
+// the generated tokens, and without the EndToken before the MinLength.
+func (c Config) scores(logits mat.Tensor, generated []int) []float64 {
+	scores := append([]float64(nil), logits.Value().Data().F64()...)
+	if p := c.RepetitionPenalty; p != 0 && p != 1 {
+		penalized := make(map[int]bool, len(generated))
+		for _, t := range generated {
+			if penalized[t] {
+				continue
+			}
+			penalized[t] = true
+			if scores[t] > 0 {
+				scores[t] /= p
+			} else {
+				scores[t] *= p
+			}
+		}
+	}
+	if len(generated) < c.MinLength && c.EndToken >= 0 && c.EndToken < len(scores) {
+		scores[c.EndToken] = math.Inf(-1)
+	}
+	return scores
+}
+
+// SampleToken draws a token from the distribution of the given scores,
+// processed according to the temperature, top-k and top-p settings.
+func (c Config) SampleToken(scores []float64, rng *rand.LockedRand) int {
+	probs := c.probabilities(scores)
+	u := rng.Float64()
+	var cumulative float64
+	last := 0
+	for i, p := range probs {
+		if p == 0 {
+			continue
+		}
+		cumulative += p
+		last = i
+		if u < cumulative {
+			return i
+		}
+	}
+	return last // rounding errors
+}
+
+// probabilities returns the distribution of the scores divided by the
+// temperature, restricted to the top-k and top-p tokens.
+func (c Config) probabilities(scores []float64) []float64 {
+	temperature := c.Temperature
+	if temperature == 0 {
+		temperature = 1
+	}
+	scaled := make([]float64, len(scores))
+	for i, s := range scores {
+		scaled[i] = s / temperature
+	}
+	probs := softmax(scaled)
+
+	order := sortedIndices(probs)
+	keep := len(order)
+	if c.TopK > 0 {
+		keep = min(keep, c.TopK)
+	}
+	if c.TopP > 0 && c.TopP < 1 {
+		var cumulative float64
+		for i, index := range order[:keep] {
+			cumulative += probs[index]
+			if cumulative >= c.TopP {
+				keep = i + 1
+				break
+			}
+		}
+	}
+	if keep == len(order) {
+		return probs
+	}
+
+	var sum float64
+	for _, index := range order[:keep] {
+		sum += probs[index]
+	}
+	kept := make([]float64, len(probs))
+	for _, index := range order[:keep] {
+		kept[index] = probs[index] / sum
+	}
+	return kept
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package decoding
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tokens of the toy language model.
+const (
+	end = iota
+	tokenA
+	tokenB
+	start
+)
+
+// toyProbabilities are the probabilities of the next token of the toy
+// language model, given the last one: the most probable sequence, b, does
+// not start with the most probable token, a. The end token is followed by
+// the other ones, when it is not the end of the sequences.
+var toyProbabilities = map[int][]float64{
+	start:  {0, 0.6, 0.4, 0},
+	tokenA: {0.4, 0.3, 0.3, 0},
+	tokenB: {0.9, 0.05, 0.05, 0},
+	end:    {0.1, 0.45, 0.45, 0},
+}
+
+// toyStep is the StepFunc of the toy language model, with no state.
+func toyStep(state struct{}, token int) (mat.Tensor, struct{}) {
+	return logits(toyProbabilities[token]), state
+}
+
+func logits(probs []float64) mat.Tensor {
+	data := make([]float64, len(probs))
+	for i, p := range probs {
+		data[i] = math.Log(p)
+	}
+	return mat.NewDense[float64](mat.WithBacking(data))
+}
+
+func newTestConfig() Config {
+	return Config{
+		StartToken: start,
+		EndToken:   end,
+		MaxLength:  5,
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, newTestConfig().Validate())
+
+	invalid := map[string]func(c *Config){
+		"max length":         func(c *Config) { c.MaxLength = 0 },
+		"min length":         func(c *Config) { c.MinLength = 6 },
+		"repetition penalty": func(c *Config) { c.RepetitionPenalty = -1 },
+		"temperature":        func(c *Config) { c.Temperature = -0.5 },
+		"top-k":              func(c *Config) { c.TopK = -1 },
+		"top-p":              func(c *Config) { c.TopP = 1.5 },
+		"beam size":          func(c *Config) { c.BeamSize = -2 },
+	}
+	for name, update := range invalid {
+		c := newTestConfig()
+		update(&c)
+		assert.Error(t, c.Validate(), name)
+		_, err := Greedy(toyStep, struct{}{}, c)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestGreedy(t *testing.T) {
+	tokens, err := Greedy(toyStep, struct{}{}, newTestConfig())
+	require.NoError(t, err)
+	assert.Equal(t, []int{tokenA}, tokens)
+
+	// The end token is not chosen before the minimum length.
+	c := newTestConfig()
+	c.MinLength = 2
+	tokens, err = Greedy(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	assert.Equal(t, []int{tokenA, tokenA}, tokens)
+
+	// Without the end token, the maximum length is reached.
+	c = newTestConfig()
+	c.EndToken = -1
+	tokens, err = Greedy(toyStep, struct{}{}, c)
+	require.NoError(t, err)
+	assert.Len(t, tokens, 5)
+}
+
+func TestConfig_scores(t *testing.T) {
+	c := newTestConfig()
+	c.RepetitionPenalty = 2
+	c.MinLength = 4
+	scores := c.scores(mat.NewDense[float64](mat.WithBacking([]float64{1, 2, -1, 4})), []int{2, 1, 2})
+	assert.Equal(t, []float64{math.Inf(-1), 1, -2, 4}, scores)
+}
+
+func TestConfig_probabilities(t *testing.T) {
+	scores := []float64{math.Log(0.1), math.Log(0.5), math.Log(0.15), math.Log(0.25)}
+
+	assert.InDeltaSlice(t, []float64{0.1, 0.5, 0.15, 0.25}, Config{}.probabilities(scores), 1.0e-9)
+	assert.InDeltaSlice(t, []float64{0, 0.5 / 0.75, 0, 0.25 / 0.75}, Config{TopK: 2}.probabilities(scores), 1.0e-9)
+	assert.InDeltaSlice(t, []float64{0, 0.5 / 0.9, 0.15 / 0.9, 0.25 / 0.9}, Config{TopP: 0.8}.probabilities(scores), 1.0e-9)
+	assert.InDeltaSlice(t, []float64{0, 1, 0, 0}, Config{TopP: 0.4}.probabilities(scores), 1.0e-9)
+
+	// The temperature flattens or sharpens the distribution.
+	hot := Config{Temperature: 2}.probabilities(scores)
+	cold := Config{Temperature: 0.5}.probabilities(scores)
+	assert.Less(t, hot[1], 0.5)
+	assert.Greater(t, cold[1], 0.5)
+	assert.InDelta(t, 0.25/(0.01+0.25+0.0225+0.0625), cold[1], 1.0e-9)
+}
+
+func TestConfig_SampleToken(t *testing.T) {
+	scores := []float64{math.Log(0.1), math.Log(0.5), math.Log(0.15), math.Log(0.25)}
+	rng := rand.NewLockedRand(42)
+	const n = 20000
+	counts := make([]float64, len(scores))
+	for i := 0; i < n; i++ {
+		counts[Config{}.SampleToken(scores, rng)]++
+	}
+	for i := range counts {
+		counts[i] /= n
+	}
+	assert.InDeltaSlice(t, []float64{0.1, 0.5, 0.15, 0.25}, counts, 0.02)
+}
+
+func TestSample(t *testing.T) {
+	c := newTestConfig()
+	c.EndToken = -1
+	sample := func(seed uint64) []int {
+		tokens, err := Sample(toyStep, struct{}{}, c, rand.NewLockedRand(seed))
+		require.NoError(t, err)
+		return tokens
+	}
+	assert.Equal(t, sample(1), sample(1), "reproducible with the same seed")
+	samples := make(map[string]bool)
+	for seed := uint64(0); seed < 10; seed++ {
+		samples[fmt.Sprint(sample(seed))] = true
+	}
+	assert.Greater(t, len(samples), 1)
+
+	// Top-k 1 is the greedy decoding.
+	c = newTestConfig()
+	c.TopK = 1
+	tokens, err := Sample(toyStep, struct{}{}, c, rand.NewLockedRand(3))
+	require.NoError(t, err)
+	assert.Equal(t, []int{tokenA}, tokens)
+
+	_, err = Sample(toyStep, struct{}{}, c, nil)
+	assert.Error(t, err)
+}
@@ -20,10 +20,9 @@ func main() {
 	// print the result
 	fmt.Printf("c = %v (float%d)\n", c.Value(), c.Value().Item().BitSize())
 
-	c.AccGrad(mat.Scalar(T(0.5)))
-
-	if err := ag.Backward(c); err != nil {
-		log.Fatalf("error during Backward(): %v", err)
+	// back-propagate the gradient of c (dc = 0.5) to a and b
+	if err := ag.BackwardWithGrads([]mat.Tensor{c}, []mat.Tensor{mat.Scalar(T(0.5))}); err != nil {
+		log.Fatalf("error during BackwardWithGrads(): %v", err)
 	}
 
 	fmt.Printf("ga = %v\n", a.Grad())
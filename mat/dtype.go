@@ -0,0 +1,69 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// DType identifies the floating-point type of the values of a matrix.
+type DType int
+
+const (
+	// Float32 identifies float32 values.
+	Float32 DType = 32
+	// Float64 identifies float64 values.
+	Float64 DType = 64
+)
+
+// DTypeFor returns the DType corresponding to T.
+func DTypeFor[T float.DType]() DType {
+	switch any(T(0)).(type) {
+	case float32:
+		return Float32
+	default:
+		return Float64
+	}
+}
+
+// DTypeOf returns the DType of the values of the matrix.
+func DTypeOf(m Matrix) DType {
+	return DType(m.Data().BitSize())
+}
+
+// String returns the name of the type.
+func (t DType) String() string {
+	switch t {
+	case Float32:
+		return "float32"
+	case Float64:
+		return "float64"
+	default:
+		return fmt.Sprintf("DType(%d)", int(t))
+	}
+}
+
+// Convert returns a new matrix with the same shape of m, whose values are
+// converted to the given type. It returns a copy of m if it already has the
+// given type. The gradient of m, if any, is not copied.
+func Convert(m Matrix, dtype DType) Matrix {
+	switch dtype {
+	case Float32:
+		return convert[float32](m)
+	case Float64:
+		return convert[float64](m)
+	default:
+		panic(fmt.Sprintf("mat: unsupported dtype %v", dtype))
+	}
+}
+
+func convert[T float.DType](m Matrix) Matrix {
+	if DTypeOf(m) == DTypeFor[T]() {
+		return m.Clone()
+	}
+	return NewDense[T](WithShape(m.Shape()...), WithBacking(float.SliceValueOf[T](m.Data())))
+}
@@ -0,0 +1,34 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDTypeFor(t *testing.T) {
+	assert.Equal(t, Float32, DTypeFor[float32]())
+	assert.Equal(t, Float64, DTypeFor[float64]())
+	assert.Equal(t, "float32", Float32.String())
+	assert.Equal(t, "float64", Float64.String())
+}
+
+func TestConvert(t *testing.T) {
+	m := NewDense[float32](WithShape(2, 3), WithBacking([]float32{1, 2, 3, 4, 5, 6}))
+
+	c := Convert(m, Float64)
+	assert.Equal(t, Float64, DTypeOf(c))
+	assert.Equal(t, []int{2, 3}, c.Shape())
+	assert.Equal(t, []float64{1, 2, 3, 4, 5, 6}, Data[float64](c))
+
+	same := Convert(m, Float32)
+	assert.Equal(t, Float32, DTypeOf(same))
+	same.SetAt(Scalar[float32](42), 0, 0)
+	assert.Equal(t, float32(1), m.At(0, 0).Item().F32(), "the result must be a copy")
+
+	assert.Panics(t, func() { Convert(m, DType(16)) })
+}
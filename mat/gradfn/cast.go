@@ -0,0 +1,51 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// Cast is an operator to convert the values of x to another type.
+// The gradients are converted back to the type of x.
+type Cast[O mat.Tensor] struct {
+	x     O
+	dtype mat.DType
+}
+
+// NewCast returns a new Cast Function.
+func NewCast[O mat.Tensor](x O, dtype mat.DType) *Cast[O] {
+	return &Cast[O]{
+		x:     x,
+		dtype: dtype,
+	}
+}
+
+// Operands returns the list of operands.
+func (r *Cast[O]) Operands() []mat.Tensor {
+	return []mat.Tensor{r.x}
+}
+
+// Forward computes the output of the function.
+func (r *Cast[O]) Forward() (mat.Tensor, error) {
+	if r.dtype != mat.Float32 && r.dtype != mat.Float64 {
+		return nil, fmt.Errorf("fn: unsupported dtype %v", r.dtype)
+	}
+	return mat.Convert(r.x.Value().(mat.Matrix), r.dtype), nil
+}
+
+// Backward computes the backward pass.
+func (r *Cast[O]) Backward(gy mat.Tensor) error {
+	if !mat.SameDims(r.x.Value(), gy) {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	if r.x.RequiresGrad() {
+		xv := r.x.Value().(mat.Matrix)
+		r.x.AccGrad(mat.Convert(gy.(mat.Matrix), mat.DTypeOf(xv)))
+	}
+	return nil
+}
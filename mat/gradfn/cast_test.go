@@ -0,0 +1,52 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCast_Forward(t *testing.T) {
+	t.Run("float32 to float64", testCastForward[float32, float64])
+	t.Run("float64 to float32", testCastForward[float64, float32])
+	t.Run("float32 to float32", testCastForward[float32, float32])
+}
+
+func testCastForward[T, U float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithShape(2, 2), mat.WithBacking([]T{
+		0.1, 0.2,
+		-0.3, 0.5,
+	}), mat.WithGrad(true))
+
+	f := NewCast(x, mat.DTypeFor[U]())
+	assert.Equal(t, []mat.Tensor{x}, f.Operands())
+
+	y, err := f.Forward()
+	assert.Nil(t, err)
+	assert.Equal(t, []int{2, 2}, y.Shape())
+	assert.InDeltaSlice(t, []U{0.1, 0.2, -0.3, 0.5}, mat.Data[U](y), 1.0e-6)
+	assert.NotSame(t, x, y)
+
+	err = f.Backward(mat.NewDense[U](mat.WithShape(2, 2), mat.WithBacking([]U{
+		1.0, 0.5,
+		0.0, -1.0,
+	})))
+	assert.Nil(t, err)
+	assert.InDeltaSlice(t, []T{1.0, 0.5, 0.0, -1.0}, mat.Data[T](x.Grad()), 1.0e-6)
+}
+
+func TestCast_InvalidArguments(t *testing.T) {
+	x := mat.NewDense[float32](mat.WithShape(2, 2), mat.WithGrad(true))
+
+	_, err := NewCast(x, mat.DType(16)).Forward()
+	assert.Error(t, err)
+
+	err = NewCast(x, mat.Float64).Backward(mat.NewDense[float64](mat.WithShape(3, 1)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,246 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// CausalLinearAttention is an operator computing the linear attention of the
+// (positive) features of the queries qs over the ones of the keys k and over
+// the values v, one for each row, with the causal mask. The queries are the
+// last positions of the keys: the query i, at the position p of the keys,
+// only attends to the keys up to p, and its output is S_p^T q_i / (z_p·q_i),
+// where S_p is the sum of the outer products of the keys and the values up
+// to p, and z_p is the sum of the keys up to p.
+//
+// The prefix sums S_p and z_p are accumulated one position at a time, and
+// recomputed in the backward pass, so that the memory does not grow with the
+// length of the sequence. The result is a matrix with one column for each
+// query.
+type CausalLinearAttention[O mat.Tensor] struct {
+	qs []O
+	k  O
+	v  O
+}
+
+// NewCausalLinearAttention returns a new CausalLinearAttention Function.
+func NewCausalLinearAttention[O mat.Tensor](qs []O, k, v O) *CausalLinearAttention[O] {
+	return &CausalLinearAttention[O]{
+		qs: qs,
+		k:  k,
+		v:  v,
+	}
+}
+
+// Operands returns the list of operands: the queries, followed by the keys
+// and the values.
+func (r *CausalLinearAttention[O]) Operands() []mat.Tensor {
+	operands := make([]mat.Tensor, 0, len(r.qs)+2)
+	for _, q := range r.qs {
+		operands = append(operands, q)
+	}
+	return append(operands, r.k, r.v)
+}
+
+// Forward computes the output of the function.
+func (r *CausalLinearAttention[O]) Forward() (mat.Tensor, error) {
+	if err := r.checkOperands(); err != nil {
+		return nil, err
+	}
+	switch mat.DTypeOf(r.k.Value().(mat.Matrix)) {
+	case mat.Float32:
+		return causalLinearAttentionForward[float32](r), nil
+	default:
+		return causalLinearAttentionForward[float64](r), nil
+	}
+}
+
+// checkOperands returns an error if the shapes of the operands are not
+// compatible.
+func (r *CausalLinearAttention[O]) checkOperands() error {
+	kShape, vShape := r.k.Value().Shape(), r.v.Value().Shape()
+	if len(r.qs) == 0 || len(r.qs) > kShape[0] {
+		return fmt.Errorf("fn: CausalLinearAttention requires between 1 and %d queries, got %d", kShape[0], len(r.qs))
+	}
+	if vShape[0] != kShape[0] {
+		return fmt.Errorf("fn: CausalLinearAttention requires as many keys as values, got %d and %d", kShape[0], vShape[0])
+	}
+	for _, q := range r.qs {
+		if q.Value().Size() != kShape[1] {
+			return fmt.Errorf("fn: CausalLinearAttention requires queries of size %d, got %d", kShape[1], q.Value().Size())
+		}
+	}
+	return nil
+}
+
+// Backward computes the backward pass.
+func (r *CausalLinearAttention[O]) Backward(gy mat.Tensor) error {
+	if gy.Size() != r.v.Value().Shape()[1]*len(r.qs) {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	switch mat.DTypeOf(gy.(mat.Matrix)) {
+	case mat.Float32:
+		causalLinearAttentionBackward[float32](r, gy.(mat.Matrix))
+	default:
+		causalLinearAttentionBackward[float64](r, gy.(mat.Matrix))
+	}
+	return nil
+}
+
+// causalState holds the prefix sums of the keys and the values, S (dk × dv)
+// and z (dk), up to the current position.
+type causalState[T float.DType] struct {
+	s, z   []T
+	dk, dv int
+}
+
+func newCausalState[T float.DType](dk, dv int) *causalState[T] {
+	return &causalState[T]{
+		s:  make([]T, dk*dv),
+		z:  make([]T, dk),
+		dk: dk,
+		dv: dv,
+	}
+}
+
+// add accumulates the key k and the value v.
+func (c *causalState[T]) add(k, v []T) {
+	for i, ki := range k {
+		row := c.s[i*c.dv : (i+1)*c.dv]
+		for j, vj := range v {
+			row[j] += ki * vj
+		}
+		c.z[i] += ki
+	}
+}
+
+// attend returns the numerator S^T q and the denominator z·q of the output
+// of the query q.
+func (c *causalState[T]) attend(q, num []T) (den T) {
+	clear(num)
+	for i, qi := range q {
+		row := c.s[i*c.dv : (i+1)*c.dv]
+		for j, sij := range row {
+			num[j] += sij * qi
+		}
+		den += c.z[i] * qi
+	}
+	return den
+}
+
+func causalLinearAttentionForward[T float.DType, O mat.Tensor](r *CausalLinearAttention[O]) mat.Matrix {
+	k, v := mat.Data[T](r.k.Value()), mat.Data[T](r.v.Value())
+	rows, dk, dv := r.k.Value().Shape()[0], r.k.Value().Shape()[1], r.v.Value().Shape()[1]
+	n := len(r.qs)
+	prefix := rows - n
+
+	y := make([]T, dv*n)
+	num := make([]T, dv)
+	state := newCausalState[T](dk, dv)
+	for p := 0; p < rows; p++ {
+		state.add(k[p*dk:(p+1)*dk], v[p*dv:(p+1)*dv])
+		if p < prefix {
+			continue
+		}
+		i := p - prefix
+		den := state.attend(mat.Data[T](r.qs[i].Value()), num)
+		for j, numj := range num {
+			y[j*n+i] = numj / den
+		}
+	}
+	return mat.NewDense[T](mat.WithShape(dv, n), mat.WithBacking(y))
+}
+
+// causalLinearAttentionBackward recomputes the prefix sums position by
+// position to compute the gradients of the queries, and then accumulates the
+// gradients of the prefix sums from the last position backwards, to compute
+// the ones of the keys and the values.
+func causalLinearAttentionBackward[T float.DType, O mat.Tensor](r *CausalLinearAttention[O], gy mat.Matrix) {
+	k, v := mat.Data[T](r.k.Value()), mat.Data[T](r.v.Value())
+	rows, dk, dv := r.k.Value().Shape()[0], r.k.Value().Shape()[1], r.v.Value().Shape()[1]
+	n := len(r.qs)
+	prefix := rows - n
+	g := mat.Data[T](gy)
+
+	// The gradients of the numerator (gNum, dv for each query) and of the
+	// denominator (gDen) of each output.
+	gNum := make([]T, dv*n)
+	gDen := make([]T, n)
+	num := make([]T, dv)
+	state := newCausalState[T](dk, dv)
+	for p := 0; p < rows; p++ {
+		state.add(k[p*dk:(p+1)*dk], v[p*dv:(p+1)*dv])
+		if p < prefix {
+			continue
+		}
+		i := p - prefix
+		q := mat.Data[T](r.qs[i].Value())
+		den := state.attend(q, num)
+		a := gNum[i*dv : (i+1)*dv]
+		var gyNum T
+		for j := range a {
+			a[j] = g[j*n+i] / den
+			gyNum += g[j*n+i] * num[j]
+		}
+		gDen[i] = -gyNum / (den * den)
+
+		if !r.qs[i].RequiresGrad() {
+			continue
+		}
+		gq := make([]T, dk)
+		for ki := range gq {
+			row := state.s[ki*dv : (ki+1)*dv]
+			var sum T
+			for j, aj := range a {
+				sum += row[j] * aj
+			}
+			gq[ki] = sum + gDen[i]*state.z[ki]
+		}
+		r.qs[i].AccGrad(mat.NewDense[T](mat.WithShape(r.qs[i].Value().Shape()...), mat.WithBacking(gq)))
+	}
+
+	if !r.k.RequiresGrad() && !r.v.RequiresGrad() {
+		return
+	}
+	// The gradients of the prefix sums, accumulated over the queries at the
+	// current position and the following ones.
+	grad := newCausalState[T](dk, dv)
+	gk := make([]T, len(k))
+	gv := make([]T, len(v))
+	for p := rows - 1; p >= 0; p-- {
+		if p >= prefix {
+			i := p - prefix
+			a := gNum[i*dv : (i+1)*dv]
+			for ki, qk := range mat.Data[T](r.qs[i].Value()) {
+				row := grad.s[ki*dv : (ki+1)*dv]
+				for j, aj := range a {
+					row[j] += qk * aj
+				}
+				grad.z[ki] += gDen[i] * qk
+			}
+		}
+		kp, vp := k[p*dk:(p+1)*dk], v[p*dv:(p+1)*dv]
+		gkp, gvp := gk[p*dk:(p+1)*dk], gv[p*dv:(p+1)*dv]
+		for ki, kk := range kp {
+			row := grad.s[ki*dv : (ki+1)*dv]
+			var sum T
+			for j, sj := range row {
+				sum += sj * vp[j]
+				gvp[j] += sj * kk
+			}
+			gkp[ki] = sum + grad.z[ki]
+		}
+	}
+	if r.k.RequiresGrad() {
+		r.k.AccGrad(mat.NewDense[T](mat.WithShape(rows, dk), mat.WithBacking(gk)))
+	}
+	if r.v.RequiresGrad() {
+		r.v.AccGrad(mat.NewDense[T](mat.WithShape(rows, dv), mat.WithBacking(gv)))
+	}
+}
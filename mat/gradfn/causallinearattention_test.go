@@ -0,0 +1,123 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCausalLinearAttention(t *testing.T) {
+	for _, queries := range []int{4, 2} {
+		t.Run(fmt.Sprintf("%d queries", queries), func(t *testing.T) {
+			t.Run("float32", func(t *testing.T) { testCausalLinearAttention[float32](t, queries) })
+			t.Run("float64", func(t *testing.T) { testCausalLinearAttention[float64](t, queries) })
+		})
+	}
+}
+
+// testCausalLinearAttention compares the outputs with the ones of the sums
+// over the keys up to the position of each query, and the gradients with
+// the numerical ones.
+func testCausalLinearAttention[T float.DType](t *testing.T, queries int) {
+	const rows, dk, dv = 4, 3, 2
+	prefix := rows - queries
+	newData := func(size, seed int) []float64 {
+		data := make([]float64, size)
+		for i := range data {
+			data[i] = 0.1 + float64((i*7+seed*5)%11)/10
+		}
+		return data
+	}
+	qsData := make([][]float64, queries)
+	for i := range qsData {
+		qsData[i] = newData(dk, i)
+	}
+	kData, vData := newData(rows*dk, 7), newData(rows*dv, 8)
+	gy := newData(dv*queries, 9)
+
+	naive := func(qs [][]float64, k, v []float64) []float64 {
+		y := make([]float64, dv*queries)
+		for i, q := range qs {
+			var sum float64
+			for p := 0; p <= prefix+i; p++ {
+				var w float64
+				for d := 0; d < dk; d++ {
+					w += q[d] * k[p*dk+d]
+				}
+				sum += w
+				for j := 0; j < dv; j++ {
+					y[j*queries+i] += w * v[p*dv+j]
+				}
+			}
+			for j := 0; j < dv; j++ {
+				y[j*queries+i] /= sum
+			}
+		}
+		return y
+	}
+
+	qs := make([]mat.Tensor, queries)
+	for i, q := range qsData {
+		qs[i] = mat.NewDense[T](mat.WithShape(dk, 1), mat.WithBacking(float.SliceValueOf[T](float.Make(q...))), mat.WithGrad(true))
+	}
+	k := mat.NewDense[T](mat.WithShape(rows, dk), mat.WithBacking(float.SliceValueOf[T](float.Make(kData...))), mat.WithGrad(true))
+	v := mat.NewDense[T](mat.WithShape(rows, dv), mat.WithBacking(float.SliceValueOf[T](float.Make(vData...))), mat.WithGrad(true))
+
+	f := NewCausalLinearAttention(qs, mat.Tensor(k), mat.Tensor(v))
+	assert.Equal(t, append(append([]mat.Tensor{}, qs...), k, v), f.Operands())
+	y, err := f.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{dv, queries}, y.Shape())
+	assert.InDeltaSlice(t, naive(qsData, kData, vData), y.Data().F64(), 1.0e-5)
+
+	require.NoError(t, f.Backward(mat.NewDense[T](mat.WithShape(dv, queries), mat.WithBacking(float.SliceValueOf[T](float.Make(gy...))))))
+
+	// The numerical gradients of the sum of the outputs weighted by gy.
+	loss := func() float64 {
+		var sum float64
+		for i, yi := range naive(qsData, kData, vData) {
+			sum += yi * gy[i]
+		}
+		return sum
+	}
+	numerical := func(data []float64) []float64 {
+		const eps = 1.0e-6
+		grads := make([]float64, len(data))
+		for i := range data {
+			x := data[i]
+			data[i] = x + eps
+			plus := loss()
+			data[i] = x - eps
+			minus := loss()
+			data[i] = x
+			grads[i] = (plus - minus) / (2 * eps)
+		}
+		return grads
+	}
+	for i, q := range qsData {
+		assert.InDeltaSlice(t, numerical(q), qs[i].Grad().Data().F64(), 1.0e-4, "query %d", i)
+	}
+	assert.InDeltaSlice(t, numerical(kData), k.Grad().Data().F64(), 1.0e-4)
+	assert.InDeltaSlice(t, numerical(vData), v.Grad().Data().F64(), 1.0e-4)
+}
+
+func TestCausalLinearAttention_InvalidOperands(t *testing.T) {
+	var q, k, v mat.Tensor = mat.NewDense[float64](mat.WithShape(3, 1)),
+		mat.NewDense[float64](mat.WithShape(2, 3)),
+		mat.NewDense[float64](mat.WithShape(2, 2))
+
+	_, err := NewCausalLinearAttention([]mat.Tensor{q, q, q}, k, v).Forward()
+	assert.Error(t, err, "more queries than keys")
+	_, err = NewCausalLinearAttention([]mat.Tensor{q}, k, mat.Tensor(mat.NewDense[float64](mat.WithShape(3, 2)))).Forward()
+	assert.Error(t, err, "more values than keys")
+	_, err = NewCausalLinearAttention([]mat.Tensor{v}, k, v).Forward()
+	assert.Error(t, err, "query size")
+}
@@ -0,0 +1,541 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// PaddingMode specifies the values used to pad the inputs of a convolution.
+type PaddingMode int
+
+const (
+	// ZeroPadding pads the inputs with zeros.
+	ZeroPadding PaddingMode = iota
+	// ReflectPadding pads the inputs with the reflection of the values at
+	// the border, excluding the border itself: e.g. [c b | a b c d | c b].
+	ReflectPadding
+	// ReplicatePadding pads the inputs with the values at the border:
+	// e.g. [a a | a b c d | d d].
+	ReplicatePadding
+)
+
+// String returns the name of the padding mode.
+func (m PaddingMode) String() string {
+	switch m {
+	case ZeroPadding:
+		return "zero"
+	case ReflectPadding:
+		return "reflect"
+	case ReplicatePadding:
+		return "replicate"
+	default:
+		return fmt.Sprintf("PaddingMode(%d)", int(m))
+	}
+}
+
+// ConvConfig provides the settings of a convolution.
+type ConvConfig struct {
+	// StrideRows and StrideCols are the steps of the kernels along the rows
+	// and the columns of the inputs.
+	StrideRows int
+	StrideCols int
+	// DilationRows and DilationCols are the spacings between the elements
+	// of the kernels, along the rows and the columns; 1 means no dilation.
+	DilationRows int
+	DilationCols int
+	// PaddingRows and PaddingCols are the amounts of padding before and
+	// after the inputs, along the rows and the columns.
+	PaddingRows [2]int
+	PaddingCols [2]int
+	// PaddingMode specifies the values of the padding.
+	PaddingMode PaddingMode
+	// Groups is the number of groups the input and output channels are
+	// split into: each output channel only depends on the input channels
+	// of its group. It must divide the number of input and output channels.
+	Groups int
+}
+
+// DefaultConvConfig returns the configuration of a convolution with the given
+// strides, no dilation, no padding and a single group.
+func DefaultConvConfig(strideRows, strideCols int) ConvConfig {
+	return ConvConfig{
+		StrideRows:   strideRows,
+		StrideCols:   strideCols,
+		DilationRows: 1,
+		DilationCols: 1,
+		Groups:       1,
+	}
+}
+
+// Validate returns an error if the configuration is not valid, regardless of
+// the inputs.
+func (c ConvConfig) Validate() error {
+	return c.validate("convolution")
+}
+
+// ValidateInput returns an error if the convolution of inputs and kernels of
+// the given shapes is not defined: the reflect padding must be smaller than
+// the inputs, and the dilated kernels must fit in the padded inputs.
+func (c ConvConfig) ValidateInput(xRows, xCols, kRows, kCols int) error {
+	return c.validateInput("convolution", xRows, xCols, kRows, kCols)
+}
+
+// validate is Validate, with the errors reported for the operator op.
+func (c ConvConfig) validate(op string) error {
+	if c.StrideRows <= 0 || c.StrideCols <= 0 {
+		return fmt.Errorf("fn: %s requires positive strides, got %d and %d", op, c.StrideRows, c.StrideCols)
+	}
+	if c.DilationRows <= 0 || c.DilationCols <= 0 {
+		return fmt.Errorf("fn: %s requires positive dilations, got %d and %d", op, c.DilationRows, c.DilationCols)
+	}
+	if c.PaddingRows[0] < 0 || c.PaddingRows[1] < 0 || c.PaddingCols[0] < 0 || c.PaddingCols[1] < 0 {
+		return fmt.Errorf("fn: %s requires non-negative paddings, got %v and %v", op, c.PaddingRows, c.PaddingCols)
+	}
+	if c.PaddingMode < ZeroPadding || c.PaddingMode > ReplicatePadding {
+		return fmt.Errorf("fn: %s unsupported padding mode %v", op, c.PaddingMode)
+	}
+	if c.Groups <= 0 {
+		return fmt.Errorf("fn: %s requires a positive number of groups, got %d", op, c.Groups)
+	}
+	return nil
+}
+
+// validateInput is ValidateInput, with the errors reported for the operator op.
+func (c ConvConfig) validateInput(op string, xRows, xCols, kRows, kCols int) error {
+	if c.PaddingMode == ReflectPadding &&
+		(c.PaddingRows[0] >= xRows || c.PaddingRows[1] >= xRows || c.PaddingCols[0] >= xCols || c.PaddingCols[1] >= xCols) {
+		return fmt.Errorf("fn: %s reflect padding %v, %v must be smaller than the input %dx%d", op, c.PaddingRows, c.PaddingCols, xRows, xCols)
+	}
+	if outRows, outCols := c.OutputSize(xRows, xCols, kRows, kCols); outRows <= 0 || outCols <= 0 {
+		return fmt.Errorf("fn: %s dilated kernel %dx%d larger than the padded input %dx%d", op, kRows, kCols, xRows, xCols)
+	}
+	return nil
+}
+
+// OutputSize returns the number of rows and columns of each output channel,
+// given the shape of the inputs and of the kernels. They are not positive if
+// the padded inputs are smaller than the dilated kernels.
+func (c ConvConfig) OutputSize(xRows, xCols, kRows, kCols int) (rows, cols int) {
+	rows = (xRows+c.PaddingRows[0]+c.PaddingRows[1]-(kRows-1)*c.DilationRows-1)/c.StrideRows + 1
+	cols = (xCols+c.PaddingCols[0]+c.PaddingCols[1]-(kCols-1)*c.DilationCols-1)/c.StrideCols + 1
+	return rows, cols
+}
+
+// Conv2D is an operator to perform a 2D convolution (i.e. a cross-correlation)
+// of one or more input channels with a bank of kernels, based on im2col and
+// matrix multiplication.
+//
+// The input channels are split into ConvConfig.Groups groups of inG channels;
+// the kernel ws[o*inG+i] is applied to the input channel i of the group of
+// the output channel o. The output channel o is the sum of the convolutions
+// of the input channels of its group, flattened in row-major order: the
+// result is a matrix with one row for each output channel.
+type Conv2D[O mat.Tensor] struct {
+	xs     []O
+	ws     []O
+	config ConvConfig
+	op     string // the name of the operator in the errors
+	// initialized during the forward pass
+	geom    *convGeometry
+	cols    mat.Matrix // im2col of the inputs, (channels*kernelSize) × (outRows*outCols)
+	kernels mat.Matrix // the kernels, (outChannels) × (channels/groups*kernelSize)
+}
+
+// NewConv2D returns a new Conv2D Function.
+func NewConv2D[O mat.Tensor](xs, ws []O, config ConvConfig) *Conv2D[O] {
+	return &Conv2D[O]{
+		xs:     xs,
+		ws:     ws,
+		config: config,
+		op:     "Conv2D",
+	}
+}
+
+// Operands returns the list of operands: the inputs, followed by the kernels.
+func (r *Conv2D[O]) Operands() []mat.Tensor {
+	operands := make([]mat.Tensor, 0, len(r.xs)+len(r.ws))
+	for _, x := range r.xs {
+		operands = append(operands, x)
+	}
+	for _, w := range r.ws {
+		operands = append(operands, w)
+	}
+	return operands
+}
+
+// OutputShape returns the number of rows and columns of each output channel.
+// It is only available after the forward pass.
+func (r *Conv2D[O]) OutputShape() (rows, cols int) {
+	return r.geom.outRows, r.geom.outCols
+}
+
+// Forward computes the output of the function.
+func (r *Conv2D[O]) Forward() (mat.Tensor, error) {
+	if err := r.checkOperands(); err != nil {
+		return nil, err
+	}
+	switch mat.DTypeOf(r.xs[0].Value().(mat.Matrix)) {
+	case mat.Float32:
+		return conv2DForward[float32](r), nil
+	default:
+		return conv2DForward[float64](r), nil
+	}
+}
+
+// checkOperands validates the configuration and the shapes of the operands,
+// and sets the geometry of the convolution.
+func (r *Conv2D[O]) checkOperands() error {
+	if err := checkConvOperands(r.op, r.xs, r.ws, r.config); err != nil {
+		return err
+	}
+	geom, err := newConvGeometry(r.op, r.xs[0].Value().Shape(), r.ws[0].Value().Shape(), r.config)
+	if err != nil {
+		return err
+	}
+	r.geom = geom
+	return nil
+}
+
+// checkConvOperands validates the configuration, the number of the inputs
+// and of the kernels, and their shapes, for the operator op.
+func checkConvOperands[O mat.Tensor](op string, xs, ws []O, c ConvConfig) error {
+	if err := c.validate(op); err != nil {
+		return err
+	}
+	if len(xs) == 0 || len(xs)%c.Groups != 0 {
+		return fmt.Errorf("fn: %s requires a number of inputs multiple of the groups, got %d inputs and %d groups", op, len(xs), c.Groups)
+	}
+	inG := len(xs) / c.Groups
+	if len(ws) == 0 || len(ws)%(inG*c.Groups) != 0 {
+		return fmt.Errorf("fn: %s requires one kernel for each input channel of a group and output channel, got %d inputs, %d groups and %d kernels", op, len(xs), c.Groups, len(ws))
+	}
+	return checkSameShapes(xs, ws)
+}
+
+// checkSameShapes returns an error if the inputs, or the kernels, do not all
+// have the same shape.
+func checkSameShapes[O mat.Tensor](xs, ws []O) error {
+	xShape := xs[0].Value().Shape()
+	wShape := ws[0].Value().Shape()
+	for _, x := range xs {
+		if !sameShape(x.Value().Shape(), xShape) {
+			return fmt.Errorf("fn: convolution requires inputs of the same shape, got %v and %v", xShape, x.Value().Shape())
+		}
+	}
+	for _, w := range ws {
+		if !sameShape(w.Value().Shape(), wShape) {
+			return fmt.Errorf("fn: convolution requires kernels of the same shape, got %v and %v", wShape, w.Value().Shape())
+		}
+	}
+	return nil
+}
+
+// convGeometry describes which positions of the (padded) inputs of a
+// convolution are read by each element of the kernels, for each position
+// of the output.
+type convGeometry struct {
+	xRows, xCols     int
+	kRows, kCols     int
+	outRows, outCols int
+	rowsIdx          []int // for each kernel row and output row, the input row, or -1 for zero padding
+	colsIdx          []int // for each kernel column and output column, the input column, or -1 for zero padding
+}
+
+// newConvGeometry returns the geometry of a convolution of inputs and kernels
+// of the given shapes, performed by the operator op.
+func newConvGeometry(op string, xShape, wShape []int, c ConvConfig) (*convGeometry, error) {
+	if err := c.validateInput(op, xShape[0], xShape[1], wShape[0], wShape[1]); err != nil {
+		return nil, err
+	}
+	outRows, outCols := c.OutputSize(xShape[0], xShape[1], wShape[0], wShape[1])
+	return &convGeometry{
+		xRows:   xShape[0],
+		xCols:   xShape[1],
+		kRows:   wShape[0],
+		kCols:   wShape[1],
+		outRows: outRows,
+		outCols: outCols,
+		rowsIdx: paddedIndices(wShape[0], outRows, xShape[0], c.StrideRows, c.DilationRows, c.PaddingRows[0], c.PaddingMode),
+		colsIdx: paddedIndices(wShape[1], outCols, xShape[1], c.StrideCols, c.DilationCols, c.PaddingCols[0], c.PaddingMode),
+	}, nil
+}
+
+// paddedIndices returns, for each kernel position k and output position o,
+// the index at k*outSize+o of the input position it reads from, or -1 if it
+// is a zero of the padding.
+func paddedIndices(kSize, outSize, inSize, stride, dilation, before int, mode PaddingMode) []int {
+	idx := make([]int, kSize*outSize)
+	for k := 0; k < kSize; k++ {
+		for o := 0; o < outSize; o++ {
+			p := o*stride + k*dilation - before
+			if p < 0 || p >= inSize {
+				switch mode {
+				case ReflectPadding:
+					if p < 0 {
+						p = -p
+					} else {
+						p = 2*(inSize-1) - p
+					}
+				case ReplicatePadding:
+					p = min(max(p, 0), inSize-1)
+				default:
+					p = -1
+				}
+			}
+			idx[k*outSize+o] = p
+		}
+	}
+	return idx
+}
+
+// im2col returns the data of the matrix whose row c*kSize+i*kCols+j holds,
+// for each output position, the value of the input channel c read by the
+// element (i, j) of the kernel.
+func im2col[T float.DType](g *convGeometry, xs [][]T) []T {
+	kSize := g.kRows * g.kCols
+	n := g.outRows * g.outCols
+	cols := make([]T, len(xs)*kSize*n)
+	for c, xd := range xs {
+		for i := 0; i < g.kRows; i++ {
+			for j := 0; j < g.kCols; j++ {
+				row := cols[(c*kSize+i*g.kCols+j)*n:]
+				rowsIdx := g.rowsIdx[i*g.outRows : (i+1)*g.outRows]
+				colsIdx := g.colsIdx[j*g.outCols : (j+1)*g.outCols]
+				p := 0
+				for _, xr := range rowsIdx {
+					for _, xc := range colsIdx {
+						if xr >= 0 && xc >= 0 {
+							row[p] = xd[xr*g.xCols+xc]
+						}
+						p++
+					}
+				}
+			}
+		}
+	}
+	return cols
+}
+
+// col2im is the adjoint of im2col: it returns the input channel c whose
+// elements are the sums of the values of the rows of cols of the channel,
+// at the positions read from by im2col.
+func col2im[T float.DType](g *convGeometry, cols []T, c int) []T {
+	kSize := g.kRows * g.kCols
+	n := g.outRows * g.outCols
+	x := make([]T, g.xRows*g.xCols)
+	for i := 0; i < g.kRows; i++ {
+		for j := 0; j < g.kCols; j++ {
+			row := cols[(c*kSize+i*g.kCols+j)*n:]
+			rowsIdx := g.rowsIdx[i*g.outRows : (i+1)*g.outRows]
+			colsIdx := g.colsIdx[j*g.outCols : (j+1)*g.outCols]
+			p := 0
+			for _, xr := range rowsIdx {
+				for _, xc := range colsIdx {
+					if xr >= 0 && xc >= 0 {
+						x[xr*g.xCols+xc] += row[p]
+					}
+					p++
+				}
+			}
+		}
+	}
+	return x
+}
+
+// Backward computes the backward pass.
+func (r *Conv2D[O]) Backward(gy mat.Tensor) error {
+	if gy.Size() != r.outChannels()*r.geom.outRows*r.geom.outCols {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	switch mat.DTypeOf(r.kernels) {
+	case mat.Float32:
+		conv2DBackward[float32](r, gy.(mat.Matrix))
+	default:
+		conv2DBackward[float64](r, gy.(mat.Matrix))
+	}
+	return nil
+}
+
+func (r *Conv2D[O]) outChannels() int {
+	return len(r.ws) / (len(r.xs) / r.config.Groups)
+}
+
+// conv2DForward computes the im2col matrix of the inputs and the matrix of
+// the kernels, one row for each output channel, and returns their product.
+func conv2DForward[T float.DType, O mat.Tensor](r *Conv2D[O]) mat.Matrix {
+	g := r.geom
+	kSize := g.kRows * g.kCols
+	n := g.outRows * g.outCols
+	r.cols = mat.NewDense[T](mat.WithShape(len(r.xs)*kSize, n), mat.WithBacking(im2col(g, dataOf[T](r.xs))))
+	r.kernels = kernelsMatrix[T](r.ws, r.outChannels())
+	return groupedMul[T](r.kernels, r.cols, r.config.Groups, false)
+}
+
+// conv2DBackward accumulates the gradients of the kernels and of the inputs.
+func conv2DBackward[T float.DType, O mat.Tensor](r *Conv2D[O], gy mat.Matrix) {
+	g := r.geom
+	outChannels := r.outChannels()
+	n := g.outRows * g.outCols
+	gyMat := mat.NewDense[T](mat.WithShape(outChannels, n), mat.WithBacking(mat.Data[T](gy)))
+
+	if anyRequiresGrad(r.ws) {
+		accKernelsGrad[T](r.ws, groupedMulT[T](gyMat, r.cols, r.config.Groups), g)
+	}
+	if anyRequiresGrad(r.xs) {
+		gCols := mat.Data[T](groupedMul[T](r.kernels, gyMat, r.config.Groups, true))
+		for c, x := range r.xs {
+			if x.RequiresGrad() {
+				x.AccGrad(mat.NewDense[T](mat.WithShape(g.xRows, g.xCols), mat.WithBacking(col2im(g, gCols, c))))
+			}
+		}
+	}
+}
+
+// dataOf returns the data of the values of the tensors.
+func dataOf[T float.DType, O mat.Tensor](xs []O) [][]T {
+	data := make([][]T, len(xs))
+	for i, x := range xs {
+		data[i] = mat.Data[T](x.Value())
+	}
+	return data
+}
+
+// kernelsMatrix returns the matrix of the kernels, with rows rows: each row
+// is the concatenation of len(ws)/rows flattened kernels.
+func kernelsMatrix[T float.DType, O mat.Tensor](ws []O, rows int) mat.Matrix {
+	kSize := ws[0].Value().Size()
+	data := make([]T, len(ws)*kSize)
+	for k, w := range ws {
+		copy(data[k*kSize:], mat.Data[T](w.Value()))
+	}
+	return mat.NewDense[T](mat.WithShape(rows, len(data)/rows), mat.WithBacking(data))
+}
+
+// accKernelsGrad accumulates the gradients of the kernels, given the matrix
+// of the gradients with the same layout of kernelsMatrix.
+func accKernelsGrad[T float.DType, O mat.Tensor](ws []O, gw mat.Matrix, g *convGeometry) {
+	kSize := g.kRows * g.kCols
+	data := mat.Data[T](gw)
+	for k, w := range ws {
+		if w.RequiresGrad() {
+			w.AccGrad(mat.NewDense[T](mat.WithShape(g.kRows, g.kCols), mat.WithBacking(data[k*kSize:(k+1)*kSize])))
+		}
+	}
+}
+
+// groupedMul returns the product of the block-diagonal matrix whose groups
+// blocks are the bands of rows of a, by b, i.e. the concatenation of the
+// rows of the products of the corresponding bands of rows of a and b.
+// If transposeA is true, each band of a is transposed.
+func groupedMul[T float.DType](a, b mat.Matrix, groups int, transposeA bool) mat.Matrix {
+	if groups == 1 {
+		if transposeA {
+			return a.T().Mul(b)
+		}
+		return a.Mul(b)
+	}
+	aG, bG := a.Shape()[0]/groups, b.Shape()[0]/groups
+	var data []T
+	for g := 0; g < groups; g++ {
+		ag := rowsOf[T](a, g*aG, aG)
+		if transposeA {
+			ag = ag.T()
+		}
+		data = append(data, mat.Data[T](ag.Mul(rowsOf[T](b, g*bG, bG)))...)
+	}
+	rows := a.Shape()[0]
+	if transposeA {
+		rows = a.Shape()[1] * groups
+	}
+	return mat.NewDense[T](mat.WithShape(rows, b.Shape()[1]), mat.WithBacking(data))
+}
+
+// groupedMulT returns the concatenation of the rows of the products of the
+// bands of rows of a by the transposed corresponding bands of rows of b.
+func groupedMulT[T float.DType](a, b mat.Matrix, groups int) mat.Matrix {
+	if groups == 1 {
+		return a.Mul(b.T())
+	}
+	aG, bG := a.Shape()[0]/groups, b.Shape()[0]/groups
+	var data []T
+	for g := 0; g < groups; g++ {
+		data = append(data, mat.Data[T](rowsOf[T](a, g*aG, aG).Mul(rowsOf[T](b, g*bG, bG).T()))...)
+	}
+	return mat.NewDense[T](mat.WithShape(a.Shape()[0], bG), mat.WithBacking(data))
+}
+
+// rowsOf returns a view of count rows of m, starting from the row from.
+func rowsOf[T float.DType](m mat.Matrix, from, count int) mat.Matrix {
+	cols := m.Shape()[1]
+	return mat.NewDense[T](mat.WithShape(count, cols), mat.WithBacking(mat.Data[T](m)[from*cols:(from+count)*cols]))
+}
+
+// Conv1D is an operator to perform a 1D convolution of one or more input
+// channels with a bank of kernels, sliding along the columns only: each
+// kernel has as many rows as the inputs. See Conv2D.
+//
+// The settings of the configuration along the rows are ignored. Unlike
+// Conv2D, the result has one column for each output channel.
+type Conv1D[O mat.Tensor] struct {
+	*Conv2D[O]
+}
+
+// NewConv1D returns a new Conv1D Function.
+func NewConv1D[O mat.Tensor](xs, ws []O, config ConvConfig) *Conv1D[O] {
+	config.StrideRows = 1
+	config.DilationRows = 1
+	config.PaddingRows = [2]int{}
+	f := NewConv2D(xs, ws, config)
+	f.op = "Conv1D"
+	return &Conv1D[O]{
+		Conv2D: f,
+	}
+}
+
+// Forward computes the output of the function.
+func (r *Conv1D[O]) Forward() (mat.Tensor, error) {
+	if len(r.xs) > 0 && len(r.ws) > 0 && r.xs[0].Value().Shape()[0] != r.ws[0].Value().Shape()[0] {
+		return nil, fmt.Errorf("fn: Conv1D requires kernels with the same number of rows of the inputs")
+	}
+	y, err := r.Conv2D.Forward()
+	if err != nil {
+		return nil, err
+	}
+	return y.(mat.Matrix).T(), nil
+}
+
+// Backward computes the backward pass.
+func (r *Conv1D[O]) Backward(gy mat.Tensor) error {
+	outChannels := r.outChannels()
+	if gy.Size() != outChannels*r.geom.outCols {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	return r.Conv2D.Backward(gy.(mat.Matrix).Reshape(r.geom.outCols, outChannels).T())
+}
+
+func sameShape(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func anyRequiresGrad[O mat.Tensor](xs []O) bool {
+	for _, x := range xs {
+		if x.RequiresGrad() {
+			return true
+		}
+	}
+	return false
+}
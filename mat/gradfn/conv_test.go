@@ -0,0 +1,311 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// naiveConv2D computes the output of Conv2D by definition, padding the
+// inputs explicitly.
+func naiveConv2D(xs, ws [][]float64, xRows, xCols, kRows, kCols int, c ConvConfig) []float64 {
+	pRows := xRows + c.PaddingRows[0] + c.PaddingRows[1]
+	pCols := xCols + c.PaddingCols[0] + c.PaddingCols[1]
+	padded := make([][]float64, len(xs))
+	for ch, x := range xs {
+		padded[ch] = make([]float64, pRows*pCols)
+		for i := 0; i < pRows; i++ {
+			for j := 0; j < pCols; j++ {
+				r, ok1 := naivePad(i-c.PaddingRows[0], xRows, c.PaddingMode)
+				s, ok2 := naivePad(j-c.PaddingCols[0], xCols, c.PaddingMode)
+				if ok1 && ok2 {
+					padded[ch][i*pCols+j] = x[r*xCols+s]
+				}
+			}
+		}
+	}
+
+	outRows := (pRows-(kRows-1)*c.DilationRows-1)/c.StrideRows + 1
+	outCols := (pCols-(kCols-1)*c.DilationCols-1)/c.StrideCols + 1
+	inG := len(xs) / c.Groups
+	outChannels := len(ws) / inG
+	outG := outChannels / c.Groups
+	y := make([]float64, outChannels*outRows*outCols)
+	for o := 0; o < outChannels; o++ {
+		for ci := 0; ci < inG; ci++ {
+			x := padded[o/outG*inG+ci]
+			w := ws[o*inG+ci]
+			for or := 0; or < outRows; or++ {
+				for oc := 0; oc < outCols; oc++ {
+					for i := 0; i < kRows; i++ {
+						for j := 0; j < kCols; j++ {
+							xi := (or*c.StrideRows+i*c.DilationRows)*pCols + oc*c.StrideCols + j*c.DilationCols
+							y[o*outRows*outCols+or*outCols+oc] += x[xi] * w[i*kCols+j]
+						}
+					}
+				}
+			}
+		}
+	}
+	return y
+}
+
+// naivePad returns the position of the input corresponding to the position p
+// of the padded input, and whether it is not a zero of the padding.
+func naivePad(p, size int, mode PaddingMode) (int, bool) {
+	switch {
+	case p >= 0 && p < size:
+		return p, true
+	case mode == ReflectPadding && p < 0:
+		return -p, true
+	case mode == ReflectPadding:
+		return size - 2 - (p - size), true
+	case mode == ReplicatePadding && p < 0:
+		return 0, true
+	case mode == ReplicatePadding:
+		return size - 1, true
+	default:
+		return 0, false
+	}
+}
+
+// numericalGrads returns the gradients of sum(naiveConv2D(xs, ws) * gy) with
+// respect to the inputs and the kernels, computed by central differences.
+func numericalGrads(xs, ws [][]float64, xRows, xCols, kRows, kCols int, c ConvConfig, gy []float64) (gxs, gws [][]float64) {
+	const eps = 1.0e-6
+	loss := func() float64 {
+		var sum float64
+		for i, v := range naiveConv2D(xs, ws, xRows, xCols, kRows, kCols, c) {
+			sum += v * gy[i]
+		}
+		return sum
+	}
+	grads := func(vs [][]float64) [][]float64 {
+		gs := make([][]float64, len(vs))
+		for k, v := range vs {
+			gs[k] = make([]float64, len(v))
+			for i := range v {
+				orig := v[i]
+				v[i] = orig + eps
+				plus := loss()
+				v[i] = orig - eps
+				minus := loss()
+				v[i] = orig
+				gs[k][i] = (plus - minus) / (2 * eps)
+			}
+		}
+		return gs
+	}
+	return grads(xs), grads(ws)
+}
+
+func TestConv2D(t *testing.T) {
+	t.Run("float32", testConv2D[float32])
+	t.Run("float64", testConv2D[float64])
+}
+
+func testConv2D[T float.DType](t *testing.T) {
+	testConv2DWithConfig[T](t, 2, 3, 5, 6, 3, 2, DefaultConvConfig(2, 1))
+}
+
+func TestConv2D_Config(t *testing.T) {
+	modes := []PaddingMode{ZeroPadding, ReflectPadding, ReplicatePadding}
+	for _, mode := range modes {
+		for _, dilation := range []int{1, 2} {
+			for _, groups := range []int{1, 2} {
+				for _, stride := range []int{1, 2} {
+					c := ConvConfig{
+						StrideRows:   stride,
+						StrideCols:   1,
+						DilationRows: dilation,
+						DilationCols: 1,
+						PaddingRows:  [2]int{2, 1},
+						PaddingCols:  [2]int{0, 3},
+						PaddingMode:  mode,
+						Groups:       groups,
+					}
+					name := fmt.Sprintf("%v padding, dilation %d, groups %d, stride %d", mode, dilation, groups, stride)
+					t.Run(name, func(t *testing.T) {
+						t.Run("float32", func(t *testing.T) { testConv2DWithConfig[float32](t, 4, 6, 5, 6, 3, 2, c) })
+						t.Run("float64", func(t *testing.T) { testConv2DWithConfig[float64](t, 4, 6, 5, 6, 3, 2, c) })
+					})
+				}
+			}
+		}
+	}
+}
+
+func testConv2DWithConfig[T float.DType](t *testing.T, inChannels, outChannels, xRows, xCols, kRows, kCols int, c ConvConfig) {
+	xsData := make([][]float64, inChannels)
+	for ch := range xsData {
+		xsData[ch] = make([]float64, xRows*xCols)
+		for i := range xsData[ch] {
+			xsData[ch][i] = float64((i*7+ch*3)%11)/10 - 0.5
+		}
+	}
+	wsData := make([][]float64, outChannels*inChannels/c.Groups)
+	for k := range wsData {
+		wsData[k] = make([]float64, kRows*kCols)
+		for i := range wsData[k] {
+			wsData[k][i] = float64((i*5+k*2)%7)/10 - 0.3
+		}
+	}
+	outRows, outCols := c.OutputSize(xRows, xCols, kRows, kCols)
+	gyData := make([]float64, outChannels*outRows*outCols)
+	for i := range gyData {
+		gyData[i] = float64(i%5)/4 - 0.5
+	}
+
+	xs := make([]mat.Tensor, len(xsData))
+	for i, d := range xsData {
+		xs[i] = mat.NewDense[T](mat.WithShape(xRows, xCols), mat.WithBacking(float.SliceValueOf[T](float.Make(d...))), mat.WithGrad(true))
+	}
+	ws := make([]mat.Tensor, len(wsData))
+	for i, d := range wsData {
+		ws[i] = mat.NewDense[T](mat.WithShape(kRows, kCols), mat.WithBacking(float.SliceValueOf[T](float.Make(d...))), mat.WithGrad(true))
+	}
+	ws[1].(mat.Matrix).SetRequiresGrad(false)
+
+	f := NewConv2D(xs, ws, c)
+	assert.Equal(t, append(append([]mat.Tensor{}, xs...), ws...), f.Operands())
+
+	y, err := f.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{outChannels, outRows * outCols}, y.Shape())
+	rows, cols := f.OutputShape()
+	assert.Equal(t, outRows, rows)
+	assert.Equal(t, outCols, cols)
+
+	expectedY := naiveConv2D(xsData, wsData, xRows, xCols, kRows, kCols, c)
+	assert.InDeltaSlice(t, expectedY, y.Data().F64(), 1.0e-5)
+
+	err = f.Backward(mat.NewDense[T](mat.WithShape(outChannels, outRows*outCols), mat.WithBacking(float.SliceValueOf[T](float.Make(gyData...)))))
+	require.NoError(t, err)
+	expectedGxs, expectedGws := numericalGrads(xsData, wsData, xRows, xCols, kRows, kCols, c, gyData)
+	for i, x := range xs {
+		assert.InDeltaSlice(t, expectedGxs[i], x.Grad().Data().F64(), 1.0e-4)
+	}
+	for i, w := range ws {
+		if i == 1 {
+			assert.False(t, w.(mat.Matrix).HasGrad())
+			continue
+		}
+		assert.InDeltaSlice(t, expectedGws[i], w.Grad().Data().F64(), 1.0e-4)
+	}
+}
+
+func TestConv1D(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(2, 5), mat.WithBacking([]float64{
+		1, 2, 3, 4, 5,
+		6, 7, 8, 9, 10,
+	}), mat.WithGrad(true))
+	w1 := mat.NewDense[float64](mat.WithShape(2, 3), mat.WithBacking([]float64{
+		1, 0, 0,
+		0, 0, 1,
+	}), mat.WithGrad(true))
+	w2 := mat.NewDense[float64](mat.WithShape(2, 3), mat.WithBacking([]float64{
+		0, 1, 0,
+		0, 0, 0,
+	}), mat.WithGrad(true))
+
+	f := NewConv1D([]mat.Tensor{x}, []mat.Tensor{w1, w2}, DefaultConvConfig(1, 2))
+	y, err := f.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 2}, y.Shape(), "one column for each output channel")
+	assert.Equal(t, []float64{
+		1 + 8, 2,
+		3 + 10, 4,
+	}, y.Data().F64())
+
+	err = f.Backward(mat.NewDense[float64](mat.WithShape(2, 2), mat.WithBacking([]float64{
+		1, 0,
+		0, 1,
+	})))
+	require.NoError(t, err)
+	assert.Equal(t, []float64{
+		1, 0, 0, 1, 0,
+		0, 0, 1, 0, 0,
+	}, x.Grad().Data().F64())
+	assert.Equal(t, []float64{
+		1, 2, 3,
+		6, 7, 8,
+	}, w1.Grad().Data().F64())
+	assert.Equal(t, []float64{
+		3, 4, 5,
+		8, 9, 10,
+	}, w2.Grad().Data().F64())
+}
+
+func TestConv2D_InvalidOperands(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(3, 3))
+	w := mat.NewDense[float64](mat.WithShape(2, 2))
+
+	_, err := NewConv2D([]mat.Tensor{x}, []mat.Tensor{w}, DefaultConvConfig(0, 1)).Forward()
+	assert.Error(t, err)
+	_, err = NewConv2D([]mat.Tensor{w}, []mat.Tensor{x}, DefaultConvConfig(1, 1)).Forward()
+	assert.Error(t, err)
+	_, err = NewConv2D([]mat.Tensor{x, x}, []mat.Tensor{w}, DefaultConvConfig(1, 1)).Forward()
+	assert.Error(t, err)
+	_, err = NewConv2D([]mat.Tensor{x, w}, []mat.Tensor{w, w}, DefaultConvConfig(1, 1)).Forward()
+	assert.Error(t, err)
+	_, err = NewConv1D([]mat.Tensor{x}, []mat.Tensor{w}, DefaultConvConfig(1, 1)).Forward()
+	assert.Error(t, err)
+
+	c := DefaultConvConfig(1, 1)
+	c.Groups = 2
+	_, err = NewConv2D([]mat.Tensor{x, x, x}, []mat.Tensor{w, w, w}, c).Forward()
+	assert.Error(t, err, "groups not dividing the inputs")
+	c = DefaultConvConfig(1, 1)
+	c.DilationRows = 3
+	_, err = NewConv2D([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "dilated kernel larger than the input")
+	c.PaddingRows = [2]int{1, 1}
+	_, err = NewConv2D([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.NoError(t, err, "dilated kernel fitting the padded input")
+	c = DefaultConvConfig(1, 1)
+	c.PaddingCols = [2]int{0, -1}
+	_, err = NewConv2D([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "negative padding")
+	c = DefaultConvConfig(1, 1)
+	c.PaddingMode = ReflectPadding
+	c.PaddingCols = [2]int{3, 0}
+	_, err = NewConv2D([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "reflect padding as large as the input")
+}
+
+func TestConv1D_InvalidOperands(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(2, 2))
+	w := mat.NewDense[float64](mat.WithShape(2, 3))
+
+	_, err := NewConv1D([]mat.Tensor{x}, []mat.Tensor{w}, DefaultConvConfig(1, 1)).Forward()
+	assert.ErrorContains(t, err, "fn: Conv1D dilated kernel")
+	_, err = NewConv1D([]mat.Tensor{x}, []mat.Tensor{w}, DefaultConvConfig(1, 0)).Forward()
+	assert.ErrorContains(t, err, "fn: Conv1D requires positive strides")
+	_, err = NewConv1D([]mat.Tensor{x, x}, []mat.Tensor{w}, DefaultConvConfig(1, 1)).Forward()
+	assert.ErrorContains(t, err, "fn: Conv1D requires one kernel")
+}
+
+func TestConvConfig_ValidateInput(t *testing.T) {
+	assert.NoError(t, DefaultConvConfig(1, 1).ValidateInput(3, 3, 3, 3))
+	assert.Error(t, DefaultConvConfig(1, 1).ValidateInput(2, 2, 3, 3), "kernel larger than the input")
+
+	c := DefaultConvConfig(1, 1)
+	c.DilationCols = 2
+	assert.Error(t, c.ValidateInput(4, 4, 3, 3), "dilated kernel larger than the input")
+	c.PaddingCols = [2]int{1, 0}
+	assert.NoError(t, c.ValidateInput(4, 4, 3, 3), "dilated kernel fitting the padded input")
+
+	c = DefaultConvConfig(1, 1)
+	c.PaddingMode = ReflectPadding
+	c.PaddingRows = [2]int{0, 2}
+	assert.Error(t, c.ValidateInput(2, 4, 1, 1), "reflect padding as large as the input")
+	assert.NoError(t, c.ValidateInput(3, 4, 1, 1), "reflect padding smaller than the input")
+}
@@ -0,0 +1,269 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// ConvTransposeConfig provides the settings of a transposed convolution.
+//
+// The embedded ConvConfig describes the convolution the transposed
+// convolution is the adjoint of: its padding, which can only be ZeroPadding,
+// is removed from the output.
+type ConvTransposeConfig struct {
+	ConvConfig
+	// OutputPaddingRows and OutputPaddingCols are the numbers of rows and
+	// columns added after the output, to resolve the ambiguity of its size
+	// when the stride is greater than 1. They must be smaller than the
+	// stride.
+	OutputPaddingRows int
+	OutputPaddingCols int
+}
+
+// DefaultConvTransposeConfig returns the configuration of a transposed
+// convolution with the given strides, no dilation, no padding and a single
+// group.
+func DefaultConvTransposeConfig(strideRows, strideCols int) ConvTransposeConfig {
+	return ConvTransposeConfig{
+		ConvConfig: DefaultConvConfig(strideRows, strideCols),
+	}
+}
+
+// Validate returns an error if the configuration is not valid, regardless of
+// the inputs.
+func (c ConvTransposeConfig) Validate() error {
+	return c.validate("transposed convolution")
+}
+
+// validate is Validate, with the errors reported for the operator op.
+func (c ConvTransposeConfig) validate(op string) error {
+	if err := c.ConvConfig.validate(op); err != nil {
+		return err
+	}
+	if c.PaddingMode != ZeroPadding {
+		return fmt.Errorf("fn: %s only supports zero padding, got %v", op, c.PaddingMode)
+	}
+	if c.OutputPaddingRows < 0 || c.OutputPaddingCols < 0 || c.OutputPaddingRows >= c.StrideRows || c.OutputPaddingCols >= c.StrideCols {
+		return fmt.Errorf("fn: %s output padding %d, %d must be non-negative and smaller than the stride", op, c.OutputPaddingRows, c.OutputPaddingCols)
+	}
+	return nil
+}
+
+// OutputSize returns the number of rows and columns of each output channel,
+// given the shape of the inputs and of the kernels.
+func (c ConvTransposeConfig) OutputSize(xRows, xCols, kRows, kCols int) (rows, cols int) {
+	rows = (xRows-1)*c.StrideRows - c.PaddingRows[0] - c.PaddingRows[1] + (kRows-1)*c.DilationRows + 1 + c.OutputPaddingRows
+	cols = (xCols-1)*c.StrideCols - c.PaddingCols[0] - c.PaddingCols[1] + (kCols-1)*c.DilationCols + 1 + c.OutputPaddingCols
+	return rows, cols
+}
+
+// Conv2DTranspose is an operator to perform a transposed (or fractionally
+// strided) 2D convolution, i.e. the adjoint of the Conv2D with the same
+// configuration and kernels, mapping the shape of its outputs to the shape
+// of its inputs. It is typically used for upsampling.
+//
+// The kernels have the same layout of the ones of Conv2D, with the roles of
+// the input and output channels exchanged, so that they can be shared with
+// the Conv2D it is the adjoint of: the input channels are split into groups,
+// and the kernel ws[i*outG+o] is applied to the input channel i for the
+// output channel o of its group, where outG is the number of output channels
+// in each group. The result is a matrix with one row for each output channel,
+// holding its values in row-major order.
+type Conv2DTranspose[O mat.Tensor] struct {
+	xs     []O
+	ws     []O
+	config ConvTransposeConfig
+	// vectors is true if each input is a vector, taken as a single row.
+	vectors bool
+	// initialized during the forward pass
+	geom    *convGeometry // the geometry of the adjoint convolution
+	x       mat.Matrix    // the inputs, one row for each channel
+	kernels mat.Matrix    // the kernels, (inChannels) × (outChannels/groups*kernelSize)
+}
+
+// NewConv2DTranspose returns a new Conv2DTranspose Function.
+func NewConv2DTranspose[O mat.Tensor](xs, ws []O, config ConvTransposeConfig) *Conv2DTranspose[O] {
+	return &Conv2DTranspose[O]{
+		xs:     xs,
+		ws:     ws,
+		config: config,
+	}
+}
+
+// Operands returns the list of operands: the inputs, followed by the kernels.
+func (r *Conv2DTranspose[O]) Operands() []mat.Tensor {
+	operands := make([]mat.Tensor, 0, len(r.xs)+len(r.ws))
+	for _, x := range r.xs {
+		operands = append(operands, x)
+	}
+	for _, w := range r.ws {
+		operands = append(operands, w)
+	}
+	return operands
+}
+
+// OutputShape returns the number of rows and columns of each output channel.
+// It is only available after the forward pass.
+func (r *Conv2DTranspose[O]) OutputShape() (rows, cols int) {
+	return r.geom.xRows, r.geom.xCols
+}
+
+// Forward computes the output of the function.
+func (r *Conv2DTranspose[O]) Forward() (mat.Tensor, error) {
+	if err := r.checkOperands(); err != nil {
+		return nil, err
+	}
+	switch mat.DTypeOf(r.xs[0].Value().(mat.Matrix)) {
+	case mat.Float32:
+		return conv2DTransposeForward[float32](r), nil
+	default:
+		return conv2DTransposeForward[float64](r), nil
+	}
+}
+
+// checkOperands validates the configuration and the shapes of the operands,
+// and sets the geometry of the adjoint convolution.
+func (r *Conv2DTranspose[O]) checkOperands() error {
+	c, op := r.config, r.op()
+	if err := c.validate(op); err != nil {
+		return err
+	}
+	if len(r.xs) == 0 || len(r.xs)%c.Groups != 0 {
+		return fmt.Errorf("fn: %s requires a number of inputs multiple of the groups, got %d inputs and %d groups", op, len(r.xs), c.Groups)
+	}
+	if len(r.ws) == 0 || len(r.ws)%len(r.xs) != 0 {
+		return fmt.Errorf("fn: %s requires one kernel for each input channel and output channel of a group, got %d inputs and %d kernels", op, len(r.xs), len(r.ws))
+	}
+	if err := checkSameShapes(r.xs, r.ws); err != nil {
+		return err
+	}
+	xShape := r.inputShape()
+	wShape := r.ws[0].Value().Shape()
+	rows, cols := c.OutputSize(xShape[0], xShape[1], wShape[0], wShape[1])
+	if rows <= 0 || cols <= 0 {
+		return fmt.Errorf("fn: %s padding %v, %v larger than the output", op, c.PaddingRows, c.PaddingCols)
+	}
+	geom, err := newConvGeometry(op, []int{rows, cols}, wShape, c.ConvConfig)
+	if err != nil {
+		return err
+	}
+	if geom.outRows != xShape[0] || geom.outCols != xShape[1] {
+		return fmt.Errorf("fn: %s incompatible input %v and kernel %v shapes", op, xShape, wShape)
+	}
+	r.geom = geom
+	return nil
+}
+
+// op returns the name of the operator in the errors.
+func (r *Conv2DTranspose[O]) op() string {
+	if r.vectors {
+		return "Conv1DTranspose"
+	}
+	return "Conv2DTranspose"
+}
+
+// inputShape returns the shape of each input channel.
+func (r *Conv2DTranspose[O]) inputShape() []int {
+	if r.vectors {
+		return []int{1, r.xs[0].Value().Size()}
+	}
+	return r.xs[0].Value().Shape()
+}
+
+func (r *Conv2DTranspose[O]) outChannels() int {
+	return len(r.ws) / len(r.xs) * r.config.Groups
+}
+
+// Backward computes the backward pass.
+func (r *Conv2DTranspose[O]) Backward(gy mat.Tensor) error {
+	if gy.Size() != r.outChannels()*r.geom.xRows*r.geom.xCols {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	switch mat.DTypeOf(r.kernels) {
+	case mat.Float32:
+		conv2DTransposeBackward[float32](r, gy.(mat.Matrix))
+	default:
+		conv2DTransposeBackward[float64](r, gy.(mat.Matrix))
+	}
+	return nil
+}
+
+// conv2DTransposeForward computes the output as the gradient of the inputs
+// of the adjoint convolution, given the inputs as its output gradient.
+func conv2DTransposeForward[T float.DType, O mat.Tensor](r *Conv2DTranspose[O]) mat.Matrix {
+	g := r.geom
+	n := g.outRows * g.outCols
+	xData := make([]T, 0, len(r.xs)*n)
+	for _, x := range r.xs {
+		xData = append(xData, mat.Data[T](x.Value())...)
+	}
+	r.x = mat.NewDense[T](mat.WithShape(len(r.xs), n), mat.WithBacking(xData))
+	r.kernels = kernelsMatrix[T](r.ws, len(r.xs))
+
+	cols := mat.Data[T](groupedMul[T](r.kernels, r.x, r.config.Groups, true))
+	outChannels := r.outChannels()
+	size := g.xRows * g.xCols
+	y := make([]T, outChannels*size)
+	for c := 0; c < outChannels; c++ {
+		copy(y[c*size:], col2im(g, cols, c))
+	}
+	return mat.NewDense[T](mat.WithShape(outChannels, size), mat.WithBacking(y))
+}
+
+// conv2DTransposeBackward accumulates the gradients of the kernels and of the
+// inputs: the gradients of the inputs are the adjoint convolution of the
+// output gradients.
+func conv2DTransposeBackward[T float.DType, O mat.Tensor](r *Conv2DTranspose[O], gy mat.Matrix) {
+	g := r.geom
+	outChannels := r.outChannels()
+	size := g.xRows * g.xCols
+	gyData := mat.Data[T](gy)
+	gys := make([][]T, outChannels)
+	for c := range gys {
+		gys[c] = gyData[c*size : (c+1)*size]
+	}
+	kSize := g.kRows * g.kCols
+	cols := mat.NewDense[T](mat.WithShape(outChannels*kSize, g.outRows*g.outCols), mat.WithBacking(im2col(g, gys)))
+
+	if anyRequiresGrad(r.ws) {
+		accKernelsGrad[T](r.ws, groupedMulT[T](r.x, cols, r.config.Groups), g)
+	}
+	if anyRequiresGrad(r.xs) {
+		gx := mat.Data[T](groupedMul[T](r.kernels, cols, r.config.Groups, false))
+		n := g.outRows * g.outCols
+		for i, x := range r.xs {
+			if x.RequiresGrad() {
+				x.AccGrad(mat.NewDense[T](mat.WithShape(x.Value().Shape()...), mat.WithBacking(gx[i*n:(i+1)*n])))
+			}
+		}
+	}
+}
+
+// Conv1DTranspose is an operator to perform a transposed 1D convolution,
+// i.e. the adjoint of the Conv1D with the same configuration and kernels.
+// Each input is a vector, such as an output channel of Conv1D, and each
+// output channel has as many rows as the kernels. See Conv2DTranspose.
+//
+// The settings of the configuration along the rows are ignored.
+type Conv1DTranspose[O mat.Tensor] struct {
+	*Conv2DTranspose[O]
+}
+
+// NewConv1DTranspose returns a new Conv1DTranspose Function.
+func NewConv1DTranspose[O mat.Tensor](xs, ws []O, config ConvTransposeConfig) *Conv1DTranspose[O] {
+	config.StrideRows = 1
+	config.DilationRows = 1
+	config.PaddingRows = [2]int{}
+	config.OutputPaddingRows = 0
+	f := NewConv2DTranspose(xs, ws, config)
+	f.vectors = true
+	return &Conv1DTranspose[O]{
+		Conv2DTranspose: f,
+	}
+}
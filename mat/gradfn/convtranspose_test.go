@@ -0,0 +1,200 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestChannels returns n matrices of the given shape, requiring gradients,
+// with deterministic values depending on seed.
+func newTestChannels[T float.DType](n, rows, cols, seed int) []mat.Tensor {
+	xs := make([]mat.Tensor, n)
+	for c := range xs {
+		data := make([]T, rows*cols)
+		for i := range data {
+			data[i] = T((i*7+c*3+seed)%11)/10 - 0.5
+		}
+		xs[c] = mat.NewDense[T](mat.WithShape(rows, cols), mat.WithBacking(data), mat.WithGrad(true))
+	}
+	return xs
+}
+
+func TestConv2DTranspose(t *testing.T) {
+	configs := []ConvTransposeConfig{
+		DefaultConvTransposeConfig(1, 1),
+		{
+			ConvConfig: ConvConfig{
+				StrideRows:   2,
+				StrideCols:   3,
+				DilationRows: 1,
+				DilationCols: 2,
+				PaddingRows:  [2]int{1, 0},
+				PaddingCols:  [2]int{1, 2},
+				Groups:       1,
+			},
+			OutputPaddingRows: 1,
+			OutputPaddingCols: 2,
+		},
+		{
+			ConvConfig: ConvConfig{
+				StrideRows:   2,
+				StrideCols:   1,
+				DilationRows: 2,
+				DilationCols: 1,
+				PaddingRows:  [2]int{2, 2},
+				PaddingCols:  [2]int{0, 1},
+				Groups:       2,
+			},
+		},
+	}
+	for i, c := range configs {
+		t.Run(fmt.Sprintf("config %d", i), func(t *testing.T) {
+			t.Run("float32", func(t *testing.T) { testConv2DTranspose[float32](t, c) })
+			t.Run("float64", func(t *testing.T) { testConv2DTranspose[float64](t, c) })
+		})
+	}
+}
+
+// testConv2DTranspose checks that Conv2DTranspose is the adjoint of Conv2D:
+// for any u and v, <Conv2D(u), v> = <u, Conv2DTranspose(v)>. Its value is
+// the gradient of the inputs of Conv2D, its input gradient is the value of
+// Conv2D, and the gradients of the shared kernels are the same.
+func testConv2DTranspose[T float.DType](t *testing.T, c ConvTransposeConfig) {
+	const uChannels, vChannels, xRows, xCols, kRows, kCols = 4, 6, 4, 5, 3, 2
+	ws := newTestChannels[T](vChannels*uChannels/c.Groups, kRows, kCols, 1)
+	ws[1].(mat.Matrix).SetRequiresGrad(false)
+	v := newTestChannels[T](vChannels, xRows, xCols, 2)
+	uRows, uCols := c.OutputSize(xRows, xCols, kRows, kCols)
+	u := newTestChannels[T](uChannels, uRows, uCols, 3)
+
+	// The transposed convolution of v.
+	tf := NewConv2DTranspose(v, ws, c)
+	z, err := tf.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{uChannels, uRows * uCols}, z.Shape())
+	rows, cols := tf.OutputShape()
+	assert.Equal(t, uRows, rows)
+	assert.Equal(t, uCols, cols)
+
+	// The convolution of u, back-propagating v.
+	f := NewConv2D(u, ws, c.ConvConfig)
+	y, err := f.Forward()
+	require.NoError(t, err)
+	require.Equal(t, []int{vChannels, xRows * xCols}, y.Shape())
+	require.NoError(t, f.Backward(stackRows[T](v)))
+
+	lhs := dot(y.Data().F64(), stackRows[T](v).Data().F64())
+	rhs := dot(stackRows[T](u).Data().F64(), z.Data().F64())
+	assert.InDelta(t, lhs, rhs, 1.0e-4, "adjoint identity")
+
+	for i, ui := range u {
+		assert.InDeltaSlice(t, ui.Grad().Data().F64(), z.Data().F64()[i*uRows*uCols:(i+1)*uRows*uCols], 1.0e-5)
+	}
+	convWsGrads := make([][]float64, len(ws))
+	for i, w := range ws {
+		if w.RequiresGrad() {
+			convWsGrads[i] = w.Grad().Data().F64()
+			w.(mat.Matrix).ZeroGrad()
+		}
+	}
+
+	require.NoError(t, tf.Backward(stackRows[T](u)))
+	for i, vi := range v {
+		assert.InDeltaSlice(t, y.Data().F64()[i*xRows*xCols:(i+1)*xRows*xCols], vi.Grad().Data().F64(), 1.0e-5)
+	}
+	for i, w := range ws {
+		if i == 1 {
+			assert.False(t, w.(mat.Matrix).HasGrad())
+			continue
+		}
+		assert.InDeltaSlice(t, convWsGrads[i], w.Grad().Data().F64(), 1.0e-4)
+	}
+}
+
+func TestConv1DTranspose(t *testing.T) {
+	t.Run("float32", testConv1DTranspose[float32])
+	t.Run("float64", testConv1DTranspose[float64])
+}
+
+// testConv1DTranspose checks that Conv1DTranspose is the adjoint of Conv1D.
+func testConv1DTranspose[T float.DType](t *testing.T) {
+	c := DefaultConvTransposeConfig(1, 2)
+	c.PaddingCols = [2]int{1, 1}
+	c.OutputPaddingCols = 1
+	ws := newTestChannels[T](2*3, 3, 2, 1)
+	v := newTestChannels[T](2, 3, 1, 2) // column vectors, as the output channels of Conv1D
+	u := newTestChannels[T](3, 3, 5, 3)
+
+	tf := NewConv1DTranspose(v, ws, c)
+	z, err := tf.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{3, 3 * 5}, z.Shape())
+
+	f := NewConv1D(u, ws, c.ConvConfig)
+	y, err := f.Forward()
+	require.NoError(t, err)
+	require.Equal(t, []int{3, 2}, y.Shape(), "one column for each output channel")
+	gy := stackRows[T](v).T()
+	require.NoError(t, f.Backward(gy))
+
+	for i, ui := range u {
+		assert.InDeltaSlice(t, ui.Grad().Data().F64(), z.Data().F64()[i*15:(i+1)*15], 1.0e-5)
+	}
+	require.NoError(t, tf.Backward(stackRows[T](u)))
+	yt := y.(mat.Matrix).T()
+	for i, vi := range v {
+		assert.Equal(t, []int{3, 1}, vi.Grad().Shape())
+		assert.InDeltaSlice(t, yt.Data().F64()[i*3:(i+1)*3], vi.Grad().Data().F64(), 1.0e-5)
+	}
+}
+
+func TestConv2DTranspose_InvalidOperands(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(3, 3))
+	w := mat.NewDense[float64](mat.WithShape(2, 2))
+
+	c := DefaultConvTransposeConfig(2, 2)
+	c.OutputPaddingRows = 2
+	_, err := NewConv2DTranspose([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "output padding not smaller than the stride")
+	c = DefaultConvTransposeConfig(1, 1)
+	c.PaddingMode = ReflectPadding
+	_, err = NewConv2DTranspose([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "padding mode")
+	c = DefaultConvTransposeConfig(1, 1)
+	c.PaddingRows = [2]int{2, 2}
+	_, err = NewConv2DTranspose([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.Error(t, err, "padding larger than the output")
+	_, err = NewConv2DTranspose([]mat.Tensor{x, x}, []mat.Tensor{w, w, w}, DefaultConvTransposeConfig(1, 1)).Forward()
+	assert.Error(t, err, "kernels not multiple of the inputs")
+
+	c = DefaultConvTransposeConfig(1, 1)
+	c.PaddingMode = ReflectPadding
+	_, err = NewConv1DTranspose([]mat.Tensor{x}, []mat.Tensor{w}, c).Forward()
+	assert.ErrorContains(t, err, "fn: Conv1DTranspose only supports zero padding")
+}
+
+// stackRows returns a matrix with one row for each flattened tensor.
+func stackRows[T float.DType](xs []mat.Tensor) mat.Matrix {
+	var data []T
+	for _, x := range xs {
+		data = append(data, mat.Data[T](x.Value())...)
+	}
+	return mat.NewDense[T](mat.WithShape(len(xs), len(data)/len(xs)), mat.WithBacking(data))
+}
+
+func dot(a, b []float64) float64 {
+	var sum float64
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
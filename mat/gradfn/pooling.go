@@ -0,0 +1,339 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// PoolingConfig provides the settings of a pooling over sliding windows.
+type PoolingConfig struct {
+	// Rows and Cols are the size of the windows.
+	Rows int
+	Cols int
+	// StrideRows and StrideCols are the steps of the windows along the rows
+	// and the columns of the input.
+	StrideRows int
+	StrideCols int
+	// PaddingRows and PaddingCols are the amounts of zero padding before and
+	// after the input, along the rows and the columns. Each of them must be
+	// smaller than the size of the windows.
+	PaddingRows [2]int
+	PaddingCols [2]int
+	// CountIncludePad specifies whether the average pooling divides by the
+	// size of the windows, including the padding, instead of by the number
+	// of elements of the input in each window.
+	CountIncludePad bool
+}
+
+// DefaultPoolingConfig returns the configuration of a pooling over
+// non-overlapping windows of the given size, without padding.
+func DefaultPoolingConfig(rows, cols int) PoolingConfig {
+	return PoolingConfig{
+		Rows:       rows,
+		Cols:       cols,
+		StrideRows: rows,
+		StrideCols: cols,
+	}
+}
+
+// Validate returns an error if the configuration is not valid, regardless of
+// the input.
+func (c PoolingConfig) Validate() error {
+	if c.Rows <= 0 || c.Cols <= 0 {
+		return fmt.Errorf("fn: pooling requires positive window sizes, got %dx%d", c.Rows, c.Cols)
+	}
+	if c.StrideRows <= 0 || c.StrideCols <= 0 {
+		return fmt.Errorf("fn: pooling requires positive strides, got %d and %d", c.StrideRows, c.StrideCols)
+	}
+	if c.PaddingRows[0] < 0 || c.PaddingRows[1] < 0 || c.PaddingRows[0] >= c.Rows || c.PaddingRows[1] >= c.Rows ||
+		c.PaddingCols[0] < 0 || c.PaddingCols[1] < 0 || c.PaddingCols[0] >= c.Cols || c.PaddingCols[1] >= c.Cols {
+		return fmt.Errorf("fn: pooling requires non-negative paddings smaller than the windows, got %v and %v", c.PaddingRows, c.PaddingCols)
+	}
+	return nil
+}
+
+// windows returns the windows of the pooling of an input of the given size.
+func (c PoolingConfig) windows(xRows, xCols int) (*poolingWindows, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	rows, rowsSize := slidingRanges(xRows, c.Rows, c.StrideRows, c.PaddingRows, c.CountIncludePad)
+	cols, colsSize := slidingRanges(xCols, c.Cols, c.StrideCols, c.PaddingCols, c.CountIncludePad)
+	if len(rows) == 0 || len(cols) == 0 {
+		return nil, fmt.Errorf("fn: pooling window %dx%d larger than the padded input %dx%d", c.Rows, c.Cols, xRows, xCols)
+	}
+	return &poolingWindows{xRows: xRows, xCols: xCols, rows: rows, cols: cols, rowsSize: rowsSize, colsSize: colsSize}, nil
+}
+
+// slidingRanges returns the ranges of the input positions of the sliding
+// windows along one dimension, clipped to the input, and the sizes to
+// average by.
+func slidingRanges(size, window, stride int, padding [2]int, includePad bool) (ranges [][2]int, sizes []int) {
+	if size+padding[0]+padding[1] < window {
+		return nil, nil
+	}
+	n := (size+padding[0]+padding[1]-window)/stride + 1
+	ranges = make([][2]int, n)
+	sizes = make([]int, n)
+	for o := range ranges {
+		start := o*stride - padding[0]
+		ranges[o] = [2]int{max(start, 0), min(start+window, size)}
+		sizes[o] = ranges[o][1] - ranges[o][0]
+		if includePad {
+			sizes[o] = window
+		}
+	}
+	return ranges, sizes
+}
+
+// adaptiveWindows returns the functions computing the windows of an adaptive
+// pooling to the given output size: the output position o covers the input
+// positions from floor(o*size/outSize) to ceil((o+1)*size/outSize).
+func adaptiveWindows(outRows, outCols int) func(xRows, xCols int) (*poolingWindows, error) {
+	return func(xRows, xCols int) (*poolingWindows, error) {
+		if outRows <= 0 || outCols <= 0 {
+			return nil, fmt.Errorf("fn: adaptive pooling requires a positive output size, got %dx%d", outRows, outCols)
+		}
+		rows, rowsSize := adaptiveRanges(xRows, outRows)
+		cols, colsSize := adaptiveRanges(xCols, outCols)
+		return &poolingWindows{xRows: xRows, xCols: xCols, rows: rows, cols: cols, rowsSize: rowsSize, colsSize: colsSize}, nil
+	}
+}
+
+// adaptiveRanges returns the ranges of the input positions of the windows
+// of an adaptive pooling along one dimension, and their sizes.
+func adaptiveRanges(size, outSize int) (ranges [][2]int, sizes []int) {
+	ranges = make([][2]int, outSize)
+	sizes = make([]int, outSize)
+	for o := range ranges {
+		ranges[o] = [2]int{o * size / outSize, ((o+1)*size + outSize - 1) / outSize}
+		sizes[o] = ranges[o][1] - ranges[o][0]
+	}
+	return ranges, sizes
+}
+
+// poolingWindows describes the windows of the input reduced to each position
+// of the output of a pooling. The windows are separable: the window of the
+// output (i, j) covers the input rows rows[i] and columns cols[j].
+type poolingWindows struct {
+	xRows, xCols int
+	rows, cols   [][2]int
+	// rowsSize and colsSize are the sizes of the windows, whose product is
+	// the divisor of the average pooling.
+	rowsSize, colsSize []int
+}
+
+type poolingKind int
+
+const (
+	avgPoolingKind poolingKind = iota
+	maxPoolingKind
+	lpPoolingKind
+)
+
+// windowPooling is the base of the pooling operators reducing each window
+// of the input to a single value of the output.
+type windowPooling[O mat.Tensor] struct {
+	x       O
+	kind    poolingKind
+	p       float64 // the norm degree of the Lp pooling
+	windows func(xRows, xCols int) (*poolingWindows, error)
+	// initialized during the forward pass
+	w      *poolingWindows
+	y      mat.Matrix
+	argmax []int
+}
+
+// Operands returns the list of operands.
+func (r *windowPooling[O]) Operands() []mat.Tensor {
+	return []mat.Tensor{r.x}
+}
+
+// Forward computes the output of the function.
+func (r *windowPooling[O]) Forward() (mat.Tensor, error) {
+	xv := r.x.Value().(mat.Matrix)
+	if xv.Shape()[0] == 0 || xv.Shape()[1] == 0 {
+		return nil, fmt.Errorf("fn: pooling of an empty input")
+	}
+	w, err := r.windows(xv.Shape()[0], xv.Shape()[1])
+	if err != nil {
+		return nil, err
+	}
+	r.w = w
+	switch mat.DTypeOf(xv) {
+	case mat.Float32:
+		r.y = windowPoolingForward[float32](r, xv)
+	default:
+		r.y = windowPoolingForward[float64](r, xv)
+	}
+	return r.y, nil
+}
+
+// Backward computes the backward pass.
+func (r *windowPooling[O]) Backward(gy mat.Tensor) error {
+	if gy.Size() != len(r.w.rows)*len(r.w.cols) {
+		return fmt.Errorf("fn: matrices have incompatible dimensions")
+	}
+	if !r.x.RequiresGrad() {
+		return nil
+	}
+	switch mat.DTypeOf(r.y) {
+	case mat.Float32:
+		r.x.AccGrad(windowPoolingBackward[float32](r, gy.(mat.Matrix)))
+	default:
+		r.x.AccGrad(windowPoolingBackward[float64](r, gy.(mat.Matrix)))
+	}
+	return nil
+}
+
+func windowPoolingForward[T float.DType, O mat.Tensor](r *windowPooling[O], xv mat.Matrix) mat.Matrix {
+	w := r.w
+	x := mat.Data[T](xv)
+	y := make([]T, len(w.rows)*len(w.cols))
+	if r.kind == maxPoolingKind {
+		r.argmax = make([]int, len(y))
+	}
+	for i, rows := range w.rows {
+		for j, cols := range w.cols {
+			o := i*len(w.cols) + j
+			switch r.kind {
+			case maxPoolingKind:
+				argmax := rows[0]*w.xCols + cols[0]
+				for k := rows[0]; k < rows[1]; k++ {
+					for l := cols[0]; l < cols[1]; l++ {
+						if x[k*w.xCols+l] > x[argmax] {
+							argmax = k*w.xCols + l
+						}
+					}
+				}
+				r.argmax[o] = argmax
+				y[o] = x[argmax]
+			case lpPoolingKind:
+				var sum float64
+				for k := rows[0]; k < rows[1]; k++ {
+					for l := cols[0]; l < cols[1]; l++ {
+						sum += math.Pow(math.Abs(float64(x[k*w.xCols+l])), r.p)
+					}
+				}
+				y[o] = T(math.Pow(sum, 1/r.p))
+			default:
+				var sum T
+				for k := rows[0]; k < rows[1]; k++ {
+					for l := cols[0]; l < cols[1]; l++ {
+						sum += x[k*w.xCols+l]
+					}
+				}
+				y[o] = sum / T(w.rowsSize[i]*w.colsSize[j])
+			}
+		}
+	}
+	return mat.NewDense[T](mat.WithShape(len(w.rows), len(w.cols)), mat.WithBacking(y))
+}
+
+func windowPoolingBackward[T float.DType, O mat.Tensor](r *windowPooling[O], gyv mat.Matrix) mat.Matrix {
+	w := r.w
+	x := mat.Data[T](r.x.Value())
+	y := mat.Data[T](r.y)
+	gy := mat.Data[T](gyv)
+	gx := make([]T, w.xRows*w.xCols)
+	for i, rows := range w.rows {
+		for j, cols := range w.cols {
+			o := i*len(w.cols) + j
+			switch r.kind {
+			case maxPoolingKind:
+				gx[r.argmax[o]] += gy[o]
+			case lpPoolingKind:
+				if y[o] == 0 {
+					continue
+				}
+				// d/dx (Σ|x|^p)^(1/p) = sign(x) |x|^(p-1) / y^(p-1)
+				scale := float64(gy[o]) / math.Pow(float64(y[o]), r.p-1)
+				for k := rows[0]; k < rows[1]; k++ {
+					for l := cols[0]; l < cols[1]; l++ {
+						v := float64(x[k*w.xCols+l])
+						gx[k*w.xCols+l] += T(scale * math.Copysign(math.Pow(math.Abs(v), r.p-1), v))
+					}
+				}
+			default:
+				g := gy[o] / T(w.rowsSize[i]*w.colsSize[j])
+				for k := rows[0]; k < rows[1]; k++ {
+					for l := cols[0]; l < cols[1]; l++ {
+						gx[k*w.xCols+l] += g
+					}
+				}
+			}
+		}
+	}
+	return mat.NewDense[T](mat.WithShape(w.xRows, w.xCols), mat.WithBacking(gx))
+}
+
+// AvgPooling is an operator to perform average pooling over sliding windows,
+// with optional zero padding.
+type AvgPooling[O mat.Tensor] struct {
+	*windowPooling[O]
+}
+
+// NewAvgPooling returns a new AvgPooling Function.
+func NewAvgPooling[O mat.Tensor](x O, config PoolingConfig) *AvgPooling[O] {
+	return &AvgPooling[O]{
+		windowPooling: &windowPooling[O]{x: x, kind: avgPoolingKind, windows: config.windows},
+	}
+}
+
+// LpPooling is an operator to perform power-average pooling over sliding
+// windows: each output is the L_p norm (Σ|x|^p)^(1/p) of its window. The
+// padding, if any, does not contribute to the norms.
+type LpPooling[O mat.Tensor] struct {
+	*windowPooling[O]
+}
+
+// NewLpPooling returns a new LpPooling Function, with the given norm degree
+// p >= 1.
+func NewLpPooling[O mat.Tensor](x O, p float64, config PoolingConfig) *LpPooling[O] {
+	windows := func(xRows, xCols int) (*poolingWindows, error) {
+		if !(p >= 1) || math.IsInf(p, 1) {
+			return nil, fmt.Errorf("fn: Lp pooling requires a finite norm degree p >= 1, got %g", p)
+		}
+		return config.windows(xRows, xCols)
+	}
+	return &LpPooling[O]{
+		windowPooling: &windowPooling[O]{x: x, kind: lpPoolingKind, p: p, windows: windows},
+	}
+}
+
+// AdaptiveAvgPooling is an operator to perform average pooling to the given
+// output size, regardless of the size of the input: the output position o
+// covers the input positions from floor(o*size/outSize) to
+// ceil((o+1)*size/outSize), along each dimension. With an output of size
+// 1×1, it is a global average pooling.
+type AdaptiveAvgPooling[O mat.Tensor] struct {
+	*windowPooling[O]
+}
+
+// NewAdaptiveAvgPooling returns a new AdaptiveAvgPooling Function.
+func NewAdaptiveAvgPooling[O mat.Tensor](x O, rows, cols int) *AdaptiveAvgPooling[O] {
+	return &AdaptiveAvgPooling[O]{
+		windowPooling: &windowPooling[O]{x: x, kind: avgPoolingKind, windows: adaptiveWindows(rows, cols)},
+	}
+}
+
+// AdaptiveMaxPooling is an operator to perform max pooling to the given
+// output size, regardless of the size of the input. See AdaptiveAvgPooling.
+// With an output of size 1×1, it is a global max pooling.
+type AdaptiveMaxPooling[O mat.Tensor] struct {
+	*windowPooling[O]
+}
+
+// NewAdaptiveMaxPooling returns a new AdaptiveMaxPooling Function.
+func NewAdaptiveMaxPooling[O mat.Tensor](x O, rows, cols int) *AdaptiveMaxPooling[O] {
+	return &AdaptiveMaxPooling[O]{
+		windowPooling: &windowPooling[O]{x: x, kind: maxPoolingKind, windows: adaptiveWindows(rows, cols)},
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type poolingFunction interface {
+	Forward() (mat.Tensor, error)
+	Backward(gy mat.Tensor) error
+	Operands() []mat.Tensor
+}
+
+func TestAvgPooling(t *testing.T) {
+	t.Run("float32", testAvgPooling[float32])
+	t.Run("float64", testAvgPooling[float64])
+}
+
+func testAvgPooling[T float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithShape(3, 4), mat.WithBacking([]T{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+		9, 10, 11, 12,
+	}), mat.WithGrad(true))
+
+	c := DefaultPoolingConfig(2, 2)
+	c.PaddingRows = [2]int{1, 0}
+	f := NewAvgPooling(x, c)
+	assert.Equal(t, []mat.Tensor{x}, f.Operands())
+	y, err := f.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 2}, y.Shape())
+	assert.InDeltaSlice(t, []T{
+		(1 + 2) / 2.0, (3 + 4) / 2.0,
+		(5 + 6 + 9 + 10) / 4.0, (7 + 8 + 11 + 12) / 4.0,
+	}, y.Data(), 1.0e-6)
+
+	require.NoError(t, f.Backward(mat.NewDense[T](mat.WithShape(2, 2), mat.WithBacking([]T{
+		1, 2,
+		4, 8,
+	}))))
+	assert.InDeltaSlice(t, []T{
+		0.5, 0.5, 1, 1,
+		1, 1, 2, 2,
+		1, 1, 2, 2,
+	}, x.Grad().Data(), 1.0e-6)
+
+	c.CountIncludePad = true
+	y, err = NewAvgPooling(x, c).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []T{
+		(1 + 2) / 4.0, (3 + 4) / 4.0,
+		(5 + 6 + 9 + 10) / 4.0, (7 + 8 + 11 + 12) / 4.0,
+	}, y.Data(), 1.0e-6)
+}
+
+func TestAdaptivePooling(t *testing.T) {
+	t.Run("float32", testAdaptivePooling[float32])
+	t.Run("float64", testAdaptivePooling[float64])
+}
+
+func testAdaptivePooling[T float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithShape(3, 5), mat.WithBacking([]T{
+		-1, -2, -3, -4, -5,
+		-6, -7, -8, -9, -10,
+		-11, -12, -13, -14, -15,
+	}))
+
+	// Rows [0, 2) and [1, 3); columns [0, 3) and [2, 5).
+	y, err := NewAdaptiveMaxPooling(x, 2, 2).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []T{
+		-1, -3,
+		-6, -8,
+	}, y.Data(), 1.0e-6)
+
+	y, err = NewAdaptiveAvgPooling(x, 2, 2).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []T{
+		(-1 - 2 - 3 - 6 - 7 - 8) / 6.0, (-3 - 4 - 5 - 8 - 9 - 10) / 6.0,
+		(-6 - 7 - 8 - 11 - 12 - 13) / 6.0, (-8 - 9 - 10 - 13 - 14 - 15) / 6.0,
+	}, y.Data(), 1.0e-5)
+
+	y, err = NewAdaptiveMaxPooling(x, 1, 1).Forward()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 1}, y.Shape())
+	assert.InDeltaSlice(t, []T{-1}, y.Data(), 1.0e-6, "global max pooling")
+
+	y, err = NewAdaptiveAvgPooling(x, 1, 1).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []T{-8}, y.Data(), 1.0e-6, "global average pooling")
+}
+
+func TestLpPooling(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(2, 2), mat.WithBacking([]float64{
+		3, -4,
+		0, 0,
+	}))
+	y, err := NewLpPooling(x, 2, DefaultPoolingConfig(2, 2)).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{5}, y.Data(), 1.0e-9)
+
+	y, err = NewLpPooling(x, 1, DefaultPoolingConfig(2, 2)).Forward()
+	require.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{7}, y.Data(), 1.0e-9)
+}
+
+// TestPooling_Gradients compares the gradients of the pooling functions with
+// the ones computed by central differences.
+func TestPooling_Gradients(t *testing.T) {
+	strided := PoolingConfig{
+		Rows:        3,
+		Cols:        2,
+		StrideRows:  2,
+		StrideCols:  1,
+		PaddingRows: [2]int{1, 2},
+		PaddingCols: [2]int{1, 0},
+	}
+	withPad := strided
+	withPad.CountIncludePad = true
+
+	testCases := map[string]func(x mat.Tensor) poolingFunction{
+		"avg":             func(x mat.Tensor) poolingFunction { return NewAvgPooling(x, strided) },
+		"avg include pad": func(x mat.Tensor) poolingFunction { return NewAvgPooling(x, withPad) },
+		"l2":              func(x mat.Tensor) poolingFunction { return NewLpPooling(x, 2, strided) },
+		"l3":              func(x mat.Tensor) poolingFunction { return NewLpPooling(x, 3, strided) },
+		"adaptive avg":    func(x mat.Tensor) poolingFunction { return NewAdaptiveAvgPooling(x, 2, 3) },
+		"adaptive max":    func(x mat.Tensor) poolingFunction { return NewAdaptiveMaxPooling(x, 2, 3) },
+		"global avg":      func(x mat.Tensor) poolingFunction { return NewAdaptiveAvgPooling(x, 1, 1) },
+		"global max":      func(x mat.Tensor) poolingFunction { return NewAdaptiveMaxPooling(x, 1, 1) },
+	}
+	for name, newFunction := range testCases {
+		t.Run(name, func(t *testing.T) {
+			data := make([]float64, 5*7)
+			for i := range data {
+				data[i] = float64((i*13)%37)/16 - 1 // distinct values, so that the max is unique
+			}
+			x := mat.NewDense[float64](mat.WithShape(5, 7), mat.WithBacking(data), mat.WithGrad(true))
+			f := newFunction(x)
+			y, err := f.Forward()
+			require.NoError(t, err)
+
+			gy := make([]float64, y.Size())
+			for i := range gy {
+				gy[i] = float64(i%3) - 0.5
+			}
+			require.NoError(t, f.Backward(mat.NewDense[float64](mat.WithShape(y.Shape()...), mat.WithBacking(gy))))
+
+			const eps = 1.0e-6
+			loss := func() float64 {
+				y, err := newFunction(mat.NewDense[float64](mat.WithShape(5, 7), mat.WithBacking(data))).Forward()
+				require.NoError(t, err)
+				var sum float64
+				for i, v := range y.Data().F64() {
+					sum += v * gy[i]
+				}
+				return sum
+			}
+			expected := make([]float64, len(data))
+			for i := range data {
+				orig := data[i]
+				data[i] = orig + eps
+				plus := loss()
+				data[i] = orig - eps
+				minus := loss()
+				data[i] = orig
+				expected[i] = (plus - minus) / (2 * eps)
+			}
+			assert.InDeltaSlice(t, expected, x.Grad().Data().F64(), 1.0e-5)
+		})
+	}
+}
+
+func TestPooling_InvalidOperands(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(3, 3))
+
+	_, err := NewAvgPooling(x, DefaultPoolingConfig(0, 1)).Forward()
+	assert.Error(t, err, "empty window")
+	_, err = NewAvgPooling(x, DefaultPoolingConfig(4, 1)).Forward()
+	assert.Error(t, err, "window larger than the input")
+	c := DefaultPoolingConfig(2, 2)
+	c.PaddingCols = [2]int{0, 2}
+	_, err = NewAvgPooling(x, c).Forward()
+	assert.Error(t, err, "padding not smaller than the window")
+	c = DefaultPoolingConfig(2, 2)
+	c.StrideRows = 0
+	_, err = NewAvgPooling(x, c).Forward()
+	assert.Error(t, err, "zero stride")
+	_, err = NewLpPooling(x, 0.5, DefaultPoolingConfig(2, 2)).Forward()
+	assert.Error(t, err, "norm degree smaller than 1")
+	_, err = NewAdaptiveAvgPooling(x, 0, 1).Forward()
+	assert.Error(t, err, "empty output")
+}
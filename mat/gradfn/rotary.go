@@ -0,0 +1,82 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"math"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// Rotary is an operator applying the rotary position embedding (RoPE) of a
+// position to a vector: each pair of elements (x[2i], x[2i+1]) is rotated
+// by the angle position / base^(2i/size). With an odd size, the last
+// element is left unchanged.
+//
+// Reference: "RoFormer: Enhanced Transformer with Rotary Position Embedding"
+// by Jianlin Su et al. (2021). (https://arxiv.org/pdf/2104.09864.pdf)
+type Rotary[O mat.Tensor] struct {
+	x        O
+	position int
+	base     float64
+}
+
+// NewRotary returns a new Rotary Function.
+func NewRotary[O mat.Tensor](x O, position int, base float64) *Rotary[O] {
+	return &Rotary[O]{
+		x:        x,
+		position: position,
+		base:     base,
+	}
+}
+
+// Operands returns the list of operands.
+func (r *Rotary[O]) Operands() []mat.Tensor {
+	return []mat.Tensor{r.x}
+}
+
+// Forward computes the output of the function.
+func (r *Rotary[O]) Forward() (mat.Tensor, error) {
+	x := r.x.Value().(mat.Matrix)
+	switch mat.DTypeOf(x) {
+	case mat.Float32:
+		return applyRotary[float32](x, float64(r.position), r.base), nil
+	default:
+		return applyRotary[float64](x, float64(r.position), r.base), nil
+	}
+}
+
+// Backward computes the backward pass: the gradient is rotated back, the
+// transpose of a rotation being its inverse.
+func (r *Rotary[O]) Backward(gy mat.Tensor) error {
+	if !r.x.RequiresGrad() {
+		return nil
+	}
+	g := gy.(mat.Matrix)
+	switch mat.DTypeOf(g) {
+	case mat.Float32:
+		r.x.AccGrad(applyRotary[float32](g, -float64(r.position), r.base))
+	default:
+		r.x.AccGrad(applyRotary[float64](g, -float64(r.position), r.base))
+	}
+	return nil
+}
+
+func applyRotary[T float.DType](x mat.Matrix, position, base float64) mat.Matrix {
+	data := mat.Data[T](x)
+	y := make([]T, len(data))
+	size := float64(len(data))
+	for i := 0; i+1 < len(data); i += 2 {
+		sin, cos := math.Sincos(position / math.Pow(base, float64(i)/size))
+		a, b := float64(data[i]), float64(data[i+1])
+		y[i] = T(a*cos - b*sin)
+		y[i+1] = T(a*sin + b*cos)
+	}
+	if len(data)%2 == 1 {
+		y[len(y)-1] = data[len(data)-1]
+	}
+	return mat.NewDense[T](mat.WithShape(x.Shape()...), mat.WithBacking(y))
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gradfn
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotary(t *testing.T) {
+	t.Run("float32", testRotary[float32])
+	t.Run("float64", testRotary[float64])
+}
+
+func testRotary[T float.DType](t *testing.T) {
+	x := mat.NewDense[T](mat.WithBacking([]T{1, 2, 3, 4, 5}), mat.WithGrad(true))
+	f := NewRotary(x, 3, 100)
+	assert.Equal(t, []mat.Tensor{x}, f.Operands())
+	y, err := f.Forward()
+	require.NoError(t, err)
+	assert.Equal(t, x.Shape(), y.Shape())
+
+	// Angles 3 / 100^(0/5) and 3 / 100^(2/5); the last element is unchanged.
+	a0, a1 := 3.0, 3/math.Pow(100, 0.4)
+	assert.InDeltaSlice(t, []T{
+		T(math.Cos(a0) - 2*math.Sin(a0)), T(math.Sin(a0) + 2*math.Cos(a0)),
+		T(3*math.Cos(a1) - 4*math.Sin(a1)), T(3*math.Sin(a1) + 4*math.Cos(a1)),
+		5,
+	}, y.Data(), 1.0e-5)
+
+	// The backward pass rotates the gradients back.
+	require.NoError(t, f.Backward(y))
+	assert.InDeltaSlice(t, []T{1, 2, 3, 4, 5}, x.Grad().Data(), 1.0e-5)
+
+	// The dot product of two rotated vectors depends on the relative position.
+	q := mat.NewDense[T](mat.WithBacking([]T{0.5, -1, 2, 0.3}))
+	k := mat.NewDense[T](mat.WithBacking([]T{-0.7, 0.2, 1, 1.5}))
+	dot := func(qPos, kPos int) float64 {
+		rq, _ := NewRotary(q, qPos, 10000).Forward()
+		rk, _ := NewRotary(k, kPos, 10000).Forward()
+		return rq.(mat.Matrix).DotUnitary(rk.(mat.Matrix)).Item().F64()
+	}
+	assert.InDelta(t, dot(2, 0), dot(7, 5), 1.0e-5)
+}
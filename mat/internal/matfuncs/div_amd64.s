@@ -94,6 +94,7 @@ tailLoop:
 	JMP   tailLoop
 
 end:
+	VZEROUPPER
 	RET
 
 // func DivAVX64(x1 []float64, x2 []float64, y []float64)
@@ -186,6 +187,7 @@ tailLoop:
 	JMP   tailLoop
 
 end:
+	VZEROUPPER
 	RET
 
 // func DivSSE32(x1 []float32, x2 []float32, y []float32)
@@ -129,6 +129,7 @@ TEXT ·LogAVX32(SB), NOSPLIT, $0-48
 	VADDPS       Y0, Y2, Y0
 	VORPS        Y0, Y1, Y0
 	VMOVUPS      Y0, (CX)
+	VZEROUPPER
 	RET
 
 DATA SSE_LCPI0_0<>+0(SB)/4, $0x00800000
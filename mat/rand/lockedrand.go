@@ -25,6 +25,18 @@ func NewLockedRand(seed uint64) *LockedRand {
 	}
 }
 
+// Source is a source of uniformly-distributed pseudo-random uint64 values,
+// such as Philox.
+type Source = rand.Source
+
+// NewLockedRandFromSource creates a new LockedRand, safe for concurrent use,
+// drawing from the given Source.
+func NewLockedRandFromSource(src Source) *LockedRand {
+	return &LockedRand{
+		r: rand.New(src),
+	}
+}
+
 // Seed uses the provided seed value to initialize the generator to a deterministic state.
 // Seed should not be called concurrently with any other Rand method.
 func (lr *LockedRand) Seed(seed uint64) {
@@ -0,0 +1,115 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rand
+
+import "math/bits"
+
+var _ Source = &Philox{}
+
+// Philox4x32-10 constants.
+const (
+	philoxM0 = 0xD2511F53
+	philoxM1 = 0xCD9E8D57
+	philoxW0 = 0x9E3779B9
+	philoxW1 = 0xBB67AE85
+)
+
+// Philox is a counter-based pseudo-random Source implementing the
+// Philox4x32-10 generator (Salmon et al., "Parallel Random Numbers: As Easy
+// as 1, 2, 3", 2011).
+//
+// Each value is a function of the seed, of the stream and of the position
+// in the stream only, so that any number of independent streams can be
+// derived from the same seed (see Split), with no shared state to be
+// synchronized, and the values drawn from a stream do not depend on the
+// values drawn from the others.
+//
+// A Philox is not safe for concurrent use: see NewLockedRandFromSource.
+type Philox struct {
+	// seed is the key of the generator.
+	seed uint64
+	// stream identifies the stream within the seed.
+	stream uint64
+	// counter is the index of the next block of the stream.
+	counter uint64
+	// block holds the values of the current block.
+	block [2]uint64
+	// pos is the index of the next unused value of block.
+	pos int
+}
+
+// NewPhilox returns a new Philox generating the given stream of the seed.
+func NewPhilox(seed, stream uint64) *Philox {
+	return &Philox{
+		seed:   seed,
+		stream: stream,
+		pos:    len(Philox{}.block),
+	}
+}
+
+// Seed sets the seed of the generator, and rewinds its stream.
+func (p *Philox) Seed(seed uint64) {
+	p.seed = seed
+	p.counter = 0
+	p.pos = len(p.block)
+}
+
+// Stream returns the identifier of the stream of the generator.
+func (p *Philox) Stream() uint64 {
+	return p.stream
+}
+
+// Split returns a new Philox generating the sub-stream of p identified by
+// the given key. The result only depends on the seed and the stream of p,
+// and on the key: it does not depend on the values already drawn from p.
+func (p *Philox) Split(key uint64) *Philox {
+	return NewPhilox(p.seed, splitMix64(p.stream^splitMix64(key)))
+}
+
+// Uint64 returns a pseudo-random 64-bit value as a uint64.
+func (p *Philox) Uint64() uint64 {
+	if p.pos == len(p.block) {
+		p.next()
+	}
+	v := p.block[p.pos]
+	p.pos++
+	return v
+}
+
+// next generates the block at the current counter, and advances it.
+func (p *Philox) next() {
+	ctr := [4]uint32{
+		uint32(p.counter), uint32(p.counter >> 32),
+		uint32(p.stream), uint32(p.stream >> 32),
+	}
+	out := philox4x32(ctr, [2]uint32{uint32(p.seed), uint32(p.seed >> 32)})
+	p.block[0] = uint64(out[0]) | uint64(out[1])<<32
+	p.block[1] = uint64(out[2]) | uint64(out[3])<<32
+	p.counter++
+	p.pos = 0
+}
+
+// philox4x32 applies the 10 rounds of Philox4x32 to the counter.
+func philox4x32(ctr [4]uint32, key [2]uint32) [4]uint32 {
+	for i := 0; i < 10; i++ {
+		if i > 0 {
+			key[0] += philoxW0
+			key[1] += philoxW1
+		}
+		hi0, lo0 := bits.Mul32(philoxM0, ctr[0])
+		hi1, lo1 := bits.Mul32(philoxM1, ctr[2])
+		ctr = [4]uint32{hi1 ^ ctr[1] ^ key[0], lo1, hi0 ^ ctr[3] ^ key[1], lo0}
+	}
+	return ctr
+}
+
+// splitMix64 is the finalizer of the SplitMix64 generator, used to scramble
+// the stream identifiers.
+func splitMix64(x uint64) uint64 {
+	x += 0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	return x ^ (x >> 31)
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rand
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhilox4x32(t *testing.T) {
+	// Known-answer vectors of the Random123 library.
+	testCases := []struct {
+		ctr      [4]uint32
+		key      [2]uint32
+		expected [4]uint32
+	}{
+		{
+			ctr:      [4]uint32{0, 0, 0, 0},
+			key:      [2]uint32{0, 0},
+			expected: [4]uint32{0x6627e8d5, 0xe169c58d, 0xbc57ac4c, 0x9b00dbd8},
+		},
+		{
+			ctr:      [4]uint32{0xffffffff, 0xffffffff, 0xffffffff, 0xffffffff},
+			key:      [2]uint32{0xffffffff, 0xffffffff},
+			expected: [4]uint32{0x408f276d, 0x41c83b0e, 0xa20bc7c6, 0x6d5451fd},
+		},
+		{
+			ctr:      [4]uint32{0x243f6a88, 0x85a308d3, 0x13198a2e, 0x03707344},
+			key:      [2]uint32{0xa4093822, 0x299f31d0},
+			expected: [4]uint32{0xd16cfe09, 0x94fdcceb, 0x5001e420, 0x24126ea1},
+		},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, philox4x32(tc.ctr, tc.key))
+	}
+}
+
+func TestPhilox(t *testing.T) {
+	draw := func(p *Philox, n int) []uint64 {
+		vs := make([]uint64, n)
+		for i := range vs {
+			vs[i] = p.Uint64()
+		}
+		return vs
+	}
+
+	a := draw(NewPhilox(42, 1), 5)
+	assert.Equal(t, a, draw(NewPhilox(42, 1), 5), "the same stream must be reproducible")
+	assert.NotEqual(t, a, draw(NewPhilox(42, 2), 5))
+	assert.NotEqual(t, a, draw(NewPhilox(43, 1), 5))
+
+	p := NewPhilox(42, 1)
+	draw(p, 3)
+	p.Seed(42)
+	assert.Equal(t, a, draw(p, 5), "Seed must rewind the stream")
+
+	used := NewPhilox(42, 1)
+	draw(used, 7)
+	assert.Equal(t,
+		draw(NewPhilox(42, 1).Split(3), 5),
+		draw(used.Split(3), 5),
+		"the sub-streams must not depend on the values already drawn",
+	)
+	assert.NotEqual(t, draw(p.Split(3), 5), draw(p.Split(4), 5))
+}
+
+func TestNewLockedRandFromSource(t *testing.T) {
+	r1 := NewLockedRandFromSource(NewPhilox(7, 11))
+	r2 := NewLockedRandFromSource(NewPhilox(7, 11))
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, r1.Float64(), r2.Float64())
+	}
+	v := r1.Float64()
+	assert.True(t, v >= 0 && v < 1)
+}
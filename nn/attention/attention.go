@@ -5,8 +5,6 @@
 package attention
 
 import (
-	"math"
-
 	"github.com/nlpodyssey/spago/ag"
 	"github.com/nlpodyssey/spago/mat"
 )
@@ -15,13 +13,29 @@ import (
 // sequence to compute a representation of the same sequence.
 // This method requires that the query, the key and the value vectors have already been obtained
 // from the input sequence. The scaled factor is the square root of the dimension of the key vectors.
+// With the causal mask, the queries are taken as the last positions of the keys, which may include
+// the ones of the previous steps of an incremental decoding.
 func ScaledDotProductAttention(q []mat.Tensor, k, v, scaleFactor mat.Tensor, useCausalMask bool) ([]mat.Tensor, []mat.Tensor) {
+	return ScaledDotProductAttentionWithBias(q, k, v, scaleFactor, useCausalMask, nil)
+}
+
+// Bias returns the additive biases of the attention scores of the query at the given position
+// over the keys at the positions from `from` to to-1, or nil if there are none. Only the biases
+// of the given keys are computed, so that the attentions over a subset of the keys, such as
+// SlidingWindowAttention, do not pay for the others.
+type Bias func(position, from, to int) mat.Tensor
+
+// ScaledDotProductAttentionWithBias is a ScaledDotProductAttention adding to the scaled scores
+// of each query the biases returned by bias, if not nil, e.g. to encode the relative positions.
+// The queries are taken as the last positions of the keys, as with the causal mask.
+func ScaledDotProductAttentionWithBias(q []mat.Tensor, k, v, scaleFactor mat.Tensor, useCausalMask bool, bias Bias) ([]mat.Tensor, []mat.Tensor) {
 	nodes := make([]mat.Tensor, len(q)*2)
 	attention := nodes[:len(q)]
 	weights := nodes[len(q):]
 
 	causalMaskEnabled := useCausalMask && len(q) > 1
 	kRows := k.Value().Shape()[0]
+	offset := kRows - len(q) // the position of the first query
 
 	kqi := make([]mat.Tensor, len(q))
 	for i, qi := range q {
@@ -31,9 +45,14 @@ func ScaledDotProductAttention(q []mat.Tensor, k, v, scaleFactor mat.Tensor, use
 	for i, kqii := range kqi {
 		scores := ag.ProdScalar(kqii, scaleFactor)
 
+		if bias != nil {
+			if b := bias(offset+i, 0, kRows); b != nil {
+				scores = ag.Add(scores, b)
+			}
+		}
+
 		if causalMaskEnabled {
-			causalMask := k.Value().(mat.Matrix).NewMatrix(mat.WithBacking(makeCausalMask(i, kRows))) // TODO: use external cache for causal mask?
-			scores = ag.Add(scores, causalMask)
+			scores = ag.Add(scores, causalMaskRow(offset+i, kRows, mat.DTypeOf(k.Value().(mat.Matrix))))
 		}
 
 		weights[i] = ag.Softmax(scores)
@@ -45,14 +64,3 @@ func ScaledDotProductAttention(q []mat.Tensor, k, v, scaleFactor mat.Tensor, use
 
 	return attention, weights
 }
-
-// makeCausalMask returns a slice of size seqLength filled with zeros until curIndex, and the rest with -inf.
-// FIXME: avoid specific float64 type, later passed to NewVec
-func makeCausalMask(curIndex, seqLength int) []float64 {
-	negInf := math.Inf(-1)
-	causalMask := make([]float64, seqLength)
-	for k := curIndex + 1; k < seqLength; k++ {
-		causalMask[k] = negInf
-	}
-	return causalMask
-}
@@ -0,0 +1,48 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// LinearAttention is a kernelized attention, whose scores are the dot products of the features
+// of the queries and of the keys, instead of the exponentials of their scaled dot products (as in
+// the linear transformer and in Performer). The features q and k, one for each row of k, must be
+// positive, e.g. given by ag.PositiveELU or by positive random features approximating the softmax.
+//
+// Since the sums of the products of the features of the keys and the values are shared by the
+// queries, its cost grows linearly with the length of the sequence. With the causal mask, the queries
+// are taken as the last positions of the keys, and only attend to the keys up to their positions;
+// a single ag.CausalLinearAttention operator accumulates the sums one key at a time, and recomputes
+// them in the backward pass, so that the memory does not grow with the length of the sequence.
+//
+// Unlike ScaledDotProductAttention, it returns no attention weights, which are never computed.
+func LinearAttention(q []mat.Tensor, k, v mat.Tensor, useCausalMask bool) []mat.Tensor {
+	attention := make([]mat.Tensor, len(q))
+
+	if useCausalMask {
+		y := ag.CausalLinearAttention(q, k, v)
+		for i := range attention {
+			attention[i] = ag.ColView(y, i)
+		}
+		return attention
+	}
+
+	kRows := k.Value().Shape()[0]
+
+	// The sums of the outer products of the features of the keys and the
+	// values, and of the features of the keys, shared by the queries.
+	kv := ag.Mul(ag.T(k), v)
+	ones := k.Value().(mat.Matrix).NewMatrix(mat.WithShape(kRows, 1)).OnesLike()
+	z := ag.MulT(k, ones)
+
+	for i, qi := range q {
+		attention[i] = ag.DivScalar(ag.MulT(kv, qi), ag.Dot(z, qi))
+	}
+
+	return attention
+}
@@ -0,0 +1,72 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinearAttention(t *testing.T) {
+	t.Run("float32", testLinearAttention[float32])
+	t.Run("float64", testLinearAttention[float64])
+}
+
+// testLinearAttention compares LinearAttention with the weighted sums of
+// the values, with weights proportional to the dot products of the features.
+func testLinearAttention[T float.DType](t *testing.T) {
+	const n, size = 5, 3
+	for _, causal := range []bool{false, true} {
+		for _, queries := range []int{n, 2} {
+			t.Run(fmt.Sprintf("causal %v, %d queries", causal, queries), func(t *testing.T) {
+				q, k, v := newTestAttentionInputs[T](n, size, 3)
+				q = q[n-queries:]
+				for i, qi := range q {
+					q[i] = ag.PositiveELU(qi)
+				}
+				fk := ag.PositiveELU(k)
+
+				results := LinearAttention(q, fk, v, causal)
+				require.Len(t, results, queries)
+
+				kData := fk.Value().Data().F64()
+				vData := v.Data().F64()
+				for i, r := range results {
+					keys := n
+					if causal {
+						keys = n - queries + i + 1
+					}
+					qData := q[i].Value().Data().F64()
+					expected := make([]float64, size)
+					var sum float64
+					for j := 0; j < keys; j++ {
+						var w float64
+						for d := 0; d < size; d++ {
+							w += qData[d] * kData[j*size+d]
+						}
+						sum += w
+						for d := range expected {
+							expected[d] += w * vData[j*size+d]
+						}
+					}
+					for d := range expected {
+						expected[d] /= sum
+					}
+					assert.Equal(t, []int{size, 1}, r.Shape())
+					assert.InDeltaSlice(t, expected, r.Value().Data().F64(), 1.0e-5, "query %d", i)
+				}
+
+				require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(results...))))
+				assert.True(t, k.HasGrad())
+				assert.True(t, v.HasGrad())
+			})
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"sort"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// SlidingWindowAttention is a ScaledDotProductAttentionWithBias where each query only attends to
+// the keys within window positions from its own (local attention), and to the keys at the global
+// positions, whose queries in turn attend to all the keys, as in Longformer. With the causal mask,
+// the queries only attend to the keys up to their positions. Its cost grows linearly with the
+// length of the sequence, for a fixed window and number of global positions.
+//
+// The queries are taken as the last positions of the keys, as with the causal mask. The weights of
+// each query are the ones of the keys of the window, followed by the ones of the global keys out of
+// it, in increasing order of position. The biases, if any, are only computed for the keys of the
+// window and the global ones. The global positions out of the keys are ignored.
+func SlidingWindowAttention(q []mat.Tensor, k, v, scaleFactor mat.Tensor, window int, global []int, useCausalMask bool, bias Bias) ([]mat.Tensor, []mat.Tensor) {
+	nodes := make([]mat.Tensor, len(q)*2)
+	attention := nodes[:len(q)]
+	weights := nodes[len(q):]
+
+	kRows := k.Value().Shape()[0]
+	offset := kRows - len(q) // the position of the first query
+	kCols := k.Value().Shape()[1]
+	vCols := v.Value().Shape()[1]
+
+	isGlobal := make(map[int]bool, len(global))
+	for _, p := range global {
+		isGlobal[p] = true
+	}
+	global = global[:0:0]
+	for p := range isGlobal {
+		if p >= 0 && p < kRows {
+			global = append(global, p)
+		}
+	}
+	sort.Ints(global)
+
+	// The rows of the global keys and values, shared by the queries.
+	globalKeys := make(map[int]mat.Tensor, len(global))
+	globalValues := make(map[int]mat.Tensor, len(global))
+
+	for i, qi := range q {
+		position := offset + i
+		from, to := 0, kRows
+		if useCausalMask {
+			to = position + 1
+		}
+		var extra []int // the global positions out of [from, to)
+		if !isGlobal[position] {
+			from = max(0, position-window)
+			to = min(to, position+window+1)
+			for _, p := range global {
+				if p >= to && useCausalMask {
+					break
+				}
+				if p < from || p >= to {
+					extra = append(extra, p)
+				}
+			}
+		}
+
+		ks := sliceRows(k, from, to, kRows, kCols)
+		vs := sliceRows(v, from, to, kRows, vCols)
+		if len(extra) > 0 {
+			ek := make([]mat.Tensor, len(extra))
+			ev := make([]mat.Tensor, len(extra))
+			for j, p := range extra {
+				if _, ok := globalKeys[p]; !ok {
+					globalKeys[p] = ag.RowView(k, p)
+					globalValues[p] = ag.RowView(v, p)
+				}
+				ek[j], ev[j] = globalKeys[p], globalValues[p]
+			}
+			ks = ag.AppendRows(ks, ek...)
+			vs = ag.AppendRows(vs, ev...)
+		}
+
+		scores := ag.ProdScalar(ag.Mul(ks, qi), scaleFactor)
+		if bias != nil {
+			if b := windowBiases(bias, position, from, to, extra); b != nil {
+				scores = ag.Add(scores, b)
+			}
+		}
+		weights[i] = ag.Softmax(scores)
+		attention[i] = ag.MulT(vs, weights[i])
+	}
+
+	return attention, weights
+}
+
+// sliceRows returns the rows of x in [from, to), or x itself if they are all
+// its rows.
+func sliceRows(x mat.Tensor, from, to, rows, cols int) mat.Tensor {
+	if from == 0 && to == rows {
+		return x
+	}
+	return ag.Slice(x, from, 0, to, cols)
+}
+
+// windowBiases returns the biases of the keys in [from, to), followed by the
+// ones of the extra keys, or nil if there are none.
+func windowBiases(bias Bias, position, from, to int, extra []int) mat.Tensor {
+	b := bias(position, from, to)
+	if b == nil || len(extra) == 0 {
+		return b
+	}
+	eb := make([]mat.Tensor, len(extra))
+	for j, p := range extra {
+		eb[j] = bias(position, p, p+1)
+	}
+	return ag.AppendRows(b, eb...)
+}
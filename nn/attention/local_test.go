@@ -0,0 +1,136 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAttentionInputs returns n queries and the matrices of n keys and
+// values, with deterministic values depending on seed.
+func newTestAttentionInputs[T float.DType](n, size, seed int) ([]mat.Tensor, mat.Matrix, mat.Matrix) {
+	value := func(i int) T {
+		return T((i*7+seed)%13)/6 - 1
+	}
+	q := make([]mat.Tensor, n)
+	for i := range q {
+		data := make([]T, size)
+		for j := range data {
+			data[j] = value(i*size + j + 5)
+		}
+		q[i] = mat.NewDense[T](mat.WithBacking(data), mat.WithGrad(true))
+	}
+	kData := make([]T, n*size)
+	vData := make([]T, n*size)
+	for i := range kData {
+		kData[i] = value(i)
+		vData[i] = value(i + 11)
+	}
+	k := mat.NewDense[T](mat.WithShape(n, size), mat.WithBacking(kData), mat.WithGrad(true))
+	v := mat.NewDense[T](mat.WithShape(n, size), mat.WithBacking(vData), mat.WithGrad(true))
+	return q, k, v
+}
+
+func TestSlidingWindowAttention(t *testing.T) {
+	t.Run("float32", testSlidingWindowAttention[float32])
+	t.Run("float64", testSlidingWindowAttention[float64])
+}
+
+// testSlidingWindowAttention checks that SlidingWindowAttention is the same
+// as ScaledDotProductAttentionWithBias with the equivalent mask.
+func testSlidingWindowAttention[T float.DType](t *testing.T) {
+	const n, size, window = 7, 3, 1
+	global := []int{5, 1, 5}
+	scaleFactor := mat.Scalar(T(1.0 / math.Sqrt(size)))
+	distance := func(position, from, to int) mat.Tensor {
+		data := make([]T, to-from)
+		for i := range data {
+			data[i] = -T(position-from-i) / 4
+		}
+		return mat.NewDense[T](mat.WithBacking(data))
+	}
+
+	for _, causal := range []bool{false, true} {
+		for name, bias := range map[string]Bias{"no bias": nil, "bias": distance} {
+			t.Run(fmt.Sprintf("causal %v, %s", causal, name), func(t *testing.T) {
+				windowMask := NewMask(func(query, key int) bool {
+					local := key >= query-window && key <= query+window
+					return (local || query == 1 || query == 5 || key == 1 || key == 5) && (!causal || key <= query)
+				})
+				q, k, v := newTestAttentionInputs[T](n, size, 1)
+				expected, _ := ScaledDotProductAttentionWithBias(q, k, v, scaleFactor, causal, JoinBiases(bias, windowMask.Bias(mat.DTypeOf(k))))
+
+				// The last queries, as in an incremental decoding.
+				for _, queries := range []int{n, 2} {
+					q, k, v := newTestAttentionInputs[T](n, size, 1)
+					q = q[n-queries:]
+					results, weights := SlidingWindowAttention(q, k, v, scaleFactor, window, global, causal, bias)
+					require.Len(t, results, queries)
+					require.Len(t, weights, queries)
+					for i, r := range results {
+						assert.InDeltaSlice(t, expected[n-queries+i].Value().Data(), r.Value().Data(), 1.0e-5, "query %d", i)
+					}
+					require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(results...))))
+					assert.True(t, k.HasGrad())
+					assert.True(t, v.HasGrad())
+				}
+			})
+		}
+	}
+}
+
+func TestSlidingWindowAttention_Weights(t *testing.T) {
+	q, k, v := newTestAttentionInputs[float64](6, 2, 2)
+	_, weights := SlidingWindowAttention(q, k, v, mat.Scalar(1.0), 1, []int{0}, false, nil)
+	// The global position attends to all the keys, and is in the window of
+	// the next one.
+	assert.Equal(t, 6, weights[0].Value().Size())
+	assert.Equal(t, 3, weights[1].Value().Size())
+	assert.Equal(t, 4, weights[3].Value().Size())
+	assert.Equal(t, 3, weights[5].Value().Size())
+	// With the causal mask, only the keys up to each query.
+	_, weights = SlidingWindowAttention(q, k, v, mat.Scalar(1.0), 1, []int{3}, true, nil)
+	assert.Equal(t, 1, weights[0].Value().Size())
+	assert.Equal(t, 2, weights[2].Value().Size())
+	assert.Equal(t, 4, weights[3].Value().Size())
+	assert.Equal(t, 3, weights[5].Value().Size())
+}
+
+func TestSlidingWindowAttention_BiasRange(t *testing.T) {
+	const n, window = 64, 2
+	global := []int{0, 40}
+	for _, causal := range []bool{false, true} {
+		q, k, v := newTestAttentionInputs[float32](n, 2, 3)
+		keep := make([]bool, n)
+		for i := range keep {
+			keep[i] = i%5 != 3
+		}
+		mask := KeyPaddingMask(keep).Bias(mat.Float32)
+		calls := 0
+		bias := func(position, from, to int) mat.Tensor {
+			calls++
+			// Only the global queries attend to all the keys.
+			if position != 0 && position != 40 {
+				assert.LessOrEqual(t, to-from, 2*window+1, "position %d", position)
+			}
+			return mask(position, from, to)
+		}
+		_, weights := SlidingWindowAttention(q, k, v, mat.Scalar(float32(1)), window, global, causal, bias)
+		assert.Greater(t, calls, n)
+		for i, w := range weights {
+			if i != 0 && i != 40 {
+				assert.Less(t, w.Value().Size(), n)
+			}
+		}
+	}
+}
@@ -0,0 +1,308 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// Mask is an attention mask, telling which keys each query can attend to,
+// and optionally adding biases to the attention scores. The queries and the
+// keys are identified by their positions, from 0; the position of a query
+// of an incremental decoding follows the ones in the cache.
+//
+// The rows of a Mask, i.e. the additive biases of the scores of each query,
+// are reused, so that a Mask can be shared by the heads and the layers of a
+// model. The rows of the masks not depending on the query, such as
+// KeyPaddingMask, are views of a single vector over all the keys, while the
+// others are kept in a cache of bounded size, evicting the least recently
+// used rows. It is safe for concurrent use.
+type Mask struct {
+	// allowed reports whether a query can attend to a key.
+	allowed func(query, key int) bool
+	// bias, if not nil, returns the bias of the score of a query and a key
+	// the query can attend to.
+	bias func(query, key int) float64
+	// keyOnly reports whether allowed and bias do not depend on the query.
+	keyOnly bool
+	mu      sync.Mutex
+	// keyRows are the rows of a keyOnly mask over all the keys seen, one for
+	// each type.
+	keyRows map[mat.DType]mat.Matrix
+	rows    maskRowCache
+}
+
+// NewMask returns a new Mask allowing each query to attend to the keys for
+// which allowed returns true.
+func NewMask(allowed func(query, key int) bool) *Mask {
+	return &Mask{allowed: allowed}
+}
+
+// NewAdditiveMask returns a new Mask adding to the score of each query and
+// key the value returned by bias, which can be -inf to mask out the key.
+func NewAdditiveMask(bias func(query, key int) float64) *Mask {
+	return &Mask{
+		allowed: func(int, int) bool { return true },
+		bias:    bias,
+	}
+}
+
+// CausalMask returns a new Mask allowing each query to attend to the keys
+// up to its position.
+func CausalMask() *Mask {
+	return NewMask(func(query, key int) bool { return key <= query })
+}
+
+// KeyPaddingMask returns a new Mask allowing the queries to attend to the
+// keys for which keep is true, e.g. excluding the padding of sequences of
+// different lengths. The keys beyond the length of keep are masked out.
+func KeyPaddingMask(keep []bool) *Mask {
+	return &Mask{
+		allowed: func(_, key int) bool { return key < len(keep) && keep[key] },
+		keyOnly: true,
+	}
+}
+
+// BooleanMask returns a new Mask allowing each query to attend to the keys
+// for which allowed[query][key] is true. The queries and keys beyond the
+// matrix are masked out.
+func BooleanMask(allowed [][]bool) *Mask {
+	return NewMask(func(query, key int) bool {
+		return query < len(allowed) && key < len(allowed[query]) && allowed[query][key]
+	})
+}
+
+// MatrixAdditiveMask returns a new Mask adding biases[query][key] to each
+// score. The queries and keys beyond the matrix are masked out.
+func MatrixAdditiveMask(biases [][]float64) *Mask {
+	return NewAdditiveMask(func(query, key int) float64 {
+		if query >= len(biases) || key >= len(biases[query]) {
+			return math.Inf(-1)
+		}
+		return biases[query][key]
+	})
+}
+
+// PrefixLMMask returns a new Mask of a prefix language model: each query can
+// attend to all the keys of the prefix of the given length, and causally to
+// the following ones.
+func PrefixLMMask(prefixLength int) *Mask {
+	return NewMask(func(query, key int) bool { return key < prefixLength || key <= query })
+}
+
+// BlockDiagonalMask returns a new Mask of packed sequences of the given
+// lengths, concatenated: each query can only attend to the keys of its own
+// sequence. The queries and keys beyond the sequences are masked out.
+func BlockDiagonalMask(lengths ...int) *Mask {
+	var segments []int
+	for s, length := range lengths {
+		for i := 0; i < length; i++ {
+			segments = append(segments, s)
+		}
+	}
+	return NewMask(func(query, key int) bool {
+		return query < len(segments) && key < len(segments) && segments[query] == segments[key]
+	})
+}
+
+// And returns a new Mask allowing each query to attend to the keys allowed
+// by m and by all the others, adding all their biases.
+func (m *Mask) And(others ...*Mask) *Mask {
+	masks := append([]*Mask{m}, others...)
+	keyOnly := true
+	for _, mask := range masks {
+		keyOnly = keyOnly && mask.keyOnly
+	}
+	combined := &Mask{
+		keyOnly: keyOnly,
+		allowed: func(query, key int) bool {
+			for _, mask := range masks {
+				if !mask.allowed(query, key) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+	for _, mask := range masks {
+		if mask.bias != nil {
+			combined.bias = func(query, key int) float64 {
+				var sum float64
+				for _, mask := range masks {
+					if mask.bias != nil {
+						sum += mask.bias(query, key)
+					}
+				}
+				return sum
+			}
+			break
+		}
+	}
+	return combined
+}
+
+// Row returns the additive biases of the scores of the query at the given
+// position over the keys from `from` to to-1, as a vector of the given type:
+// the biases of the mask for the keys the query can attend to, and -inf for
+// the others. The vector is shared, and must not be modified.
+func (m *Mask) Row(query, from, to int, dtype mat.DType) mat.Matrix {
+	checkMaskType(dtype)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.keyOnly {
+		return m.keyRow(from, to, dtype)
+	}
+	k := maskRowKey{query: query, from: from, to: to, dtype: dtype}
+	if row, ok := m.rows.get(k); ok {
+		return row
+	}
+	row := newMaskRow(m, query, from, to, dtype)
+	m.rows.add(k, row)
+	return row
+}
+
+// keyRow returns the row of a keyOnly mask over the keys from `from` to
+// to-1, sharing the data of the row over all the keys seen, which is grown as
+// needed.
+func (m *Mask) keyRow(from, to int, dtype mat.DType) mat.Matrix {
+	row := m.keyRows[dtype]
+	if row == nil || row.Size() < to {
+		size := to
+		if row != nil {
+			size = max(to, 2*row.Size())
+		}
+		row = newMaskRow(m, 0, 0, size, dtype)
+		if m.keyRows == nil {
+			m.keyRows = make(map[mat.DType]mat.Matrix)
+		}
+		m.keyRows[dtype] = row // the previous rows keep sharing the old data
+	}
+	if from == 0 && row.Size() == to {
+		return row
+	}
+	return rowsView(row, from, to-from)
+}
+
+// NewRow is the same as Row, but the vector is built anew and not cached,
+// e.g. for the rows of an incremental decoding, which are not reused by the
+// following steps.
+func (m *Mask) NewRow(query, from, to int, dtype mat.DType) mat.Matrix {
+	checkMaskType(dtype)
+	return newMaskRow(m, query, from, to, dtype)
+}
+
+func checkMaskType(dtype mat.DType) {
+	if dtype != mat.Float32 && dtype != mat.Float64 {
+		panic(fmt.Sprintf("attention: unsupported mask type %v", dtype))
+	}
+}
+
+func newMaskRow(m *Mask, query, from, to int, dtype mat.DType) mat.Matrix {
+	if dtype == mat.Float32 {
+		return newTypedMaskRow[float32](m, query, from, to)
+	}
+	return newTypedMaskRow[float64](m, query, from, to)
+}
+
+func newTypedMaskRow[T float.DType](m *Mask, query, from, to int) mat.Matrix {
+	data := make([]T, to-from)
+	negInf := T(math.Inf(-1))
+	for i := range data {
+		key := from + i
+		switch {
+		case !m.allowed(query, key):
+			data[i] = negInf
+		case m.bias != nil:
+			data[i] = T(m.bias(query, key))
+		}
+	}
+	return mat.NewDense[T](mat.WithShape(len(data), 1), mat.WithBacking(data))
+}
+
+// Bias returns the Bias of the mask, with vectors of the given type.
+func (m *Mask) Bias(dtype mat.DType) Bias {
+	return func(position, from, to int) mat.Tensor {
+		return m.Row(position, from, to, dtype)
+	}
+}
+
+// JoinBiases returns the Bias adding the ones given, skipping the nil ones,
+// or nil if there are none.
+func JoinBiases(biases ...Bias) Bias {
+	var nonNil []Bias
+	for _, b := range biases {
+		if b != nil {
+			nonNil = append(nonNil, b)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	}
+	return func(position, from, to int) mat.Tensor {
+		var sum mat.Tensor
+		for _, b := range nonNil {
+			if v := b(position, from, to); v != nil {
+				if sum == nil {
+					sum = v
+				} else {
+					sum = ag.Add(sum, v)
+				}
+			}
+		}
+		return sum
+	}
+}
+
+// causalPattern holds n zeros followed by n -inf, whose slices of any
+// length up to n are the rows of the causal masks.
+type causalPattern[T float.DType] struct {
+	mu   sync.Mutex
+	data []T
+}
+
+var (
+	causalPattern32 causalPattern[float32]
+	causalPattern64 causalPattern[float64]
+)
+
+// row returns the row of the causal mask of the query at the given position
+// over the given number of keys, sharing the data of the pattern, which is
+// grown as needed.
+func (p *causalPattern[T]) row(position, keys int) mat.Matrix {
+	p.mu.Lock()
+	if len(p.data)/2 < keys {
+		n := max(keys, len(p.data))
+		data := make([]T, 2*n)
+		negInf := T(math.Inf(-1))
+		for i := n; i < len(data); i++ {
+			data[i] = negInf
+		}
+		p.data = data // the previous rows keep sharing the old data
+	}
+	data := p.data
+	p.mu.Unlock()
+
+	start := len(data)/2 - 1 - position
+	return mat.NewDense[T](mat.WithShape(keys, 1), mat.WithBacking(data[start:start+keys]))
+}
+
+// causalMaskRow returns the row of the causal mask of the query at the given
+// position over the given number of keys, as a vector of the given type.
+// The vector is shared, and must not be modified.
+func causalMaskRow(position, keys int, dtype mat.DType) mat.Matrix {
+	if dtype == mat.Float32 {
+		return causalPattern32.row(position, keys)
+	}
+	return causalPattern64.row(position, keys)
+}
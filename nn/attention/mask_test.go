@@ -0,0 +1,136 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMask_Row(t *testing.T) {
+	inf := math.Inf(-1)
+	testCases := []struct {
+		name     string
+		mask     *Mask
+		query    int
+		expected []float64
+	}{
+		{"causal", CausalMask(), 1, []float64{0, 0, inf, inf}},
+		{"key padding", KeyPaddingMask([]bool{true, false, true}), 0, []float64{0, inf, 0, inf}},
+		{"boolean", BooleanMask([][]bool{{true}, {false, true, true, false}}), 1, []float64{inf, 0, 0, inf}},
+		{"additive", MatrixAdditiveMask([][]float64{{1, 2, 3, inf}}), 0, []float64{1, 2, 3, inf}},
+		{"prefix LM", PrefixLMMask(3), 0, []float64{0, 0, 0, inf}},
+		{"prefix LM after the prefix", PrefixLMMask(1), 2, []float64{0, 0, 0, inf}},
+		{"block diagonal", BlockDiagonalMask(1, 2, 1), 2, []float64{inf, 0, 0, inf}},
+		{"and", CausalMask().And(KeyPaddingMask([]bool{false, true, true, true}), MatrixAdditiveMask([][]float64{{}, {}, {1, 2, 3, 4}})), 2, []float64{inf, 2, 3, inf}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			row := tc.mask.Row(tc.query, 0, 4, mat.Float64)
+			assert.Equal(t, []int{4, 1}, row.Shape())
+			assert.Equal(t, tc.expected, row.Data().F64())
+			assert.Same(t, row, tc.mask.Row(tc.query, 0, 4, mat.Float64), "the rows are cached")
+
+			row32 := tc.mask.Row(tc.query, 0, 4, mat.Float32)
+			assert.Equal(t, mat.Float32, mat.DTypeOf(row32))
+			assert.Equal(t, tc.expected, row32.Data().F64())
+		})
+	}
+}
+
+func TestCausalMaskRow(t *testing.T) {
+	inf := math.Inf(-1)
+	assert.Equal(t, []float64{0, 0, inf}, causalMaskRow(1, 3, mat.Float64).Data().F64())
+	assert.Equal(t, []float64{0, 0, 0, 0, 0, inf, inf}, causalMaskRow(4, 7, mat.Float64).Data().F64())
+	assert.Equal(t, []float64{0, 0, 0}, causalMaskRow(2, 3, mat.Float32).Data().F64())
+	assert.Equal(t, []float64{0}, causalMaskRow(0, 1, mat.Float64).Data().F64())
+}
+
+func TestScaledDotProductAttentionWithBias_KeyPadding(t *testing.T) {
+	q := []mat.Tensor{
+		mat.NewDense[float64](mat.WithBacking([]float64{1.1, 0.0, 2.3})),
+		mat.NewDense[float64](mat.WithBacking([]float64{2.2, -0.5, 0.3})),
+	}
+	keys := []float64{
+		0.0, 1.2, 1.3,
+		4.5, 4.3, 0.2,
+		2.7, 3.6, 2.1,
+	}
+	values := []float64{
+		1.2, 2.3, 3.4,
+		2.2, 8.5, 0.0,
+		2.3, 6.5, 3.5,
+	}
+	k := mat.NewDense[float64](mat.WithShape(3, 3), mat.WithBacking(keys))
+	v := mat.NewDense[float64](mat.WithShape(3, 3), mat.WithBacking(values))
+	scaleFactor := mat.Scalar(1.0 / math.Sqrt(3))
+
+	mask := KeyPaddingMask([]bool{true, false, true})
+	results, weights := ScaledDotProductAttentionWithBias(q, k, v, scaleFactor, false, mask.Bias(mat.Float64))
+
+	// The same as the attention over the keys which are not masked out.
+	k2 := mat.NewDense[float64](mat.WithShape(2, 3), mat.WithBacking(append(append([]float64{}, keys[:3]...), keys[6:]...)))
+	v2 := mat.NewDense[float64](mat.WithShape(2, 3), mat.WithBacking(append(append([]float64{}, values[:3]...), values[6:]...)))
+	expected, _ := ScaledDotProductAttention(q, k2, v2, scaleFactor, false)
+	require.Len(t, results, 2)
+	for i := range results {
+		assert.InDelta(t, 0, weights[i].Value().Data().F64()[1], 1.0e-12)
+		assert.InDeltaSlice(t, expected[i].Value().Data(), results[i].Value().Data(), 1.0e-9)
+	}
+}
+
+func TestJoinBiases(t *testing.T) {
+	assert.Nil(t, JoinBiases(nil, nil))
+	a := CausalMask().Bias(mat.Float64)
+	b := MatrixAdditiveMask([][]float64{{}, {1, 2, 3}}).Bias(mat.Float64)
+	assert.Equal(t, []float64{0, 0, math.Inf(-1)}, JoinBiases(nil, a)(1, 0, 3).Value().Data().F64())
+	assert.Equal(t, []float64{1, 2, math.Inf(-1)}, JoinBiases(a, nil, b)(1, 0, 3).Value().Data().F64())
+	assert.Equal(t, []float64{2, math.Inf(-1)}, JoinBiases(a, b)(1, 1, 3).Value().Data().F64())
+}
+
+func TestMask_RowCache(t *testing.T) {
+	inf := math.Inf(-1)
+
+	// The rows of a key padding mask are views of a single row, whatever
+	// the query.
+	mask := KeyPaddingMask([]bool{true, false, true})
+	for query := 0; query < 100; query++ {
+		mask.Row(query, 0, 3, mat.Float64)
+	}
+	assert.Equal(t, 0, mask.rows.len())
+	assert.Equal(t, []float64{0, inf}, mask.Row(7, 0, 2, mat.Float64).Data().F64())
+	assert.Equal(t, []float64{0, inf, 0, inf, inf}, mask.Row(7, 0, 5, mat.Float64).Data().F64())
+	assert.Equal(t, 6, mask.keyRows[mat.Float64].Size(), "the row doubled")
+	assert.Equal(t, []float64{0, inf}, mask.Row(7, 2, 4, mat.Float64).Data().F64())
+	combined := mask.And(KeyPaddingMask([]bool{false, true, true}))
+	assert.Equal(t, []float64{inf, inf, 0}, combined.Row(5, 0, 3, mat.Float64).Data().F64())
+	assert.Equal(t, 0, combined.rows.len())
+
+	// The rows of the other masks are evicted beyond the maximum size.
+	causal := CausalMask()
+	const keys = 1 << 10
+	first := causal.Row(0, 0, keys, mat.Float32)
+	for query := 1; query < 2*maxMaskCacheSize/keys; query++ {
+		causal.Row(query, 0, keys, mat.Float32)
+	}
+	assert.Equal(t, maxMaskCacheSize/keys, causal.rows.len())
+	assert.LessOrEqual(t, causal.rows.size, maxMaskCacheSize)
+	assert.NotSame(t, first, causal.Row(0, 0, keys, mat.Float32))
+	last := causal.Row(2*maxMaskCacheSize/keys-1, 0, keys, mat.Float32)
+	assert.Same(t, last, causal.Row(2*maxMaskCacheSize/keys-1, 0, keys, mat.Float32))
+}
+
+func TestMask_NewRow(t *testing.T) {
+	inf := math.Inf(-1)
+	mask := CausalMask()
+	row := mask.NewRow(5, 4, 8, mat.Float32)
+	assert.Equal(t, []float64{0, 0, inf, inf}, row.Data().F64())
+	assert.NotSame(t, row, mask.NewRow(5, 4, 8, mat.Float32))
+	assert.Equal(t, 0, mask.rows.len(), "the rows are not cached")
+}
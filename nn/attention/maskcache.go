@@ -0,0 +1,82 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"container/list"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// maxMaskCacheSize is the maximum number of values of the rows kept in the
+// cache of a Mask.
+const maxMaskCacheSize = 1 << 20
+
+type maskRowKey struct {
+	query, from, to int
+	dtype           mat.DType
+}
+
+// maskRowCache is a cache of the rows of a Mask, holding at most
+// maxMaskCacheSize values, which evicts the least recently used rows.
+// It is not safe for concurrent use.
+type maskRowCache struct {
+	entries map[maskRowKey]*list.Element
+	order   list.List // front: most recently used
+	size    int       // the number of values of the rows
+}
+
+type maskRowEntry struct {
+	key maskRowKey
+	row mat.Matrix
+}
+
+// get returns the cached row of the given key, if any.
+func (c *maskRowCache) get(k maskRowKey) (mat.Matrix, bool) {
+	e, ok := c.entries[k]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*maskRowEntry).row, true
+}
+
+// add adds a row to the cache, evicting the least recently used ones as
+// needed. The rows larger than the cache are not added.
+func (c *maskRowCache) add(k maskRowKey, row mat.Matrix) {
+	if row.Size() > maxMaskCacheSize {
+		return
+	}
+	if c.entries == nil {
+		c.entries = make(map[maskRowKey]*list.Element)
+	}
+	for c.size+row.Size() > maxMaskCacheSize {
+		oldest := c.order.Back()
+		entry := c.order.Remove(oldest).(*maskRowEntry)
+		delete(c.entries, entry.key)
+		c.size -= entry.row.Size()
+	}
+	c.entries[k] = c.order.PushFront(&maskRowEntry{key: k, row: row})
+	c.size += row.Size()
+}
+
+// len returns the number of cached rows.
+func (c *maskRowCache) len() int {
+	return len(c.entries)
+}
+
+// rowsView returns a vector of n values of the vector v, from the given one,
+// sharing its memory.
+func rowsView(v mat.Matrix, from, n int) mat.Matrix {
+	if mat.DTypeOf(v) == mat.Float32 {
+		return newRowsView[float32](v, from, n)
+	}
+	return newRowsView[float64](v, from, n)
+}
+
+func newRowsView[T float.DType](v mat.Matrix, from, n int) mat.Matrix {
+	return mat.NewDense[T](mat.WithShape(n, 1), mat.WithBacking(mat.Data[T](v)[from:from+n]))
+}
@@ -6,6 +6,7 @@ package multiheadattention
 
 import (
 	"encoding/gob"
+	"fmt"
 	"math"
 
 	"github.com/nlpodyssey/spago/ag"
@@ -15,6 +16,7 @@ import (
 	"github.com/nlpodyssey/spago/mat/rand"
 	"github.com/nlpodyssey/spago/nn"
 	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/attention"
 	"github.com/nlpodyssey/spago/nn/attention/selfattention"
 	"github.com/nlpodyssey/spago/nn/linear"
 )
@@ -24,6 +26,7 @@ var _ nn.Model = &Model{}
 // Model contains the serializable parameters.
 type Model struct {
 	nn.Module
+	Config      Config
 	Heads       []*selfattention.Model
 	OutputMerge *linear.Model
 }
@@ -32,11 +35,46 @@ func init() {
 	gob.Register(&Model{})
 }
 
+// Config provides configuration settings for a multi-head attention Model.
+type Config struct {
+	Size       int
+	NumOfHeads int
+	// NumOfKVHeads is the number of heads projecting the keys and values,
+	// each shared by a group of NumOfHeads/NumOfKVHeads query heads
+	// (grouped-query attention); it must divide NumOfHeads. One is the
+	// multi-query attention, while zero means NumOfHeads, one for each head.
+	NumOfKVHeads     int
+	UseCausalMask    bool
+	IsCrossAttention bool
+	// Position provides the settings of the relative position information of
+	// the heads. With the ALiBiPositionEncoding, the slope of each head is
+	// given by selfattention.ALiBiSlopes, instead of ALiBiSlope.
+	Position selfattention.PositionConfig
+	// Attention provides the settings of the attention mechanism of the heads.
+	Attention selfattention.AttentionConfig
+}
+
 // New returns a new model with parameters initialized to zeros.
 func New[T float.DType](size, numOfHeads int, useCausalMask, isCrossAttention bool) *Model {
+	return NewWithConfig[T](Config{
+		Size:             size,
+		NumOfHeads:       numOfHeads,
+		UseCausalMask:    useCausalMask,
+		IsCrossAttention: isCrossAttention,
+	})
+}
+
+// NewWithConfig returns a new model with parameters initialized to zeros,
+// according to the given configuration.
+// It panics if the number of key-value heads does not divide the number of heads.
+func NewWithConfig[T float.DType](config Config) *Model {
+	if kv := config.NumOfKVHeads; kv < 0 || kv > 0 && config.NumOfHeads%kv != 0 {
+		panic(fmt.Sprintf("multiheadattention: the number of key-value heads (%d) must divide the number of heads (%d)", kv, config.NumOfHeads))
+	}
 	return &Model{
-		Heads:       makeAttentionHeads[T](size, numOfHeads, useCausalMask, isCrossAttention),
-		OutputMerge: linear.New[T](size, size),
+		Config:      config,
+		Heads:       makeAttentionHeads[T](config),
+		OutputMerge: linear.New[T](config.Size, config.Size),
 	}
 }
 
@@ -49,25 +87,48 @@ func (m *Model) Init(rng *rand.LockedRand) {
 	}
 }
 
-func makeAttentionHeads[T float.DType](dm, n int, useCausalMask, isCrossAttention bool) []*selfattention.Model {
+func makeAttentionHeads[T float.DType](config Config) []*selfattention.Model {
+	dm, n := config.Size, config.NumOfHeads
 	heads := make([]*selfattention.Model, n)
 	dk := dm / n
 	scaleFactor := 1.0 / math.Sqrt(float64(dk))
+	slopes := selfattention.ALiBiSlopes(n)
+	groupSize := config.groupSize()
 	for i := 0; i < n; i++ {
+		position := config.Position
+		if position.Encoding == selfattention.ALiBiPositionEncoding {
+			position.ALiBiSlope = slopes[i]
+		}
 		heads[i] = selfattention.New[T](selfattention.Config{
 			InputSize:        dm,
 			QuerySize:        dk,
 			KeySize:          dk,
 			ValueSize:        dk,
 			ScaleFactor:      scaleFactor,
-			UseCausalMask:    useCausalMask,
-			IsCrossAttention: isCrossAttention,
+			UseCausalMask:    config.UseCausalMask,
+			IsCrossAttention: config.IsCrossAttention,
+			QueryOnly:        i%groupSize != 0,
+			Position:         position,
+			Attention:        config.Attention,
 		})
 	}
 	return heads
 }
 
-// Cache contains the self-attention cache for each head.
+// numOfKVHeads returns the actual number of key-value heads.
+func (c Config) numOfKVHeads() int {
+	if c.NumOfKVHeads == 0 {
+		return c.NumOfHeads
+	}
+	return c.NumOfKVHeads
+}
+
+// groupSize returns the number of query heads sharing each key-value head.
+func (c Config) groupSize() int {
+	return c.NumOfHeads / c.numOfKVHeads()
+}
+
+// Cache contains the self-attention cache for each key-value head.
 type Cache []selfattention.Cache
 
 func (r Cache) At(i int) selfattention.Cache {
@@ -78,32 +139,90 @@ func (r Cache) At(i int) selfattention.Cache {
 }
 
 // Forward performs the forward step for each input node and returns the result.
-func (m *Model) Forward(cache Cache, q, x []mat.Tensor) ([]mat.Tensor, [][]mat.Tensor, Cache) {
+// The optional masks are applied to each head (see selfattention.Model.Forward).
+//
+// The keys and values are projected once for each group of heads sharing
+// them, so the returned cache has one entry for each key-value head.
+func (m *Model) Forward(cache Cache, q, x []mat.Tensor, masks ...*attention.Mask) ([]mat.Tensor, [][]mat.Tensor, Cache) {
 	n := len(m.Heads)
+	groupSize := m.groupSize()
+	nextCache := make(Cache, n/groupSize)
+	for g := range nextCache {
+		nextCache[g] = m.Heads[g*groupSize].KeysValues(cache.At(g), x)
+	}
 	attentions := make([][]mat.Tensor, n)
 	weights := make([][]mat.Tensor, n)
-	nextCache := make(Cache, n)
-
 	for i, h := range m.Heads {
-		attentions[i], weights[i], nextCache[i] = h.Forward(cache.At(i), q, x)
+		attentions[i], weights[i] = h.Attend(q, nextCache[i/groupSize], masks...)
 	}
-
 	projected := m.project(attentions, len(q))
-
 	return projected, weights, nextCache
 }
 
+// KVCache contains the selfattention.KVCache of each key-value head.
+type KVCache []*selfattention.KVCache
+
+// NewKVCache returns a new empty KVCache for the model, with one
+// selfattention.KVCache of the given capacity and window for each key-value
+// head.
+func (m *Model) NewKVCache(capacity, window int) KVCache {
+	cache := make(KVCache, len(m.Heads)/m.groupSize())
+	for i := range cache {
+		cache[i] = selfattention.NewKVCache(capacity, window)
+	}
+	return cache
+}
+
+// Clone returns a copy of the cache.
+func (c KVCache) Clone() KVCache {
+	clone := make(KVCache, len(c))
+	for i, h := range c {
+		clone[i] = h.Clone()
+	}
+	return clone
+}
+
+// ForwardKVCache performs the forward step as Forward, appending the keys
+// and values of the inputs x to the cache in place, instead of returning a
+// new cache (see selfattention.Model.ForwardKVCache). The cache must be
+// created by NewKVCache.
+func (m *Model) ForwardKVCache(cache KVCache, q, x []mat.Tensor, masks ...*attention.Mask) ([]mat.Tensor, [][]mat.Tensor) {
+	n := len(m.Heads)
+	groupSize := m.groupSize()
+	if len(cache) != n/groupSize {
+		panic(fmt.Sprintf("multiheadattention: KVCache with %d heads instead of %d", len(cache), n/groupSize))
+	}
+	for g, c := range cache {
+		m.Heads[g*groupSize].AppendKeysValues(c, x)
+	}
+	attentions := make([][]mat.Tensor, n)
+	weights := make([][]mat.Tensor, n)
+	for i, h := range m.Heads {
+		attentions[i], weights[i] = h.AttendKVCache(q, cache[i/groupSize], masks...)
+	}
+	return m.project(attentions, len(q)), weights
+}
+
+// groupSize returns the number of heads sharing each key-value head. The
+// models serialized without configuration have one key-value head for each head.
+func (m *Model) groupSize() int {
+	if m.Config.NumOfHeads == 0 {
+		return 1
+	}
+	return m.Config.groupSize()
+}
+
 func (m *Model) project(heads [][]mat.Tensor, seqLen int) []mat.Tensor {
 	n := len(heads)
 	buf := make([]mat.Tensor, seqLen*n)
-	concat := buf[:0] // shares the same backing array with buf
+	concat := make([]mat.Tensor, seqLen) // must not share the backing array with buf, retained by ag.Concat
 
 	for i := 0; i < seqLen; i++ {
 		buf2 := buf[i*n : i*n+n]
 		for j := 0; j < n; j++ {
 			buf2[j] = heads[j][i]
 		}
-		concat = append(concat, ag.Concat(buf2...))
+		concat[i] = ag.Concat(buf2...)
 	}
 	return m.OutputMerge.Forward(concat...)
 }
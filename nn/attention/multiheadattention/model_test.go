@@ -0,0 +1,140 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package multiheadattention
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/attention/selfattention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModel_Forward(t *testing.T) {
+	model := New[float64](4, 2, true, false)
+	model.Init(rand.NewLockedRand(42))
+	xs := []mat.Tensor{
+		mat.NewDense[float64](mat.WithBacking([]float64{0.1, 0.2, 0.3, 0.4})),
+		mat.NewDense[float64](mat.WithBacking([]float64{-0.4, 0.3, -0.2, 0.1})),
+		mat.NewDense[float64](mat.WithBacking([]float64{0.5, -0.5, 0.5, -0.5})),
+	}
+
+	ys, _, cache := model.Forward(Cache{}, xs, xs)
+	require.Len(t, ys, len(xs))
+	for _, y := range ys {
+		assert.Equal(t, []int{4, 1}, y.Shape())
+	}
+	assert.Len(t, cache, 2)
+
+	// The heads of each position are concatenated by distinct operators.
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ys...))))
+	for _, head := range model.Heads {
+		assert.NotNil(t, head.Query.W.Grad())
+	}
+}
+
+func TestNewWithConfig(t *testing.T) {
+	model := NewWithConfig[float32](Config{
+		Size:       8,
+		NumOfHeads: 4,
+		Position:   selfattention.PositionConfig{Encoding: selfattention.ALiBiPositionEncoding},
+	})
+	require.Len(t, model.Heads, 4)
+	for i, head := range model.Heads {
+		assert.Equal(t, selfattention.ALiBiPositionEncoding, head.Position.Encoding)
+		assert.Equal(t, selfattention.ALiBiSlopes(4)[i], head.Position.ALiBiSlope)
+		assert.Equal(t, 2, head.QuerySize)
+	}
+}
+
+func TestModel_GroupedQuery(t *testing.T) {
+	for _, kvHeads := range []int{1, 2} {
+		model := NewWithConfig[float64](Config{
+			Size:          8,
+			NumOfHeads:    4,
+			NumOfKVHeads:  kvHeads,
+			UseCausalMask: true,
+			Position:      selfattention.PositionConfig{Encoding: selfattention.RotaryPositionEncoding},
+		})
+		model.Init(rand.NewLockedRand(42))
+		groupSize := 4 / kvHeads
+		for i, head := range model.Heads {
+			assert.Equal(t, i%groupSize != 0, head.QueryOnly)
+			assert.Equal(t, head.QueryOnly, head.Key == nil)
+		}
+
+		xs := make([]mat.Tensor, 4)
+		for i := range xs {
+			data := make([]float64, 8)
+			for j := range data {
+				data[j] = float64((i*5+j*3)%7)/4 - 0.5
+			}
+			xs[i] = mat.NewDense[float64](mat.WithBacking(data))
+		}
+		ys, weights, cache := model.Forward(Cache{}, xs, xs)
+		require.Len(t, cache, kvHeads, "one cache entry for each key-value head")
+		assert.Len(t, weights, 4)
+		assert.Equal(t, []int{4, 2}, cache[0][0].Value().Shape())
+
+		// The incremental decoding gives the same outputs.
+		var incremental []mat.Tensor
+		cache = nil
+		for _, chunk := range [][]mat.Tensor{xs[:1], xs[1:3], xs[3:]} {
+			var out []mat.Tensor
+			out, _, cache = model.Forward(cache, chunk, chunk)
+			incremental = append(incremental, out...)
+		}
+		require.Len(t, cache, kvHeads)
+		for i, y := range incremental {
+			assert.InDeltaSlice(t, ys[i].Value().Data(), y.Value().Data(), 1.0e-9, "position %d", i)
+		}
+
+		// The same with the KVCache.
+		kvCache := model.NewKVCache(2, 0)
+		require.Len(t, kvCache, kvHeads)
+		for _, chunk := range [][]mat.Tensor{xs[:1], xs[1:3], xs[3:]} {
+			out, _ := model.ForwardKVCache(kvCache, chunk, chunk)
+			for i, y := range out {
+				assert.InDeltaSlice(t, incremental[kvCache[0].Len()-len(chunk)+i].Value().Data(), y.Value().Data(), 1.0e-9)
+			}
+		}
+		assert.Equal(t, 4, kvCache.Clone()[0].Len())
+
+		// The shared keys and values receive the gradients of each head of the group.
+		require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ys...))))
+		nn.ForEachParam(model, func(p *nn.Param) {
+			assert.True(t, p.HasGrad())
+		})
+	}
+}
+
+func TestNewWithConfig_InvalidKVHeads(t *testing.T) {
+	assert.Panics(t, func() {
+		NewWithConfig[float32](Config{Size: 8, NumOfHeads: 4, NumOfKVHeads: 3})
+	})
+}
+
+func BenchmarkModel_ForwardBackward(b *testing.B) {
+	model := New[float32](64, 4, true, false)
+	model.Init(rand.NewLockedRand(42))
+	xs := make([]mat.Tensor, 32)
+	for i := range xs {
+		xs[i] = mat.NewDense[float32](mat.WithShape(64)).OnesLike()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ys, _, _ := model.Forward(Cache{}, xs, xs)
+		if err := ag.Backward(ag.ReduceSum(ag.Sum(ys...))); err != nil {
+			b.Fatal(err)
+		}
+		nn.ZeroGrad(model)
+	}
+}
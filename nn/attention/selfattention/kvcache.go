@@ -0,0 +1,298 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// KVCache is a cache of the projected keys and values of an incremental
+// decoding, an alternative to Cache which does not copy the previous keys
+// and values at each step.
+//
+// The keys and values are appended in place to buffers of preallocated
+// capacity, which are only reallocated, doubling their size, when full.
+// With a window, only the keys and values of the last window positions are
+// kept, the oldest ones being evicted; a capacity of at least twice the
+// window amortizes the cost of moving the kept rows to the beginning of the
+// buffers when their end is reached.
+//
+// The values of the cached keys and values are copied, so that the
+// gradients do not flow through the cache, which is meant for inference.
+//
+// The rows returned by Cache are never overwritten or moved, since the
+// operators reading them may still be pending when the next keys are
+// appended: once they are returned, the buffers are reallocated instead of
+// reused in place.
+type KVCache struct {
+	capacity int
+	window   int
+	keys     mat.Matrix // buffer, one row for each key
+	values   mat.Matrix // buffer, one row for each value
+	start    int        // the first row of the buffers in use
+	length   int        // the number of rows in use
+	offset   int        // the position of the first cached key
+	shared   bool       // whether Cache returned views of the rows in use
+}
+
+// NewKVCache returns a new empty KVCache, whose buffers are allocated with
+// the given capacity, or the number of keys of the first step if larger.
+// A window greater than zero is the maximum number of keys and values kept.
+// It panics if the capacity or the window are negative.
+func NewKVCache(capacity, window int) *KVCache {
+	if capacity < 0 || window < 0 {
+		panic(fmt.Sprintf("selfattention: the capacity (%d) and the window (%d) of a KVCache must not be negative", capacity, window))
+	}
+	return &KVCache{
+		capacity: capacity,
+		window:   window,
+	}
+}
+
+// Len returns the number of cached keys and values.
+func (c *KVCache) Len() int {
+	return c.length
+}
+
+// Offset returns the position of the first cached key, i.e. the number of
+// keys evicted.
+func (c *KVCache) Offset() int {
+	return c.offset
+}
+
+// Position returns the position of the next key, i.e. the number of keys
+// appended.
+func (c *KVCache) Position() int {
+	return c.offset + c.length
+}
+
+// Window returns the maximum number of keys and values kept, or zero if
+// there is no limit.
+func (c *KVCache) Window() int {
+	return c.window
+}
+
+// Capacity returns the number of rows of the buffers.
+func (c *KVCache) Capacity() int {
+	if c.keys == nil {
+		return c.capacity
+	}
+	return c.keys.Shape()[0]
+}
+
+// Append appends the given keys and values, one vector for each position,
+// evicting the oldest ones beyond the window. It panics if their numbers
+// or sizes differ from the ones of the cache.
+func (c *KVCache) Append(keys, values []mat.Tensor) {
+	if len(keys) != len(values) {
+		panic(fmt.Sprintf("selfattention: %d keys and %d values appended to a KVCache", len(keys), len(values)))
+	}
+	n := len(keys)
+	if n == 0 {
+		return
+	}
+	if c.keys == nil {
+		rows := max(c.capacity, n)
+		if c.window > 0 {
+			rows = max(c.capacity, min(n, c.window))
+		}
+		c.keys = keys[0].Value().(mat.Matrix).NewMatrix(mat.WithShape(rows, keys[0].Value().Size()))
+		c.values = values[0].Value().(mat.Matrix).NewMatrix(mat.WithShape(rows, values[0].Value().Size()))
+	}
+
+	if c.window > 0 && c.length+n > c.window {
+		if n >= c.window {
+			// Only the last window keys are kept.
+			c.offset += c.length + n - c.window
+			keys, values = keys[n-c.window:], values[n-c.window:]
+			n = c.window
+			c.start, c.length = 0, 0
+			if c.shared {
+				c.reallocate(c.keys.Shape()[0])
+			}
+		} else {
+			evicted := c.length + n - c.window
+			c.start += evicted
+			c.length -= evicted
+			c.offset += evicted
+		}
+	}
+	c.reserve(n)
+
+	for i := range keys {
+		row := c.start + c.length + i
+		copyRow(c.keys, row, keys[i])
+		copyRow(c.values, row, values[i])
+	}
+	c.length += n
+}
+
+// reserve makes room for n rows after the ones in use, moving them to the
+// beginning of the buffers, or reallocating them if full or if the rows in
+// use may still be read through the views returned by Cache.
+func (c *KVCache) reserve(n int) {
+	rows := c.keys.Shape()[0]
+	if c.start+c.length+n <= rows {
+		return
+	}
+	if c.length+n > rows {
+		c.reallocate(max(2*rows, c.length+n))
+		return
+	}
+	if c.shared {
+		c.reallocate(rows)
+		return
+	}
+	copyRows(c.keys, 0, c.keys, c.start, c.length)
+	copyRows(c.values, 0, c.values, c.start, c.length)
+	c.start = 0
+}
+
+// reallocate replaces the buffers with new ones of the given number of rows,
+// copying the rows in use to their beginning. The old buffers are left to
+// the views returned by Cache.
+func (c *KVCache) reallocate(rows int) {
+	keys := c.keys.NewMatrix(mat.WithShape(rows, c.keys.Shape()[1]))
+	values := c.values.NewMatrix(mat.WithShape(rows, c.values.Shape()[1]))
+	copyRows(keys, 0, c.keys, c.start, c.length)
+	copyRows(values, 0, c.values, c.start, c.length)
+	c.keys, c.values = keys, values
+	c.start = 0
+	c.shared = false
+}
+
+// Cache returns the cached keys and values, as a Cache sharing the memory
+// of the buffers, or an empty Cache. It stays valid after the next Append,
+// which does not modify the rows it shares.
+func (c *KVCache) Cache() Cache {
+	if c.length == 0 {
+		return Cache{}
+	}
+	c.shared = true
+	return Cache{
+		rowsView(c.keys, c.start, c.length),
+		rowsView(c.values, c.start, c.length),
+	}
+}
+
+// Clone returns a copy of the cache, with buffers of the same capacity.
+// It lets decoding.SelectBeams reorder the caches of a beam search.
+func (c *KVCache) Clone() *KVCache {
+	clone := &KVCache{
+		capacity: c.capacity,
+		window:   c.window,
+		length:   c.length,
+		offset:   c.offset,
+	}
+	if c.keys != nil {
+		clone.keys = c.keys.NewMatrix(mat.WithShape(c.keys.Shape()...))
+		clone.values = c.values.NewMatrix(mat.WithShape(c.values.Shape()...))
+		copyRows(clone.keys, 0, c.keys, c.start, c.length)
+		copyRows(clone.values, 0, c.values, c.start, c.length)
+	}
+	return clone
+}
+
+// kvCacheData is the serializable representation of a KVCache.
+type kvCacheData struct {
+	Capacity int
+	Window   int
+	Offset   int
+	Keys     mat.Matrix
+	Values   mat.Matrix
+}
+
+// MarshalBinary marshals the cache into binary form, with the cached keys
+// and values only.
+func (c *KVCache) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	data := kvCacheData{
+		Capacity: c.capacity,
+		Window:   c.window,
+		Offset:   c.offset,
+	}
+	if c.length > 0 {
+		data.Keys = rowsView(c.keys, c.start, c.length)
+		data.Values = rowsView(c.values, c.start, c.length)
+	}
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary unmarshals a binary representation of a cache, allocating
+// the buffers with its capacity.
+func (c *KVCache) UnmarshalBinary(b []byte) error {
+	var data kvCacheData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data); err != nil {
+		return err
+	}
+	*c = KVCache{
+		capacity: data.Capacity,
+		window:   data.Window,
+		offset:   data.Offset,
+	}
+	if data.Keys == nil || data.Values == nil {
+		return nil
+	}
+	n := data.Keys.Shape()[0]
+	if data.Values.Shape()[0] != n {
+		return fmt.Errorf("selfattention: KVCache with %d keys and %d values", n, data.Values.Shape()[0])
+	}
+	rows := max(c.capacity, n)
+	c.keys = data.Keys.NewMatrix(mat.WithShape(rows, data.Keys.Shape()[1]))
+	c.values = data.Values.NewMatrix(mat.WithShape(rows, data.Values.Shape()[1]))
+	copyRows(c.keys, 0, data.Keys, 0, n)
+	copyRows(c.values, 0, data.Values, 0, n)
+	c.length = n
+	return nil
+}
+
+// copyRow copies the vector v to the given row of dst.
+func copyRow(dst mat.Matrix, row int, v mat.Tensor) {
+	cols := dst.Shape()[1]
+	if v.Size() != cols {
+		panic(fmt.Sprintf("selfattention: vector of size %d appended to a KVCache of size %d", v.Size(), cols))
+	}
+	switch mat.DTypeOf(dst) {
+	case mat.Float32:
+		copy(mat.Data[float32](dst)[row*cols:(row+1)*cols], mat.Data[float32](v.Value()))
+	default:
+		copy(mat.Data[float64](dst)[row*cols:(row+1)*cols], mat.Data[float64](v.Value()))
+	}
+}
+
+// copyRows copies n rows of src, from srcRow, to dst, from dstRow.
+func copyRows(dst mat.Matrix, dstRow int, src mat.Matrix, srcRow, n int) {
+	cols := dst.Shape()[1]
+	switch mat.DTypeOf(dst) {
+	case mat.Float32:
+		copy(mat.Data[float32](dst)[dstRow*cols:(dstRow+n)*cols], mat.Data[float32](src)[srcRow*cols:(srcRow+n)*cols])
+	default:
+		copy(mat.Data[float64](dst)[dstRow*cols:(dstRow+n)*cols], mat.Data[float64](src)[srcRow*cols:(srcRow+n)*cols])
+	}
+}
+
+// rowsView returns a matrix of n rows of m, from the given one, sharing its
+// memory.
+func rowsView(m mat.Matrix, from, n int) mat.Matrix {
+	switch mat.DTypeOf(m) {
+	case mat.Float32:
+		return newRowsView[float32](m, from, n)
+	default:
+		return newRowsView[float64](m, from, n)
+	}
+}
+
+func newRowsView[T float.DType](m mat.Matrix, from, n int) mat.Matrix {
+	cols := m.Shape()[1]
+	return mat.NewDense[T](mat.WithShape(n, cols), mat.WithBacking(mat.Data[T](m)[from*cols:(from+n)*cols]))
+}
@@ -0,0 +1,266 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nlpodyssey/spago/decoding"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRows returns n vectors of the given size, whose values are the
+// position of the first one plus the index of the vector.
+func newTestRows[T float.DType](from, n, size int) []mat.Tensor {
+	vs := make([]mat.Tensor, n)
+	for i := range vs {
+		data := make([]T, size)
+		for j := range data {
+			data[j] = T(from+i) + T(j)/10
+		}
+		vs[i] = mat.NewDense[T](mat.WithBacking(data))
+	}
+	return vs
+}
+
+// cachedPositions returns the positions of the cached keys, as encoded by
+// newTestRows, checking that the values are the same plus 100.
+func cachedPositions(t *testing.T, c *KVCache) []float64 {
+	kv := c.Cache()
+	if c.Len() == 0 {
+		assert.False(t, kv.HasValues())
+		return nil
+	}
+	keys := kv[0].Value().Data().F64()
+	values := kv[1].Value().Data().F64()
+	cols := kv[0].Value().Shape()[1]
+	positions := make([]float64, c.Len())
+	for i := range positions {
+		positions[i] = keys[i*cols]
+		assert.InDelta(t, keys[i*cols]+100, values[i*cols], 1.0e-6)
+	}
+	return positions
+}
+
+func appendTestRows[T float.DType](c *KVCache, from, n int) {
+	c.Append(newTestRows[T](from, n, 3), newTestRows[T](from+100, n, 3))
+}
+
+func TestKVCache(t *testing.T) {
+	t.Run("float32", testKVCache[float32])
+	t.Run("float64", testKVCache[float64])
+}
+
+func testKVCache[T float.DType](t *testing.T) {
+	c := NewKVCache(2, 0)
+	assert.Equal(t, 2, c.Capacity())
+	appendTestRows[T](c, 0, 1)
+	appendTestRows[T](c, 1, 2)
+	appendTestRows[T](c, 3, 1)
+	assert.Equal(t, 4, c.Len())
+	assert.Equal(t, 0, c.Offset())
+	assert.Equal(t, 4, c.Capacity(), "the buffers doubled")
+	assert.Equal(t, []float64{0, 1, 2, 3}, cachedPositions(t, c))
+	assert.Equal(t, []int{4, 3}, c.Cache()[0].Shape())
+
+	// With a window, the oldest keys are evicted.
+	c = NewKVCache(6, 3)
+	for i := 0; i < 5; i++ {
+		appendTestRows[T](c, i, 1)
+	}
+	assert.Equal(t, 3, c.Len())
+	assert.Equal(t, 2, c.Offset())
+	assert.Equal(t, 5, c.Position())
+	assert.Equal(t, 6, c.Capacity(), "the kept rows are moved instead of reallocated")
+	assert.Equal(t, []float64{2, 3, 4}, cachedPositions(t, c))
+	appendTestRows[T](c, 5, 2)
+	assert.Equal(t, []float64{4, 5, 6}, cachedPositions(t, c))
+	appendTestRows[T](c, 7, 4)
+	assert.Equal(t, []float64{8, 9, 10}, cachedPositions(t, c))
+	assert.Equal(t, 8, c.Offset())
+
+	// The clone does not share the buffers.
+	clone := c.Clone()
+	appendTestRows[T](c, 11, 1)
+	assert.Equal(t, []float64{8, 9, 10}, cachedPositions(t, clone))
+	assert.Equal(t, []float64{9, 10, 11}, cachedPositions(t, c))
+	appendTestRows[T](clone, 20, 1)
+	assert.Equal(t, []float64{9, 10, 20}, cachedPositions(t, clone))
+
+	assert.Panics(t, func() { c.Append(newTestRows[T](0, 1, 2), newTestRows[T](0, 1, 3)) }, "wrong size")
+	assert.Panics(t, func() { c.Append(newTestRows[T](0, 1, 3), nil) }, "missing values")
+	assert.Panics(t, func() { NewKVCache(-1, 0) })
+}
+
+func TestKVCache_Serialization(t *testing.T) {
+	c := NewKVCache(8, 4)
+	appendTestRows[float32](c, 0, 6)
+
+	var buf bytes.Buffer
+	require.NoError(t, nn.Dump(c, &buf))
+	loaded, err := nn.Load[*KVCache](&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 4, loaded.Len())
+	assert.Equal(t, 2, loaded.Offset())
+	assert.Equal(t, 4, loaded.Window())
+	assert.Equal(t, 8, loaded.Capacity())
+	assert.Equal(t, mat.Float32, mat.DTypeOf(loaded.Cache()[0].Value().(mat.Matrix)))
+	assert.Equal(t, []float64{2, 3, 4, 5}, cachedPositions(t, loaded))
+	appendTestRows[float32](loaded, 6, 1)
+	assert.Equal(t, []float64{3, 4, 5, 6}, cachedPositions(t, loaded))
+
+	buf.Reset()
+	require.NoError(t, nn.Dump(NewKVCache(3, 0), &buf))
+	loaded, err = nn.Load[*KVCache](&buf)
+	require.NoError(t, err)
+	assert.Equal(t, 0, loaded.Len())
+	assert.Equal(t, 3, loaded.Capacity())
+}
+
+func TestKVCache_SelectBeams(t *testing.T) {
+	caches := []*KVCache{NewKVCache(4, 0), NewKVCache(4, 0)}
+	appendTestRows[float64](caches[0], 0, 1)
+	appendTestRows[float64](caches[1], 10, 1)
+
+	beams := decoding.SelectBeams(caches, []int{1, 1, 0})
+	require.Len(t, beams, 3)
+	assert.Same(t, caches[1], beams[0])
+	assert.NotSame(t, caches[1], beams[1])
+	assert.Same(t, caches[0], beams[2])
+	appendTestRows[float64](beams[0], 11, 1)
+	assert.Equal(t, []float64{10, 11}, cachedPositions(t, beams[0]))
+	assert.Equal(t, []float64{10}, cachedPositions(t, beams[1]))
+}
+
+func TestModel_ForwardKVCache(t *testing.T) {
+	t.Run("float32", testModelForwardKVCache[float32])
+	t.Run("float64", testModelForwardKVCache[float64])
+}
+
+// testModelForwardKVCache checks that the incremental decoding with the
+// KVCache gives the same outputs of the one with the Cache, and, with a
+// window, of the sliding window attention.
+func testModelForwardKVCache[T float.DType](t *testing.T) {
+	newModel := func(mechanism AttentionConfig, encoding PositionEncoding) *Model {
+		m := newTestMechanismModel[T](mechanism, true)
+		m.Position = PositionConfig{Encoding: encoding, ALiBiSlope: 0.5}
+		return m
+	}
+	xs := newTestMechanismInputs[T](7)
+	mask := attention.KeyPaddingMask([]bool{true, false, true, true, true, true, true})
+	chunks := [][]mat.Tensor{xs[:2], xs[2:3], xs[3:4], xs[4:6], xs[6:]}
+
+	for _, encoding := range []PositionEncoding{RotaryPositionEncoding, ALiBiPositionEncoding} {
+		m := newModel(AttentionConfig{}, encoding)
+		var cache Cache
+		kvCache := NewKVCache(3, 0)
+		for _, chunk := range chunks {
+			var expected []mat.Tensor
+			expected, _, cache = m.Forward(cache, chunk, chunk, mask)
+			ys, _ := m.ForwardKVCache(kvCache, chunk, chunk, mask)
+			require.Len(t, ys, len(chunk))
+			for i, y := range ys {
+				assert.InDeltaSlice(t, expected[i].Value().Data(), y.Value().Data(), 1.0e-5)
+			}
+		}
+		assert.Equal(t, 7, kvCache.Len())
+
+		// With a window of 3 keys, one position at a time.
+		local := newModel(AttentionConfig{Mechanism: SlidingWindowAttention, Window: 2}, encoding)
+		expected, _, _ := local.Forward(Cache{}, xs, xs, mask)
+		kvCache = NewKVCache(6, 3)
+		for i, x := range xs {
+			ys, _ := m.ForwardKVCache(kvCache, xs[i:i+1], []mat.Tensor{x}, mask)
+			assert.InDeltaSlice(t, expected[i].Value().Data(), ys[0].Value().Data(), 1.0e-5, "position %d", i)
+		}
+		assert.Equal(t, 3, kvCache.Len())
+		assert.Equal(t, 4, kvCache.Offset())
+		assert.Panics(t, func() { m.ForwardKVCache(kvCache, xs[:4], xs[:4]) }, "more queries than the window")
+	}
+}
+
+func TestModel_ForwardKVCache_MaskRows(t *testing.T) {
+	m := newTestMechanismModel[float32](AttentionConfig{}, true)
+	xs := newTestMechanismInputs[float32](40)
+
+	// The rows of the mask are only built for the keys in the cache.
+	var minKey, maxKey, calls int
+	mask := attention.NewMask(func(query, key int) bool {
+		minKey, maxKey = min(minKey, key), max(maxKey, key)
+		calls++
+		return key%7 != 3
+	})
+	kvCache := NewKVCache(8, 4)
+	for i, x := range xs {
+		minKey, maxKey, calls = i, 0, 0
+		m.ForwardKVCache(kvCache, []mat.Tensor{x}, []mat.Tensor{x}, mask)
+		assert.Equal(t, kvCache.Offset(), minKey, "position %d", i)
+		assert.Equal(t, i, maxKey, "position %d", i)
+		assert.Equal(t, kvCache.Len(), calls, "position %d", i)
+	}
+}
+
+func TestModel_ForwardKVCache_BackToBack(t *testing.T) {
+	const size, n = 32, 48
+	newModel := func() *Model {
+		m := New[float32](Config{
+			InputSize:     size,
+			QuerySize:     size,
+			KeySize:       size,
+			ValueSize:     size,
+			ScaleFactor:   0.2,
+			UseCausalMask: true,
+		})
+		m.Init(rand.NewLockedRand(3))
+		return m
+	}
+	xs := make([]mat.Tensor, n)
+	for i := range xs {
+		data := make([]float32, size)
+		for j := range data {
+			data[j] = float32((i*size+j)%11)/5 - 1
+		}
+		xs[i] = mat.NewDense[float32](mat.WithBacking(data))
+	}
+	var chunks [][]mat.Tensor
+	for i, from := 0, 0; from < n; i++ {
+		to := min(n, from+[]int{6, 3, 1, 8, 1, 5}[i%6])
+		chunks = append(chunks, xs[from:to])
+		from = to
+	}
+
+	// The outputs of each step are read before the next one.
+	m := newModel()
+	kvCache := NewKVCache(12, 8)
+	var expected [][]float64
+	for _, chunk := range chunks {
+		ys, _ := m.ForwardKVCache(kvCache, chunk, chunk)
+		for _, y := range ys {
+			expected = append(expected, y.Value().Data().F64())
+		}
+	}
+
+	// The steps are computed back to back, while the operators of the
+	// previous ones may still be reading the cached keys and values, whose
+	// rows are evicted and moved.
+	m = newModel()
+	kvCache = NewKVCache(12, 8)
+	var ys []mat.Tensor
+	for _, chunk := range chunks {
+		out, _ := m.ForwardKVCache(kvCache, chunk, chunk)
+		ys = append(ys, out...)
+	}
+	require.Len(t, ys, len(expected))
+	for i, y := range ys {
+		assert.InDeltaSlice(t, expected[i], y.Value().Data().F64(), 1.0e-6, "position %d", i)
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn/attention"
+)
+
+// Mechanism is the kind of attention computed by a self-attention.
+type Mechanism int
+
+const (
+	// FullAttention attends to all the keys, with a cost growing
+	// quadratically with the length of the sequence.
+	FullAttention Mechanism = iota
+	// SlidingWindowAttention only attends to the keys within a window of
+	// positions around each query, and to the ones at the global positions.
+	// See attention.SlidingWindowAttention.
+	SlidingWindowAttention
+	// LinearAttention attends to all the keys with the scores given by the
+	// dot products of the features of the queries and of the keys, with a
+	// cost growing linearly with the length of the sequence.
+	// See attention.LinearAttention.
+	LinearAttention
+)
+
+// FeatureMap is the kind of features of the queries and keys of the
+// LinearAttention.
+type FeatureMap int
+
+const (
+	// ELUFeatureMap maps each value x to ELU(x) + 1, as in the linear
+	// transformer.
+	ELUFeatureMap FeatureMap = iota
+	// RandomFeatureMap maps the queries and keys to positive random
+	// features, whose dot products approximate the exponentials of the
+	// scaled dot products of the softmax attention, as in Performer (FAVOR+).
+	// The random projections are drawn by Init.
+	RandomFeatureMap
+)
+
+// AttentionConfig provides the settings of the attention mechanism of a
+// self-attention.
+type AttentionConfig struct {
+	Mechanism Mechanism
+	// Window is the number of positions before and after each query whose
+	// keys are attended by the SlidingWindowAttention; with the causal mask,
+	// only the ones before count. It must be positive.
+	Window int
+	// GlobalTokens are the positions of the SlidingWindowAttention whose
+	// queries attend to all the keys, and whose keys are attended by all
+	// the queries, e.g. the ones of the classification tokens.
+	GlobalTokens []int
+	// FeatureMap is the kind of features of the LinearAttention.
+	FeatureMap FeatureMap
+	// NumOfFeatures is the number of random features of the RandomFeatureMap.
+	// Zero means 4 times the size of the keys.
+	NumOfFeatures int
+}
+
+// Validate returns an error if the configuration is not valid, also with
+// the given settings of the relative position information.
+func (c AttentionConfig) Validate(position PositionConfig) error {
+	switch c.Mechanism {
+	case FullAttention:
+		return nil
+	case SlidingWindowAttention:
+		if c.Window <= 0 {
+			return fmt.Errorf("selfattention: the window must be positive; found %d", c.Window)
+		}
+		for _, p := range c.GlobalTokens {
+			if p < 0 {
+				return fmt.Errorf("selfattention: the global positions must not be negative; found %d", p)
+			}
+		}
+		return nil
+	case LinearAttention:
+		if c.FeatureMap != ELUFeatureMap && c.FeatureMap != RandomFeatureMap {
+			return fmt.Errorf("selfattention: unknown feature map %d", c.FeatureMap)
+		}
+		if c.NumOfFeatures < 0 {
+			return fmt.Errorf("selfattention: the number of features must not be negative; found %d", c.NumOfFeatures)
+		}
+		if e := position.Encoding; e == ALiBiPositionEncoding || e == RelativeBiasPositionEncoding {
+			return fmt.Errorf("selfattention: the linear attention does not support position biases")
+		}
+		return nil
+	default:
+		return fmt.Errorf("selfattention: unknown attention mechanism %d", c.Mechanism)
+	}
+}
+
+func (c AttentionConfig) numOfFeatures(keySize int) int {
+	if c.NumOfFeatures == 0 {
+		return 4 * keySize
+	}
+	return c.NumOfFeatures
+}
+
+// linearAttention returns the results of the attention of the queries q to
+// the keys and values kv. It panics if there are masks, not supported.
+func (m *Model) linearAttention(q []mat.Tensor, kv Cache, masks []*attention.Mask) []mat.Tensor {
+	if len(masks) > 0 {
+		panic("selfattention: the linear attention does not support masks")
+	}
+	k := m.features(kv[0])
+	fq := m.features(ag.Stack(q...))
+	rows := ag.RowViews(fq)
+	for i, r := range rows {
+		rows[i] = ag.T(r)
+	}
+	return attention.LinearAttention(rows, k, kv[1], m.UseCausalMask)
+}
+
+// features returns the features of the rows of x, with the FeatureMap of the
+// model.
+func (m *Model) features(x mat.Tensor) mat.Tensor {
+	if m.Attention.FeatureMap == ELUFeatureMap {
+		return ag.PositiveELU(x)
+	}
+	// exp(w·x' - |x'|²/2) / sqrt(n), where x' = x / d^(1/4), for each random
+	// projection w of the n ones.
+	w := m.RandomFeatures
+	x = ag.ProdScalar(x, ag.Sqrt(m.ScaleFactor))
+	wv := w.Value().(mat.Matrix)
+	n := wv.Shape()[0]
+	ones := wv.NewMatrix(mat.WithShape(x.Shape()[1], 1)).OnesLike()
+	halfSqNorms := ag.ProdScalar(ag.Mul(ag.Square(x), ones), wv.NewScalar(0.5))
+	onesRow := wv.NewMatrix(mat.WithShape(1, n)).OnesLike()
+	projections := ag.Mul(x, ag.T(w))
+	scale := wv.NewScalar(1 / math.Sqrt(float64(n)))
+	return ag.ProdScalar(ag.Exp(ag.Sub(projections, ag.Mul(halfSqNorms, onesRow))), scale)
+}
@@ -0,0 +1,145 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttentionConfig_Validate(t *testing.T) {
+	assert.NoError(t, AttentionConfig{}.Validate(PositionConfig{}))
+	assert.NoError(t, AttentionConfig{Mechanism: SlidingWindowAttention, Window: 2, GlobalTokens: []int{0}}.Validate(PositionConfig{}))
+	assert.NoError(t, AttentionConfig{Mechanism: LinearAttention}.Validate(PositionConfig{Encoding: RotaryPositionEncoding}))
+
+	assert.Error(t, AttentionConfig{Mechanism: SlidingWindowAttention}.Validate(PositionConfig{}), "no window")
+	assert.Error(t, AttentionConfig{Mechanism: SlidingWindowAttention, Window: 1, GlobalTokens: []int{-1}}.Validate(PositionConfig{}), "negative global position")
+	assert.Error(t, AttentionConfig{Mechanism: LinearAttention}.Validate(PositionConfig{Encoding: ALiBiPositionEncoding}), "position biases")
+	assert.Error(t, AttentionConfig{Mechanism: LinearAttention, NumOfFeatures: -1}.Validate(PositionConfig{}), "negative features")
+	assert.Error(t, AttentionConfig{Mechanism: 42}.Validate(PositionConfig{}), "unknown mechanism")
+
+	assert.Panics(t, func() {
+		New[float32](Config{InputSize: 2, QuerySize: 2, KeySize: 2, ValueSize: 2, IsCrossAttention: true,
+			Attention: AttentionConfig{Mechanism: SlidingWindowAttention, Window: 1}})
+	}, "sliding window cross-attention")
+}
+
+func TestModel_Mechanisms(t *testing.T) {
+	mechanisms := map[string]AttentionConfig{
+		"sliding window": {Mechanism: SlidingWindowAttention, Window: 1, GlobalTokens: []int{0}},
+		"linear elu":     {Mechanism: LinearAttention},
+		"linear random":  {Mechanism: LinearAttention, FeatureMap: RandomFeatureMap, NumOfFeatures: 8},
+	}
+	for name, mechanism := range mechanisms {
+		t.Run(name, func(t *testing.T) {
+			t.Run("float32", func(t *testing.T) { testModelMechanism[float32](t, mechanism) })
+			t.Run("float64", func(t *testing.T) { testModelMechanism[float64](t, mechanism) })
+		})
+	}
+}
+
+// newTestMechanismModel returns a new initialized model with the given
+// attention mechanism and rotary position encoding.
+func newTestMechanismModel[T float.DType](mechanism AttentionConfig, causal bool) *Model {
+	m := New[T](Config{
+		InputSize:     4,
+		QuerySize:     4,
+		KeySize:       4,
+		ValueSize:     4,
+		ScaleFactor:   0.5,
+		UseCausalMask: causal,
+		Position:      PositionConfig{Encoding: RotaryPositionEncoding},
+		Attention:     mechanism,
+	})
+	m.Init(rand.NewLockedRand(7))
+	return m
+}
+
+func newTestMechanismInputs[T float.DType](n int) []mat.Tensor {
+	xs := make([]mat.Tensor, n)
+	for i := range xs {
+		xs[i] = mat.NewDense[T](mat.WithBacking([]T{T(i%3) - 1, 0.5, T(i) / 4, -0.2}), mat.WithGrad(true))
+	}
+	return xs
+}
+
+// testModelMechanism checks that the incremental decoding with the cache
+// gives the same outputs of the whole sequence, and that the gradients
+// reach the inputs and the parameters.
+func testModelMechanism[T float.DType](t *testing.T, mechanism AttentionConfig) {
+	m := newTestMechanismModel[T](mechanism, true)
+	xs := newTestMechanismInputs[T](6)
+	ys, weights, _ := m.Forward(Cache{}, xs, xs)
+	require.Len(t, ys, len(xs))
+	assert.Equal(t, mechanism.Mechanism == LinearAttention, weights == nil)
+
+	var cache Cache
+	var incremental []mat.Tensor
+	for _, chunk := range [][]mat.Tensor{xs[:2], xs[2:3], xs[3:]} {
+		var out []mat.Tensor
+		out, _, cache = m.Forward(cache, chunk, chunk)
+		incremental = append(incremental, out...)
+	}
+	require.Len(t, incremental, len(ys))
+	for i := range ys {
+		assert.Equal(t, []int{4, 1}, ys[i].Shape())
+		assert.InDeltaSlice(t, ys[i].Value().Data(), incremental[i].Value().Data(), 1.0e-5, "position %d", i)
+	}
+
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ys...))))
+	for _, x := range xs {
+		assert.True(t, x.(mat.Matrix).HasGrad())
+	}
+	assert.True(t, m.Query.W.HasGrad())
+	assert.True(t, m.Key.W.HasGrad())
+	assert.True(t, m.Value.W.HasGrad())
+}
+
+func TestModel_SlidingWindowAttention(t *testing.T) {
+	// A window covering the whole sequence is the full attention.
+	xs := newTestMechanismInputs[float64](5)
+	for _, causal := range []bool{false, true} {
+		full, _, _ := newTestMechanismModel[float64](AttentionConfig{}, causal).Forward(Cache{}, xs, xs)
+		local := newTestMechanismModel[float64](AttentionConfig{Mechanism: SlidingWindowAttention, Window: 4}, causal)
+		ys, _, _ := local.Forward(Cache{}, xs, xs)
+		for i := range ys {
+			assert.InDeltaSlice(t, full[i].Value().Data(), ys[i].Value().Data(), 1.0e-9)
+		}
+		// The masks still apply.
+		mask := attention.KeyPaddingMask([]bool{true, true, true, false, false})
+		full, _, _ = newTestMechanismModel[float64](AttentionConfig{}, causal).Forward(Cache{}, xs, xs, mask)
+		ys, _, _ = local.Forward(Cache{}, xs, xs, mask)
+		for i := range ys {
+			assert.InDeltaSlice(t, full[i].Value().Data(), ys[i].Value().Data(), 1.0e-9)
+		}
+	}
+}
+
+func TestModel_LinearAttention(t *testing.T) {
+	// The positive random features approximate the full attention.
+	xs := newTestMechanismInputs[float64](5)
+	for _, causal := range []bool{false, true} {
+		full, _, _ := newTestMechanismModel[float64](AttentionConfig{}, causal).Forward(Cache{}, xs, xs)
+		m := newTestMechanismModel[float64](AttentionConfig{Mechanism: LinearAttention, FeatureMap: RandomFeatureMap, NumOfFeatures: 4096}, causal)
+		assert.Equal(t, []int{4096, 4}, m.RandomFeatures.Shape())
+		ys, _, _ := m.Forward(Cache{}, xs, xs)
+		for i := range ys {
+			assert.InDeltaSlice(t, full[i].Value().Data(), ys[i].Value().Data(), 0.05)
+		}
+	}
+
+	m := newTestMechanismModel[float64](AttentionConfig{Mechanism: LinearAttention}, false)
+	assert.Nil(t, m.RandomFeatures)
+	assert.Panics(t, func() {
+		m.Forward(Cache{}, xs, xs, attention.CausalMask())
+	}, "masks")
+}
@@ -6,6 +6,7 @@ package selfattention
 
 import (
 	"encoding/gob"
+	"fmt"
 
 	"github.com/nlpodyssey/spago/ag"
 	"github.com/nlpodyssey/spago/initializers"
@@ -36,6 +37,13 @@ type Model struct {
 	Key         *linear.Model
 	Value       *linear.Model
 	ScaleFactor *nn.Buffer
+	// RelativeBias contains the learned biases of the buckets of relative
+	// positions, only present with the RelativeBiasPositionEncoding.
+	RelativeBias *nn.Param
+	// RandomFeatures contains the random projections of the queries and keys,
+	// one for each row, only present with the RandomFeatureMap of the
+	// LinearAttention.
+	RandomFeatures *nn.Buffer
 }
 
 // Config provides configuration settings for a Self-Attention Model.
@@ -47,6 +55,16 @@ type Config struct {
 	ScaleFactor      float64
 	UseCausalMask    bool
 	IsCrossAttention bool
+	// QueryOnly specifies whether the model only projects the queries,
+	// attending to the keys and values projected by another model, e.g. the
+	// head sharing them with others in a grouped-query attention. Such a
+	// model has no Key and Value, and can only be used with Attend.
+	QueryOnly bool
+	// Position provides the settings of the relative position information.
+	Position PositionConfig
+	// Attention provides the settings of the attention mechanism, by default
+	// the FullAttention.
+	Attention AttentionConfig
 }
 
 func init() {
@@ -54,47 +72,190 @@ func init() {
 }
 
 // New returns a new model with parameters initialized to zeros.
+// It panics if the settings of the attention mechanism are not valid.
 func New[T float.DType](config Config) *Model {
-	return &Model{
+	if err := config.Attention.Validate(config.Position); err != nil {
+		panic(err)
+	}
+	if config.IsCrossAttention && config.Attention.Mechanism == SlidingWindowAttention {
+		panic("selfattention: the sliding window attention does not support cross-attention")
+	}
+	m := &Model{
 		Config:      config,
 		Query:       linear.New[T](config.InputSize, config.QuerySize),
-		Key:         linear.New[T](config.InputSize, config.KeySize),
-		Value:       linear.New[T](config.InputSize, config.ValueSize),
 		ScaleFactor: nn.Buf(mat.Scalar(T(config.ScaleFactor))),
 	}
+	if !config.QueryOnly {
+		m.Key = linear.New[T](config.InputSize, config.KeySize)
+		m.Value = linear.New[T](config.InputSize, config.ValueSize)
+	}
+	if config.Position.Encoding == RelativeBiasPositionEncoding && !config.IsCrossAttention {
+		m.RelativeBias = nn.NewParam(mat.NewDense[T](mat.WithShape(config.Position.relativeBuckets())))
+	}
+	if config.Attention.Mechanism == LinearAttention && config.Attention.FeatureMap == RandomFeatureMap {
+		n := config.Attention.numOfFeatures(config.KeySize)
+		m.RandomFeatures = nn.Buf(mat.NewDense[T](mat.WithShape(n, config.KeySize)))
+	}
+	return m
 }
 
-// Init initializes the query, key and value linear layers with uniform Xavier random distribution.
+// Init initializes the query, key and value linear layers with uniform Xavier random distribution,
+// and draws the random features, if any, from the standard normal distribution.
 func (m *Model) Init(rng *rand.LockedRand) {
 	gain := initializers.Gain(activation.Identity)
 	initializers.XavierUniform(m.Query.W.Value().(mat.Matrix), gain, rng)
-	initializers.XavierUniform(m.Key.W.Value().(mat.Matrix), gain, rng)
-	initializers.XavierUniform(m.Value.W.Value().(mat.Matrix), gain, rng)
+	if !m.QueryOnly {
+		initializers.XavierUniform(m.Key.W.Value().(mat.Matrix), gain, rng)
+		initializers.XavierUniform(m.Value.W.Value().(mat.Matrix), gain, rng)
+	}
+	if m.RandomFeatures != nil {
+		initializers.Normal(m.RandomFeatures.Value().(mat.Matrix), 0, 1, rng)
+	}
 }
 
 // Forward performs the forward step for each input node and returns the result.
-func (m *Model) Forward(cache Cache, q, x []mat.Tensor) ([]mat.Tensor, []mat.Tensor, Cache) {
-	var pk, pv mat.Tensor
+// With a relative position encoding, the inputs x of a self-attention are taken as
+// the positions following the ones in the cache, and the queries q as the last ones.
+//
+// The optional masks tell which keys each query can attend to, in addition to the
+// causal mask, if enabled. The queries of a self-attention are at the positions
+// of the last inputs, as above; the ones of a cross-attention at the positions from 0.
+func (m *Model) Forward(cache Cache, q, x []mat.Tensor, masks ...*attention.Mask) ([]mat.Tensor, []mat.Tensor, Cache) {
+	kv := m.KeysValues(cache, x)
+	result, weights := m.Attend(q, kv, masks...)
+	return result, weights, kv
+}
+
+// KeysValues returns the cache extended with the projected keys and values of
+// the inputs x, following the ones in the cache. The keys and values of a
+// cross-attention are only projected if the cache is empty.
+func (m *Model) KeysValues(cache Cache, x []mat.Tensor) Cache {
+	hasCache := cache.HasValues()
+	if hasCache && m.IsCrossAttention {
+		return cache
+	}
+
+	position := 0
+	if hasCache {
+		position = cache[0].Value().Shape()[0]
+	}
+	k, v := m.projectKeysValues(x, position)
+
+	if hasCache {
+		return Cache{ag.AppendRows(cache[0], k...), ag.AppendRows(cache[1], v...)}
+	}
+	return Cache{ag.Stack(k...), ag.Stack(v...)}
+}
+
+// projectKeysValues returns the projected keys and values of the inputs x,
+// starting from the given position.
+func (m *Model) projectKeysValues(x []mat.Tensor, position int) ([]mat.Tensor, []mat.Tensor) {
+	k := m.Key.Forward(x...)
+	v := m.Value.Forward(x...)
+	if m.Position.Encoding == RotaryPositionEncoding && !m.IsCrossAttention {
+		k = m.rotate(k, position)
+	}
+	return k, v
+}
 
+// Attend projects the queries q and returns the results of their attention
+// to the keys and values kv, e.g. returned by KeysValues, and the attention
+// weights, which are nil for the LinearAttention. See Forward.
+//
+// The LinearAttention does not support masks, and panics if there are any.
+func (m *Model) Attend(q []mat.Tensor, kv Cache, masks ...*attention.Mask) ([]mat.Tensor, []mat.Tensor) {
+	return m.attend(q, kv, 0, masks)
+}
+
+// ForwardKVCache performs the forward step as Forward, appending the keys
+// and values of the inputs x to the cache in place, instead of returning a
+// new cache. See KVCache.
+//
+// With a window, each query only attends to the cached keys, so that the
+// queries of a step with several inputs, but the last one, attend to less
+// than window keys. It panics if the queries of a self-attention are more
+// than the cached keys.
+func (m *Model) ForwardKVCache(cache *KVCache, q, x []mat.Tensor, masks ...*attention.Mask) ([]mat.Tensor, []mat.Tensor) {
+	m.AppendKeysValues(cache, x)
+	return m.AttendKVCache(q, cache, masks...)
+}
+
+// AppendKeysValues appends the projected keys and values of the inputs x to
+// the cache, following the ones in it. The keys and values of a
+// cross-attention are only appended if the cache is empty.
+func (m *Model) AppendKeysValues(cache *KVCache, x []mat.Tensor) {
+	if m.IsCrossAttention && cache.Len() > 0 {
+		return
+	}
+	k, v := m.projectKeysValues(x, cache.Position())
+	cache.Append(k, v)
+}
+
+// AttendKVCache is the same as Attend, with the keys and values of the given
+// cache. See ForwardKVCache.
+func (m *Model) AttendKVCache(q []mat.Tensor, cache *KVCache, masks ...*attention.Mask) ([]mat.Tensor, []mat.Tensor) {
+	if !m.IsCrossAttention && len(q) > cache.Len() {
+		panic(fmt.Sprintf("selfattention: %d queries attending to %d cached keys", len(q), cache.Len()))
+	}
+	return m.attend(q, cache.Cache(), cache.Offset(), masks)
+}
+
+// attend is the same as Attend, where offset is the position of the first
+// key in kv, following the evicted ones.
+func (m *Model) attend(q []mat.Tensor, kv Cache, offset int, masks []*attention.Mask) ([]mat.Tensor, []mat.Tensor) {
 	pq := m.Query.Forward(q...)
+	if m.Position.Encoding == RotaryPositionEncoding && !m.IsCrossAttention {
+		pq = m.rotate(pq, offset+kv[0].Value().Shape()[0]-len(q))
+	}
 
-	if hasCache := cache.HasValues(); hasCache && m.IsCrossAttention {
-		pk = cache[0]
-		pv = cache[1]
-	} else {
-		k := m.Key.Forward(x...)
-		v := m.Value.Forward(x...)
-
-		if hasCache {
-			pk = ag.AppendRows(cache[0], k...)
-			pv = ag.AppendRows(cache[1], v...)
-		} else {
-			pk = ag.Stack(k...)
-			pv = ag.Stack(v...)
-		}
+	if m.Attention.Mechanism == LinearAttention {
+		return m.linearAttention(pq, kv, masks), nil
 	}
 
-	result, weights := attention.ScaledDotProductAttention(pq, pk, pv, m.ScaleFactor, m.UseCausalMask)
+	var bias attention.Bias
+	if !m.IsCrossAttention {
+		bias = m.positionBias()
+	}
+	bias = attention.JoinBiases(bias, m.masksBias(masks, len(q), kv[0].Value().Shape()[0], offset))
+	if m.Attention.Mechanism == SlidingWindowAttention {
+		global := m.Attention.GlobalTokens
+		if offset > 0 {
+			global = make([]int, len(m.Attention.GlobalTokens))
+			for i, p := range m.Attention.GlobalTokens {
+				global[i] = p - offset
+			}
+		}
+		return attention.SlidingWindowAttention(pq, kv[0], kv[1], m.ScaleFactor, m.Attention.Window, global, m.UseCausalMask, bias)
+	}
+	return attention.ScaledDotProductAttentionWithBias(pq, kv[0], kv[1], m.ScaleFactor, m.UseCausalMask, bias)
+}
 
-	return result, weights, Cache{pk, pv}
+// masksBias returns the attention.Bias of the given masks, or nil if there
+// are none. The offset is the position of the first key of a self-attention.
+//
+// The rows of the masks of an incremental decoding, where the queries follow
+// the cached keys, are only built for the keys in the cache, and are not
+// cached by the masks, since the following steps do not reuse them.
+func (m *Model) masksBias(masks []*attention.Mask, queries, keys, offset int) attention.Bias {
+	dtype := mat.DTypeOf(m.ScaleFactor.Value().(mat.Matrix))
+	biases := make([]attention.Bias, len(masks))
+	for i, mask := range masks {
+		mask := mask
+		switch {
+		case m.IsCrossAttention:
+			biases[i] = func(position, from, to int) mat.Tensor {
+				// The queries are placed at the last positions of the keys,
+				// while the ones of a cross-attention start from 0.
+				return mask.Row(position-(keys-queries), from, to, dtype)
+			}
+		case offset == 0 && keys == queries:
+			biases[i] = mask.Bias(dtype)
+		default:
+			biases[i] = func(position, from, to int) mat.Tensor {
+				// The keys follow the evicted ones.
+				return mask.NewRow(position+offset, from+offset, to+offset, dtype)
+			}
+		}
+	}
+	return attention.JoinBiases(biases...)
 }
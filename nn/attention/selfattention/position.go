@@ -0,0 +1,180 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn/attention"
+)
+
+// PositionEncoding is the kind of relative position information encoded by
+// a self-attention.
+type PositionEncoding int
+
+const (
+	// NoPositionEncoding encodes no position information, which must be
+	// added to the inputs, e.g. with absolute positional encodings.
+	NoPositionEncoding PositionEncoding = iota
+	// RotaryPositionEncoding rotates the projected queries and keys by
+	// angles proportional to their positions (RoPE), so that their dot
+	// products only depend on the relative positions.
+	RotaryPositionEncoding
+	// ALiBiPositionEncoding adds to the scores a bias proportional to the
+	// distance between the positions of the query and the key (ALiBi).
+	ALiBiPositionEncoding
+	// RelativeBiasPositionEncoding adds to the scores a learned bias for
+	// each bucket of relative positions, as in T5.
+	RelativeBiasPositionEncoding
+)
+
+// PositionConfig provides the settings of the relative position information
+// of a self-attention. They have no effect on a cross-attention.
+type PositionConfig struct {
+	Encoding PositionEncoding
+	// RotaryBase is the base of the angles of the RotaryPositionEncoding.
+	// Zero means 10000.
+	RotaryBase float64
+	// ALiBiSlope is the slope of the biases of the ALiBiPositionEncoding,
+	// usually different for each head.
+	ALiBiSlope float64
+	// RelativeBuckets is the number of buckets of the relative positions of
+	// the RelativeBiasPositionEncoding. Zero means 32.
+	RelativeBuckets int
+	// RelativeMaxDistance is the distance from which the relative positions
+	// share the last bucket. Zero means 128.
+	RelativeMaxDistance int
+}
+
+func (c PositionConfig) rotaryBase() float64 {
+	if c.RotaryBase == 0 {
+		return 10000
+	}
+	return c.RotaryBase
+}
+
+func (c PositionConfig) relativeBuckets() int {
+	if c.RelativeBuckets == 0 {
+		return 32
+	}
+	return c.RelativeBuckets
+}
+
+func (c PositionConfig) relativeMaxDistance() int {
+	if c.RelativeMaxDistance == 0 {
+		return 128
+	}
+	return c.RelativeMaxDistance
+}
+
+// ALiBiSlopes returns the slopes of the ALiBiPositionEncoding of each one of
+// the given number of heads: the geometric sequence starting at 2^(-8/n)
+// with the same ratio, where n is the smallest power of 2 not lower than the
+// number of heads.
+func ALiBiSlopes(heads int) []float64 {
+	n := 1
+	for n < heads {
+		n *= 2
+	}
+	slopes := make([]float64, heads)
+	for h := range slopes {
+		slopes[h] = math.Pow(2, -8*float64(h+1)/float64(n))
+	}
+	return slopes
+}
+
+// rotate applies the RotaryPositionEncoding to the vectors xs, starting at
+// the given position.
+func (m *Model) rotate(xs []mat.Tensor, position int) []mat.Tensor {
+	base := m.Position.rotaryBase()
+	ys := make([]mat.Tensor, len(xs))
+	for i, x := range xs {
+		ys[i] = ag.Rotary(x, position+i, base)
+	}
+	return ys
+}
+
+// positionBias returns the attention.Bias of the ALiBiPositionEncoding or
+// the RelativeBiasPositionEncoding, or nil for the other encodings.
+func (m *Model) positionBias() attention.Bias {
+	newVector := func(data []float64) mat.Tensor {
+		return m.ScaleFactor.Value().(mat.Matrix).NewMatrix(mat.WithShape(len(data)), mat.WithBacking(data))
+	}
+	switch m.Position.Encoding {
+	case ALiBiPositionEncoding:
+		slope := m.Position.ALiBiSlope
+		return func(position, from, to int) mat.Tensor {
+			bias := make([]float64, to-from)
+			for j := range bias {
+				bias[j] = -slope * math.Abs(float64(position-from-j))
+			}
+			return newVector(bias)
+		}
+	case RelativeBiasPositionEncoding:
+		buckets := m.Position.relativeBuckets()
+		maxDistance := m.Position.relativeMaxDistance()
+		bidirectional := !m.UseCausalMask
+		bucket := func(position, key int) int {
+			return relativePositionBucket(key-position, bidirectional, buckets, maxDistance)
+		}
+		return func(position, from, to int) mat.Tensor {
+			// The buckets are monotonic in the relative positions, so that
+			// the keys form runs of the same bucket, whose biases are the
+			// same learned scalar.
+			var runs []mat.Tensor
+			for start := from; start < to; {
+				b := bucket(position, start)
+				end := start + 1
+				for end < to && bucket(position, end) == b {
+					end++
+				}
+				runs = append(runs, m.relativeBiasRun(b, end-start))
+				start = end
+			}
+			if len(runs) == 1 {
+				return runs[0]
+			}
+			return ag.Concat(runs...)
+		}
+	default:
+		return nil
+	}
+}
+
+// relativeBiasRun returns a vector of n copies of the learned bias of the
+// given bucket of relative positions.
+func (m *Model) relativeBiasRun(bucket, n int) mat.Tensor {
+	b := ag.At(m.RelativeBias, bucket, 0)
+	if n == 1 {
+		return b
+	}
+	return ag.ProdScalar(m.ScaleFactor.Value().(mat.Matrix).NewMatrix(mat.WithShape(n)).OnesLike(), b)
+}
+
+// relativePositionBucket returns the bucket of the relative position of a
+// key from a query, as in T5: half of the buckets (of each direction, if
+// bidirectional) are for the exact distances, the others for distances
+// growing logarithmically up to maxDistance.
+func relativePositionBucket(relativePosition int, bidirectional bool, buckets, maxDistance int) int {
+	bucket := 0
+	n := -relativePosition
+	if bidirectional {
+		buckets /= 2
+		if n < 0 {
+			bucket += buckets
+			n = -n
+		}
+	} else if n < 0 {
+		n = 0
+	}
+	maxExact := buckets / 2
+	if n < maxExact || maxExact == 0 {
+		return bucket + min(n, buckets-1)
+	}
+	large := maxExact + int(math.Log(float64(n)/float64(maxExact))/math.Log(float64(maxDistance)/float64(maxExact))*float64(buckets-maxExact))
+	return bucket + min(large, buckets-1)
+}
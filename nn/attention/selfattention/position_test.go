@@ -0,0 +1,169 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package selfattention
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestALiBiSlopes(t *testing.T) {
+	assert.InDeltaSlice(t, []float64{0.25, 0.0625, 0.015625, 0.00390625}, ALiBiSlopes(4), 1.0e-12)
+	assert.InDeltaSlice(t, []float64{0.25, 0.0625, 0.015625}, ALiBiSlopes(3), 1.0e-12)
+	assert.InDelta(t, math.Pow(2, -8), ALiBiSlopes(8)[7], 1.0e-12)
+}
+
+func TestRelativePositionBucket(t *testing.T) {
+	testCases := []struct {
+		relativePosition int
+		bidirectional    bool
+		expected         int
+	}{
+		{0, true, 0},
+		{-1, true, 1},
+		{1, true, 17},
+		{-7, true, 7},
+		{-100, true, 15},
+		{100, true, 31},
+		{-1000, true, 15},
+		{0, false, 0},
+		{-1, false, 1},
+		{1, false, 0},
+		{-15, false, 15},
+		{-20, false, 17},
+		{-1000, false, 31},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, relativePositionBucket(tc.relativePosition, tc.bidirectional, 32, 128),
+			"relative position %d, bidirectional %v", tc.relativePosition, tc.bidirectional)
+	}
+}
+
+func TestModel_PositionEncodings(t *testing.T) {
+	encodings := map[string]PositionEncoding{
+		"none":          NoPositionEncoding,
+		"rotary":        RotaryPositionEncoding,
+		"alibi":         ALiBiPositionEncoding,
+		"relative bias": RelativeBiasPositionEncoding,
+	}
+	for name, encoding := range encodings {
+		t.Run(name, func(t *testing.T) {
+			t.Run("float32", func(t *testing.T) { testModelPositionEncoding[float32](t, encoding) })
+			t.Run("float64", func(t *testing.T) { testModelPositionEncoding[float64](t, encoding) })
+		})
+	}
+}
+
+// testModelPositionEncoding checks that the incremental decoding with the
+// cache gives the same outputs of the whole sequence, and that the outputs
+// of a non-causal attention depend on the order of the inputs, but for the
+// encoding of no position.
+func testModelPositionEncoding[T float.DType](t *testing.T, encoding PositionEncoding) {
+	newModel := func(causal bool) *Model {
+		m := New[T](Config{
+			InputSize:     4,
+			QuerySize:     4,
+			KeySize:       4,
+			ValueSize:     4,
+			ScaleFactor:   0.5,
+			UseCausalMask: causal,
+			Position: PositionConfig{
+				Encoding:            encoding,
+				ALiBiSlope:          0.5,
+				RelativeBuckets:     8,
+				RelativeMaxDistance: 16,
+			},
+		})
+		m.Init(rand.NewLockedRand(7))
+		if m.RelativeBias != nil {
+			mat.SetData[T](m.RelativeBias.Value(), []T{0.5, -1, 2, 0.1, -0.3, 1, 0.2, -2})
+		}
+		return m
+	}
+
+	m := newModel(true)
+	xs := make([]mat.Tensor, 5)
+	for i := range xs {
+		xs[i] = mat.NewDense[T](mat.WithBacking([]T{T(i%3) - 1, 0.5, T(i) / 4, -0.2}), mat.WithGrad(true))
+	}
+	ys, _, _ := m.Forward(Cache{}, xs, xs)
+
+	var cache Cache
+	var incremental []mat.Tensor
+	for _, chunk := range [][]mat.Tensor{xs[:2], xs[2:3], xs[3:]} {
+		var out []mat.Tensor
+		out, _, cache = m.Forward(cache, chunk, chunk)
+		incremental = append(incremental, out...)
+	}
+	require.Len(t, incremental, len(ys))
+	for i := range ys {
+		assert.InDeltaSlice(t, ys[i].Value().Data(), incremental[i].Value().Data(), 1.0e-5, "position %d", i)
+	}
+
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ys...))))
+	if encoding == RelativeBiasPositionEncoding {
+		assert.True(t, m.RelativeBias.HasGrad())
+	}
+
+	// Without position information, the attention is equivariant to the
+	// permutations of the inputs.
+	ys, _, _ = newModel(false).Forward(Cache{}, xs[:3], xs[:3])
+	rotated := []mat.Tensor{xs[1], xs[2], xs[0]}
+	zs, _, _ := newModel(false).Forward(Cache{}, rotated, rotated)
+	var diff float64
+	for j, v := range ys[0].Value().Data().F64() {
+		diff = math.Max(diff, math.Abs(v-zs[2].Value().Data().F64()[j]))
+	}
+	assert.Equal(t, encoding != NoPositionEncoding, diff > 1.0e-4)
+}
+
+func TestModel_positionBias(t *testing.T) {
+	for _, encoding := range []PositionEncoding{ALiBiPositionEncoding, RelativeBiasPositionEncoding} {
+		for _, causal := range []bool{false, true} {
+			m := New[float64](Config{
+				InputSize:     2,
+				QuerySize:     2,
+				KeySize:       2,
+				ValueSize:     2,
+				ScaleFactor:   1,
+				UseCausalMask: causal,
+				Position: PositionConfig{
+					Encoding:            encoding,
+					ALiBiSlope:          0.5,
+					RelativeBuckets:     8,
+					RelativeMaxDistance: 16,
+				},
+			})
+			if m.RelativeBias != nil {
+				mat.SetData[float64](m.RelativeBias.Value(), []float64{0.5, -1, 2, 0.1, -0.3, 1, 0.2, -2})
+			}
+			expected := func(position, key int) float64 {
+				if encoding == ALiBiPositionEncoding {
+					return -0.5 * math.Abs(float64(position-key))
+				}
+				bucket := relativePositionBucket(key-position, !causal, 8, 16)
+				return m.RelativeBias.Value().Data().F64()[bucket]
+			}
+
+			// Only the biases of the given range of keys.
+			bias := m.positionBias()
+			for _, r := range [][3]int{{10, 0, 40}, {10, 7, 14}, {30, 30, 31}, {3, 25, 40}} {
+				position, from, to := r[0], r[1], r[2]
+				b := bias(position, from, to).Value().Data().F64()
+				require.Len(t, b, to-from)
+				for j, v := range b {
+					assert.InDelta(t, expected(position, from+j), v, 1.0e-12, "%v, position %d, key %d", encoding, position, from+j)
+				}
+			}
+		}
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/nlpodyssey/spago/ag"
 	"github.com/nlpodyssey/spago/mat"
 	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn/attention"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -68,6 +69,36 @@ func testModelSelfAttention[T float.DType](t *testing.T) {
 	}, model.Query.B.Grad().Data(), 1.0e-05)
 }
 
+func TestModel_ForwardMasked(t *testing.T) {
+	t.Run("float32", testModelForwardMasked[float32])
+	t.Run("float64", testModelForwardMasked[float64])
+}
+
+func testModelForwardMasked[T float.DType](t *testing.T) {
+	model := newTestModel[T]()
+	x1 := mat.NewDense[T](mat.WithBacking([]T{-0.8, -0.9, -0.9, 1.0}))
+	x2 := mat.NewDense[T](mat.WithBacking([]T{0.8, -0.3, 0.5, 0.3}))
+	x3 := mat.NewDense[T](mat.WithBacking([]T{-0.2, 0.7, 0.2, 0.4}))
+
+	// The padding is ignored.
+	expected, _, _ := model.Forward(Cache{}, []mat.Tensor{x1, x3}, []mat.Tensor{x1, x3})
+	x := []mat.Tensor{x1, x3, x2}
+	output, weights, _ := model.Forward(Cache{}, x, x, attention.KeyPaddingMask([]bool{true, true, false}))
+	for i := range expected {
+		assert.InDeltaSlice(t, expected[i].Value().Data(), output[i].Value().Data(), 1.0e-6)
+		assert.InDelta(t, 0, weights[i].Value().Data().F64()[2], 1.0e-9)
+	}
+
+	// The masks are combined; the queries of a cross-attention are at the
+	// positions from 0, whatever the number of keys.
+	model.IsCrossAttention = true
+	onlyFirst := attention.NewMask(func(query, key int) bool { return key == query })
+	output, weights, _ = model.Forward(Cache{}, []mat.Tensor{x1, x2}, x, onlyFirst, attention.KeyPaddingMask([]bool{true, true, true}))
+	assert.InDeltaSlice(t, []T{1, 0, 0}, weights[0].Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, []T{0, 1, 0}, weights[1].Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, model.Value.Forward(x3)[0].Value().Data(), output[1].Value().Data(), 1.0e-6)
+}
+
 func newTestModel[T float.DType]() *Model {
 	model := New[T](Config{
 		InputSize:   4,
@@ -5,55 +5,215 @@
 package convolution
 
 import (
+	"fmt"
+	"slices"
+
 	"github.com/nlpodyssey/spago/ag"
 	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/gradfn"
+)
+
+// PaddingMode specifies the values used to pad the inputs of a convolution.
+type PaddingMode = gradfn.PaddingMode
+
+const (
+	// ZeroPadding pads the inputs with zeros.
+	ZeroPadding = gradfn.ZeroPadding
+	// ReflectPadding pads the inputs with the reflection of the values at
+	// the border, excluding the border itself.
+	ReflectPadding = gradfn.ReflectPadding
+	// ReplicatePadding pads the inputs with the values at the border.
+	ReplicatePadding = gradfn.ReplicatePadding
 )
 
-// Conv1D performs a 1D convolution.
+// Options provides the settings of a convolution of several channels.
+type Options = gradfn.ConvConfig
+
+// DefaultOptions returns the options of a convolution with the given strides
+// along the rows and the columns, no dilation, no padding and a single group.
+func DefaultOptions(xStride, yStride int) Options {
+	return gradfn.DefaultConvConfig(xStride, yStride)
+}
+
+// TransposeOptions provides the settings of a transposed convolution of
+// several channels.
+type TransposeOptions = gradfn.ConvTransposeConfig
+
+// DefaultTransposeOptions returns the options of a transposed convolution
+// with the given strides along the rows and the columns, no dilation, no
+// padding and a single group.
+func DefaultTransposeOptions(xStride, yStride int) TransposeOptions {
+	return gradfn.DefaultConvTransposeConfig(xStride, yStride)
+}
+
+// SamePadding returns the padding before and after the input, along one
+// dimension, such that the output has the same size of the input, with
+// stride 1, or the size of the input divided by the stride, rounded up.
+// The extra padding, if any, is added after the input.
+func SamePadding(kernelSize, dilation int) [2]int {
+	total := (kernelSize - 1) * dilation
+	return [2]int{total / 2, total - total/2}
+}
+
+// ValidPadding returns the padding before and after the input, along one
+// dimension, such that the kernel is only applied where it fully overlaps
+// the input, i.e. no padding.
+func ValidPadding() [2]int {
+	return [2]int{}
+}
+
+// Conv1D performs a 1D convolution. If the input columns, minus the kernel
+// columns, are not a multiple of the stride, the last columns are ignored.
+// It panics if the shapes of w and x are not compatible.
 func Conv1D(w, x mat.Tensor, stride int) mat.Tensor {
-	var dim int
-	wr, wc := w.Value().Shape()[0], w.Value().Shape()[1]
-	xr, xc := x.Value().Shape()[0], x.Value().Shape()[1]
-	if (xc-wc)%stride != 0 {
-		panic("Incompatible stride value for columns")
+	ys, err := Conv1DChannels([]mat.Tensor{w}, []mat.Tensor{x}, DefaultOptions(1, stride))
+	if err != nil {
+		panic(err)
+	}
+	return ys[0]
+}
+
+// Conv1DChannels performs a 1D convolution of the input channels xs, along
+// the columns, with the settings along the columns of the given options.
+// With a single group, ws[o*len(xs)+i] is the kernel applied to the input
+// channel i for the output channel o. It returns one column vector for each
+// output channel, as the sum of the convolutions of the input channels of
+// its group, or an error if the options, the inputs and the kernels are not
+// compatible.
+func Conv1DChannels(ws, xs []mat.Tensor, opts Options) ([]mat.Tensor, error) {
+	opts.StrideRows, opts.DilationRows, opts.PaddingRows = 1, 1, [2]int{}
+	outChannels, err := checkOperands(ws, xs, opts)
+	if err != nil {
+		return nil, err
 	}
-	if xr != wr {
-		panic("Incompatible stride value for rows")
+	xShape, wShape := xs[0].Value().Shape(), ws[0].Value().Shape()
+	if xShape[0] != wShape[0] {
+		return nil, fmt.Errorf("convolution: the kernels must have the same number of rows of the inputs; found %d and %d", wShape[0], xShape[0])
 	}
-	dim = (xc-wc)/stride + 1
-	ys := make([]mat.Tensor, dim)
-	for i := 0; i < dim; i++ {
-		fromCol := i * stride
-		ys[i] = ag.Dot(ag.Slice(x, 0, fromCol, wr, fromCol+wc), w)
+	if err := opts.ValidateInput(xShape[0], xShape[1], wShape[0], wShape[1]); err != nil {
+		return nil, err
 	}
-	return ag.Concat(ys...)
+
+	y := ag.Conv1D(xs, ws, opts)
+	if outChannels == 1 {
+		return []mat.Tensor{y}, nil
+	}
+	ys := make([]mat.Tensor, outChannels)
+	for o := range ys {
+		ys[o] = ag.ColView(y, o)
+	}
+	return ys, nil
 }
 
-// Conv2D performs a 2D convolution.
+// Conv2D performs a 2D convolution. If the input rows (or columns), minus the
+// kernel rows (or columns), are not a multiple of the stride, the last rows
+// (or columns) are ignored. It panics if the shapes of w and x are not
+// compatible.
 func Conv2D(w, x mat.Tensor, xStride, yStride int) mat.Tensor {
-	var dimx, dimy int
-	if (x.Value().Shape()[0]-w.Value().Shape()[0])%xStride != 0 {
-		panic("Incompatible stride value for rows")
-	}
-	if (x.Value().Shape()[1]-w.Value().Shape()[1])%yStride != 0 {
-		panic("Incompatible stride value for columns")
-	}
-	dimx = (x.Value().Shape()[0]-w.Value().Shape()[0])/xStride + 1
-	dimy = (x.Value().Shape()[1]-w.Value().Shape()[1])/yStride + 1
-
-	shape := w.Value().Shape()
-	wRows, wCols := shape[0], shape[1]
-
-	var outList []mat.Tensor
-	for i := 0; i < dimx; i++ {
-		for j := 0; j < dimy; j++ {
-			fromRow := i * xStride
-			fromCol := j * yStride
-			var view = ag.Slice(x, fromRow, fromCol, fromRow+wRows, fromCol+wCols)
-			var dotProduct = ag.Dot(view, w)
-			outList = append(outList, dotProduct)
+	ys, err := Conv2DChannels([]mat.Tensor{w}, []mat.Tensor{x}, DefaultOptions(xStride, yStride))
+	if err != nil {
+		panic(err)
+	}
+	return ys[0]
+}
+
+// Conv2DChannels performs a 2D convolution of the input channels xs, with
+// the given options. With a single group, ws[o*len(xs)+i] is the kernel
+// applied to the input channel i for the output channel o. It returns one
+// matrix for each output channel, as the sum of the convolutions of the
+// input channels of its group, or an error if the options, the inputs and
+// the kernels are not compatible.
+func Conv2DChannels(ws, xs []mat.Tensor, opts Options) ([]mat.Tensor, error) {
+	outChannels, err := checkOperands(ws, xs, opts)
+	if err != nil {
+		return nil, err
+	}
+	xShape, wShape := xs[0].Value().Shape(), ws[0].Value().Shape()
+	if err := opts.ValidateInput(xShape[0], xShape[1], wShape[0], wShape[1]); err != nil {
+		return nil, err
+	}
+	rows, cols := opts.OutputSize(xShape[0], xShape[1], wShape[0], wShape[1])
+
+	y := ag.Conv2D(xs, ws, opts)
+	ys := make([]mat.Tensor, outChannels)
+	for o := range ys {
+		ys[o] = ag.Reshape(ag.RowView(y, o), rows, cols)
+	}
+	return ys, nil
+}
+
+// Conv1DTransposeChannels performs a transposed 1D convolution of the input
+// channels xs, i.e. the adjoint of Conv1DChannels with the same kernels and
+// options: each input channel is a vector, such as an output channel of
+// Conv1DChannels, and ws[i*outG+o] is the kernel applied to the input
+// channel i for the output channel o of its group. It returns one matrix
+// for each output channel, with as many rows as the kernels.
+func Conv1DTransposeChannels(ws, xs []mat.Tensor, opts TransposeOptions) []mat.Tensor {
+	outChannels := transposeOutputChannels(ws, xs, opts)
+	wShape := ws[0].Value().Shape()
+	_, cols := opts.OutputSize(1, xs[0].Value().Size(), 1, wShape[1])
+	rows := wShape[0]
+
+	y := ag.Conv1DTranspose(xs, ws, opts)
+	ys := make([]mat.Tensor, outChannels)
+	for o := range ys {
+		ys[o] = ag.Reshape(ag.RowView(y, o), rows, cols)
+	}
+	return ys
+}
+
+// Conv2DTransposeChannels performs a transposed 2D convolution of the input
+// channels xs, i.e. the adjoint of Conv2DChannels with the same kernels and
+// options, where ws[i*outG+o] is the kernel applied to the input channel i
+// for the output channel o of its group. It returns one matrix for each
+// output channel.
+func Conv2DTransposeChannels(ws, xs []mat.Tensor, opts TransposeOptions) []mat.Tensor {
+	outChannels := transposeOutputChannels(ws, xs, opts)
+	xShape, wShape := xs[0].Value().Shape(), ws[0].Value().Shape()
+	rows, cols := opts.OutputSize(xShape[0], xShape[1], wShape[0], wShape[1])
+
+	y := ag.Conv2DTranspose(xs, ws, opts)
+	ys := make([]mat.Tensor, outChannels)
+	for o := range ys {
+		ys[o] = ag.Reshape(ag.RowView(y, o), rows, cols)
+	}
+	return ys
+}
+
+// checkOperands returns the number of output channels of the convolution,
+// or an error if the options are not valid, the number of kernels does not
+// match the number of inputs and groups, or the inputs (or the kernels) do
+// not all have the same shape.
+func checkOperands(ws, xs []mat.Tensor, opts Options) (int, error) {
+	if err := opts.Validate(); err != nil {
+		return 0, err
+	}
+	if len(xs) == 0 || len(ws) == 0 || len(xs)%opts.Groups != 0 || len(ws)%len(xs) != 0 {
+		return 0, fmt.Errorf("convolution: incompatible number of inputs, kernels and groups; found %d, %d and %d", len(xs), len(ws), opts.Groups)
+	}
+	xShape, wShape := xs[0].Value().Shape(), ws[0].Value().Shape()
+	for _, x := range xs[1:] {
+		if !slices.Equal(x.Value().Shape(), xShape) {
+			return 0, fmt.Errorf("convolution: the inputs must have the same shape; found %v and %v", xShape, x.Value().Shape())
 		}
 	}
+	for _, w := range ws[1:] {
+		if !slices.Equal(w.Value().Shape(), wShape) {
+			return 0, fmt.Errorf("convolution: the kernels must have the same shape; found %v and %v", wShape, w.Value().Shape())
+		}
+	}
+	return len(ws) / (len(xs) / opts.Groups), nil
+}
 
-	return ag.Reshape(ag.Concat(outList...), dimx, dimy)
+// transposeOutputChannels returns the number of output channels of the
+// transposed convolution. It panics if the options are not valid, or the
+// number of kernels does not match the number of inputs and groups.
+func transposeOutputChannels(ws, xs []mat.Tensor, opts TransposeOptions) int {
+	if err := opts.Validate(); err != nil {
+		panic(err)
+	}
+	if len(xs) == 0 || len(xs)%opts.Groups != 0 || len(ws)%len(xs) != 0 {
+		panic("convolution: incompatible number of inputs, kernels and groups")
+	}
+	return len(ws) / len(xs) * opts.Groups
 }
@@ -26,8 +26,79 @@ type Config struct {
 	InputChannels  int
 	OutputChannels int
 	Mask           []int
-	DepthWise      bool // Special case od depth-wise convolution, where output channels == input channels
+	DepthWise      bool // Special case of grouped convolution, where Groups == input channels == output channels
 	Activation     activation.Activation
+	// YDilation is the spacing between the elements of the kernels along
+	// the columns. Zero means no dilation.
+	YDilation int
+	// YPadding is the amount of padding before and after the inputs along
+	// the columns (see convolution.SamePadding and convolution.ValidPadding),
+	// filled according to PaddingMode.
+	YPadding    [2]int
+	PaddingMode convolution.PaddingMode
+	// Groups is the number of groups the input and output channels are split
+	// into: each output channel is the convolution of the input channels of
+	// its group only. Zero means a single group.
+	Groups int
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c Config) Validate() error {
+	switch {
+	case c.KernelSizeX <= 0 || c.KernelSizeY <= 0:
+		return fmt.Errorf("convolution1d: kernel size must be positive; found %dx%d", c.KernelSizeX, c.KernelSizeY)
+	case c.YStride <= 0:
+		return fmt.Errorf("convolution1d: stride must be positive; found %d", c.YStride)
+	case c.YDilation < 0:
+		return fmt.Errorf("convolution1d: dilation must not be negative; found %d", c.YDilation)
+	case c.YPadding[0] < 0 || c.YPadding[1] < 0:
+		return fmt.Errorf("convolution1d: padding must not be negative; found %v", c.YPadding)
+	case c.PaddingMode < convolution.ZeroPadding || c.PaddingMode > convolution.ReplicatePadding:
+		return fmt.Errorf("convolution1d: unsupported padding mode %v", c.PaddingMode)
+	case c.InputChannels <= 0 || c.OutputChannels <= 0:
+		return fmt.Errorf("convolution1d: channels must be positive; found %d input and %d output channels", c.InputChannels, c.OutputChannels)
+	case c.Mask != nil && c.InputChannels != len(c.Mask):
+		return fmt.Errorf("convolution1d: wrong mask size; found %d, expected %d", len(c.Mask), c.InputChannels)
+	case c.DepthWise && c.OutputChannels != c.InputChannels:
+		return fmt.Errorf("convolution1d: depth-wise convolution input channels must be equal to output channels")
+	case c.DepthWise && c.Groups != 0 && c.Groups != c.InputChannels:
+		return fmt.Errorf("convolution1d: depth-wise convolution groups must be equal to input channels; found %d", c.Groups)
+	case c.Groups < 0:
+		return fmt.Errorf("convolution1d: groups must not be negative; found %d", c.Groups)
+	}
+	if g := c.groups(); c.InputChannels%g != 0 || c.OutputChannels%g != 0 {
+		return fmt.Errorf("convolution1d: groups (%d) must divide input (%d) and output (%d) channels", g, c.InputChannels, c.OutputChannels)
+	}
+	return nil
+}
+
+// groups returns the actual number of groups.
+func (c Config) groups() int {
+	switch {
+	case c.DepthWise:
+		return c.InputChannels
+	case c.Groups == 0:
+		return 1
+	default:
+		return c.Groups
+	}
+}
+
+// options returns the options of the convolution.
+func (c Config) options() convolution.Options {
+	opts := convolution.DefaultOptions(1, c.YStride)
+	opts.DilationCols = max(c.YDilation, 1)
+	opts.PaddingCols = c.YPadding
+	opts.PaddingMode = c.PaddingMode
+	opts.Groups = c.groups()
+	return opts
+}
+
+// inputChannel returns the input channel the kernel K[k] is applied to.
+func (c Config) inputChannel(k int) int {
+	g := c.groups()
+	inG, outG := c.InputChannels/g, c.OutputChannels/g
+	return k/inG/outG*inG + k%inG
 }
 
 // Model contains the serializable parameters for a convolutional neural network model.
@@ -42,25 +113,18 @@ func init() {
 	gob.Register(&Model{})
 }
 
-// New returns a new convolution Model, initialized according to the given configuration.
-func New[T float.DType](config Config) *Model {
-	if config.Mask != nil && config.InputChannels != len(config.Mask) {
-		panic(fmt.Sprintf("convolution: wrong mask size; found %d, expected %d", config.InputChannels, len(config.Mask)))
-	}
-	var paramsSize int
-	if config.DepthWise {
-		if config.OutputChannels != config.InputChannels {
-			panic("convolution: DepthWise convolution input channels must be equals to output channels")
-		}
-		paramsSize = config.OutputChannels
-	} else {
-		paramsSize = config.InputChannels * config.OutputChannels
+// New returns a new convolution Model, initialized according to the given
+// configuration. It returns an error if the configuration is not valid.
+func New[T float.DType](config Config) (*Model, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
+	paramsSize := config.OutputChannels * config.InputChannels / config.groups()
 
 	kernels := make([]*nn.Param, paramsSize)
 	biases := make([]*nn.Param, paramsSize)
 	for i := 0; i < paramsSize; i++ {
-		requireGrad := config.Mask == nil || config.Mask[i%len(config.Mask)] == 1
+		requireGrad := config.Mask == nil || config.Mask[config.inputChannel(i)] == 1
 		kernels[i] = nn.NewParam(mat.NewDense[T](mat.WithShape(config.KernelSizeX, config.KernelSizeY))).WithGrad(requireGrad)
 		biases[i] = nn.NewParam(mat.NewDense[T](mat.WithShape(1))).WithGrad(requireGrad)
 	}
@@ -68,32 +132,66 @@ func New[T float.DType](config Config) *Model {
 		Config: config,
 		K:      kernels,
 		B:      biases,
-	}
+	}, nil
 }
 
 // Forward performs the forward step for each input node and returns the result.
+// It panics if the inputs are not compatible with the model; see
+// ForwardWithError.
 func (m *Model) Forward(xs ...mat.Tensor) []mat.Tensor {
-	ys := make([]mat.Tensor, m.Config.OutputChannels)
-	for i := range ys {
-		ys[i] = m.forward(xs, i)
+	ys, err := m.ForwardWithError(xs...)
+	if err != nil {
+		panic(err)
 	}
 	return ys
 }
 
-func (m *Model) forward(xs []mat.Tensor, outputChannel int) mat.Tensor {
-	offset := outputChannel * m.Config.InputChannels
-	var out mat.Tensor
-	if m.Config.DepthWise {
-		out = convolution.Conv1D(m.K[outputChannel], xs[outputChannel], m.Config.YStride)
-		out = ag.AddScalar(out, m.B[outputChannel])
-	} else {
-		for i := 0; i < len(xs); i++ {
-			if m.Config.Mask == nil || m.Config.Mask[i] == 1 {
-				out = ag.Add(out, convolution.Conv1D(m.K[i+offset], xs[i], m.Config.YStride))
-				out = ag.AddScalar(out, m.B[i+offset])
+// ForwardWithError performs the forward step for each input node and returns
+// the result, or an error if the number or the shapes of the inputs are not
+// compatible with the model, e.g. if the inputs are smaller than the dilated
+// kernels. The convolutions of all the channels are computed by a single
+// operator; the masked input channels are replaced by zeros.
+func (m *Model) ForwardWithError(xs ...mat.Tensor) ([]mat.Tensor, error) {
+	c := m.Config
+	if len(xs) != c.InputChannels {
+		return nil, fmt.Errorf("convolution1d: wrong number of inputs; found %d, expected %d", len(xs), c.InputChannels)
+	}
+	ys := make([]mat.Tensor, c.OutputChannels)
+
+	inputs := xs
+	if c.Mask != nil {
+		inputs = make([]mat.Tensor, len(xs))
+		masked := 0
+		for i, x := range xs {
+			if c.Mask[i] == 1 {
+				inputs[i] = x
+				continue
 			}
+			inputs[i] = x.Value().(mat.Matrix).ZerosLike()
+			masked++
+		}
+		if masked == len(xs) {
+			return ys, nil
 		}
 	}
+	ks := make([]mat.Tensor, len(m.K))
+	for i, k := range m.K {
+		ks[i] = k
+	}
 
-	return activation.New(m.Config.Activation).Forward(out)[0] // TODO: refactor for performance
+	outs, err := convolution.Conv1DChannels(ks, inputs, c.options())
+	if err != nil {
+		return nil, err
+	}
+	kernelsPerOutput := len(m.K) / c.OutputChannels
+	for outputChannel, out := range outs {
+		offset := outputChannel * kernelsPerOutput
+		for i := offset; i < offset+kernelsPerOutput; i++ {
+			if c.Mask == nil || c.Mask[c.inputChannel(i)] == 1 {
+				out = ag.AddScalar(out, m.B[i])
+			}
+		}
+		ys[outputChannel] = activation.New(c.Activation).Forward(out)[0] // TODO: refactor for performance
+	}
+	return ys, nil
 }
@@ -11,7 +11,9 @@ import (
 	"github.com/nlpodyssey/spago/mat"
 	"github.com/nlpodyssey/spago/mat/float"
 	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/convolution"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 //gocyclo:ignore
@@ -21,7 +23,7 @@ func TestModel_Forward(t *testing.T) {
 }
 
 func testModelForward[T float.DType](t *testing.T) {
-	model := newTestModel[T]()
+	model := newTestModel[T](t)
 
 	// == Forward
 
@@ -129,7 +131,7 @@ func TestDepthwise_Forward(t *testing.T) {
 }
 
 func testDepthwiseForward[T float.DType](t *testing.T) {
-	model := newTestModel2[T]()
+	model := newTestModel2[T](t)
 
 	// == Forward
 
@@ -160,8 +162,125 @@ func testDepthwiseForward[T float.DType](t *testing.T) {
 	}, y[2].Value().Data(), 1.0e-05)
 }
 
-func newTestModel[T float.DType]() *Model {
-	model := New[T](Config{
+func TestNew_InvalidConfig(t *testing.T) {
+	valid := Config{
+		KernelSizeX:    2,
+		KernelSizeY:    2,
+		YStride:        1,
+		InputChannels:  4,
+		OutputChannels: 2,
+		Activation:     activation.Identity,
+	}
+	_, err := New[float32](valid)
+	require.NoError(t, err)
+
+	testCases := map[string]func(c *Config){
+		"zero stride":        func(c *Config) { c.YStride = 0 },
+		"negative dilation":  func(c *Config) { c.YDilation = -1 },
+		"negative padding":   func(c *Config) { c.YPadding = [2]int{-1, 0} },
+		"wrong mask size":    func(c *Config) { c.Mask = []int{1} },
+		"depthwise channels": func(c *Config) { c.DepthWise = true },
+		"groups":             func(c *Config) { c.Groups = 3 },
+	}
+	for name, f := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			f(&c)
+			_, err := New[float32](c)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestModel_ForwardWithError(t *testing.T) {
+	valid := Config{
+		KernelSizeX:    2,
+		KernelSizeY:    3,
+		YStride:        1,
+		InputChannels:  1,
+		OutputChannels: 1,
+		Activation:     activation.Identity,
+	}
+	testCases := map[string]struct {
+		rows, cols int
+		config     func(c *Config)
+	}{
+		"kernel larger than the input": {2, 2, func(c *Config) {}},
+		"dilated kernel larger than the padded input": {2, 4, func(c *Config) {
+			c.YDilation, c.PaddingMode = 2, convolution.ReplicatePadding
+		}},
+		"reflect padding as large as the input": {2, 3, func(c *Config) {
+			c.PaddingMode, c.YPadding = convolution.ReflectPadding, [2]int{0, 3}
+		}},
+		"kernel rows not matching the input": {3, 4, func(c *Config) {}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			tc.config(&c)
+			model, err := New[float64](c)
+			require.NoError(t, err)
+			x := mat.NewDense[float64](mat.WithShape(tc.rows, tc.cols))
+			_, err = model.ForwardWithError(x)
+			assert.Error(t, err)
+			assert.Panics(t, func() { model.Forward(x) })
+		})
+	}
+
+	t.Run("wrong number of inputs", func(t *testing.T) {
+		model, err := New[float64](valid)
+		require.NoError(t, err)
+		_, err = model.ForwardWithError()
+		assert.Error(t, err)
+	})
+}
+
+func TestModel_ForwardPadding(t *testing.T) {
+	t.Run("float32", testModelForwardPadding[float32])
+	t.Run("float64", testModelForwardPadding[float64])
+}
+
+func testModelForwardPadding[T float.DType](t *testing.T) {
+	model, err := New[T](Config{
+		KernelSizeX:    2,
+		KernelSizeY:    2,
+		YStride:        1,
+		YDilation:      2,
+		YPadding:       convolution.SamePadding(2, 2),
+		PaddingMode:    convolution.ReplicatePadding,
+		InputChannels:  2,
+		OutputChannels: 2,
+		Groups:         2,
+		Activation:     activation.Identity,
+	})
+	require.NoError(t, err)
+	require.Len(t, model.K, 2)
+	mat.SetData[T](model.K[0].Value(), []T{
+		1, 0,
+		0, 0,
+	})
+	mat.SetData[T](model.K[1].Value(), []T{
+		0, 0,
+		0, 1,
+	})
+
+	x1 := mat.NewDense[T](mat.WithShape(2, 4), mat.WithBacking([]T{
+		1, 2, 3, 4,
+		5, 6, 7, 8,
+	}), mat.WithGrad(true))
+	x2 := mat.NewDense[T](mat.WithShape(2, 4), mat.WithBacking([]T{
+		-1, -2, -3, -4,
+		-5, -6, -7, -8,
+	}), mat.WithGrad(true))
+	ys := model.Forward(x1, x2)
+
+	// The inputs are padded to [a a b c d d] along the columns.
+	assert.InDeltaSlice(t, []T{1, 1, 2, 3}, ys[0].Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, []T{-6, -7, -8, -8}, ys[1].Value().Data(), 1.0e-6)
+}
+
+func newTestModel[T float.DType](t *testing.T) *Model {
+	model, err := New[T](Config{
 		KernelSizeX:    2,
 		KernelSizeY:    2,
 		YStride:        1,
@@ -171,6 +290,7 @@ func newTestModel[T float.DType]() *Model {
 		DepthWise:      false,
 		Activation:     activation.Tanh,
 	})
+	require.NoError(t, err)
 	mat.SetData[T](model.K[0].Value(), []T{
 		0.5, -0.4,
 		0.3, 0.3,
@@ -204,8 +324,8 @@ func newTestModel[T float.DType]() *Model {
 	return model
 }
 
-func newTestModel2[T float.DType]() *Model {
-	model := New[T](Config{
+func newTestModel2[T float.DType](t *testing.T) *Model {
+	model, err := New[T](Config{
 		KernelSizeX:    2,
 		KernelSizeY:    2,
 		YStride:        1,
@@ -215,6 +335,7 @@ func newTestModel2[T float.DType]() *Model {
 		DepthWise:      true,
 		Activation:     activation.Identity,
 	})
+	require.NoError(t, err)
 	mat.SetData[T](model.K[0].Value(), []T{
 		0.5, -0.4,
 		0.3, 0.3,
@@ -0,0 +1,133 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package convolution1d
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/convolution"
+)
+
+var _ nn.Model = &TransposeModel{}
+
+// TransposeConfig provides configuration settings for a TransposeModel.
+type TransposeConfig struct {
+	KernelSizeX    int
+	KernelSizeY    int
+	YStride        int
+	InputChannels  int
+	OutputChannels int
+	Activation     activation.Activation
+	// YDilation is the spacing between the elements of the kernels along
+	// the columns. Zero means no dilation.
+	YDilation int
+	// YPadding is the amount of padding of the convolution the model is the
+	// transpose of, removed from the outputs.
+	YPadding [2]int
+	// YOutputPadding is the number of columns added after the outputs; it
+	// must be smaller than the stride.
+	YOutputPadding int
+	// Groups is the number of groups the input and output channels are split
+	// into. Zero means a single group.
+	Groups int
+}
+
+// TransposeModel contains the serializable parameters for a transposed
+// (or fractionally strided) convolution model, typically used to upsample
+// the inputs, e.g. in decoders.
+//
+// The kernels K have the same layout of the ones of a Model with the input
+// and output channels exchanged, of which the TransposeModel computes the
+// adjoint, so that they can be shared with it, e.g. to tie the weights of
+// an encoder and a decoder.
+type TransposeModel struct {
+	nn.Module
+	Config TransposeConfig
+	K      []*nn.Param
+	B      *nn.Param // one bias for each output channel
+}
+
+func init() {
+	gob.Register(&TransposeModel{})
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c TransposeConfig) Validate() error {
+	switch {
+	case c.KernelSizeX <= 0 || c.KernelSizeY <= 0:
+		return fmt.Errorf("convolution1d: kernel size must be positive; found %dx%d", c.KernelSizeX, c.KernelSizeY)
+	case c.YStride <= 0:
+		return fmt.Errorf("convolution1d: stride must be positive; found %d", c.YStride)
+	case c.YDilation < 0:
+		return fmt.Errorf("convolution1d: dilation must not be negative; found %d", c.YDilation)
+	case c.YPadding[0] < 0 || c.YPadding[1] < 0:
+		return fmt.Errorf("convolution1d: padding must not be negative; found %v", c.YPadding)
+	case c.YOutputPadding < 0 || c.YOutputPadding >= c.YStride:
+		return fmt.Errorf("convolution1d: output padding must not be negative and must be smaller than the stride; found %d", c.YOutputPadding)
+	case c.InputChannels <= 0 || c.OutputChannels <= 0:
+		return fmt.Errorf("convolution1d: channels must be positive; found %d input and %d output channels", c.InputChannels, c.OutputChannels)
+	case c.Groups < 0:
+		return fmt.Errorf("convolution1d: groups must not be negative; found %d", c.Groups)
+	}
+	if g := c.groups(); c.InputChannels%g != 0 || c.OutputChannels%g != 0 {
+		return fmt.Errorf("convolution1d: groups (%d) must divide input (%d) and output (%d) channels", g, c.InputChannels, c.OutputChannels)
+	}
+	return nil
+}
+
+// groups returns the actual number of groups.
+func (c TransposeConfig) groups() int {
+	return max(c.Groups, 1)
+}
+
+// options returns the options of the transposed convolution.
+func (c TransposeConfig) options() convolution.TransposeOptions {
+	opts := convolution.DefaultTransposeOptions(1, c.YStride)
+	opts.DilationCols = max(c.YDilation, 1)
+	opts.PaddingCols = c.YPadding
+	opts.OutputPaddingCols = c.YOutputPadding
+	opts.Groups = c.groups()
+	return opts
+}
+
+// NewTranspose returns a new transposed convolution Model, initialized
+// according to the given configuration. It returns an error if the
+// configuration is not valid.
+func NewTranspose[T float.DType](config TransposeConfig) (*TransposeModel, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	kernels := make([]*nn.Param, config.InputChannels*config.OutputChannels/config.groups())
+	for i := range kernels {
+		kernels[i] = nn.NewParam(mat.NewDense[T](mat.WithShape(config.KernelSizeX, config.KernelSizeY)))
+	}
+	return &TransposeModel{
+		Config: config,
+		K:      kernels,
+		B:      nn.NewParam(mat.NewDense[T](mat.WithShape(config.OutputChannels))),
+	}, nil
+}
+
+// Forward performs the forward step for each input channel, such as the
+// output channels of a Model, and returns the output channels, with as many
+// rows as the kernels.
+func (m *TransposeModel) Forward(xs ...mat.Tensor) []mat.Tensor {
+	ks := make([]mat.Tensor, len(m.K))
+	for i, k := range m.K {
+		ks[i] = k
+	}
+	ys := convolution.Conv1DTransposeChannels(ks, xs, m.Config.options())
+	for o, y := range ys {
+		y = ag.AddScalar(y, ag.At(m.B, o))
+		ys[o] = activation.New(m.Config.Activation).Forward(y)[0] // TODO: refactor for performance
+	}
+	return ys
+}
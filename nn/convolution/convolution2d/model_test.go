@@ -10,8 +10,11 @@ import (
 	"github.com/nlpodyssey/spago/ag"
 	"github.com/nlpodyssey/spago/mat"
 	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
 	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/convolution"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 //gocyclo:ignore
@@ -21,7 +24,7 @@ func TestModel_Forward(t *testing.T) {
 }
 
 func testModelForward[T float.DType](t *testing.T) {
-	model := newTestModel[T]()
+	model := newTestModel[T](t)
 
 	// == Forward
 
@@ -153,7 +156,7 @@ func TestDepthwise_Forward(t *testing.T) {
 }
 
 func testDepthwiseForward[T float.DType](t *testing.T) {
-	model := newTestModel2[T]()
+	model := newTestModel2[T](t)
 
 	// == Forward
 
@@ -196,8 +199,145 @@ func testDepthwiseForward[T float.DType](t *testing.T) {
 	}, y[2].Value().Data(), 1.0e-05)
 }
 
-func newTestModel[T float.DType]() *Model {
-	model := New[T](Config{
+func TestNew_InvalidConfig(t *testing.T) {
+	valid := Config{
+		KernelSizeX:    2,
+		KernelSizeY:    2,
+		XStride:        1,
+		YStride:        1,
+		InputChannels:  4,
+		OutputChannels: 2,
+		Activation:     activation.Identity,
+	}
+	_, err := New[float32](valid)
+	require.NoError(t, err)
+
+	testCases := map[string]func(c *Config){
+		"zero kernel size":                    func(c *Config) { c.KernelSizeX = 0 },
+		"zero stride":                         func(c *Config) { c.YStride = 0 },
+		"negative dilation":                   func(c *Config) { c.XDilation = -1 },
+		"negative padding":                    func(c *Config) { c.YPadding = [2]int{0, -1} },
+		"padding mode":                        func(c *Config) { c.PaddingMode = 42 },
+		"no output channels":                  func(c *Config) { c.OutputChannels = 0 },
+		"wrong mask size":                     func(c *Config) { c.Mask = []int{1, 1} },
+		"depthwise channels":                  func(c *Config) { c.DepthWise = true },
+		"depthwise groups":                    func(c *Config) { c.DepthWise, c.OutputChannels, c.Groups = true, 4, 2 },
+		"negative groups":                     func(c *Config) { c.Groups = -1 },
+		"groups not dividing input channels":  func(c *Config) { c.Groups, c.InputChannels = 2, 3 },
+		"groups not dividing output channels": func(c *Config) { c.Groups, c.OutputChannels = 4, 2 },
+	}
+	for name, f := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			f(&c)
+			_, err := New[float32](c)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestModel_ForwardWithError(t *testing.T) {
+	valid := Config{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        1,
+		YStride:        1,
+		InputChannels:  1,
+		OutputChannels: 1,
+		Activation:     activation.Identity,
+	}
+	testCases := map[string]struct {
+		rows, cols int
+		config     func(c *Config)
+	}{
+		"kernel larger than the input": {2, 2, func(c *Config) {}},
+		"dilated kernel larger than the padded input": {4, 4, func(c *Config) {
+			c.XDilation, c.YPadding = 2, [2]int{0, 1}
+		}},
+		"reflect padding as large as the input": {3, 3, func(c *Config) {
+			c.PaddingMode, c.YPadding = convolution.ReflectPadding, [2]int{3, 0}
+		}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			tc.config(&c)
+			model, err := New[float64](c)
+			require.NoError(t, err)
+			x := mat.NewDense[float64](mat.WithShape(tc.rows, tc.cols))
+			_, err = model.ForwardWithError(x)
+			assert.Error(t, err)
+			assert.Panics(t, func() { model.Forward(x) })
+		})
+	}
+
+	t.Run("wrong number of inputs", func(t *testing.T) {
+		model, err := New[float64](valid)
+		require.NoError(t, err)
+		x := mat.NewDense[float64](mat.WithShape(3, 3))
+		_, err = model.ForwardWithError(x, x)
+		assert.Error(t, err)
+		ys, err := model.ForwardWithError(x)
+		assert.NoError(t, err)
+		assert.Equal(t, []int{1, 1}, ys[0].Value().Shape())
+	})
+}
+
+func TestModel_ForwardGroups(t *testing.T) {
+	t.Run("float32", testModelForwardGroups[float32])
+	t.Run("float64", testModelForwardGroups[float64])
+}
+
+func testModelForwardGroups[T float.DType](t *testing.T) {
+	model, err := New[T](Config{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        1,
+		YStride:        2,
+		XDilation:      2,
+		XPadding:       convolution.SamePadding(3, 2),
+		YPadding:       convolution.SamePadding(3, 1),
+		PaddingMode:    convolution.ReflectPadding,
+		InputChannels:  4,
+		OutputChannels: 2,
+		Groups:         2,
+		Mask:           []int{1, 0, 1, 1},
+		Activation:     activation.Identity,
+	})
+	require.NoError(t, err)
+	require.Len(t, model.K, 4, "two kernels for each output channel")
+	for i, k := range model.K {
+		mat.SetData[T](k.Value(), []T{
+			0.1, -0.2, 0.3,
+			0.4, 0.5, -0.6,
+			0.7, -0.8, 0.9 * T(i+1),
+		})
+	}
+	assert.False(t, model.K[1].RequiresGrad(), "masked input channel")
+
+	xs := make([]mat.Tensor, 4)
+	for i := range xs {
+		x := mat.NewDense[T](mat.WithShape(5, 5)).OnesLike()
+		x.SetRequiresGrad(true)
+		xs[i] = x
+	}
+	ys := model.Forward(xs...)
+	require.Len(t, ys, 2)
+	assert.Equal(t, []int{5, 3}, ys[0].Value().Shape(), "same padding, rounded up with stride 2")
+
+	ys[0].AccGrad(ys[0].Value().(mat.Matrix).OnesLike())
+	require.NoError(t, ag.Backward(ys[0]))
+	assert.True(t, xs[0].(mat.Matrix).HasGrad())
+	assert.False(t, xs[1].(mat.Matrix).HasGrad(), "masked input channel")
+	assert.Equal(t, make([]float64, 25), xs[2].Grad().Data().F64(), "input channel of another group")
+	assert.Equal(t, make([]float64, 25), xs[3].Grad().Data().F64(), "input channel of another group")
+	assert.True(t, model.K[0].HasGrad())
+	assert.True(t, model.B[0].HasGrad())
+	assert.False(t, model.B[1].HasGrad(), "bias of a masked input channel")
+}
+
+func newTestModel[T float.DType](t *testing.T) *Model {
+	model, err := New[T](Config{
 		KernelSizeX:    2,
 		KernelSizeY:    2,
 		XStride:        1,
@@ -208,6 +348,7 @@ func newTestModel[T float.DType]() *Model {
 		DepthWise:      false,
 		Activation:     activation.Tanh,
 	})
+	require.NoError(t, err)
 	mat.SetData[T](model.K[0].Value(), []T{
 		0.5, -0.4,
 		0.3, 0.3,
@@ -241,8 +382,8 @@ func newTestModel[T float.DType]() *Model {
 	return model
 }
 
-func newTestModel2[T float.DType]() *Model {
-	model := New[T](Config{
+func newTestModel2[T float.DType](t *testing.T) *Model {
+	model, err := New[T](Config{
 		KernelSizeX:    2,
 		KernelSizeY:    2,
 		XStride:        1,
@@ -253,6 +394,7 @@ func newTestModel2[T float.DType]() *Model {
 		DepthWise:      true,
 		Activation:     activation.Identity,
 	})
+	require.NoError(t, err)
 	mat.SetData[T](model.K[0].Value(), []T{
 		0.5, -0.4,
 		0.3, 0.3,
@@ -270,3 +412,35 @@ func newTestModel2[T float.DType]() *Model {
 	mat.SetData[T](model.B[2].Value(), []T{0.5})
 	return model
 }
+
+func BenchmarkModel_ForwardBackward(b *testing.B) {
+	model, err := New[float32](Config{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        1,
+		YStride:        1,
+		InputChannels:  3,
+		OutputChannels: 8,
+		Activation:     activation.Identity,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	xs := make([]mat.Tensor, 3)
+	for i := range xs {
+		xs[i] = mat.NewDense[float32](mat.WithShape(64, 64)).OnesLike()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ys := model.Forward(xs...)
+		for _, y := range ys {
+			y.AccGrad(y.Value().(mat.Matrix).OnesLike())
+		}
+		if err := ag.Backward(ys...); err != nil {
+			b.Fatal(err)
+		}
+		nn.ZeroGrad(model)
+	}
+}
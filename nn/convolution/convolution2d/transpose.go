@@ -0,0 +1,139 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package convolution2d
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/convolution"
+)
+
+var _ nn.Model = &TransposeModel{}
+
+// TransposeConfig provides configuration settings for a TransposeModel.
+type TransposeConfig struct {
+	KernelSizeX    int
+	KernelSizeY    int
+	XStride        int
+	YStride        int
+	InputChannels  int
+	OutputChannels int
+	Activation     activation.Activation
+	// XDilation and YDilation are the spacings between the elements of the
+	// kernels along the rows and the columns. Zero means no dilation.
+	XDilation int
+	YDilation int
+	// XPadding and YPadding are the amounts of padding of the convolution
+	// the model is the transpose of, removed from the outputs.
+	XPadding [2]int
+	YPadding [2]int
+	// XOutputPadding and YOutputPadding are the numbers of rows and columns
+	// added after the outputs; they must be smaller than the strides.
+	XOutputPadding int
+	YOutputPadding int
+	// Groups is the number of groups the input and output channels are split
+	// into. Zero means a single group.
+	Groups int
+}
+
+// TransposeModel contains the serializable parameters for a transposed
+// (or fractionally strided) convolution model, typically used to upsample
+// the inputs, e.g. in decoders.
+//
+// The kernels K have the same layout of the ones of a Model with the input
+// and output channels exchanged, of which the TransposeModel computes the
+// adjoint, so that they can be shared with it, e.g. to tie the weights of
+// an encoder and a decoder.
+type TransposeModel struct {
+	nn.Module
+	Config TransposeConfig
+	K      []*nn.Param
+	B      *nn.Param // one bias for each output channel
+}
+
+func init() {
+	gob.Register(&TransposeModel{})
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c TransposeConfig) Validate() error {
+	switch {
+	case c.KernelSizeX <= 0 || c.KernelSizeY <= 0:
+		return fmt.Errorf("convolution2d: kernel size must be positive; found %dx%d", c.KernelSizeX, c.KernelSizeY)
+	case c.XStride <= 0 || c.YStride <= 0:
+		return fmt.Errorf("convolution2d: strides must be positive; found %d and %d", c.XStride, c.YStride)
+	case c.XDilation < 0 || c.YDilation < 0:
+		return fmt.Errorf("convolution2d: dilations must not be negative; found %d and %d", c.XDilation, c.YDilation)
+	case c.XPadding[0] < 0 || c.XPadding[1] < 0 || c.YPadding[0] < 0 || c.YPadding[1] < 0:
+		return fmt.Errorf("convolution2d: paddings must not be negative; found %v and %v", c.XPadding, c.YPadding)
+	case c.XOutputPadding < 0 || c.XOutputPadding >= c.XStride || c.YOutputPadding < 0 || c.YOutputPadding >= c.YStride:
+		return fmt.Errorf("convolution2d: output paddings must not be negative and must be smaller than the strides; found %d and %d", c.XOutputPadding, c.YOutputPadding)
+	case c.InputChannels <= 0 || c.OutputChannels <= 0:
+		return fmt.Errorf("convolution2d: channels must be positive; found %d input and %d output channels", c.InputChannels, c.OutputChannels)
+	case c.Groups < 0:
+		return fmt.Errorf("convolution2d: groups must not be negative; found %d", c.Groups)
+	}
+	if g := c.groups(); c.InputChannels%g != 0 || c.OutputChannels%g != 0 {
+		return fmt.Errorf("convolution2d: groups (%d) must divide input (%d) and output (%d) channels", g, c.InputChannels, c.OutputChannels)
+	}
+	return nil
+}
+
+// groups returns the actual number of groups.
+func (c TransposeConfig) groups() int {
+	return max(c.Groups, 1)
+}
+
+// options returns the options of the transposed convolution.
+func (c TransposeConfig) options() convolution.TransposeOptions {
+	opts := convolution.DefaultTransposeOptions(c.XStride, c.YStride)
+	opts.DilationRows = max(c.XDilation, 1)
+	opts.DilationCols = max(c.YDilation, 1)
+	opts.PaddingRows = c.XPadding
+	opts.PaddingCols = c.YPadding
+	opts.OutputPaddingRows = c.XOutputPadding
+	opts.OutputPaddingCols = c.YOutputPadding
+	opts.Groups = c.groups()
+	return opts
+}
+
+// NewTranspose returns a new transposed convolution Model, initialized
+// according to the given configuration. It returns an error if the
+// configuration is not valid.
+func NewTranspose[T float.DType](config TransposeConfig) (*TransposeModel, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	kernels := make([]*nn.Param, config.InputChannels*config.OutputChannels/config.groups())
+	for i := range kernels {
+		kernels[i] = nn.NewParam(mat.NewDense[T](mat.WithShape(config.KernelSizeX, config.KernelSizeY)))
+	}
+	return &TransposeModel{
+		Config: config,
+		K:      kernels,
+		B:      nn.NewParam(mat.NewDense[T](mat.WithShape(config.OutputChannels))),
+	}, nil
+}
+
+// Forward performs the forward step for each input channel and returns the
+// output channels.
+func (m *TransposeModel) Forward(xs ...mat.Tensor) []mat.Tensor {
+	ks := make([]mat.Tensor, len(m.K))
+	for i, k := range m.K {
+		ks[i] = k
+	}
+	ys := convolution.Conv2DTransposeChannels(ks, xs, m.Config.options())
+	for o, y := range ys {
+		y = ag.AddScalar(y, ag.At(m.B, o))
+		ys[o] = activation.New(m.Config.Activation).Forward(y)[0] // TODO: refactor for performance
+	}
+	return ys
+}
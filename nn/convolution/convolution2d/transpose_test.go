@@ -0,0 +1,124 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package convolution2d
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/convolution"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTranspose_InvalidConfig(t *testing.T) {
+	valid := TransposeConfig{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        2,
+		YStride:        2,
+		InputChannels:  2,
+		OutputChannels: 4,
+		Activation:     activation.Identity,
+	}
+	_, err := NewTranspose[float32](valid)
+	require.NoError(t, err)
+
+	testCases := map[string]func(c *TransposeConfig){
+		"zero kernel size":        func(c *TransposeConfig) { c.KernelSizeY = 0 },
+		"zero stride":             func(c *TransposeConfig) { c.XStride = 0 },
+		"negative padding":        func(c *TransposeConfig) { c.XPadding = [2]int{-1, 0} },
+		"output padding":          func(c *TransposeConfig) { c.YOutputPadding = 2 },
+		"no input channels":       func(c *TransposeConfig) { c.InputChannels = 0 },
+		"groups not dividing":     func(c *TransposeConfig) { c.Groups = 4 },
+		"negative output padding": func(c *TransposeConfig) { c.XOutputPadding = -1 },
+	}
+	for name, f := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := valid
+			f(&c)
+			_, err := NewTranspose[float32](c)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTransposeModel_Forward(t *testing.T) {
+	t.Run("float32", testTransposeModelForward[float32])
+	t.Run("float64", testTransposeModelForward[float64])
+}
+
+// testTransposeModelForward checks that a TransposeModel sharing the kernels
+// of a Model computes the gradients of the inputs of the Model.
+func testTransposeModelForward[T float.DType](t *testing.T) {
+	encoder, err := New[T](Config{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        2,
+		YStride:        2,
+		XPadding:       convolution.SamePadding(3, 1),
+		YPadding:       convolution.SamePadding(3, 1),
+		InputChannels:  2,
+		OutputChannels: 3,
+		Activation:     activation.Identity,
+	})
+	require.NoError(t, err)
+	for i, k := range encoder.K {
+		data := make([]T, 9)
+		for j := range data {
+			data[j] = T((i*5+j*3)%7)/10 - 0.3
+		}
+		mat.SetData[T](k.Value(), data)
+	}
+
+	decoder, err := NewTranspose[T](TransposeConfig{
+		KernelSizeX:    3,
+		KernelSizeY:    3,
+		XStride:        2,
+		YStride:        2,
+		XPadding:       convolution.SamePadding(3, 1),
+		YPadding:       convolution.SamePadding(3, 1),
+		XOutputPadding: 1,
+		YOutputPadding: 1,
+		InputChannels:  3,
+		OutputChannels: 2,
+		Activation:     activation.Identity,
+	})
+	require.NoError(t, err)
+	require.Len(t, decoder.K, len(encoder.K))
+	decoder.K = encoder.K
+
+	us := make([]mat.Tensor, 2)
+	for i := range us {
+		u := mat.NewDense[T](mat.WithShape(6, 6)).OnesLike()
+		u.SetRequiresGrad(true)
+		us[i] = u
+	}
+	vs := make([]mat.Tensor, 3)
+	for i := range vs {
+		data := make([]T, 9)
+		for j := range data {
+			data[j] = T((i*3+j*7)%11)/10 - 0.5
+		}
+		vs[i] = mat.NewDense[T](mat.WithShape(3, 3), mat.WithBacking(data))
+	}
+
+	ys := encoder.Forward(us...)
+	for i, y := range ys {
+		require.Equal(t, []int{3, 3}, y.Value().Shape())
+		y.AccGrad(vs[i].(mat.Matrix))
+	}
+	require.NoError(t, ag.Backward(ys...))
+
+	zs := decoder.Forward(vs...)
+	require.Len(t, zs, 2)
+	for i, z := range zs {
+		assert.Equal(t, []int{6, 6}, z.Value().Shape(), "upsampled to the input shape of the encoder")
+		assert.InDeltaSlice(t, us[i].Grad().Data().F64(), z.Value().Data().F64(), 1.0e-5)
+	}
+}
@@ -136,3 +136,43 @@ func testConv2DStride2[T float.DType](t *testing.T) {
 		0.15, 0.15, 0.09, 0.09,
 	}, x.Grad().Data(), 0.005)
 }
+
+func TestConv2DChannels_InvalidInput(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(2, 2))
+	w := mat.NewDense[float64](mat.WithShape(3, 3))
+
+	_, err := Conv2DChannels([]mat.Tensor{w}, []mat.Tensor{x}, DefaultOptions(1, 1))
+	assert.Error(t, err, "kernel larger than the input")
+	_, err = Conv2DChannels([]mat.Tensor{w}, []mat.Tensor{x, w}, DefaultOptions(1, 1))
+	assert.Error(t, err, "inputs of different shapes")
+	_, err = Conv2DChannels([]mat.Tensor{w, w}, []mat.Tensor{x, x, x}, DefaultOptions(1, 1))
+	assert.Error(t, err, "kernels not multiple of the inputs")
+
+	opts := DefaultOptions(1, 1)
+	opts.PaddingMode = ReflectPadding
+	opts.PaddingRows = [2]int{2, 2}
+	_, err = Conv2DChannels([]mat.Tensor{x}, []mat.Tensor{x}, opts)
+	assert.Error(t, err, "reflect padding as large as the input")
+	assert.Panics(t, func() { Conv2D(w, x, 1, 1) })
+}
+
+func TestConv1DChannels_InvalidInput(t *testing.T) {
+	x := mat.NewDense[float64](mat.WithShape(2, 2))
+	w := mat.NewDense[float64](mat.WithShape(2, 3))
+
+	_, err := Conv1DChannels([]mat.Tensor{w}, []mat.Tensor{x}, DefaultOptions(1, 1))
+	assert.Error(t, err, "kernel larger than the input")
+	_, err = Conv1DChannels([]mat.Tensor{w}, []mat.Tensor{w.T()}, DefaultOptions(1, 1))
+	assert.Error(t, err, "kernel rows not matching the input")
+
+	x4 := mat.NewDense[float64](mat.WithShape(2, 4))
+	opts := DefaultOptions(1, 1)
+	opts.DilationCols = 2
+	_, err = Conv1DChannels([]mat.Tensor{w}, []mat.Tensor{x4}, opts)
+	assert.Error(t, err, "dilated kernel larger than the input")
+	opts.PaddingRows = [2]int{5, 5}
+	opts.PaddingCols = [2]int{1, 0}
+	_, err = Conv1DChannels([]mat.Tensor{w}, []mat.Tensor{x4}, opts)
+	assert.NoError(t, err, "dilated kernel fitting the padded input, ignoring the rows settings")
+	assert.Panics(t, func() { Conv1D(w, x, 1) })
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nn
+
+import (
+	"reflect"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// ConvertDType converts, in place, the values of all the parameters and
+// buffers of the model (including sub-models) to T.
+//
+// The accumulated gradients of the parameters are converted too, as well as
+// the matrices of their optimizer state (i.e. the exported fields of type
+// mat.Matrix of the struct pointed by Param.State, such as the moments of
+// Adam). Generic optimization strategies must then be instantiated with T.
+//
+// Buffers are not visited in models implementing ParamsTraverser.
+// It must not be called concurrently with the forward or backward passes.
+func ConvertDType[T float.DType](m Model) {
+	dtype := mat.DTypeFor[T]()
+	paramsTraversal{
+		paramsFunc: func(param *Param) {
+			param.convertDType(dtype)
+		},
+		buffersFunc: func(buffer *Buffer) {
+			buffer.convertDType(dtype)
+		},
+		exploreSubModels: true,
+	}.walk(m)
+}
+
+// convertDType converts the value, the gradients and the optimizer state
+// of the param. Params already of the given type, including params shared
+// by more models and visited twice, are left untouched.
+func (p *Param) convertDType(dtype mat.DType) {
+	if mat.DTypeOf(p.Matrix) == dtype {
+		return
+	}
+	value := mat.Convert(p.Matrix, dtype)
+	value.SetRequiresGrad(p.RequiresGrad())
+	if p.HasGrad() {
+		value.AccGrad(mat.Convert(p.Grad().(mat.Matrix), dtype))
+	}
+	p.Matrix = value
+	convertStateDType(p.State, dtype)
+}
+
+// convertStateDType converts the exported fields of type mat.Matrix of the
+// struct pointed by state, if any.
+func convertStateDType(state any, dtype mat.DType) {
+	v := reflect.ValueOf(state)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	matrixType := reflect.TypeOf((*mat.Matrix)(nil)).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if field.Type() != matrixType || !field.CanSet() || field.IsNil() {
+			continue
+		}
+		field.Set(reflect.ValueOf(mat.Convert(field.Interface().(mat.Matrix), dtype)))
+	}
+}
+
+// convertDType converts the value of the buffer.
+func (b *Buffer) convertDType(dtype mat.DType) {
+	if b.Tensor == nil {
+		return
+	}
+	value := b.Value().(mat.Matrix)
+	if mat.DTypeOf(value) == dtype {
+		return
+	}
+	b.Tensor = ag.StopGrad(mat.Convert(value, dtype))
+}
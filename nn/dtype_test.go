@@ -0,0 +1,78 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nn
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type dtypeTestState struct {
+	M      mat.Matrix
+	Master *Param
+}
+
+type dtypeTestSubModel struct {
+	Module
+	W *Param
+}
+
+type dtypeTestModel struct {
+	Module
+	W      *Param
+	Frozen *Param
+	Eps    *Buffer
+	Layers []*dtypeTestSubModel
+}
+
+func TestConvertDType(t *testing.T) {
+	w := NewParam(mat.NewDense[float64](mat.WithShape(2, 2), mat.WithBacking([]float64{1, 2, 3, 4})))
+	w.AccGrad(mat.NewDense[float64](mat.WithShape(2, 2), mat.WithBacking([]float64{0.1, 0.2, 0.3, 0.4})))
+	master := NewParam(mat.NewDense[float64](mat.WithShape(2, 2)))
+	w.State = &dtypeTestState{
+		M:      mat.NewDense[float64](mat.WithShape(2, 2), mat.WithBacking([]float64{5, 6, 7, 8})),
+		Master: master,
+	}
+	shared := &dtypeTestSubModel{W: NewParam(mat.NewDense[float64](mat.WithBacking([]float64{1, 2})))}
+
+	m := &dtypeTestModel{
+		W:      w,
+		Frozen: NewParam(mat.NewDense[float64](mat.WithBacking([]float64{1, 2}))).WithGrad(false),
+		Eps:    Buf(mat.Scalar(1e-5)),
+		Layers: []*dtypeTestSubModel{shared, shared},
+	}
+
+	ConvertDType[float32](m)
+
+	assert.Same(t, w, m.W, "the params must be converted in place")
+	assert.Equal(t, []float32{1, 2, 3, 4}, mat.Data[float32](m.W))
+	assert.Equal(t, []int{2, 2}, m.W.Shape())
+	assert.True(t, m.W.RequiresGrad())
+	assert.InDeltaSlice(t, []float32{0.1, 0.2, 0.3, 0.4}, mat.Data[float32](m.W.Grad()), 1e-6)
+
+	state := m.W.State.(*dtypeTestState)
+	assert.Equal(t, []float32{5, 6, 7, 8}, mat.Data[float32](state.M))
+	assert.Same(t, master, state.Master)
+	assert.Equal(t, mat.Float64, mat.DTypeOf(state.Master), "only the matrices of the state must be converted")
+
+	assert.False(t, m.Frozen.RequiresGrad())
+	assert.Equal(t, mat.Float32, mat.DTypeOf(m.Frozen))
+	assert.Equal(t, mat.Float32, mat.DTypeOf(m.Eps.Value().(mat.Matrix)))
+	assert.False(t, m.Eps.RequiresGrad())
+	assert.Equal(t, []float32{1, 2}, mat.Data[float32](shared.W))
+
+	x := mat.NewDense[float32](mat.WithBacking([]float32{1, 1}))
+	y := ag.ReduceSum(ag.Mul(m.W, x))
+	require.NoError(t, ag.Backward(y))
+	assert.InDeltaSlice(t, []float32{1.1, 1.2, 1.3, 1.4}, mat.Data[float32](m.W.Grad()), 1e-6)
+
+	ConvertDType[float64](m)
+	assert.InDeltaSlice(t, []float64{1, 2, 3, 4}, mat.Data[float64](m.W), 1e-6)
+	assert.InDelta(t, 1e-5, m.Eps.Value().Item().F64(), 1e-10)
+}
@@ -21,9 +21,12 @@ var _ nn.ParamsTraverser = &Model{}
 // embeddings using their corresponding indices.
 type Model struct {
 	nn.Module
-	Size         int
-	Dim          int
-	Weights      []*nn.Param
+	Size    int
+	Dim     int
+	Weights []*nn.Param
+	// Vocabulary optionally maps the tokens to the rows, e.g. the one of
+	// the pretrained vectors (see LoadWord2VecText), for EncodeTokens.
+	Vocabulary   *Vocabulary
 	embedGradIdx map[int]struct{}
 	mu           sync.Mutex
 }
@@ -48,9 +51,23 @@ func New[T float.DType](size int, dim int) *Model {
 }
 
 // TraverseParams allows embeddings with gradients to be traversed for optimization.
+// The embeddings whose gradients have been zeroed directly on their
+// parameters, as the optimizers do, are no longer tracked, so that only the
+// rows used since the last optimization are traversed.
 func (m *Model) TraverseParams(callback func(param *nn.Param)) {
+	m.mu.Lock()
+	params := make([]*nn.Param, 0, len(m.embedGradIdx))
 	for idx := range m.embedGradIdx {
-		callback(m.Weights[idx])
+		if !m.Weights[idx].HasGrad() {
+			delete(m.embedGradIdx, idx)
+			continue
+		}
+		params = append(params, m.Weights[idx])
+	}
+	m.mu.Unlock()
+
+	for _, param := range params {
+		callback(param)
 	}
 }
 
@@ -82,6 +99,21 @@ func (m *Model) Encode(input []int) ([]mat.Tensor, error) {
 	return encoded, nil
 }
 
+// EncodeTokens returns the embedding values associated with the input
+// tokens, according to the Vocabulary. It returns ErrNoVocabulary if the
+// model has no vocabulary, or an error wrapping ErrUnknownToken if one of
+// the tokens is out of vocabulary and there is no unknown token.
+func (m *Model) EncodeTokens(tokens []string) ([]mat.Tensor, error) {
+	if m.Vocabulary == nil {
+		return nil, ErrNoVocabulary
+	}
+	indices, err := m.Vocabulary.Encode(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return m.Encode(indices)
+}
+
 // MustEncode returns the embedding values associated with the input indices.
 func (m *Model) MustEncode(input []int) []mat.Tensor {
 	encoded, err := m.Encode(input)
@@ -100,3 +100,26 @@ func TestModel_TraverseParams(t *testing.T) {
 		require.Len(t, embeddingsWithGrad, 0)
 	})
 }
+
+func TestModel_TraverseParams_ZeroedParams(t *testing.T) {
+	type T = float32
+
+	m := embedding.New[T](3, 2)
+	for _, idx := range []int{0, 2} {
+		e, _ := m.Embedding(idx)
+		e.AccGrad(mat.NewDense[T](mat.WithBacking([]T{1, 2})))
+	}
+	require.Equal(t, 2, m.CountEmbedWithGrad())
+
+	// The optimizers zero the gradients of the parameters, not of the
+	// embeddings.
+	m.Weights[0].ZeroGrad()
+
+	var params []*nn.Param
+	nn.ForEachParam(m, func(p *nn.Param) {
+		params = append(params, p)
+	})
+	require.Len(t, params, 1)
+	assert.Same(t, m.Weights[2], params[0])
+	assert.Equal(t, 1, m.CountEmbedWithGrad())
+}
@@ -0,0 +1,265 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embedding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+)
+
+// LoadConfig provides the settings for loading pretrained vectors into a
+// Model.
+type LoadConfig struct {
+	// SpecialTokens are the tokens at the beginning of the vocabulary, e.g.
+	// padding, unknown or beginning of sequence. Their vectors are the ones
+	// of the file, if found, or zeros otherwise.
+	SpecialTokens []string
+	// UnknownToken is the token replacing the out-of-vocabulary tokens of
+	// EncodeTokens. It must be one of the special tokens or of the file.
+	// Empty means that the out-of-vocabulary tokens are an error.
+	UnknownToken string
+	// MaxTokens is the maximum number of vectors read from the file, which
+	// usually sorts the tokens by decreasing frequency. Zero means all.
+	MaxTokens int
+	// Freeze freezes the rows of the vectors read from the file, so that
+	// they are not trained. The special tokens not found in the file can
+	// still be trained.
+	Freeze bool
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c LoadConfig) Validate() error {
+	if c.MaxTokens < 0 {
+		return fmt.Errorf("embedding: the maximum number of tokens must not be negative; found %d", c.MaxTokens)
+	}
+	seen := make(map[string]bool, len(c.SpecialTokens))
+	for _, token := range c.SpecialTokens {
+		if token == "" || seen[token] {
+			return fmt.Errorf("embedding: invalid or duplicate special token %q", token)
+		}
+		seen[token] = true
+	}
+	return nil
+}
+
+// LoadWord2VecText returns a new Model with the vectors of the word2vec text
+// format: a header with the number of vectors and their size, followed by a
+// line for each token and the values of its vector, separated by spaces.
+func LoadWord2VecText[T float.DType](r io.Reader, config LoadConfig) (*Model, error) {
+	return loadText[T](r, config, true)
+}
+
+// LoadFastText returns a new Model with the vectors of a fastText .vec file,
+// which has the word2vec text format (see LoadWord2VecText).
+func LoadFastText[T float.DType](r io.Reader, config LoadConfig) (*Model, error) {
+	return loadText[T](r, config, true)
+}
+
+// LoadGloVe returns a new Model with the vectors of the GloVe text format:
+// a line for each token and the values of its vector, separated by spaces,
+// without a header. The size of the vectors is the one of the first line,
+// and the following tokens may contain spaces.
+func LoadGloVe[T float.DType](r io.Reader, config LoadConfig) (*Model, error) {
+	return loadText[T](r, config, false)
+}
+
+// LoadWord2VecBinary returns a new Model with the vectors of the word2vec
+// binary format: a text header with the number of vectors and their size,
+// followed by each token, a space, and the values of its vector as
+// little-endian float32, optionally followed by a newline.
+func LoadWord2VecBinary[T float.DType](r io.Reader, config LoadConfig) (*Model, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("embedding: reading the word2vec header: %w", err)
+	}
+	count, dim, ok := parseHeader(strings.Fields(header))
+	if !ok {
+		return nil, fmt.Errorf("embedding: invalid word2vec header %q", strings.TrimSpace(header))
+	}
+
+	b := newModelBuilder[T](config, dim)
+	buf := make([]byte, 4*dim)
+	values := make([]T, dim)
+	for i := 0; i < count && !b.full(); i++ {
+		token, err := br.ReadString(' ')
+		if err != nil {
+			return nil, fmt.Errorf("embedding: reading the token of vector %d: %w", i, unexpectedEOF(err))
+		}
+		token = strings.TrimLeft(strings.TrimSuffix(token, " "), "\n")
+		if _, err := io.ReadFull(br, buf); err != nil {
+			return nil, fmt.Errorf("embedding: reading the vector of %q: %w", token, unexpectedEOF(err))
+		}
+		for j := range values {
+			values[j] = T(math.Float32frombits(binary.LittleEndian.Uint32(buf[j*4:])))
+		}
+		b.add(token, values)
+	}
+	return b.build()
+}
+
+// loadText reads the vectors of the text formats, with or without header.
+func loadText[T float.DType](r io.Reader, config LoadConfig, header bool) (*Model, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(r)
+	count, dim := -1, 0
+	var b *modelBuilder[T]
+	var values []T
+	bitSize := float.Interface(T(0)).BitSize()
+
+	for line := 1; b == nil || (!b.full() && (count < 0 || b.read < count)); line++ {
+		text, err := br.ReadString('\n')
+		if err == io.EOF && text == "" {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if header && count < 0 {
+			var ok bool
+			if count, dim, ok = parseHeader(fields); !ok {
+				return nil, fmt.Errorf("embedding: invalid header %q", strings.TrimSpace(text))
+			}
+			continue
+		}
+		if b == nil {
+			if !header {
+				dim = len(fields) - 1
+			}
+			if dim <= 0 {
+				return nil, fmt.Errorf("embedding: line %d: no vector values", line)
+			}
+			b = newModelBuilder[T](config, dim)
+			values = make([]T, dim)
+		}
+		if len(fields) <= dim {
+			return nil, fmt.Errorf("embedding: line %d: expected %d values, found %d", line, dim, len(fields)-1)
+		}
+		split := len(fields) - dim
+		token := strings.Join(fields[:split], " ")
+		for j, field := range fields[split:] {
+			v, err := strconv.ParseFloat(field, bitSize)
+			if err != nil {
+				return nil, fmt.Errorf("embedding: line %d: %w", line, err)
+			}
+			values[j] = T(v)
+		}
+		b.add(token, values)
+	}
+
+	if b == nil {
+		if !header || count < 0 {
+			return nil, errors.New("embedding: no vectors found")
+		}
+		b = newModelBuilder[T](config, dim)
+	}
+	if count >= 0 && b.read < count && !b.full() {
+		return nil, fmt.Errorf("embedding: expected %d vectors, found %d", count, b.read)
+	}
+	return b.build()
+}
+
+// parseHeader parses the number of vectors and their size.
+func parseHeader(fields []string) (count, dim int, ok bool) {
+	if len(fields) != 2 {
+		return 0, 0, false
+	}
+	count, err1 := strconv.Atoi(fields[0])
+	dim, err2 := strconv.Atoi(fields[1])
+	if err1 != nil || err2 != nil || count < 0 || dim <= 0 {
+		return 0, 0, false
+	}
+	return count, dim, true
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// modelBuilder collects the vectors read from a file, and builds the Model
+// and its Vocabulary.
+type modelBuilder[T float.DType] struct {
+	config     LoadConfig
+	dim        int
+	vocabulary *Vocabulary
+	data       []T
+	pretrained []bool // whether the vector of each row was read
+	read       int    // the number of vectors read
+	loaded     int    // the number of vectors of the file in the vocabulary
+}
+
+func newModelBuilder[T float.DType](config LoadConfig, dim int) *modelBuilder[T] {
+	b := &modelBuilder[T]{
+		config:     config,
+		dim:        dim,
+		vocabulary: &Vocabulary{index: make(map[string]int), unknown: -1},
+	}
+	for _, token := range config.SpecialTokens {
+		b.vocabulary.add(token)
+	}
+	b.data = make([]T, len(config.SpecialTokens)*dim)
+	b.pretrained = make([]bool, len(config.SpecialTokens))
+	return b
+}
+
+// full reports whether the maximum number of tokens has been loaded.
+func (b *modelBuilder[T]) full() bool {
+	return b.config.MaxTokens > 0 && b.loaded >= b.config.MaxTokens
+}
+
+// add adds the vector of a token. The repeated tokens are ignored, keeping
+// the first vector, except for the special tokens not read yet.
+func (b *modelBuilder[T]) add(token string, values []T) {
+	b.read++
+	idx, ok := b.vocabulary.Index(token)
+	switch {
+	case !ok:
+		idx = b.vocabulary.add(token)
+		b.data = append(b.data, values...)
+		b.pretrained = append(b.pretrained, true)
+	case !b.pretrained[idx]:
+		copy(b.data[idx*b.dim:(idx+1)*b.dim], values)
+		b.pretrained[idx] = true
+	default:
+		return
+	}
+	b.loaded++
+}
+
+func (b *modelBuilder[T]) build() (*Model, error) {
+	if err := b.vocabulary.setUnknown(b.config.UnknownToken); err != nil {
+		return nil, err
+	}
+	m := New[T](b.vocabulary.Len(), b.dim)
+	m.Vocabulary = b.vocabulary
+	for i, w := range m.Weights {
+		copy(mat.Data[T](w.Value()), b.data[i*b.dim:(i+1)*b.dim])
+		if b.config.Freeze && b.pretrained[i] {
+			w.WithGrad(false)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embedding_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/embedding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testVectors are the vectors of the test files, in order.
+var testVectors = []struct {
+	token  string
+	values []float32
+}{
+	{"the", []float32{0.5, -1, 2}},
+	{"cat", []float32{1.25, 0, -0.5}},
+	{"<unk>", []float32{0.1, 0.2, 0.3}},
+	{"sat", []float32{-2, 3.5, 1}},
+}
+
+func newTestText(header bool) string {
+	var sb strings.Builder
+	if header {
+		sb.WriteString("4 3\n")
+	}
+	for _, v := range testVectors {
+		sb.WriteString(v.token)
+		for _, x := range v.values {
+			sb.WriteString(" ")
+			sb.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+func newTestBinary() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("4 3\n")
+	for _, v := range testVectors {
+		buf.WriteString(v.token + " ")
+		for _, x := range v.values {
+			_ = binary.Write(&buf, binary.LittleEndian, math.Float32bits(x))
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes()
+}
+
+func TestLoadPretrained(t *testing.T) {
+	t.Run("float32", testLoadPretrained[float32])
+	t.Run("float64", testLoadPretrained[float64])
+}
+
+func testLoadPretrained[T float.DType](t *testing.T) {
+	loaders := map[string]func(config embedding.LoadConfig) (*embedding.Model, error){
+		"word2vec text": func(c embedding.LoadConfig) (*embedding.Model, error) {
+			return embedding.LoadWord2VecText[T](strings.NewReader(newTestText(true)), c)
+		},
+		"word2vec binary": func(c embedding.LoadConfig) (*embedding.Model, error) {
+			return embedding.LoadWord2VecBinary[T](bytes.NewReader(newTestBinary()), c)
+		},
+		"fastText": func(c embedding.LoadConfig) (*embedding.Model, error) {
+			return embedding.LoadFastText[T](strings.NewReader(newTestText(true)), c)
+		},
+		"GloVe": func(c embedding.LoadConfig) (*embedding.Model, error) {
+			return embedding.LoadGloVe[T](strings.NewReader(newTestText(false)), c)
+		},
+	}
+
+	for name, load := range loaders {
+		t.Run(name, func(t *testing.T) {
+			m, err := load(embedding.LoadConfig{
+				SpecialTokens: []string{"<pad>", "<unk>"},
+				UnknownToken:  "<unk>",
+				Freeze:        true,
+			})
+			require.NoError(t, err)
+			assert.Equal(t, 5, m.Size)
+			assert.Equal(t, 3, m.Dim)
+			assert.Equal(t, []string{"<pad>", "<unk>", "the", "cat", "sat"}, m.Vocabulary.Tokens())
+
+			// The special tokens found in the file have its vectors.
+			assert.Equal(t, []T{0, 0, 0}, mat.Data[T](m.Weights[0].Value()))
+			assert.InDeltaSlice(t, []T{0.1, 0.2, 0.3}, mat.Data[T](m.Weights[1].Value()), 1.0e-6)
+			assert.Equal(t, []T{-2, 3.5, 1}, mat.Data[T](m.Weights[4].Value()))
+
+			// Only the pretrained rows are frozen.
+			assert.True(t, m.Weights[0].RequiresGrad())
+			for _, w := range m.Weights[1:] {
+				assert.False(t, w.RequiresGrad())
+			}
+
+			xs, err := m.EncodeTokens([]string{"the", "dog", "sat"})
+			require.NoError(t, err)
+			require.Len(t, xs, 3)
+			assert.Equal(t, []T{0.5, -1, 2}, mat.Data[T](xs[0].Value()))
+			assert.InDeltaSlice(t, []T{0.1, 0.2, 0.3}, mat.Data[T](xs[1].Value()), 1.0e-6)
+			assert.Equal(t, []T{-2, 3.5, 1}, mat.Data[T](xs[2].Value()))
+
+			// Without unknown token, the out-of-vocabulary tokens are an
+			// error; with a maximum number of tokens, the last ones are not
+			// loaded.
+			m, err = load(embedding.LoadConfig{MaxTokens: 2})
+			require.NoError(t, err)
+			assert.Equal(t, []string{"the", "cat"}, m.Vocabulary.Tokens())
+			assert.True(t, m.Weights[0].RequiresGrad())
+			_, err = m.EncodeTokens([]string{"the", "sat"})
+			assert.ErrorIs(t, err, embedding.ErrUnknownToken)
+
+			_, err = load(embedding.LoadConfig{UnknownToken: "[UNK]"})
+			assert.Error(t, err, "missing unknown token")
+			_, err = load(embedding.LoadConfig{SpecialTokens: []string{"<pad>", "<pad>"}})
+			assert.Error(t, err, "duplicate special token")
+		})
+	}
+}
+
+func TestLoadGloVe_TokensWithSpaces(t *testing.T) {
+	// The size of the vectors is the one of the first line.
+	m, err := embedding.LoadGloVe[float64](strings.NewReader("the 0 1\nnew york 1 2\n. . . 3 4\n"), embedding.LoadConfig{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, m.Dim)
+	assert.Equal(t, []string{"the", "new york", ". . ."}, m.Vocabulary.Tokens())
+}
+
+func TestLoadPretrained_Errors(t *testing.T) {
+	invalid := map[string]string{
+		"header":         "4\nthe 1 2 3\n",
+		"missing values": "2 3\nthe 1 2 3\ncat 1 2\n",
+		"invalid value":  "1 3\nthe 1 x 3\n",
+		"truncated":      "3 3\nthe 1 2 3\ncat 1 2 3\n",
+	}
+	for name, text := range invalid {
+		_, err := embedding.LoadWord2VecText[float32](strings.NewReader(text), embedding.LoadConfig{})
+		assert.Error(t, err, name)
+	}
+	_, err := embedding.LoadGloVe[float32](strings.NewReader(""), embedding.LoadConfig{})
+	assert.Error(t, err, "empty")
+
+	data := newTestBinary()
+	_, err = embedding.LoadWord2VecBinary[float32](bytes.NewReader(data[:len(data)-5]), embedding.LoadConfig{})
+	assert.Error(t, err, "truncated")
+}
+
+func TestModel_EncodeTokens(t *testing.T) {
+	m := embedding.New[float32](2, 3)
+	_, err := m.EncodeTokens([]string{"the"})
+	assert.ErrorIs(t, err, embedding.ErrNoVocabulary)
+
+	m, err = embedding.LoadWord2VecText[float32](strings.NewReader(newTestText(true)), embedding.LoadConfig{UnknownToken: "<unk>"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, nn.Dump(m, &buf))
+	loaded, err := nn.Load[*embedding.Model](&buf)
+	require.NoError(t, err)
+	xs, err := loaded.EncodeTokens([]string{"cat", "dog"})
+	require.NoError(t, err)
+	assert.Equal(t, []float32{1.25, 0, -0.5}, mat.Data[float32](xs[0].Value()))
+	assert.Equal(t, []float32{0.1, 0.2, 0.3}, mat.Data[float32](xs[1].Value()))
+}
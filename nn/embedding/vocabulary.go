@@ -0,0 +1,159 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embedding
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+)
+
+// ErrUnknownToken is returned when a token is not in the vocabulary, and
+// there is no unknown token to replace it.
+var ErrUnknownToken = errors.New("embedding: unknown token")
+
+// ErrNoVocabulary is returned when the tokens are encoded by a Model without
+// a Vocabulary.
+var ErrNoVocabulary = errors.New("embedding: the model has no vocabulary")
+
+// Vocabulary maps the tokens to the indices of the rows of a Model.
+// The out-of-vocabulary tokens are mapped to the index of the unknown token,
+// if any.
+type Vocabulary struct {
+	tokens  []string
+	index   map[string]int
+	unknown int // -1 if none
+}
+
+// NewVocabulary returns a new Vocabulary of the given tokens, whose indices
+// are their positions. The unknown token, if not empty, must be one of the
+// tokens. It returns an error if a token is repeated or the unknown token is
+// missing.
+func NewVocabulary(tokens []string, unknownToken string) (*Vocabulary, error) {
+	v := &Vocabulary{
+		tokens:  make([]string, 0, len(tokens)),
+		index:   make(map[string]int, len(tokens)),
+		unknown: -1,
+	}
+	for _, token := range tokens {
+		if _, ok := v.Index(token); ok {
+			return nil, fmt.Errorf("embedding: duplicate token %q in the vocabulary", token)
+		}
+		v.add(token)
+	}
+	if err := v.setUnknown(unknownToken); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// add appends a new token to the vocabulary, returning its index.
+func (v *Vocabulary) add(token string) int {
+	v.index[token] = len(v.tokens)
+	v.tokens = append(v.tokens, token)
+	return len(v.tokens) - 1
+}
+
+func (v *Vocabulary) setUnknown(token string) error {
+	if token == "" {
+		v.unknown = -1
+		return nil
+	}
+	idx, ok := v.Index(token)
+	if !ok {
+		return fmt.Errorf("embedding: the unknown token %q is not in the vocabulary", token)
+	}
+	v.unknown = idx
+	return nil
+}
+
+// Len returns the number of tokens.
+func (v *Vocabulary) Len() int {
+	return len(v.tokens)
+}
+
+// Tokens returns the tokens, in order of index. The returned slice must not
+// be modified.
+func (v *Vocabulary) Tokens() []string {
+	return v.tokens
+}
+
+// Token returns the token of the given index, and whether the index is in
+// range.
+func (v *Vocabulary) Token(idx int) (string, bool) {
+	if idx < 0 || idx >= len(v.tokens) {
+		return "", false
+	}
+	return v.tokens[idx], true
+}
+
+// Index returns the index of the given token, and whether it is in the
+// vocabulary, without falling back to the unknown token.
+func (v *Vocabulary) Index(token string) (int, bool) {
+	idx, ok := v.index[token]
+	return idx, ok
+}
+
+// Unknown returns the index of the unknown token, and whether there is one.
+func (v *Vocabulary) Unknown() (int, bool) {
+	return v.unknown, v.unknown >= 0
+}
+
+// Encode returns the indices of the given tokens, mapping the
+// out-of-vocabulary ones to the unknown token. It returns an error wrapping
+// ErrUnknownToken if a token is out of vocabulary and there is no unknown
+// token.
+func (v *Vocabulary) Encode(tokens []string) ([]int, error) {
+	indices := make([]int, len(tokens))
+	for i, token := range tokens {
+		idx, ok := v.index[token]
+		if !ok {
+			if v.unknown < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownToken, token)
+			}
+			idx = v.unknown
+		}
+		indices[i] = idx
+	}
+	return indices, nil
+}
+
+// vocabularyData is the serializable representation of a Vocabulary.
+type vocabularyData struct {
+	Tokens  []string
+	Unknown int
+}
+
+// MarshalBinary marshals the vocabulary into binary form.
+func (v *Vocabulary) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+	data := vocabularyData{Tokens: v.tokens, Unknown: v.unknown}
+	if err := gob.NewEncoder(&buf).Encode(data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary unmarshals a binary representation of a vocabulary,
+// rebuilding the index of the tokens.
+func (v *Vocabulary) UnmarshalBinary(b []byte) error {
+	var data vocabularyData
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&data); err != nil {
+		return err
+	}
+	if data.Unknown < -1 || data.Unknown >= len(data.Tokens) {
+		return fmt.Errorf("embedding: unknown token index %d out of a vocabulary of %d tokens", data.Unknown, len(data.Tokens))
+	}
+	*v = Vocabulary{
+		tokens:  make([]string, 0, len(data.Tokens)),
+		index:   make(map[string]int, len(data.Tokens)),
+		unknown: data.Unknown,
+	}
+	for _, token := range data.Tokens {
+		v.add(token)
+	}
+	return nil
+}
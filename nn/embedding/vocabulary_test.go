@@ -0,0 +1,65 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package embedding_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/embedding"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVocabulary(t *testing.T) {
+	v, err := embedding.NewVocabulary([]string{"<unk>", "the", "cat"}, "<unk>")
+	require.NoError(t, err)
+	assert.Equal(t, 3, v.Len())
+	assert.Equal(t, []string{"<unk>", "the", "cat"}, v.Tokens())
+
+	idx, ok := v.Index("cat")
+	assert.True(t, ok)
+	assert.Equal(t, 2, idx)
+	_, ok = v.Index("dog")
+	assert.False(t, ok)
+
+	token, ok := v.Token(1)
+	assert.True(t, ok)
+	assert.Equal(t, "the", token)
+	_, ok = v.Token(3)
+	assert.False(t, ok)
+
+	unknown, ok := v.Unknown()
+	assert.True(t, ok)
+	assert.Equal(t, 0, unknown)
+
+	indices, err := v.Encode([]string{"the", "dog", "cat"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 0, 2}, indices)
+
+	var buf bytes.Buffer
+	require.NoError(t, nn.Dump(v, &buf))
+	loaded, err := nn.Load[*embedding.Vocabulary](&buf)
+	require.NoError(t, err)
+	assert.Equal(t, v.Tokens(), loaded.Tokens())
+	indices, err = loaded.Encode([]string{"cat", "dog"})
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 0}, indices)
+}
+
+func TestVocabulary_Errors(t *testing.T) {
+	v, err := embedding.NewVocabulary([]string{"the", "cat"}, "")
+	require.NoError(t, err)
+	_, ok := v.Unknown()
+	assert.False(t, ok)
+	_, err = v.Encode([]string{"the", "dog"})
+	assert.ErrorIs(t, err, embedding.ErrUnknownToken)
+
+	_, err = embedding.NewVocabulary([]string{"the", "cat", "the"}, "")
+	assert.Error(t, err, "duplicate token")
+	_, err = embedding.NewVocabulary([]string{"the", "cat"}, "<unk>")
+	assert.Error(t, err, "missing unknown token")
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nn
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+)
+
+// ForwardPreHook is called with the input of a model before its forward
+// step. It can return a new input to be used in place of the given one;
+// if it returns nil, the input is left unchanged.
+type ForwardPreHook func(m StandardModel, xs []mat.Tensor) []mat.Tensor
+
+// ForwardHook is called with the input and the output of a model after its
+// forward step. It can return a new output to be used in place of the
+// given one; if it returns nil, the output is left unchanged.
+type ForwardHook func(m StandardModel, xs, ys []mat.Tensor) []mat.Tensor
+
+// Hooks allows the registration of forward hooks on a model.
+// The hooks are called when the model is run through Forward.
+type Hooks struct {
+	model StandardModel
+}
+
+// modelHooks holds the forward hooks registered on a model.
+type modelHooks struct {
+	pre  ag.HookList[ForwardPreHook]
+	post ag.HookList[ForwardHook]
+}
+
+var (
+	// hooksMu guards hooksRegistry and the hooks it holds.
+	hooksMu sync.RWMutex
+	// hooksRegistry holds the hooks of each model, keyed by the model pointer.
+	// A model is removed once all its hooks are removed.
+	hooksRegistry = map[StandardModel]*modelHooks{}
+)
+
+// Forward runs the forward step of m, calling the forward pre-hooks and the
+// forward hooks registered on m, if any, before and after it.
+func Forward(m StandardModel, xs ...mat.Tensor) []mat.Tensor {
+	preHooks, hooks := forwardHooksOf(m)
+	for _, hook := range preHooks {
+		if r := hook(m, xs); r != nil {
+			xs = r
+		}
+	}
+	ys := m.Forward(xs...)
+	for _, hook := range hooks {
+		if r := hook(m, xs, ys); r != nil {
+			ys = r
+		}
+	}
+	return ys
+}
+
+// forwardHooksOf returns the forward pre-hooks and the forward hooks
+// registered on m.
+func forwardHooksOf(m StandardModel) ([]ForwardPreHook, []ForwardHook) {
+	if reflect.TypeOf(m).Kind() != reflect.Ptr {
+		return nil, nil
+	}
+	hooksMu.RLock()
+	defer hooksMu.RUnlock()
+	h, ok := hooksRegistry[m]
+	if !ok {
+		return nil, nil
+	}
+	return h.pre.List(), h.post.List()
+}
+
+// RegisterForwardPreHook registers a hook to be called before the forward
+// step of the model.
+func (h *Hooks) RegisterForwardPreHook(hook ForwardPreHook) *ag.HookHandle {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	mh := h.modelHooks()
+	return h.releaseOnRemove(mh.pre.Add(&hooksMu, hook))
+}
+
+// RegisterForwardHook registers a hook to be called after the forward step
+// of the model.
+func (h *Hooks) RegisterForwardHook(hook ForwardHook) *ag.HookHandle {
+	hooksMu.Lock()
+	defer hooksMu.Unlock()
+	mh := h.modelHooks()
+	return h.releaseOnRemove(mh.post.Add(&hooksMu, hook))
+}
+
+// modelHooks returns the hooks of the model, adding them to the registry if
+// needed. The caller must hold hooksMu.
+func (h *Hooks) modelHooks() *modelHooks {
+	mh, ok := hooksRegistry[h.model]
+	if !ok {
+		mh = new(modelHooks)
+		hooksRegistry[h.model] = mh
+	}
+	return mh
+}
+
+// releaseOnRemove returns a handle which removes the hook, and the model from
+// the registry if it has no more hooks.
+func (h *Hooks) releaseOnRemove(handle *ag.HookHandle) *ag.HookHandle {
+	return ag.NewHookHandle(func() {
+		handle.Remove()
+		hooksMu.Lock()
+		defer hooksMu.Unlock()
+		if mh, ok := hooksRegistry[h.model]; ok && mh.pre.Len() == 0 && mh.post.Len() == 0 {
+			delete(hooksRegistry, h.model)
+		}
+	})
+}
+
+// ForEachNamedModel calls fn for each sub-model of m, explored recursively,
+// together with its name.
+//
+// The name is a dot-separated path built from the names of the struct fields,
+// the indices of slices and arrays, and the keys of maps (e.g. "Layers.2.FFN").
+// Any name can be passed to Hook to attach hooks to the sub-model.
+func ForEachNamedModel(m Model, fn func(name string, model Model)) {
+	forEachNamedField(m, "", fn)
+}
+
+// forEachNamedField visits the fields of the struct, or pointer to struct, i,
+// whose names are prefixed by prefix.
+func forEachNamedField(i any, prefix string, fn func(name string, model Model)) {
+	v := reflect.ValueOf(i)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+	forEachField(i, func(field any, name string) {
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+		walkNamedModels(field, name, fn)
+	})
+}
+
+// walkNamedModels calls fn for item, if it is a model, and for the models it
+// holds, explored recursively.
+func walkNamedModels(item any, name string, fn func(name string, model Model)) {
+	v := reflect.ValueOf(item)
+	if !v.IsValid() || isNilValue(v) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Struct, reflect.Ptr:
+		switch m := item.(type) {
+		case Module, *Module, *Param:
+		case Model:
+			fn(name, m)
+			forEachNamedField(m, name, fn)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if e := v.Index(i); e.CanInterface() {
+				walkNamedModels(e.Interface(), name+"."+strconv.Itoa(i), fn)
+			}
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			if key, ok := mapKeyName(iter.Key()); ok {
+				walkNamedModels(iter.Value().Interface(), name+"."+key, fn)
+			}
+		}
+	}
+}
+
+// Hook returns the Hooks of the sub-model of m identified by name (see
+// ForEachNamedModel), or of m itself if the name is empty.
+//
+// The model must be a StandardModel held by pointer; otherwise an error is
+// returned. The hooks are called when the model is run through Forward, as
+// ModuleList does with its modules, regardless of how it is held by m.
+func Hook(m Model, name string) (*Hooks, error) {
+	target := m
+	if name != "" {
+		target = nil
+		ForEachNamedModel(m, func(n string, sub Model) {
+			if n == name {
+				target = sub
+			}
+		})
+		if target == nil {
+			return nil, fmt.Errorf("nn: cannot hook %q: model not found", name)
+		}
+	}
+	sm, ok := target.(StandardModel)
+	if !ok {
+		return nil, fmt.Errorf("nn: cannot hook %q: %T is not a StandardModel", name, target)
+	}
+	if reflect.TypeOf(sm).Kind() != reflect.Ptr {
+		return nil, fmt.Errorf("nn: cannot hook %q: %T is not a pointer", name, target)
+	}
+	return &Hooks{model: sm}, nil
+}
+
+func isNilValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+func mapKeyName(key reflect.Value) (string, bool) {
+	switch k := key.Interface().(type) {
+	case string:
+		return k, true
+	case int:
+		return strconv.Itoa(k), true
+	default:
+		return "", false
+	}
+}
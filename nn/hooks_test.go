@@ -0,0 +1,132 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nn
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type scaleModel struct {
+	Module
+	Factor float64
+}
+
+func (m *scaleModel) Forward(xs ...mat.Tensor) []mat.Tensor {
+	ys := make([]mat.Tensor, len(xs))
+	for i, x := range xs {
+		ys[i] = x.Value().(mat.Matrix).ProdScalar(m.Factor)
+	}
+	return ys
+}
+
+type hookableModel struct {
+	Module
+	Layers ModuleList[StandardModel]
+	Named  map[string]StandardModel
+	Fixed  *scaleModel
+}
+
+func newHookableModel() *hookableModel {
+	return &hookableModel{
+		Layers: []StandardModel{&scaleModel{Factor: 2}, &scaleModel{Factor: 3}},
+		Named:  map[string]StandardModel{"last": &scaleModel{Factor: 5}},
+		Fixed:  &scaleModel{Factor: 7},
+	}
+}
+
+func TestParam_RegisterGradHook(t *testing.T) {
+	p := NewParam(mat.NewDense[float64](mat.WithBacking([]float64{1, 2})))
+	h := p.RegisterGradHook(func(grad mat.Tensor) mat.Tensor {
+		return grad.(mat.Matrix).ProdScalar(10)
+	})
+
+	p.AccGrad(mat.NewDense[float64](mat.WithBacking([]float64{1, 1})))
+	assert.Equal(t, []float64{10, 10}, mat.Data[float64](p.Grad()))
+
+	h.Remove()
+	p.AccGrad(mat.NewDense[float64](mat.WithBacking([]float64{1, 1})))
+	assert.Equal(t, []float64{11, 11}, mat.Data[float64](p.Grad()))
+}
+
+func TestForEachNamedModel(t *testing.T) {
+	m := newHookableModel()
+	var names []string
+	ForEachNamedModel(m, func(name string, _ Model) {
+		names = append(names, name)
+	})
+	assert.ElementsMatch(t, []string{"Layers.0", "Layers.1", "Named.last", "Fixed"}, names)
+}
+
+func TestHook(t *testing.T) {
+	m := newHookableModel()
+
+	t.Run("slice element", func(t *testing.T) {
+		h, err := Hook(m, "Layers.1")
+		require.NoError(t, err)
+
+		var captured []mat.Tensor
+		pre := h.RegisterForwardPreHook(func(_ StandardModel, xs []mat.Tensor) []mat.Tensor {
+			return []mat.Tensor{xs[0].Value().(mat.Matrix).AddScalar(1)}
+		})
+		post := h.RegisterForwardHook(func(_ StandardModel, _, ys []mat.Tensor) []mat.Tensor {
+			captured = ys
+			return nil
+		})
+
+		x := mat.Scalar(1.0)
+		y := m.Layers.Forward(x)[0]
+		assert.Equal(t, 9.0, y.Item().F64()) // (1*2+1)*3
+		assert.Equal(t, 9.0, captured[0].Item().F64())
+
+		pre.Remove()
+		post.Remove()
+		y = m.Layers.Forward(x)[0]
+		assert.Equal(t, 6.0, y.Item().F64())
+		assert.Empty(t, hooksRegistry)
+	})
+
+	t.Run("pointer field", func(t *testing.T) {
+		h, err := Hook(m, "Fixed")
+		require.NoError(t, err)
+		handle := h.RegisterForwardHook(func(_ StandardModel, _, ys []mat.Tensor) []mat.Tensor {
+			return []mat.Tensor{ys[0].Value().(mat.Matrix).ProdScalar(-1)}
+		})
+		defer handle.Remove()
+
+		x := mat.Scalar(1.0)
+		assert.Equal(t, -7.0, Forward(m.Fixed, x)[0].Item().F64())
+		assert.Equal(t, 7.0, m.Fixed.Forward(x)[0].Item().F64())
+	})
+
+	t.Run("map value", func(t *testing.T) {
+		h, err := Hook(m, "Named.last")
+		require.NoError(t, err)
+		handle := h.RegisterForwardPreHook(func(_ StandardModel, xs []mat.Tensor) []mat.Tensor {
+			return []mat.Tensor{xs[0].Value().(mat.Matrix).AddScalar(1)}
+		})
+		defer handle.Remove()
+
+		assert.Equal(t, 10.0, Forward(m.Named["last"], mat.Scalar(1.0))[0].Item().F64())
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		_, err := Hook(m, "")
+		assert.Error(t, err, "not a StandardModel")
+		_, err = Hook(m, "Layers.5")
+		assert.Error(t, err)
+		_, err = Hook(m, "Missing")
+		assert.Error(t, err)
+	})
+
+	t.Run("traversal", func(t *testing.T) {
+		var count int
+		Apply(m, func(Model) { count++ })
+		assert.Equal(t, 5, count) // root, 2 layers, map value, fixed
+	})
+}
@@ -108,10 +108,10 @@ type StandardModel interface {
 type ModuleList[T StandardModel] []T
 
 // Forward operates on a slice of StandardModel connecting outputs to inputs sequentially for each module following,
-// finally returning its output.
+// finally returning its output. The modules are run through Forward, calling their forward hooks, if any.
 func (ml ModuleList[T]) Forward(xs ...mat.Tensor) []mat.Tensor {
 	for _, m := range ml {
-		xs = m.Forward(xs...)
+		xs = Forward(m, xs...)
 	}
 	return xs
 }
@@ -4,11 +4,20 @@
 
 package nn
 
-import "github.com/nlpodyssey/spago/mat"
+import (
+	"sync"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+)
 
 type Param struct {
 	mat.Matrix
 	State interface{} // support structure for the optimization algorithm
+
+	// hooksMu guards gradHooks.
+	hooksMu   sync.RWMutex
+	gradHooks ag.HookList[ag.GradHook]
 }
 
 // NewParam returns a new param.
@@ -34,3 +43,27 @@ func (p *Param) ReplaceValue(value mat.Matrix) {
 	p.Matrix = value
 	p.State = nil
 }
+
+// AccGrad accumulates the gradients into the param, after passing them
+// through the registered grad hooks, if any.
+func (p *Param) AccGrad(grad mat.Tensor) {
+	p.hooksMu.RLock()
+	var hooks []ag.GradHook
+	if p.gradHooks.Len() > 0 {
+		hooks = p.gradHooks.List()
+	}
+	p.hooksMu.RUnlock()
+	if hooks != nil {
+		grad = ag.ApplyGradHooks(grad, hooks)
+	}
+	p.Matrix.AccGrad(grad)
+}
+
+// RegisterGradHook registers a hook to be called on every gradient
+// accumulated into the param (see AccGrad).
+// Hooks are called in order of registration.
+func (p *Param) RegisterGradHook(hook ag.GradHook) *ag.HookHandle {
+	p.hooksMu.Lock()
+	defer p.hooksMu.Unlock()
+	return p.gradHooks.Add(&p.hooksMu, hook)
+}
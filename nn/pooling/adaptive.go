@@ -0,0 +1,125 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn"
+)
+
+var (
+	_ nn.Model = &AdaptiveAvgPooling{}
+	_ nn.Model = &AdaptiveMaxPooling{}
+	_ nn.Model = &GlobalAvgPooling{}
+	_ nn.Model = &GlobalMaxPooling{}
+)
+
+// AdaptiveAvgPooling is a parameter-free model pooling each input channel
+// to a matrix of Rows×Columns averages, whatever the size of the input.
+type AdaptiveAvgPooling struct {
+	nn.Module
+	Rows    int
+	Columns int
+}
+
+// AdaptiveMaxPooling is a parameter-free model pooling each input channel
+// to a matrix of Rows×Columns maxima, whatever the size of the input.
+type AdaptiveMaxPooling struct {
+	nn.Module
+	Rows    int
+	Columns int
+}
+
+// GlobalAvgPooling is a parameter-free model reducing each input channel
+// to the average of its values, as a 1×1 matrix.
+type GlobalAvgPooling struct {
+	nn.Module
+}
+
+// GlobalMaxPooling is a parameter-free model reducing each input channel
+// to the maximum of its values, as a 1×1 matrix.
+type GlobalMaxPooling struct {
+	nn.Module
+}
+
+func init() {
+	gob.Register(&AdaptiveAvgPooling{})
+	gob.Register(&AdaptiveMaxPooling{})
+	gob.Register(&GlobalAvgPooling{})
+	gob.Register(&GlobalMaxPooling{})
+}
+
+// NewAdaptiveAvg returns a new model. It returns an error if the output
+// size is not positive.
+func NewAdaptiveAvg(rows, columns int) (*AdaptiveAvgPooling, error) {
+	if err := validateOutputSize(rows, columns); err != nil {
+		return nil, err
+	}
+	return &AdaptiveAvgPooling{
+		Rows:    rows,
+		Columns: columns,
+	}, nil
+}
+
+// NewAdaptiveMax returns a new model. It returns an error if the output
+// size is not positive.
+func NewAdaptiveMax(rows, columns int) (*AdaptiveMaxPooling, error) {
+	if err := validateOutputSize(rows, columns); err != nil {
+		return nil, err
+	}
+	return &AdaptiveMaxPooling{
+		Rows:    rows,
+		Columns: columns,
+	}, nil
+}
+
+// NewGlobalAvg returns a new model.
+func NewGlobalAvg() *GlobalAvgPooling {
+	return &GlobalAvgPooling{}
+}
+
+// NewGlobalMax returns a new model.
+func NewGlobalMax() *GlobalMaxPooling {
+	return &GlobalMaxPooling{}
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *AdaptiveAvgPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	pooled := func(x mat.Tensor) mat.Tensor {
+		return ag.AdaptiveAvgPooling(x, m.Rows, m.Columns)
+	}
+	return ag.Map(pooled, xs)
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *AdaptiveMaxPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	pooled := func(x mat.Tensor) mat.Tensor {
+		return ag.AdaptiveMaxPooling(x, m.Rows, m.Columns)
+	}
+	return ag.Map(pooled, xs)
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *GlobalAvgPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return ag.Map(ag.GlobalAvgPooling, xs)
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *GlobalMaxPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return ag.Map(ag.GlobalMaxPooling, xs)
+}
+
+// validateOutputSize returns an error if the output size of an adaptive
+// pooling is not positive.
+func validateOutputSize(rows, columns int) error {
+	if rows <= 0 || columns <= 0 {
+		return fmt.Errorf("pooling: the output size must be positive; found %dx%d", rows, columns)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+)
+
+var _ nn.StandardModel = &AttentionPooling{}
+
+// AttentionPooling is a model reducing a sequence of vectors to their
+// average weighted by the softmax of their scaled dot products with a
+// learned query.
+//
+// With more than one head, the vectors are split into as many equal parts,
+// each one pooled with its own query, and the results are concatenated.
+type AttentionPooling struct {
+	nn.Module
+	// Queries are the learned queries, one for each head.
+	Queries     []*nn.Param
+	ScaleFactor *nn.Buffer
+}
+
+func init() {
+	gob.Register(&AttentionPooling{})
+}
+
+// NewAttention returns a new model pooling vectors of the given size with
+// the given number of heads, which must divide the size. The queries are
+// initialized to zeros, so that the pooling starts as an average.
+func NewAttention[T float.DType](size, heads int) (*AttentionPooling, error) {
+	if size <= 0 || heads <= 0 || size%heads != 0 {
+		return nil, fmt.Errorf("pooling: the number of heads (%d) must divide the size (%d)", heads, size)
+	}
+	headSize := size / heads
+	queries := make([]*nn.Param, heads)
+	for i := range queries {
+		queries[i] = nn.NewParam(mat.NewDense[T](mat.WithShape(headSize)))
+	}
+	return &AttentionPooling{
+		Queries:     queries,
+		ScaleFactor: nn.Buf(mat.Scalar(T(1.0 / math.Sqrt(float64(headSize))))),
+	}, nil
+}
+
+// Forward returns the attention pooling of the whole input sequence.
+func (m *AttentionPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	y, _ := m.ForwardMasked(nil, xs...)
+	return []mat.Tensor{y}
+}
+
+// ForwardMasked returns the attention pooling of the elements of the input
+// sequence for which the mask is true, and the attention weights of each
+// head. A nil mask keeps all the elements. It panics if the mask has not the
+// length of the sequence, or no element is kept.
+func (m *AttentionPooling) ForwardMasked(mask []bool, xs ...mat.Tensor) (mat.Tensor, []mat.Tensor) {
+	checkSequence(xs)
+	var maskScores mat.Tensor
+	if mask != nil {
+		checkMask(mask, len(xs))
+		maskScores = xs[0].Value().(mat.Matrix).NewMatrix(mat.WithShape(len(xs)), mat.WithBacking(makeMaskScores(mask)))
+	}
+
+	x := ag.Stack(xs...)
+	heads := len(m.Queries)
+	headSize := xs[0].Value().Size() / heads
+	pooled := make([]mat.Tensor, heads)
+	weights := make([]mat.Tensor, heads)
+	for h, q := range m.Queries {
+		xh := x
+		if heads > 1 {
+			xh = ag.Slice(x, 0, h*headSize, len(xs), (h+1)*headSize)
+		}
+		scores := ag.ProdScalar(ag.Mul(xh, q), m.ScaleFactor)
+		if maskScores != nil {
+			scores = ag.Add(scores, maskScores)
+		}
+		weights[h] = ag.Softmax(scores)
+		pooled[h] = ag.MulT(xh, weights[h])
+	}
+	if heads == 1 {
+		return pooled[0], weights
+	}
+	return ag.Concat(pooled...), weights
+}
+
+// makeMaskScores returns the scores to add to the ones of the attention,
+// zero for the elements to keep and -inf for the others.
+func makeMaskScores(mask []bool) []float64 {
+	scores := make([]float64, len(mask))
+	for i, keep := range mask {
+		if !keep {
+			scores[i] = math.Inf(-1)
+		}
+	}
+	return scores
+}
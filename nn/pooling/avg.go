@@ -0,0 +1,57 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"encoding/gob"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/gradfn"
+	"github.com/nlpodyssey/spago/nn"
+)
+
+// Config provides the settings of a pooling over sliding windows, with
+// stride and padding.
+type Config = gradfn.PoolingConfig
+
+// DefaultConfig returns the configuration of a pooling over non-overlapping
+// windows of the given size, without padding.
+func DefaultConfig(rows, columns int) Config {
+	return gradfn.DefaultPoolingConfig(rows, columns)
+}
+
+var _ nn.Model = &AvgPooling{}
+
+// AvgPooling is a parameter-free model performing the average pooling of
+// each input channel over sliding windows.
+type AvgPooling struct {
+	nn.Module
+	Config Config
+}
+
+func init() {
+	gob.Register(&AvgPooling{})
+}
+
+// NewAvg returns a new model. It returns an error if the configuration is
+// not valid.
+func NewAvg(config Config) (*AvgPooling, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &AvgPooling{
+		Config: config,
+	}, nil
+}
+
+// Forward performs the forward step for each input node and returns the result.
+// The average pooling is applied independently to each input.
+func (m *AvgPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	pooled := func(x mat.Tensor) mat.Tensor {
+		return ag.AvgPooling(x, m.Config)
+	}
+	return ag.Map(pooled, xs)
+}
@@ -0,0 +1,55 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn"
+)
+
+var _ nn.Model = &LpPooling{}
+
+// LpPooling is a parameter-free model performing the L_p pooling of each
+// input channel over sliding windows, i.e. the p-norm of each window.
+// With p = 1 it is a sum pooling, and it approaches the max pooling of the
+// absolute values as p grows.
+type LpPooling struct {
+	nn.Module
+	P      float64
+	Config Config
+}
+
+func init() {
+	gob.Register(&LpPooling{})
+}
+
+// NewLp returns a new model. It returns an error if the norm degree p is
+// smaller than 1, or the configuration is not valid.
+func NewLp(p float64, config Config) (*LpPooling, error) {
+	if !(p >= 1) || math.IsInf(p, 1) {
+		return nil, fmt.Errorf("pooling: the norm degree must be finite and at least 1; found %g", p)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &LpPooling{
+		P:      p,
+		Config: config,
+	}, nil
+}
+
+// Forward performs the forward step for each input node and returns the result.
+// The L_p pooling is applied independently to each input.
+func (m *LpPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	pooled := func(x mat.Tensor) mat.Tensor {
+		return ag.LpPooling(x, m.P, m.Config)
+	}
+	return ag.Map(pooled, xs)
+}
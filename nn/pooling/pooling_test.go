@@ -0,0 +1,91 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestModels_Forward(t *testing.T) {
+	t.Run("float32", testModelsForward[float32])
+	t.Run("float64", testModelsForward[float64])
+}
+
+func testModelsForward[T float.DType](t *testing.T) {
+	newChannels := func() []mat.Tensor {
+		return []mat.Tensor{
+			mat.NewDense[T](mat.WithShape(2, 4), mat.WithBacking([]T{
+				1, 2, 3, 4,
+				5, 6, 7, 8,
+			}), mat.WithGrad(true)),
+			mat.NewDense[T](mat.WithShape(2, 4), mat.WithBacking([]T{
+				-1, 0, 0, 3,
+				0, 0, 4, 0,
+			}), mat.WithGrad(true)),
+		}
+	}
+
+	avg, err := NewAvg(DefaultConfig(2, 2))
+	require.NoError(t, err)
+	lp, err := NewLp(2, DefaultConfig(2, 2))
+	require.NoError(t, err)
+	adaptiveAvg, err := NewAdaptiveAvg(1, 3)
+	require.NoError(t, err)
+	adaptiveMax, err := NewAdaptiveMax(2, 1)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name     string
+		model    nn.StandardModel
+		shape    []int
+		expected [][]T
+	}{
+		{"avg", avg, []int{1, 2}, [][]T{{3.5, 5.5}, {-0.25, 1.75}}},
+		{"lp", lp, []int{1, 2}, [][]T{{8.124038, 11.74734}, {1, 5}}},
+		{"max", NewMax(2, 2), []int{1, 2}, [][]T{{6, 8}, {0, 4}}},
+		{"adaptive avg", adaptiveAvg, []int{1, 3}, [][]T{{3.5, 4.5, 5.5}, {-0.25, 1, 1.75}}},
+		{"adaptive max", adaptiveMax, []int{2, 1}, [][]T{{4, 8}, {3, 4}}},
+		{"global avg", NewGlobalAvg(), []int{1, 1}, [][]T{{4.5}, {0.75}}},
+		{"global max", NewGlobalMax(), []int{1, 1}, [][]T{{8}, {4}}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			xs := newChannels()
+			ys := tc.model.Forward(xs...)
+			require.Len(t, ys, len(xs))
+			for i, y := range ys {
+				assert.Equal(t, tc.shape, y.Shape())
+				assert.InDeltaSlice(t, tc.expected[i], y.Value().Data(), 1.0e-5)
+				y.AccGrad(y.Value().(mat.Matrix).OnesLike())
+			}
+			require.NoError(t, ag.Backward(ys...))
+			for _, x := range xs {
+				assert.True(t, x.(mat.Matrix).HasGrad(), "each channel receives its gradient")
+			}
+		})
+	}
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := NewAvg(DefaultConfig(0, 2))
+	assert.Error(t, err)
+	c := DefaultConfig(2, 2)
+	c.PaddingRows = [2]int{2, 0}
+	_, err = NewAvg(c)
+	assert.Error(t, err)
+	_, err = NewLp(0.5, DefaultConfig(2, 2))
+	assert.Error(t, err)
+	_, err = NewAdaptiveAvg(0, 2)
+	assert.Error(t, err)
+	_, err = NewAdaptiveMax(2, -1)
+	assert.Error(t, err)
+}
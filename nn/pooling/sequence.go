@@ -0,0 +1,155 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn"
+)
+
+// The sequence pooling models reduce a sequence of vectors, such as the
+// outputs of a recurrent network, to a single vector, returned as the only
+// element of the output. They panic if the sequence is empty.
+
+var (
+	_ nn.StandardModel = &SequenceMeanPooling{}
+	_ nn.StandardModel = &SequenceMaxPooling{}
+	_ nn.StandardModel = &SequenceFirstPooling{}
+	_ nn.StandardModel = &SequenceLastPooling{}
+	_ nn.StandardModel = &MaskedMeanPooling{}
+)
+
+// SequenceMeanPooling is a parameter-free model returning the element-wise
+// average of a sequence of vectors.
+type SequenceMeanPooling struct {
+	nn.Module
+}
+
+// SequenceMaxPooling is a parameter-free model returning the element-wise
+// maximum of a sequence of vectors.
+type SequenceMaxPooling struct {
+	nn.Module
+}
+
+// SequenceFirstPooling is a parameter-free model returning the first vector
+// of a sequence, e.g. the output of a special classification token.
+type SequenceFirstPooling struct {
+	nn.Module
+}
+
+// SequenceLastPooling is a parameter-free model returning the last vector
+// of a sequence, e.g. the last hidden state of a recurrent network.
+type SequenceLastPooling struct {
+	nn.Module
+}
+
+// MaskedMeanPooling is a parameter-free model returning the element-wise
+// average of the vectors of a sequence which are not masked out, e.g. to
+// exclude the padding of a batch of sequences of different lengths.
+type MaskedMeanPooling struct {
+	nn.Module
+}
+
+func init() {
+	gob.Register(&SequenceMeanPooling{})
+	gob.Register(&SequenceMaxPooling{})
+	gob.Register(&SequenceFirstPooling{})
+	gob.Register(&SequenceLastPooling{})
+	gob.Register(&MaskedMeanPooling{})
+}
+
+// NewSequenceMean returns a new model.
+func NewSequenceMean() *SequenceMeanPooling {
+	return &SequenceMeanPooling{}
+}
+
+// NewSequenceMax returns a new model.
+func NewSequenceMax() *SequenceMaxPooling {
+	return &SequenceMaxPooling{}
+}
+
+// NewSequenceFirst returns a new model.
+func NewSequenceFirst() *SequenceFirstPooling {
+	return &SequenceFirstPooling{}
+}
+
+// NewSequenceLast returns a new model.
+func NewSequenceLast() *SequenceLastPooling {
+	return &SequenceLastPooling{}
+}
+
+// NewMaskedMean returns a new model.
+func NewMaskedMean() *MaskedMeanPooling {
+	return &MaskedMeanPooling{}
+}
+
+// Forward returns the average of the input sequence.
+func (m *SequenceMeanPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	checkSequence(xs)
+	return []mat.Tensor{ag.Mean(xs)}
+}
+
+// Forward returns the maximum of the input sequence.
+func (m *SequenceMaxPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	checkSequence(xs)
+	return []mat.Tensor{ag.Maximum(xs)}
+}
+
+// Forward returns the first element of the input sequence.
+func (m *SequenceFirstPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	checkSequence(xs)
+	return []mat.Tensor{xs[0]}
+}
+
+// Forward returns the last element of the input sequence.
+func (m *SequenceLastPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	checkSequence(xs)
+	return []mat.Tensor{xs[len(xs)-1]}
+}
+
+// Forward returns the average of the whole input sequence.
+func (m *MaskedMeanPooling) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.ForwardMasked(nil, xs...)
+}
+
+// ForwardMasked returns the average of the elements of the input sequence
+// for which the mask is true. A nil mask keeps all the elements. It panics
+// if the mask has not the length of the sequence, or no element is kept.
+func (m *MaskedMeanPooling) ForwardMasked(mask []bool, xs ...mat.Tensor) []mat.Tensor {
+	checkSequence(xs)
+	if mask == nil {
+		return []mat.Tensor{ag.Mean(xs)}
+	}
+	checkMask(mask, len(xs))
+	kept := make([]mat.Tensor, 0, len(xs))
+	for i, x := range xs {
+		if mask[i] {
+			kept = append(kept, x)
+		}
+	}
+	return []mat.Tensor{ag.Mean(kept)}
+}
+
+func checkSequence(xs []mat.Tensor) {
+	if len(xs) == 0 {
+		panic("pooling: empty sequence")
+	}
+}
+
+func checkMask(mask []bool, length int) {
+	if len(mask) != length {
+		panic(fmt.Sprintf("pooling: mask length %d does not match the sequence length %d", len(mask), length))
+	}
+	for _, keep := range mask {
+		if keep {
+			return
+		}
+	}
+	panic("pooling: the mask excludes all the elements of the sequence")
+}
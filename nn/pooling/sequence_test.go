@@ -0,0 +1,115 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pooling
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSequence[T float.DType]() []mat.Tensor {
+	return []mat.Tensor{
+		mat.NewDense[T](mat.WithBacking([]T{1, -2, 3, 0}), mat.WithGrad(true)),
+		mat.NewDense[T](mat.WithBacking([]T{-1, 4, 1, 2}), mat.WithGrad(true)),
+		mat.NewDense[T](mat.WithBacking([]T{3, 1, -4, 4}), mat.WithGrad(true)),
+	}
+}
+
+func TestSequencePooling(t *testing.T) {
+	t.Run("float32", testSequencePooling[float32])
+	t.Run("float64", testSequencePooling[float64])
+}
+
+func testSequencePooling[T float.DType](t *testing.T) {
+	testCases := []struct {
+		name     string
+		model    nn.StandardModel
+		expected []T
+	}{
+		{"mean", NewSequenceMean(), []T{1, 1, 0, 2}},
+		{"max", NewSequenceMax(), []T{3, 4, 3, 4}},
+		{"first", NewSequenceFirst(), []T{1, -2, 3, 0}},
+		{"last", NewSequenceLast(), []T{3, 1, -4, 4}},
+		{"masked mean without mask", NewMaskedMean(), []T{1, 1, 0, 2}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ys := tc.model.Forward(newTestSequence[T]()...)
+			require.Len(t, ys, 1)
+			assert.InDeltaSlice(t, tc.expected, ys[0].Value().Data(), 1.0e-6)
+		})
+	}
+
+	y := NewMaskedMean().ForwardMasked([]bool{true, false, true}, newTestSequence[T]()...)
+	assert.InDeltaSlice(t, []T{2, -0.5, -0.5, 2}, y[0].Value().Data(), 1.0e-6)
+
+	assert.Panics(t, func() { NewSequenceMean().Forward() }, "empty sequence")
+	assert.Panics(t, func() { NewMaskedMean().ForwardMasked([]bool{true}, newTestSequence[T]()...) }, "mask length")
+	assert.Panics(t, func() { NewMaskedMean().ForwardMasked([]bool{false, false, false}, newTestSequence[T]()...) }, "all masked")
+}
+
+func TestAttentionPooling(t *testing.T) {
+	t.Run("float32", testAttentionPooling[float32])
+	t.Run("float64", testAttentionPooling[float64])
+}
+
+func testAttentionPooling[T float.DType](t *testing.T) {
+	_, err := NewAttention[T](4, 3)
+	assert.Error(t, err, "heads not dividing the size")
+
+	m, err := NewAttention[T](4, 1)
+	require.NoError(t, err)
+	y := m.Forward(newTestSequence[T]()...)
+	assert.InDeltaSlice(t, []T{1, 1, 0, 2}, y[0].Value().Data(), 1.0e-6, "zero queries average the sequence")
+	y2, _ := m.ForwardMasked([]bool{true, false, true}, newTestSequence[T]()...)
+	assert.InDeltaSlice(t, []T{2, -0.5, -0.5, 2}, y2.Value().Data(), 1.0e-6, "zero queries average the kept elements")
+
+	m.Queries[0].ReplaceValue(mat.NewDense[T](mat.WithBacking([]T{1, 0, 0, 1}), mat.WithGrad(true)))
+	xs := newTestSequence[T]()
+	y2, weights := m.ForwardMasked(nil, xs...)
+	// Scores (x_0 + x_3) / 2: 0.5, 0.5, 3.5.
+	e := []float64{math.Exp(0.5), math.Exp(0.5), math.Exp(3.5)}
+	sum := e[0] + e[1] + e[2]
+	require.Len(t, weights, 1)
+	assert.InDeltaSlice(t, []T{T(e[0] / sum), T(e[1] / sum), T(e[2] / sum)}, weights[0].Value().Data(), 1.0e-6)
+	expected := make([]T, 4)
+	for i, x := range xs {
+		for j, v := range x.Value().Data().F64() {
+			expected[j] += T(v * e[i] / sum)
+		}
+	}
+	assert.InDeltaSlice(t, expected, y2.Value().Data(), 1.0e-5)
+
+	y2.AccGrad(y2.Value().(mat.Matrix).OnesLike())
+	require.NoError(t, ag.Backward(y2))
+	assert.True(t, m.Queries[0].HasGrad())
+	for _, x := range xs {
+		assert.True(t, x.(mat.Matrix).HasGrad())
+	}
+}
+
+func TestAttentionPooling_MultiHead(t *testing.T) {
+	m, err := NewAttention[float64](4, 2)
+	require.NoError(t, err)
+	m.Queries[1].ReplaceValue(mat.NewDense[float64](mat.WithBacking([]float64{0, 100})))
+
+	// The first head averages the first halves, the second one selects the
+	// second half with the greatest last element.
+	y, weights := m.ForwardMasked([]bool{true, true, false}, newTestSequence[float64]()...)
+	assert.Len(t, weights, 2)
+	assert.InDeltaSlice(t, []float64{0, 1, 1, 2}, y.Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, []float64{0, 1, 0}, weights[1].Value().Data(), 1.0e-6)
+
+	// It composes with the other models.
+	ys := nn.ModuleList[nn.StandardModel]{m, NewSequenceMax()}.Forward(newTestSequence[float64]()...)
+	assert.Equal(t, []int{4, 1}, ys[0].Shape())
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/nlpodyssey/spago/mat"
 	"github.com/nlpodyssey/spago/mat/float"
 	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -425,3 +426,38 @@ func TestModel_Init(t *testing.T) {
 	t.Run("float32", testModelInit[float32])
 	t.Run("float64", testModelInit[float64])
 }
+
+func TestModel_NoGrad(t *testing.T) {
+	model := New[float64](4, 3).Init(rand.NewLockedRand(42))
+	xs := []mat.Tensor{
+		mat.NewDense[float64](mat.WithBacking([]float64{0.1, -0.2, 0.3, -0.4})),
+		mat.NewDense[float64](mat.WithBacking([]float64{0.5, 0.6, -0.7, 0.8})),
+	}
+	expected := model.Forward(xs...)
+
+	e := ag.NewEngine(ag.WithNoGrad(true))
+	ys := model.Forward(e.Bind(xs[0]), e.Bind(xs[1]))
+	for i, y := range ys {
+		_, isOperator := y.(*ag.Operator)
+		assert.False(t, isOperator)
+		assert.InDeltaSlice(t, expected[i].Value().Data().F64(), y.Value().Data().F64(), 1e-12)
+	}
+}
+
+func BenchmarkModel_ForwardBackward(b *testing.B) {
+	model := New[float32](32, 32).Init(rand.NewLockedRand(42))
+	xs := make([]mat.Tensor, 64)
+	for i := range xs {
+		xs[i] = mat.NewDense[float32](mat.WithShape(32)).OnesLike()
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ys := model.Forward(xs...)
+		if err := ag.Backward(ag.ReduceSum(ag.Sum(ys...))); err != nil {
+			b.Fatal(err)
+		}
+		nn.ZeroGrad(model)
+	}
+}
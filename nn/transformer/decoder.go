@@ -0,0 +1,285 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"encoding/gob"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/nlpodyssey/spago/nn/attention/multiheadattention"
+	"github.com/nlpodyssey/spago/nn/normalization/layernorm"
+)
+
+var (
+	_ nn.Model = &DecoderLayer{}
+	_ nn.Model = &Decoder{}
+)
+
+// DecoderLayer is a Transformer decoder layer: a causal multi-head
+// self-attention, a multi-head cross-attention over the outputs of an
+// encoder (the memory) and a feed-forward network, each one with a residual
+// connection and a layer normalization.
+type DecoderLayer struct {
+	nn.Module
+	Config             Config
+	SelfAttention      *multiheadattention.Model
+	SelfAttentionNorm  *layernorm.Model
+	CrossAttention     *multiheadattention.Model
+	CrossAttentionNorm *layernorm.Model
+	FF                 *FeedForward
+	FFNorm             *layernorm.Model
+	// Training specifies whether the layer is in training mode, applying the
+	// dropout; it is false by default, for inference.
+	Training bool
+}
+
+// Decoder is a stack of Transformer decoder layers.
+type Decoder struct {
+	nn.Module
+	Config Config
+	Layers []*DecoderLayer
+	// Norm is the normalization of the outputs of the last layer, only
+	// present with PreNorm.
+	Norm *layernorm.Model
+}
+
+// LayerCache contains the keys and values of the attentions of a
+// DecoderLayer, computed at the previous steps of an incremental decoding.
+type LayerCache struct {
+	SelfAttention  multiheadattention.Cache
+	CrossAttention multiheadattention.Cache
+}
+
+// Cache contains the LayerCache of each layer of a Decoder.
+type Cache []LayerCache
+
+// At returns the cache of the i-th layer, or an empty cache.
+func (c Cache) At(i int) LayerCache {
+	if len(c) == 0 {
+		return LayerCache{}
+	}
+	return c[i]
+}
+
+// Len returns the number of positions already decoded, i.e. the position
+// of the next input of the incremental decoding.
+func (c Cache) Len() int {
+	if len(c) == 0 || len(c[0].SelfAttention) == 0 || !c[0].SelfAttention[0].HasValues() {
+		return 0
+	}
+	return c[0].SelfAttention[0][0].Value().Shape()[0]
+}
+
+// LayerKVCache contains the keys and values of the attentions of a
+// DecoderLayer, appended in place at each step of an incremental decoding.
+// See selfattention.KVCache.
+type LayerKVCache struct {
+	SelfAttention  multiheadattention.KVCache
+	CrossAttention multiheadattention.KVCache
+}
+
+// KVCache contains the LayerKVCache of each layer of a Decoder.
+type KVCache []LayerKVCache
+
+// NewKVCache returns a new empty KVCache for the decoder, whose
+// self-attention caches have the given capacity and window; the ones of the
+// cross-attentions have the size of the memory.
+func (m *Decoder) NewKVCache(capacity, window int) KVCache {
+	cache := make(KVCache, len(m.Layers))
+	for i, layer := range m.Layers {
+		cache[i] = LayerKVCache{
+			SelfAttention:  layer.SelfAttention.NewKVCache(capacity, window),
+			CrossAttention: layer.CrossAttention.NewKVCache(0, 0),
+		}
+	}
+	return cache
+}
+
+// Position returns the position of the next input of the incremental
+// decoding.
+func (c KVCache) Position() int {
+	if len(c) == 0 || len(c[0].SelfAttention) == 0 {
+		return 0
+	}
+	return c[0].SelfAttention[0].Position()
+}
+
+// Clone returns a copy of the cache, e.g. for a beam of a beam search. The
+// caches of the cross-attentions, which do not change after the first step,
+// are shared.
+func (c KVCache) Clone() KVCache {
+	clone := make(KVCache, len(c))
+	for i, layer := range c {
+		clone[i] = LayerKVCache{
+			SelfAttention:  layer.SelfAttention.Clone(),
+			CrossAttention: layer.CrossAttention,
+		}
+	}
+	return clone
+}
+
+func init() {
+	gob.Register(&DecoderLayer{})
+	gob.Register(&Decoder{})
+}
+
+// NewDecoderLayer returns a new DecoderLayer with attention and feed-forward
+// parameters initialized to zeros. It returns an error if the configuration
+// is not valid.
+func NewDecoderLayer[T float.DType](config Config) (*DecoderLayer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &DecoderLayer{
+		Config:             config,
+		SelfAttention:      multiheadattention.NewWithConfig[T](config.attentionConfig(true, false)),
+		SelfAttentionNorm:  newLayerNorm[T](config),
+		CrossAttention:     multiheadattention.NewWithConfig[T](config.attentionConfig(false, true)),
+		CrossAttentionNorm: newLayerNorm[T](config),
+		FF:                 NewFeedForward[T](config),
+		FFNorm:             newLayerNorm[T](config),
+	}, nil
+}
+
+// NewDecoder returns a new Decoder of config.NumOfLayers layers, with
+// attention and feed-forward parameters initialized to zeros. It returns an
+// error if the configuration is not valid.
+func NewDecoder[T float.DType](config Config) (*Decoder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Decoder{
+		Config: config,
+		Layers: make([]*DecoderLayer, config.NumOfLayers),
+	}
+	for i := range m.Layers {
+		layer, err := NewDecoderLayer[T](config)
+		if err != nil {
+			return nil, err
+		}
+		m.Layers[i] = layer
+	}
+	if config.PreNorm {
+		m.Norm = newLayerNorm[T](config)
+	}
+	return m, nil
+}
+
+// Init initializes the attentions and the feed-forward network with uniform
+// Xavier random distribution.
+func (m *DecoderLayer) Init(rng *rand.LockedRand) {
+	m.SelfAttention.Init(rng)
+	m.CrossAttention.Init(rng)
+	m.FF.Init(rng)
+}
+
+// Init initializes each layer with uniform Xavier random distribution.
+func (m *Decoder) Init(rng *rand.LockedRand) {
+	for _, layer := range m.Layers {
+		layer.Init(rng)
+	}
+}
+
+// SetTraining sets the training mode of the layer: the dropout is only
+// applied in training mode.
+func (m *DecoderLayer) SetTraining(training bool) {
+	m.Training = training
+}
+
+// SetTraining sets the training mode of each layer: the dropout is only
+// applied in training mode.
+func (m *Decoder) SetTraining(training bool) {
+	for _, layer := range m.Layers {
+		layer.SetTraining(training)
+	}
+}
+
+// Forward performs the forward step for each input node, attending to the
+// memory, and returns the result and the cache for the next step.
+//
+// For an incremental decoding, the inputs are the positions following the
+// ones in the cache; the memory is only used when the cache is empty, its
+// keys and values being cached afterwards.
+func (m *DecoderLayer) Forward(cache LayerCache, xs, memory []mat.Tensor) ([]mat.Tensor, LayerCache) {
+	return m.ForwardMasked(cache, xs, memory, nil, nil)
+}
+
+// ForwardMasked performs the forward step as Forward, with the self-attention
+// masked by selfMask, in addition to the causal mask, and the cross-attention
+// masked by memoryMask, e.g. an attention.KeyPaddingMask of the memory. The
+// masks are ignored if nil.
+func (m *DecoderLayer) ForwardMasked(cache LayerCache, xs, memory []mat.Tensor, selfMask, memoryMask *attention.Mask) ([]mat.Tensor, LayerCache) {
+	var next LayerCache
+	xs = m.Config.residual(m.Training, m.SelfAttentionNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		var ys []mat.Tensor
+		ys, _, next.SelfAttention = m.SelfAttention.Forward(cache.SelfAttention, xs, xs, masks(selfMask)...)
+		return ys
+	})
+	xs = m.Config.residual(m.Training, m.CrossAttentionNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		var ys []mat.Tensor
+		ys, _, next.CrossAttention = m.CrossAttention.Forward(cache.CrossAttention, xs, memory, masks(memoryMask)...)
+		return ys
+	})
+	xs = m.Config.residual(m.Training, m.FFNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		return m.FF.Forward(xs...)
+	})
+	return xs, next
+}
+
+// ForwardKVCache performs the forward step as ForwardMasked, appending the
+// keys and values of the attentions to the cache in place, instead of
+// returning a new cache. The masks are ignored if nil.
+func (m *DecoderLayer) ForwardKVCache(cache LayerKVCache, xs, memory []mat.Tensor, selfMask, memoryMask *attention.Mask) []mat.Tensor {
+	xs = m.Config.residual(m.Training, m.SelfAttentionNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		ys, _ := m.SelfAttention.ForwardKVCache(cache.SelfAttention, xs, xs, masks(selfMask)...)
+		return ys
+	})
+	xs = m.Config.residual(m.Training, m.CrossAttentionNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		ys, _ := m.CrossAttention.ForwardKVCache(cache.CrossAttention, xs, memory, masks(memoryMask)...)
+		return ys
+	})
+	return m.Config.residual(m.Training, m.FFNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		return m.FF.Forward(xs...)
+	})
+}
+
+// Forward performs the forward step of each layer in turn, and returns the
+// outputs of the last one and the cache for the next step. See
+// DecoderLayer.Forward.
+func (m *Decoder) Forward(cache Cache, xs, memory []mat.Tensor) ([]mat.Tensor, Cache) {
+	return m.ForwardMasked(cache, xs, memory, nil, nil)
+}
+
+// ForwardMasked performs the forward step of each layer in turn, with the
+// given masks, and returns the outputs of the last one and the cache for the
+// next step. See DecoderLayer.ForwardMasked.
+func (m *Decoder) ForwardMasked(cache Cache, xs, memory []mat.Tensor, selfMask, memoryMask *attention.Mask) ([]mat.Tensor, Cache) {
+	next := make(Cache, len(m.Layers))
+	for i, layer := range m.Layers {
+		xs, next[i] = layer.ForwardMasked(cache.At(i), xs, memory, selfMask, memoryMask)
+	}
+	if m.Norm != nil {
+		xs = m.Norm.Forward(xs...)
+	}
+	return xs, next
+}
+
+// ForwardKVCache performs the forward step of each layer in turn, appending
+// the keys and values of the attentions to the cache, created by NewKVCache,
+// in place, and returns the outputs of the last one. See
+// DecoderLayer.ForwardKVCache.
+func (m *Decoder) ForwardKVCache(cache KVCache, xs, memory []mat.Tensor, selfMask, memoryMask *attention.Mask) []mat.Tensor {
+	for i, layer := range m.Layers {
+		xs = layer.ForwardKVCache(cache[i], xs, memory, selfMask, memoryMask)
+	}
+	if m.Norm != nil {
+		xs = m.Norm.Forward(xs...)
+	}
+	return xs
+}
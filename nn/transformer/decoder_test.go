@@ -0,0 +1,156 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/attention/selfattention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecoder_Forward(t *testing.T) {
+	for _, preNorm := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pre-norm %v", preNorm), func(t *testing.T) {
+			config := newTestConfig(preNorm)
+			t.Run("float32", func(t *testing.T) { testDecoderForward[float32](t, config) })
+			t.Run("float64", func(t *testing.T) { testDecoderForward[float64](t, config) })
+		})
+	}
+	encodings := map[string]selfattention.PositionEncoding{
+		"rotary":        selfattention.RotaryPositionEncoding,
+		"alibi":         selfattention.ALiBiPositionEncoding,
+		"relative bias": selfattention.RelativeBiasPositionEncoding,
+	}
+	for name, encoding := range encodings {
+		t.Run(name, func(t *testing.T) {
+			config := newTestConfig(true)
+			config.Position.Encoding = encoding
+			testDecoderForward[float64](t, config)
+		})
+	}
+	mechanisms := map[string]selfattention.AttentionConfig{
+		"sliding window": {Mechanism: selfattention.SlidingWindowAttention, Window: 2, GlobalTokens: []int{0}},
+		"linear":         {Mechanism: selfattention.LinearAttention},
+	}
+	for name, mechanism := range mechanisms {
+		t.Run(name, func(t *testing.T) {
+			config := newTestConfig(true)
+			config.Attention = mechanism
+			testDecoderForward[float64](t, config)
+		})
+	}
+	t.Run("multi-query", func(t *testing.T) {
+		config := newTestConfig(true)
+		config.NumOfKVHeads = 1
+		config.Position.Encoding = selfattention.RotaryPositionEncoding
+		testDecoderForward[float64](t, config)
+	})
+}
+
+func testDecoderForward[T float.DType](t *testing.T, config Config) {
+	m, err := NewDecoder[T](config)
+	require.NoError(t, err)
+	m.Init(rand.NewLockedRand(42))
+
+	xs := newTestSequence[T](5, 4, 1)
+	memory := newTestSequence[T](3, 4, 2)
+	ys, cache := m.Forward(nil, xs, memory)
+	require.Len(t, ys, 5)
+	assert.Len(t, cache, 2)
+	assert.Equal(t, 5, cache.Len())
+
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ag.Map(ag.Square, ys)...))))
+	for _, x := range append(xs, memory...) {
+		assert.True(t, x.(mat.Matrix).HasGrad())
+	}
+	nn.ForEachParam(m, func(p *nn.Param) {
+		assert.True(t, p.HasGrad(), "each parameter receives a gradient")
+	})
+
+	// The outputs do not depend on the following positions.
+	prefix, _ := m.Forward(nil, xs[:2], memory)
+	for i, y := range prefix {
+		assert.InDeltaSlice(t, ys[i].Value().Data(), y.Value().Data(), 1.0e-5)
+	}
+
+	// The incremental decoding, one position and then two at a time, gives
+	// the same outputs, without the memory after the first step.
+	var incremental []mat.Tensor
+	cache = nil
+	for i, chunk := range [][]mat.Tensor{xs[:1], xs[1:2], xs[2:4], xs[4:]} {
+		assert.Equal(t, len(incremental), cache.Len())
+		mem := memory
+		if i > 0 {
+			mem = nil
+		}
+		var out []mat.Tensor
+		out, cache = m.Forward(cache, chunk, mem)
+		incremental = append(incremental, out...)
+	}
+	require.Len(t, incremental, len(ys))
+	for i, y := range incremental {
+		assert.InDeltaSlice(t, ys[i].Value().Data(), y.Value().Data(), 1.0e-5, "position %d", i)
+	}
+
+	// The same with the KVCache, cloned after the first step.
+	kvCache := m.NewKVCache(2, 0)
+	var clone KVCache
+	for i, chunk := range [][]mat.Tensor{xs[:1], xs[1:2], xs[2:4], xs[4:]} {
+		mem := memory
+		if i > 0 {
+			mem = nil
+		}
+		out := m.ForwardKVCache(kvCache, chunk, mem, nil, nil)
+		for j, y := range out {
+			assert.InDeltaSlice(t, ys[kvCache.Position()-len(chunk)+j].Value().Data(), y.Value().Data(), 1.0e-5)
+		}
+		if i == 0 {
+			clone = kvCache.Clone()
+		}
+	}
+	assert.Equal(t, 5, kvCache.Position())
+	require.Equal(t, 1, clone.Position())
+	out := m.ForwardKVCache(clone, xs[1:2], nil, nil, nil)
+	assert.InDeltaSlice(t, ys[1].Value().Data(), out[0].Value().Data(), 1.0e-5)
+}
+
+func TestDecoder_SetTraining(t *testing.T) {
+	config := newTestConfig(true)
+	m, err := NewDecoder[float64](config)
+	require.NoError(t, err)
+	m.Init(rand.NewLockedRand(42))
+	config.Dropout = 0.5
+	dropped, err := NewDecoder[float64](config)
+	require.NoError(t, err)
+	dropped.Init(rand.NewLockedRand(42))
+
+	// The dropout is only applied in training mode.
+	xs := newTestSequence[float64](3, 4, 1)
+	memory := newTestSequence[float64](2, 4, 2)
+	expected, _ := m.Forward(nil, xs, memory)
+	ys, _ := dropped.Forward(nil, xs, memory)
+	for i, y := range ys {
+		assert.InDeltaSlice(t, expected[i].Value().Data(), y.Value().Data(), 1.0e-9)
+	}
+
+	dropped.SetTraining(true)
+	for _, layer := range dropped.Layers {
+		assert.True(t, layer.Training)
+	}
+	ys, _ = dropped.Forward(nil, xs, memory)
+	different := false
+	for i, y := range ys {
+		different = different || !assert.ObjectsAreEqualValues(expected[i].Value().Data(), y.Value().Data())
+	}
+	assert.True(t, different, "the dropout is applied in training mode")
+}
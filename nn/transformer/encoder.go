@@ -0,0 +1,158 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"encoding/gob"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/nlpodyssey/spago/nn/attention/multiheadattention"
+	"github.com/nlpodyssey/spago/nn/normalization/layernorm"
+)
+
+var (
+	_ nn.StandardModel = &EncoderLayer{}
+	_ nn.StandardModel = &Encoder{}
+)
+
+// EncoderLayer is a Transformer encoder layer: a multi-head self-attention
+// followed by a feed-forward network, each one with a residual connection
+// and a layer normalization.
+type EncoderLayer struct {
+	nn.Module
+	Config            Config
+	SelfAttention     *multiheadattention.Model
+	SelfAttentionNorm *layernorm.Model
+	FF                *FeedForward
+	FFNorm            *layernorm.Model
+	// Training specifies whether the layer is in training mode, applying the
+	// dropout; it is false by default, for inference.
+	Training bool
+}
+
+// Encoder is a stack of Transformer encoder layers.
+type Encoder struct {
+	nn.Module
+	Config Config
+	Layers []*EncoderLayer
+	// Norm is the normalization of the outputs of the last layer, only
+	// present with PreNorm.
+	Norm *layernorm.Model
+}
+
+func init() {
+	gob.Register(&EncoderLayer{})
+	gob.Register(&Encoder{})
+}
+
+// NewEncoderLayer returns a new EncoderLayer with attention and feed-forward
+// parameters initialized to zeros. It returns an error if the configuration
+// is not valid.
+func NewEncoderLayer[T float.DType](config Config) (*EncoderLayer, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &EncoderLayer{
+		Config:            config,
+		SelfAttention:     multiheadattention.NewWithConfig[T](config.attentionConfig(false, false)),
+		SelfAttentionNorm: newLayerNorm[T](config),
+		FF:                NewFeedForward[T](config),
+		FFNorm:            newLayerNorm[T](config),
+	}, nil
+}
+
+// NewEncoder returns a new Encoder of config.NumOfLayers layers, with
+// attention and feed-forward parameters initialized to zeros. It returns an
+// error if the configuration is not valid.
+func NewEncoder[T float.DType](config Config) (*Encoder, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	m := &Encoder{
+		Config: config,
+		Layers: make([]*EncoderLayer, config.NumOfLayers),
+	}
+	for i := range m.Layers {
+		layer, err := NewEncoderLayer[T](config)
+		if err != nil {
+			return nil, err
+		}
+		m.Layers[i] = layer
+	}
+	if config.PreNorm {
+		m.Norm = newLayerNorm[T](config)
+	}
+	return m, nil
+}
+
+// Init initializes the attention and the feed-forward network with uniform
+// Xavier random distribution.
+func (m *EncoderLayer) Init(rng *rand.LockedRand) {
+	m.SelfAttention.Init(rng)
+	m.FF.Init(rng)
+}
+
+// Init initializes each layer with uniform Xavier random distribution.
+func (m *Encoder) Init(rng *rand.LockedRand) {
+	for _, layer := range m.Layers {
+		layer.Init(rng)
+	}
+}
+
+// SetTraining sets the training mode of the layer: the dropout is only
+// applied in training mode.
+func (m *EncoderLayer) SetTraining(training bool) {
+	m.Training = training
+}
+
+// SetTraining sets the training mode of each layer: the dropout is only
+// applied in training mode.
+func (m *Encoder) SetTraining(training bool) {
+	for _, layer := range m.Layers {
+		layer.SetTraining(training)
+	}
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *EncoderLayer) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.ForwardMasked(nil, xs...)
+}
+
+// ForwardMasked performs the forward step for each input node, with the
+// self-attention masked by the given mask, if not nil, and returns the result.
+func (m *EncoderLayer) ForwardMasked(mask *attention.Mask, xs ...mat.Tensor) []mat.Tensor {
+	if len(xs) == 0 {
+		return nil
+	}
+	xs = m.Config.residual(m.Training, m.SelfAttentionNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		ys, _, _ := m.SelfAttention.Forward(multiheadattention.Cache{}, xs, xs, masks(mask)...)
+		return ys
+	})
+	return m.Config.residual(m.Training, m.FFNorm, xs, func(xs []mat.Tensor) []mat.Tensor {
+		return m.FF.Forward(xs...)
+	})
+}
+
+// Forward performs the forward step of each layer in turn, and returns the
+// outputs of the last one.
+func (m *Encoder) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.ForwardMasked(nil, xs...)
+}
+
+// ForwardMasked performs the forward step of each layer in turn, with the
+// given mask, if not nil, and returns the outputs of the last one.
+func (m *Encoder) ForwardMasked(mask *attention.Mask, xs ...mat.Tensor) []mat.Tensor {
+	for _, layer := range m.Layers {
+		xs = layer.ForwardMasked(mask, xs...)
+	}
+	if m.Norm != nil && len(xs) > 0 {
+		xs = m.Norm.Forward(xs...)
+	}
+	return xs
+}
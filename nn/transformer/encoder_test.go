@@ -0,0 +1,177 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/nlpodyssey/spago/nn/attention/selfattention"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestConfig(preNorm bool) Config {
+	return Config{
+		Size:         4,
+		NumOfHeads:   2,
+		FFSize:       6,
+		FFActivation: activation.ReLU,
+		PreNorm:      preNorm,
+		NumOfLayers:  2,
+	}
+}
+
+// newTestSequence returns n vectors of the given size, with deterministic
+// values depending on seed.
+func newTestSequence[T float.DType](n, size, seed int) []mat.Tensor {
+	xs := make([]mat.Tensor, n)
+	for i := range xs {
+		data := make([]T, size)
+		for j := range data {
+			data[j] = T((i*7+j*3+seed)%11)/5 - 1
+		}
+		xs[i] = mat.NewDense[T](mat.WithBacking(data), mat.WithGrad(true))
+	}
+	return xs
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, newTestConfig(false).Validate())
+
+	c := newTestConfig(false)
+	c.NumOfHeads = 3
+	assert.Error(t, c.Validate(), "heads not dividing the size")
+	c = newTestConfig(false)
+	c.NumOfKVHeads = 3
+	assert.Error(t, c.Validate(), "key-value heads not dividing the heads")
+	c = newTestConfig(false)
+	c.Attention = selfattention.AttentionConfig{Mechanism: selfattention.SlidingWindowAttention}
+	assert.Error(t, c.Validate(), "sliding window without window")
+	c = newTestConfig(false)
+	c.Dropout = 1
+	assert.Error(t, c.Validate(), "dropout")
+	c = newTestConfig(false)
+	c.FFSize = 0
+	assert.Error(t, c.Validate(), "feed-forward size")
+
+	_, err := NewEncoder[float64](c)
+	assert.Error(t, err)
+	_, err = NewDecoder[float64](c)
+	assert.Error(t, err)
+}
+
+func TestEncoder_Forward(t *testing.T) {
+	for _, preNorm := range []bool{false, true} {
+		t.Run(fmt.Sprintf("pre-norm %v", preNorm), func(t *testing.T) {
+			t.Run("float32", func(t *testing.T) { testEncoderForward[float32](t, preNorm) })
+			t.Run("float64", func(t *testing.T) { testEncoderForward[float64](t, preNorm) })
+		})
+	}
+}
+
+func testEncoderForward[T float.DType](t *testing.T, preNorm bool) {
+	m, err := NewEncoder[T](newTestConfig(preNorm))
+	require.NoError(t, err)
+	m.Init(rand.NewLockedRand(42))
+	assert.Len(t, m.Layers, 2)
+	assert.Equal(t, preNorm, m.Norm != nil)
+
+	xs := newTestSequence[T](3, 4, 0)
+	ys := m.Forward(xs...)
+	require.Len(t, ys, 3)
+	for _, y := range ys {
+		assert.Equal(t, []int{4, 1}, y.Shape())
+		// The outputs of the last normalization are standardized.
+		assert.InDelta(t, 0, mean(y.Value().Data().F64()), 1.0e-5)
+	}
+
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ag.Map(ag.Square, ys)...))))
+	for _, x := range xs {
+		assert.True(t, x.(mat.Matrix).HasGrad())
+	}
+	nn.ForEachParam(m, func(p *nn.Param) {
+		assert.True(t, p.HasGrad(), "each parameter receives a gradient")
+	})
+
+	// A layer is a standard model, and the encoder is a stack of them.
+	stack := nn.ModuleList[nn.StandardModel]{m.Layers[0], m.Layers[1]}
+	if preNorm {
+		stack = append(stack, m.Norm)
+	}
+	assert.InDeltaSlice(t, ys[1].Value().Data(), stack.Forward(xs...)[1].Value().Data(), 1.0e-6)
+}
+
+func TestEncoder_SetTraining(t *testing.T) {
+	config := newTestConfig(false)
+	m, err := NewEncoder[float64](config)
+	require.NoError(t, err)
+	m.Init(rand.NewLockedRand(42))
+	config.Dropout = 0.5
+	dropped, err := NewEncoder[float64](config)
+	require.NoError(t, err)
+	dropped.Init(rand.NewLockedRand(42))
+
+	// The dropout is only applied in training mode.
+	xs := newTestSequence[float64](3, 4, 0)
+	expected := m.Forward(xs...)
+	for i, y := range dropped.Forward(xs...) {
+		assert.InDeltaSlice(t, expected[i].Value().Data(), y.Value().Data(), 1.0e-9)
+	}
+
+	dropped.SetTraining(true)
+	for _, layer := range dropped.Layers {
+		assert.True(t, layer.Training)
+	}
+	ys := dropped.Forward(xs...)
+	different := false
+	for i, y := range ys {
+		different = different || !assert.ObjectsAreEqualValues(expected[i].Value().Data(), y.Value().Data())
+	}
+	assert.True(t, different, "the dropout is applied in training mode")
+
+	dropped.SetTraining(false)
+	for i, y := range dropped.Forward(xs...) {
+		assert.InDeltaSlice(t, expected[i].Value().Data(), y.Value().Data(), 1.0e-9)
+	}
+}
+
+func TestEncoder_ForwardMasked(t *testing.T) {
+	m, err := NewEncoder[float64](newTestConfig(true))
+	require.NoError(t, err)
+	m.Init(rand.NewLockedRand(42))
+
+	// The outputs of a padded sequence are the ones of the sequence alone.
+	xs := newTestSequence[float64](3, 4, 0)
+	expected := m.Forward(xs...)
+	padded := append(xs, newTestSequence[float64](2, 4, 5)...)
+	ys := m.ForwardMasked(attention.KeyPaddingMask([]bool{true, true, true, false, false}), padded...)
+	require.Len(t, ys, 5)
+	for i := range expected {
+		assert.InDeltaSlice(t, expected[i].Value().Data(), ys[i].Value().Data(), 1.0e-9)
+	}
+
+	// Two packed sequences do not attend to each other.
+	others := newTestSequence[float64](2, 4, 3)
+	packed := m.ForwardMasked(attention.BlockDiagonalMask(3, 2), append(append([]mat.Tensor{}, xs...), others...)...)
+	for i, y := range m.Forward(others...) {
+		assert.InDeltaSlice(t, y.Value().Data(), packed[3+i].Value().Data(), 1.0e-9)
+	}
+}
+
+func mean(xs []float64) float64 {
+	var sum float64
+	for _, x := range xs {
+		sum += x
+	}
+	return sum / float64(len(xs))
+}
@@ -0,0 +1,53 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"encoding/gob"
+
+	"github.com/nlpodyssey/spago/initializers"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/mat/rand"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/linear"
+)
+
+var _ nn.StandardModel = &FeedForward{}
+
+// FeedForward is the position-wise feed-forward network of the Transformer
+// layers, made of two linear layers with an activation in between.
+type FeedForward struct {
+	nn.Module
+	In         *linear.Model
+	Activation *activation.Model
+	Out        *linear.Model
+}
+
+func init() {
+	gob.Register(&FeedForward{})
+}
+
+// NewFeedForward returns a new FeedForward with parameters initialized to
+// zeros.
+func NewFeedForward[T float.DType](config Config) *FeedForward {
+	return &FeedForward{
+		In:         linear.New[T](config.Size, config.FFSize),
+		Activation: activation.New(config.FFActivation),
+		Out:        linear.New[T](config.FFSize, config.Size),
+	}
+}
+
+// Init initializes the linear layers with uniform Xavier random distribution.
+func (m *FeedForward) Init(rng *rand.LockedRand) {
+	initializers.XavierUniform(m.In.W.Value().(mat.Matrix), initializers.Gain(m.Activation.Activation), rng)
+	initializers.XavierUniform(m.Out.W.Value().(mat.Matrix), initializers.Gain(activation.Identity), rng)
+}
+
+// Forward performs the forward step for each input node and returns the result.
+func (m *FeedForward) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.Out.Forward(m.Activation.Forward(m.In.Forward(xs...)...)...)
+}
@@ -0,0 +1,112 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/embedding"
+)
+
+var (
+	_ nn.StandardModel = &SinusoidalPositionalEncoding{}
+	_ nn.StandardModel = &LearnedPositionalEncoding{}
+)
+
+// SinusoidalPositionalEncoding is a parameter-free model adding to each
+// input the fixed encoding of its position:
+//
+//	PE(pos, 2i) = sin(pos / Base^(2i/Size))
+//	PE(pos, 2i+1) = cos(pos / Base^(2i/Size))
+type SinusoidalPositionalEncoding struct {
+	nn.Module
+	Size int
+	Base float64
+}
+
+// LearnedPositionalEncoding is a model adding to each input the learned
+// encoding of its position, up to a maximum length.
+type LearnedPositionalEncoding struct {
+	nn.Module
+	Embeddings *embedding.Model
+}
+
+func init() {
+	gob.Register(&SinusoidalPositionalEncoding{})
+	gob.Register(&LearnedPositionalEncoding{})
+}
+
+// NewSinusoidalPositionalEncoding returns a new SinusoidalPositionalEncoding
+// for inputs of the given size, with the usual base 10000.
+func NewSinusoidalPositionalEncoding(size int) *SinusoidalPositionalEncoding {
+	return &SinusoidalPositionalEncoding{
+		Size: size,
+		Base: 10000,
+	}
+}
+
+// NewLearnedPositionalEncoding returns a new LearnedPositionalEncoding for
+// inputs of the given size and sequences of up to maxLength positions, with
+// the encodings initialized to zeros.
+func NewLearnedPositionalEncoding[T float.DType](maxLength, size int) *LearnedPositionalEncoding {
+	return &LearnedPositionalEncoding{
+		Embeddings: embedding.New[T](maxLength, size),
+	}
+}
+
+// Forward adds to each input the encoding of its position, starting from 0.
+func (m *SinusoidalPositionalEncoding) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.Encode(0, xs...)
+}
+
+// Encode adds to each input the encoding of its position, starting from
+// offset, e.g. the length of the cache of an incremental decoding.
+func (m *SinusoidalPositionalEncoding) Encode(offset int, xs ...mat.Tensor) []mat.Tensor {
+	ys := make([]mat.Tensor, len(xs))
+	for i, x := range xs {
+		pe := x.Value().(mat.Matrix).NewMatrix(mat.WithShape(x.Shape()...), mat.WithBacking(m.encoding(offset+i)))
+		ys[i] = ag.Add(x, pe)
+	}
+	return ys
+}
+
+// encoding returns the encoding of the given position.
+func (m *SinusoidalPositionalEncoding) encoding(pos int) []float64 {
+	pe := make([]float64, m.Size)
+	for i := 0; i < m.Size; i += 2 {
+		angle := float64(pos) / math.Pow(m.Base, float64(i)/float64(m.Size))
+		pe[i] = math.Sin(angle)
+		if i+1 < m.Size {
+			pe[i+1] = math.Cos(angle)
+		}
+	}
+	return pe
+}
+
+// Forward adds to each input the encoding of its position, starting from 0.
+func (m *LearnedPositionalEncoding) Forward(xs ...mat.Tensor) []mat.Tensor {
+	return m.Encode(0, xs...)
+}
+
+// Encode adds to each input the encoding of its position, starting from
+// offset, e.g. the length of the cache of an incremental decoding. It panics
+// if a position exceeds the maximum length.
+func (m *LearnedPositionalEncoding) Encode(offset int, xs ...mat.Tensor) []mat.Tensor {
+	positions := make([]int, len(xs))
+	for i := range positions {
+		positions[i] = offset + i
+	}
+	pes, err := m.Embeddings.Encode(positions)
+	if err != nil {
+		panic(fmt.Sprintf("transformer: positions from %d to %d exceed the maximum length %d", offset, offset+len(xs)-1, m.Embeddings.Size))
+	}
+	return ag.Map2(ag.Add, xs, pes)
+}
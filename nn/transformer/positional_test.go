@@ -0,0 +1,58 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package transformer
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinusoidalPositionalEncoding(t *testing.T) {
+	t.Run("float32", testSinusoidalPositionalEncoding[float32])
+	t.Run("float64", testSinusoidalPositionalEncoding[float64])
+}
+
+func testSinusoidalPositionalEncoding[T float.DType](t *testing.T) {
+	m := NewSinusoidalPositionalEncoding(4)
+	xs := []mat.Tensor{
+		mat.NewDense[T](mat.WithShape(4)),
+		mat.NewDense[T](mat.WithShape(4)),
+	}
+	ys := m.Forward(xs...)
+	require.Len(t, ys, 2)
+	assert.InDeltaSlice(t, []T{0, 1, 0, 1}, ys[0].Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, []T{
+		T(math.Sin(1)), T(math.Cos(1)), T(math.Sin(0.01)), T(math.Cos(0.01)),
+	}, ys[1].Value().Data(), 1.0e-6)
+
+	ys = m.Encode(2, xs[1])
+	assert.InDeltaSlice(t, []T{
+		T(math.Sin(2)), T(math.Cos(2)), T(math.Sin(0.02)), T(math.Cos(0.02)),
+	}, ys[0].Value().Data(), 1.0e-6)
+}
+
+func TestLearnedPositionalEncoding(t *testing.T) {
+	m := NewLearnedPositionalEncoding[float64](3, 2)
+	m.Embeddings.Weights[2].ReplaceValue(mat.NewDense[float64](mat.WithBacking([]float64{1, 2}), mat.WithGrad(true)))
+	xs := []mat.Tensor{
+		mat.NewDense[float64](mat.WithBacking([]float64{0.5, 0.5})),
+		mat.NewDense[float64](mat.WithBacking([]float64{-1, 1})),
+	}
+	ys := m.Encode(1, xs...)
+	assert.InDeltaSlice(t, []float64{0.5, 0.5}, ys[0].Value().Data(), 1.0e-9)
+	assert.InDeltaSlice(t, []float64{0, 3}, ys[1].Value().Data(), 1.0e-9)
+
+	require.NoError(t, ag.Backward(ag.ReduceSum(ag.Sum(ys...))))
+	assert.Equal(t, 2, m.Embeddings.CountEmbedWithGrad())
+	assert.True(t, m.Embeddings.Weights[2].HasGrad())
+
+	assert.Panics(t, func() { m.Encode(2, xs...) }, "exceeding the maximum length")
+}
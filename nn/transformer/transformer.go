@@ -0,0 +1,138 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package transformer implements the encoder and decoder layers of the
+// Transformer, their stacks, and the positional encodings of their inputs.
+//
+// Reference: "Attention Is All You Need" by Ashish Vaswani et al. (2017).
+// (https://arxiv.org/pdf/1706.03762.pdf)
+package transformer
+
+import (
+	"fmt"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn/activation"
+	"github.com/nlpodyssey/spago/nn/attention"
+	"github.com/nlpodyssey/spago/nn/attention/multiheadattention"
+	"github.com/nlpodyssey/spago/nn/attention/selfattention"
+	"github.com/nlpodyssey/spago/nn/normalization/layernorm"
+)
+
+// Config provides configuration settings for the layers of a Transformer,
+// and their stacks.
+type Config struct {
+	// Size is the size of the inputs and outputs of each layer.
+	Size int
+	// NumOfHeads is the number of heads of the attentions; it must divide Size.
+	NumOfHeads int
+	// NumOfKVHeads is the number of key-value heads of the attentions, shared
+	// by groups of query heads; it must divide NumOfHeads. Zero means
+	// NumOfHeads. See multiheadattention.Config.
+	NumOfKVHeads int
+	// FFSize is the size of the hidden layer of the feed-forward networks.
+	FFSize int
+	// FFActivation is the activation of the hidden layer of the
+	// feed-forward networks, e.g. activation.ReLU or activation.GELU.
+	FFActivation activation.Activation
+	// Dropout is the dropout probability of the outputs of each sublayer,
+	// before the residual connection. It is only applied by the layers in
+	// training mode (see EncoderLayer.SetTraining).
+	Dropout float64
+	// NormEps is the epsilon of the layer normalizations. Zero means 1e-5.
+	NormEps float64
+	// PreNorm specifies whether the layer normalizations are applied to the
+	// inputs of each sublayer, instead of to the outputs of the residual
+	// connections. The stacks of pre-norm layers end with a further
+	// normalization.
+	PreNorm bool
+	// NumOfLayers is the number of layers of the stacks.
+	NumOfLayers int
+	// Position provides the settings of the relative position information
+	// of the self-attentions, as an alternative to the positional encodings
+	// of the inputs.
+	Position selfattention.PositionConfig
+	// Attention provides the settings of the attention mechanism of the
+	// self-attentions, e.g. a sliding window or linear attention for long
+	// sequences. The cross-attentions use the full attention.
+	Attention selfattention.AttentionConfig
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c Config) Validate() error {
+	switch {
+	case c.Size <= 0 || c.FFSize <= 0:
+		return fmt.Errorf("transformer: sizes must be positive; found %d and feed-forward %d", c.Size, c.FFSize)
+	case c.NumOfHeads <= 0 || c.Size%c.NumOfHeads != 0:
+		return fmt.Errorf("transformer: the number of heads (%d) must divide the size (%d)", c.NumOfHeads, c.Size)
+	case c.NumOfKVHeads < 0 || c.NumOfKVHeads > 0 && c.NumOfHeads%c.NumOfKVHeads != 0:
+		return fmt.Errorf("transformer: the number of key-value heads (%d) must divide the number of heads (%d)", c.NumOfKVHeads, c.NumOfHeads)
+	case c.Dropout < 0 || c.Dropout >= 1:
+		return fmt.Errorf("transformer: dropout must be in [0, 1); found %g", c.Dropout)
+	case c.NormEps < 0:
+		return fmt.Errorf("transformer: normalization epsilon must not be negative; found %g", c.NormEps)
+	case c.NumOfLayers < 0:
+		return fmt.Errorf("transformer: the number of layers must not be negative; found %d", c.NumOfLayers)
+	}
+	return c.Attention.Validate(c.Position)
+}
+
+// attentionConfig returns the configuration of a multi-head attention.
+func (c Config) attentionConfig(useCausalMask, isCrossAttention bool) multiheadattention.Config {
+	var mechanism selfattention.AttentionConfig
+	if !isCrossAttention {
+		mechanism = c.Attention
+	}
+	return multiheadattention.Config{
+		Size:             c.Size,
+		NumOfHeads:       c.NumOfHeads,
+		NumOfKVHeads:     c.NumOfKVHeads,
+		UseCausalMask:    useCausalMask,
+		IsCrossAttention: isCrossAttention,
+		Position:         c.Position,
+		Attention:        mechanism,
+	}
+}
+
+func (c Config) normEps() float64 {
+	if c.NormEps == 0 {
+		return 1e-5
+	}
+	return c.NormEps
+}
+
+// newLayerNorm returns a layer normalization with unit gains and zero biases,
+// the identity on standardized inputs.
+func newLayerNorm[T float.DType](config Config) *layernorm.Model {
+	m := layernorm.New[T](config.Size, config.normEps())
+	m.W.ReplaceValue(m.W.Value().(mat.Matrix).OnesLike())
+	m.W.SetRequiresGrad(true)
+	return m
+}
+
+// residual applies the sublayer f to xs with the residual connection, the
+// dropout, only in training mode, and the layer normalization, in the order
+// given by PreNorm.
+func (c Config) residual(training bool, norm *layernorm.Model, xs []mat.Tensor, f func(xs []mat.Tensor) []mat.Tensor) []mat.Tensor {
+	dropout := ag.DropoutFunc(0)
+	if training {
+		dropout = ag.DropoutFunc(c.Dropout)
+	}
+	if c.PreNorm {
+		ys := ag.Map(dropout, f(norm.Forward(xs...)))
+		return ag.Map2(ag.Add, xs, ys)
+	}
+	ys := ag.Map(dropout, f(xs))
+	return norm.Forward(ag.Map2(ag.Add, xs, ys)...)
+}
+
+// masks returns the given mask as the optional masks of an attention.
+func masks(mask *attention.Mask) []*attention.Mask {
+	if mask == nil {
+		return nil
+	}
+	return []*attention.Mask{mask}
+}
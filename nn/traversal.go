@@ -18,11 +18,13 @@ type ParamsTraverser interface {
 }
 
 // paramsTraversal allows the traversal of Model parameters.
-// The given paramsFunc is invoked for each parameter of the Model.
+// The given paramsFunc is invoked for each parameter of the Model, and
+// buffersFunc, if not nil, for each Buffer.
 // If exploreSubModels is true, every nested Model and its parameters are
 // also visited.
 type paramsTraversal struct {
 	paramsFunc       func(param *Param)
+	buffersFunc      func(buffer *Buffer)
 	modelsFunc       func(model Model)
 	exploreSubModels bool
 }
@@ -58,6 +60,10 @@ func (pt paramsTraversal) walkStructOrPtr(item any, name string) bool {
 		if pt.paramsFunc != nil {
 			pt.paramsFunc(itemT)
 		}
+	case *Buffer:
+		if pt.buffersFunc != nil {
+			pt.buffersFunc(itemT)
+		}
 	case ParamsTraverser:
 		if pt.paramsFunc != nil {
 			itemT.TraverseParams(pt.paramsFunc)
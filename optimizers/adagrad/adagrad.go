@@ -44,6 +44,11 @@ func NewDefaultConfig() Config {
 }
 
 // AdaGrad assigns a different learning rate to each parameter using the sum of squares of its all historical gradients.
+//
+// The update of each parameter only depends on its own gradients, and an optimizers.Optimizer only updates the
+// parameters with gradients, e.g. the rows of an embedding.Model used since the last step, so that AdaGrad is
+// already sparse (lazy) with respect to the rows of the embeddings.
+//
 // References
 //
 //	Adaptive Subgradient Methods for Online Learning and Stochastic Optimization
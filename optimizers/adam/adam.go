@@ -117,8 +117,13 @@ func (o *Adam) IncExample() {
 }
 
 func (o *Adam) updateAlpha() {
-	ts := float64(o.TimeStep)
-	o.Alpha = o.StepSize * math.Sqrt(1.0-math.Pow(o.Beta2, ts)) / (1.0 - math.Pow(o.Beta1, ts))
+	o.Alpha = o.alpha(o.TimeStep)
+}
+
+// alpha returns the step size with the bias correction of the given time step.
+func (c Config) alpha(timeStep int) float64 {
+	ts := float64(timeStep)
+	return c.StepSize * math.Sqrt(1.0-math.Pow(c.Beta2, ts)) / (1.0 - math.Pow(c.Beta1, ts))
 }
 
 // v = v*beta1 + grads*(1.0-beta1)
@@ -172,14 +177,18 @@ func (o *Adam) OptimizeParams(param *nn.Param) error {
 		return fmt.Errorf("unsupported state type: %T, expected %T", param.State, &State{})
 	}
 
+	o.optimize(param, state)
+	return nil
+}
+
+// optimize updates the param with the given state, and zeroes its gradients.
+func (o *Adam) optimize(param *nn.Param, state *State) {
 	if o.adamw {
 		param.SubInPlace(o.calculateParamUpdateW(param.Grad().(mat.Matrix), state, param.Value().(mat.Matrix)))
 		param.ZeroGrad()
-		return nil
+		return
 	}
 
 	param.SubInPlace(o.calculateParamUpdate(param.Grad().(mat.Matrix), state))
 	param.ZeroGrad()
-
-	return nil
 }
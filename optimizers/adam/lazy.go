@@ -0,0 +1,65 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package adam
+
+import (
+	"encoding/gob"
+	"fmt"
+
+	"github.com/nlpodyssey/spago/nn"
+)
+
+// LazyAdam implements a lazy (sparse) variant of the Adam optimization
+// method, meant for parameters receiving sparse gradients, such as the rows
+// of an embedding.Model.
+//
+// An optimizers.Optimizer only updates the parameters with gradients, so
+// that the moments of the rows of an embedding.Model are only decayed when
+// the rows are used, with both Adam and LazyAdam. However, Adam computes the
+// bias correction from its global TimeStep, as if every row were updated at
+// every step, so that the first updates of a rare row are corrected as the
+// ones of a row updated many times. LazyAdam computes it from the count of
+// the updates of each parameter instead.
+type LazyAdam struct {
+	Config
+}
+
+// NewLazy returns a new LazyAdam optimizer, initialized according to the
+// given configuration.
+func NewLazy(c Config) *LazyAdam {
+	return &LazyAdam{Config: c}
+}
+
+// LazyState is the state of a parameter optimized by LazyAdam.
+type LazyState struct {
+	State
+	// Steps is the number of updates of the parameter.
+	Steps int
+}
+
+func init() {
+	gob.Register(&LazyState{})
+}
+
+func (o *LazyAdam) OptimizeParams(param *nn.Param) error {
+	if param.State == nil {
+		param.State = &LazyState{State: *(&Adam{}).newStateFor(param)}
+	}
+
+	state, ok := param.State.(*LazyState)
+	if !ok {
+		return fmt.Errorf("unsupported state type: %T, expected %T", param.State, &LazyState{})
+	}
+
+	state.Steps++
+	adam := &Adam{
+		Config:   o.Config,
+		Alpha:    o.alpha(state.Steps),
+		TimeStep: state.Steps,
+		adamw:    o.Lambda != 0.0,
+	}
+	adam.optimize(param, &state.State)
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package adam
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/embedding"
+	"github.com/nlpodyssey/spago/optimizers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLazyAdam_OptimizeParams(t *testing.T) {
+	t.Run("float32", testLazyAdamOptimizeParams[float32])
+	t.Run("float64", testLazyAdamOptimizeParams[float64])
+}
+
+func testLazyAdamOptimizeParams[T float.DType](t *testing.T) {
+	for _, c := range []Config{NewDefaultConfig(), NewAdamWConfig(0.001, 0.9, 0.999, 1.0e-8, 0.1)} {
+		lazy := NewLazy(c)
+		m := embedding.New[T](3, 2)
+		for i, w := range m.Weights {
+			mat.SetData[T](w.Value().(mat.Matrix), []T{T(i), T(i) + 0.5})
+		}
+		optimizer := optimizers.New(nn.Parameters(m), lazy)
+		accGrad := func(idx int, grad ...T) {
+			e, err := m.Embedding(idx)
+			require.NoError(t, err)
+			e.AccGrad(mat.NewDense[T](mat.WithBacking(grad)))
+		}
+
+		accGrad(0, 0.5, -0.3)
+		require.NoError(t, optimizer.Optimize())
+		accGrad(0, 0.1, 0.2)
+		accGrad(2, 0.5, -0.3)
+		require.NoError(t, optimizer.Optimize())
+
+		assert.Equal(t, 2, m.Weights[0].State.(*LazyState).Steps)
+		assert.Equal(t, 1, m.Weights[2].State.(*LazyState).Steps)
+		assert.Nil(t, m.Weights[1].State, "the row without gradients is not touched")
+		assert.Equal(t, []T{1, 1.5}, mat.Data[T](m.Weights[1].Value()))
+
+		// The first update of each row is the first update of Adam.
+		adam := New(c)
+		expected := nn.NewParam(mat.NewDense[T](mat.WithBacking([]T{2, 2.5})))
+		expected.AccGrad(mat.NewDense[T](mat.WithBacking([]T{0.5, -0.3})))
+		require.NoError(t, adam.OptimizeParams(expected))
+		assert.InDeltaSlice(t, expected.Value().Data(), m.Weights[2].Value().Data(), 1.0e-6)
+
+		// The second update of a row is the second update of Adam.
+		expected = nn.NewParam(mat.NewDense[T](mat.WithBacking([]T{0, 0.5})))
+		expected.AccGrad(mat.NewDense[T](mat.WithBacking([]T{0.5, -0.3})))
+		require.NoError(t, adam.OptimizeParams(expected))
+		adam.IncExample()
+		expected.AccGrad(mat.NewDense[T](mat.WithBacking([]T{0.1, 0.2})))
+		require.NoError(t, adam.OptimizeParams(expected))
+		assert.InDeltaSlice(t, expected.Value().Data(), m.Weights[0].Value().Data(), 1.0e-6)
+
+		nn.ForEachParam(m, func(p *nn.Param) {
+			assert.Fail(t, "no rows have gradients")
+		})
+
+		// The eager Adam corrects the first update of the last row as the
+		// second one, from its global time step.
+		eager := New(c)
+		m2 := embedding.New[T](3, 2)
+		for i, w := range m2.Weights {
+			mat.SetData[T](w.Value().(mat.Matrix), []T{T(i), T(i) + 0.5})
+		}
+		optimizer = optimizers.New(nn.Parameters(m2), eager)
+		for _, step := range []map[int][]T{{0: {0.5, -0.3}}, {0: {0.1, 0.2}, 2: {0.5, -0.3}}} {
+			for idx, grad := range step {
+				e, err := m2.Embedding(idx)
+				require.NoError(t, err)
+				e.AccGrad(mat.NewDense[T](mat.WithBacking(grad)))
+			}
+			require.NoError(t, optimizer.Optimize())
+			eager.IncExample()
+		}
+		assert.InDeltaSlice(t, m2.Weights[0].Value().Data(), m.Weights[0].Value().Data(), 1.0e-6)
+		for j, v := range mat.Data[T](m2.Weights[2].Value()) {
+			lazyUpdate := T(2+0.5*float64(j)) - mat.Data[T](m.Weights[2].Value())[j]
+			eagerUpdate := T(2+0.5*float64(j)) - v
+			assert.Greater(t, math.Abs(float64(lazyUpdate)), math.Abs(float64(eagerUpdate))+1.0e-4)
+		}
+	}
+}
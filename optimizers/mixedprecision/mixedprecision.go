@@ -0,0 +1,230 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mixedprecision implements mixed-precision training: the forward
+// and backward passes run in the (lower) precision of the model, e.g.
+// float32, while the optimization strategy updates float64 master copies of
+// the parameters, with dynamic loss scaling.
+package mixedprecision
+
+import (
+	"context"
+	"encoding/gob"
+	"fmt"
+	"math"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/optimizers"
+)
+
+// Config provides configuration settings for the dynamic loss scaling.
+type Config struct {
+	// InitScale is the initial loss scale.
+	InitScale float64
+	// GrowthFactor multiplies the scale after GrowthInterval consecutive
+	// steps without overflow.
+	GrowthFactor float64
+	// BackoffFactor multiplies the scale when an overflow is detected.
+	BackoffFactor float64
+	// GrowthInterval is the number of consecutive steps without overflow
+	// after which the scale is increased.
+	GrowthInterval int
+}
+
+// NewDefaultConfig returns a new Config with generically reasonable default values.
+func NewDefaultConfig() Config {
+	return Config{
+		InitScale:      65536,
+		GrowthFactor:   2,
+		BackoffFactor:  0.5,
+		GrowthInterval: 2000,
+	}
+}
+
+// Validate returns an error if the configuration is not valid.
+func (c Config) Validate() error {
+	switch {
+	case c.InitScale <= 0:
+		return fmt.Errorf("mixedprecision: initial scale must be positive; found %g", c.InitScale)
+	case c.GrowthFactor < 1:
+		return fmt.Errorf("mixedprecision: growth factor must be at least 1; found %g", c.GrowthFactor)
+	case c.BackoffFactor <= 0 || c.BackoffFactor > 1:
+		return fmt.Errorf("mixedprecision: backoff factor must be in (0, 1]; found %g", c.BackoffFactor)
+	case c.GrowthInterval <= 0:
+		return fmt.Errorf("mixedprecision: growth interval must be positive; found %d", c.GrowthInterval)
+	}
+	return nil
+}
+
+// State is the state of a param trained in mixed precision.
+type State struct {
+	// Master is the float64 master copy of the param. Its own State holds
+	// the state of the wrapped optimization strategy.
+	Master *nn.Param
+}
+
+func init() {
+	gob.Register(&State{})
+}
+
+var _ optimizers.OptimizationStrategy = &Strategy{}
+
+// Strategy wraps an optimization strategy, so that it is applied to the
+// float64 master copies of the params, held in nn.Param.State.
+//
+// Generic optimization strategies (e.g. sgd.New[T]) must be instantiated
+// with float64, the type of the master copies.
+type Strategy struct {
+	strategy optimizers.OptimizationStrategy
+	// scale is the loss scale the gradients are divided by.
+	scale float64
+}
+
+// NewStrategy returns a new Strategy wrapping the given one.
+func NewStrategy(strategy optimizers.OptimizationStrategy) *Strategy {
+	return &Strategy{
+		strategy: strategy,
+		scale:    1,
+	}
+}
+
+// OptimizeParams unscales the gradients of the param, applies the wrapped
+// strategy to its master copy, and copies the updated master values back to
+// the param, in its own precision.
+func (s *Strategy) OptimizeParams(param *nn.Param) error {
+	if param.State == nil {
+		param.State = newState(param)
+	}
+	state, ok := param.State.(*State)
+	if !ok {
+		return fmt.Errorf("unsupported state type: %T, expected %T", param.State, &State{})
+	}
+
+	shape := param.Shape()
+	grad := mat.NewDense[float64](mat.WithShape(shape...), mat.WithBacking(param.Grad().Data().F64()))
+	state.Master.AccGrad(grad.ProdScalar(1 / s.scale))
+
+	if err := s.strategy.OptimizeParams(state.Master); err != nil {
+		return err
+	}
+
+	param.SetData(state.Master.Data())
+	param.ZeroGrad()
+	return nil
+}
+
+func newState(param *nn.Param) *State {
+	master := mat.NewDense[float64](mat.WithShape(param.Shape()...), mat.WithBacking(param.Data().F64()))
+	return &State{
+		Master: nn.NewParam(master),
+	}
+}
+
+// Optimizer is an optimizer performing mixed-precision training of a set of
+// parameters, with dynamic loss scaling.
+//
+// The loss must be scaled with ScaleLoss before the backward pass, so that
+// small gradients do not underflow in the lower precision. If any gradient
+// overflows, the optimization step is skipped and the scale is decreased;
+// after a number of consecutive steps without overflow, the scale is
+// increased.
+type Optimizer struct {
+	Config
+	parameters nn.ParamChannelFunc
+	strategy   *Strategy
+	optimizer  *optimizers.Optimizer
+	// goodSteps is the number of consecutive steps without overflow.
+	goodSteps int
+}
+
+// New returns a new Optimizer, applying the given strategy to the float64
+// master copies of the parameters. It returns an error if the configuration
+// is not valid.
+func New(parameters nn.ParamChannelFunc, strategy optimizers.OptimizationStrategy, c Config) (*Optimizer, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	s := NewStrategy(strategy)
+	s.scale = c.InitScale
+	return &Optimizer{
+		Config:     c,
+		parameters: parameters,
+		strategy:   s,
+		optimizer:  optimizers.New(parameters, s),
+	}, nil
+}
+
+// Scale returns the current loss scale.
+func (o *Optimizer) Scale() float64 {
+	return o.strategy.scale
+}
+
+// ScaleLoss returns the loss multiplied by the current loss scale.
+func (o *Optimizer) ScaleLoss(loss mat.Tensor) mat.Tensor {
+	return ag.ProdScalar(loss, loss.Value().(mat.Matrix).NewScalar(o.strategy.scale))
+}
+
+// Optimize performs the optimization step, unless any gradient overflows:
+// in this case, the gradients are cleared and the loss scale is decreased.
+// It reports whether the step has been applied.
+func (o *Optimizer) Optimize() (bool, error) {
+	if !o.gradsAreFinite() {
+		o.zeroGrads()
+		o.strategy.scale *= o.BackoffFactor
+		o.goodSteps = 0
+		return false, nil
+	}
+
+	if err := o.optimizer.Optimize(); err != nil {
+		return false, err
+	}
+
+	o.goodSteps++
+	if o.goodSteps == o.GrowthInterval {
+		o.strategy.scale *= o.GrowthFactor
+		o.goodSteps = 0
+	}
+	return true, nil
+}
+
+// gradsAreFinite reports whether the gradients of all the parameters are
+// finite.
+func (o *Optimizer) gradsAreFinite() bool {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for param := range o.parameters(ctx) {
+		if param.HasGrad() && !isFinite(param.Grad().Data()) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *Optimizer) zeroGrads() {
+	for param := range o.parameters(context.Background()) {
+		param.ZeroGrad()
+	}
+}
+
+// isFinite reports whether all the values are finite, in their own precision.
+func isFinite(data float.Slice) bool {
+	if data.BitSize() == 32 {
+		for _, v := range data.F32() {
+			if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range data.F64() {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
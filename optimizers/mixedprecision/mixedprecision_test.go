@@ -0,0 +1,128 @@
+// Copyright 2023 spaGO Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mixedprecision
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/spago/ag"
+	"github.com/nlpodyssey/spago/mat"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/optimizers"
+	"github.com/nlpodyssey/spago/optimizers/adagrad"
+	"github.com/nlpodyssey/spago/optimizers/adam"
+	"github.com/nlpodyssey/spago/optimizers/lamb"
+	"github.com/nlpodyssey/spago/optimizers/radam"
+	"github.com/nlpodyssey/spago/optimizers/rmsprop"
+	"github.com/nlpodyssey/spago/optimizers/sgd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestParam() *nn.Param {
+	return nn.NewParam(mat.NewDense[float32](mat.WithBacking([]float32{0.4, 0.4, 0.5, 1.0})))
+}
+
+func TestOptimizer_Optimize(t *testing.T) {
+	param := newTestParam()
+	c := Config{InitScale: 1024, GrowthFactor: 2, BackoffFactor: 0.5, GrowthInterval: 2}
+	opt, err := New(nn.StreamParams([]*nn.Param{param}), sgd.New[float64](sgd.NewConfig(0.1, 0, false)), c)
+	require.NoError(t, err)
+
+	loss := opt.ScaleLoss(ag.ReduceSum(ag.Square(param)))
+	require.NoError(t, ag.Backward(loss))
+	assert.InDeltaSlice(t, []float32{819.2, 819.2, 1024, 2048}, param.Grad().Data().F32(), 1e-3)
+
+	applied, err := opt.Optimize()
+	require.NoError(t, err)
+	assert.True(t, applied)
+
+	// x - 0.1 * 2x
+	assert.InDeltaSlice(t, []float32{0.32, 0.32, 0.4, 0.8}, param.Data().F32(), 1e-6)
+	assert.Nil(t, param.Grad())
+	assert.Equal(t, 1024.0, opt.Scale())
+
+	master := param.State.(*State).Master
+	assert.Equal(t, 64, master.Data().BitSize())
+	assert.InDeltaSlice(t, []float64{0.32, 0.32, 0.4, 0.8}, master.Data().F64(), 1e-6)
+
+	require.NoError(t, ag.Backward(opt.ScaleLoss(ag.ReduceSum(param))))
+	applied, err = opt.Optimize()
+	require.NoError(t, err)
+	assert.True(t, applied)
+	assert.InDeltaSlice(t, []float32{0.22, 0.22, 0.3, 0.7}, param.Data().F32(), 1e-6)
+	assert.Equal(t, 2048.0, opt.Scale(), "the scale must grow after GrowthInterval steps")
+}
+
+func TestOptimizer_Overflow(t *testing.T) {
+	param := newTestParam()
+	opt, err := New(nn.StreamParams([]*nn.Param{param}), sgd.New[float64](sgd.NewConfig(0.1, 0, false)), NewDefaultConfig())
+	require.NoError(t, err)
+
+	param.AccGrad(mat.NewDense[float32](mat.WithBacking([]float32{1, float32(math.Inf(1)), 0, 0})))
+	applied, err := opt.Optimize()
+	require.NoError(t, err)
+	assert.False(t, applied)
+	assert.Nil(t, param.Grad())
+	assert.Nil(t, param.State)
+	assert.Equal(t, []float32{0.4, 0.4, 0.5, 1.0}, param.Data().F32())
+	assert.Equal(t, 32768.0, opt.Scale())
+
+	param.AccGrad(mat.NewDense[float32](mat.WithBacking([]float32{float32(math.NaN()), 0, 0, 0})))
+	applied, err = opt.Optimize()
+	require.NoError(t, err)
+	assert.False(t, applied)
+	assert.Equal(t, 16384.0, opt.Scale())
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	params := nn.StreamParams(nil)
+	strategy := sgd.New[float64](sgd.NewConfig(0.1, 0.9, false))
+	configs := []Config{
+		{},
+		{InitScale: -1, GrowthFactor: 2, BackoffFactor: 0.5, GrowthInterval: 1},
+		{InitScale: 1, GrowthFactor: 0.5, BackoffFactor: 0.5, GrowthInterval: 1},
+		{InitScale: 1, GrowthFactor: 2, BackoffFactor: 2, GrowthInterval: 1},
+		{InitScale: 1, GrowthFactor: 2, BackoffFactor: 0, GrowthInterval: 1},
+		{InitScale: 1, GrowthFactor: 2, BackoffFactor: 0.5, GrowthInterval: 0},
+	}
+	for _, c := range configs {
+		opt, err := New(params, strategy, c)
+		assert.Error(t, err, "%+v", c)
+		assert.Nil(t, opt)
+	}
+}
+
+func TestStrategy_OptimizeParams(t *testing.T) {
+	strategies := map[string]optimizers.OptimizationStrategy{
+		"adam":    adam.New(adam.NewDefaultConfig()),
+		"adagrad": adagrad.New[float64](adagrad.NewDefaultConfig()),
+		"lamb":    lamb.New[float64](lamb.NewDefaultConfig()),
+		"radam":   radam.New[float64](radam.NewDefaultConfig()),
+		"rmsprop": rmsprop.New[float64](rmsprop.NewDefaultConfig()),
+		"sgd":     sgd.New[float64](sgd.NewConfig(0.1, 0.9, false)),
+	}
+	for name, strategy := range strategies {
+		t.Run(name, func(t *testing.T) {
+			param := newTestParam()
+			opt, err := New(nn.StreamParams([]*nn.Param{param}), strategy, NewDefaultConfig())
+			require.NoError(t, err)
+
+			for i := 0; i < 3; i++ {
+				require.NoError(t, ag.Backward(opt.ScaleLoss(ag.ReduceSum(ag.Square(param)))))
+				applied, err := opt.Optimize()
+				require.NoError(t, err)
+				require.True(t, applied)
+			}
+
+			master := param.State.(*State).Master.Data().F64()
+			assert.NotEqual(t, []float64{0.4, 0.4, 0.5, 1.0}, master)
+			for i, v := range param.Data().F32() {
+				assert.Equal(t, float32(master[i]), v)
+			}
+		})
+	}
+}
@@ -68,6 +68,7 @@ func (o *Optimizer) Optimize() error {
 		}
 	}
 
+	wg.Wait()
 	close(errCh)
 
 	if err, ok := <-errCh; ok {
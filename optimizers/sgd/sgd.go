@@ -32,6 +32,10 @@ func NewConfig(lr, momentum float64, nesterov bool) Config {
 //var _ optimizers.Strategy = &SGD[float32]{}
 
 // SGD implements the SGD gradient descent optimization method.
+//
+// An optimizers.Optimizer only updates the parameters with gradients, e.g. the rows of an embedding.Model used
+// since the last step, so that SGD is already sparse (lazy) with respect to the rows of the embeddings: the velocity
+// of a row with momentum is only decayed and applied when the row has gradients.
 type SGD[T float.DType] struct {
 	Config
 	Alpha float64
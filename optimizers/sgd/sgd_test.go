@@ -9,7 +9,11 @@ import (
 
 	"github.com/nlpodyssey/spago/mat"
 	"github.com/nlpodyssey/spago/mat/float"
+	"github.com/nlpodyssey/spago/nn"
+	"github.com/nlpodyssey/spago/nn/embedding"
+	"github.com/nlpodyssey/spago/optimizers"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSGD_Update(t *testing.T) {
@@ -208,3 +212,29 @@ func testSGDNesterovMomentumUpdate2[T float.DType](t *testing.T) {
 		0.697809, -0.40111, 0.195093,
 	}, params.Data(), 1.0e-6)
 }
+
+func TestSGD_SparseRows(t *testing.T) {
+	t.Run("float32", testSGDSparseRows[float32])
+	t.Run("float64", testSGDSparseRows[float64])
+}
+
+// testSGDSparseRows checks that the momentum does not move the rows of an
+// embedding.Model without gradients, which are not traversed.
+func testSGDSparseRows[T float.DType](t *testing.T) {
+	m := embedding.New[T](2, 2)
+	optimizer := optimizers.New(nn.Parameters(m), New[T](NewConfig(0.1, 0.9, false)))
+	accGrad := func(idx int, grad ...T) {
+		e, err := m.Embedding(idx)
+		require.NoError(t, err)
+		e.AccGrad(mat.NewDense[T](mat.WithBacking(grad)))
+	}
+
+	accGrad(0, 1, -2)
+	accGrad(1, 0.5, 0.5)
+	require.NoError(t, optimizer.Optimize())
+	assert.InDeltaSlice(t, []T{-0.1, 0.2}, m.Weights[0].Value().Data(), 1.0e-6)
+	accGrad(1, 0.5, 0.5)
+	require.NoError(t, optimizer.Optimize())
+	assert.InDeltaSlice(t, []T{-0.1, 0.2}, m.Weights[0].Value().Data(), 1.0e-6)
+	assert.InDeltaSlice(t, []T{-0.145, -0.145}, m.Weights[1].Value().Data(), 1.0e-6)
+}